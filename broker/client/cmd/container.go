@@ -149,6 +149,11 @@ var containerMount = cli.Command{
 			Value: api.DefaultContainerMountPoint,
 			Usage: "Mount point of the container",
 		},
+		cli.StringFlag{
+			Name:  "driver",
+			Value: "rclone",
+			Usage: "Driver used to mount the container, allowed values: rclone, s3fs, goofys (objects exposed as plain files), s3ql (objects only readable through s3ql)",
+		},
 	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() != 2 {
@@ -167,7 +172,8 @@ var containerMount = cli.Command{
 			VM: &pb.Reference{
 				Name: c.Args().Get(1),
 			},
-			Path: c.String("path"),
+			Path:   c.String("path"),
+			Driver: c.String("driver"),
 		})
 		if err != nil {
 			return fmt.Errorf("Could not mount container '%s': %v", c.Args().Get(0), err)
@@ -0,0 +1,231 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+	utils "github.com/CS-SI/SafeScale/broker/utils"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"github.com/urfave/cli"
+)
+
+//LoadBalancerCmd load balancer command
+var LoadBalancerCmd = cli.Command{
+	Name:  "lb",
+	Usage: "lb COMMAND",
+	Subcommands: []cli.Command{
+		lbCreate,
+		lbList,
+		lbInspect,
+		lbAddBackend,
+		lbRemoveBackend,
+		lbDelete,
+	},
+}
+
+var lbCreate = cli.Command{
+	Name:      "create",
+	Usage:     "Create a load balancer receiving the traffic of a network",
+	ArgsUsage: "<Load_balancer_name> <Network_name|Network_ID>",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "port",
+			Usage: "Port on which the load balancer receives the traffic",
+		},
+		cli.IntFlag{
+			Name:  "backend-port",
+			Usage: "Port on which the backends receive the traffic (default: port)",
+		},
+		cli.StringFlag{
+			Name:  "protocol",
+			Value: "tcp",
+			Usage: "Protocol of the traffic balanced (tcp, http, https). HTTPS traffic is passed through to the backends",
+		},
+		cli.StringFlag{
+			Name:  "check",
+			Usage: "Path of the HTTP health check of the backends (default: TCP health check)",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Load_balancer_name> and/or <Network_name|Network_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Load balancer name and network required")
+		}
+		if c.Int("port") <= 0 {
+			return fmt.Errorf("Port required")
+		}
+		protocol, ok := pb.LBProtocol_value["LB_"+strings.ToUpper(c.String("protocol"))]
+		if !ok {
+			return fmt.Errorf("Invalid protocol '%s'", c.String("protocol"))
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxLoadBalancer)
+		defer cancel()
+		service := pb.NewLoadBalancerServiceClient(conn)
+		lb, err := service.Create(ctx, &pb.LoadBalancerDefinition{
+			Name:            c.Args().Get(0),
+			Network:         &pb.Reference{Name: c.Args().Get(1)},
+			Protocol:        pb.LBProtocol(protocol),
+			Port:            int32(c.Int("port")),
+			BackendPort:     int32(c.Int("backend-port")),
+			HealthCheckPath: c.String("check"),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not create load balancer '%s': %v", c.Args().Get(0), err)
+		}
+
+		out, _ := json.Marshal(lb)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var lbList = cli.Command{
+	Name:  "list",
+	Usage: "List load balancers",
+	Action: func(c *cli.Context) error {
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewLoadBalancerServiceClient(conn)
+		resp, err := service.List(ctx, &google_protobuf.Empty{})
+		if err != nil {
+			return fmt.Errorf("Could not get load balancer list: %v", err)
+		}
+
+		out, _ := json.Marshal(resp.GetLoadBalancers())
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var lbInspect = cli.Command{
+	Name:      "inspect",
+	Usage:     "Inspect load balancer",
+	ArgsUsage: "<Load_balancer_name|Load_balancer_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <Load_balancer_name|Load_balancer_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Load balancer name or ID required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewLoadBalancerServiceClient(conn)
+		lb, err := service.Inspect(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not get load balancer '%s': %v", c.Args().First(), err)
+		}
+
+		out, _ := json.Marshal(lb)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var lbAddBackend = cli.Command{
+	Name:      "add-backend",
+	Usage:     "Add a VM to the backends of a load balancer",
+	ArgsUsage: "<Load_balancer_name|Load_balancer_ID> <VM_name|VM_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Load_balancer_name|Load_balancer_ID> and/or <VM_name|VM_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Load balancer and VM required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxLoadBalancer)
+		defer cancel()
+		service := pb.NewLoadBalancerServiceClient(conn)
+		_, err := service.AddBackend(ctx, &pb.LoadBalancerBackend{
+			LoadBalancer: &pb.Reference{Name: c.Args().Get(0)},
+			VM:           &pb.Reference{Name: c.Args().Get(1)},
+		})
+		if err != nil {
+			return fmt.Errorf("Could not add VM '%s' to load balancer '%s': %v", c.Args().Get(1), c.Args().Get(0), err)
+		}
+		fmt.Println(fmt.Sprintf("VM '%s' added to load balancer '%s'", c.Args().Get(1), c.Args().Get(0)))
+
+		return nil
+	},
+}
+
+var lbRemoveBackend = cli.Command{
+	Name:      "remove-backend",
+	Usage:     "Remove a VM from the backends of a load balancer",
+	ArgsUsage: "<Load_balancer_name|Load_balancer_ID> <VM_name|VM_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Load_balancer_name|Load_balancer_ID> and/or <VM_name|VM_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Load balancer and VM required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxLoadBalancer)
+		defer cancel()
+		service := pb.NewLoadBalancerServiceClient(conn)
+		_, err := service.RemoveBackend(ctx, &pb.LoadBalancerBackend{
+			LoadBalancer: &pb.Reference{Name: c.Args().Get(0)},
+			VM:           &pb.Reference{Name: c.Args().Get(1)},
+		})
+		if err != nil {
+			return fmt.Errorf("Could not remove VM '%s' from load balancer '%s': %v", c.Args().Get(1), c.Args().Get(0), err)
+		}
+		fmt.Println(fmt.Sprintf("VM '%s' removed from load balancer '%s'", c.Args().Get(1), c.Args().Get(0)))
+
+		return nil
+	},
+}
+
+var lbDelete = cli.Command{
+	Name:      "delete",
+	Usage:     "Delete load balancer",
+	ArgsUsage: "<Load_balancer_name|Load_balancer_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <Load_balancer_name|Load_balancer_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Load balancer name or ID required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxLoadBalancer)
+		defer cancel()
+		service := pb.NewLoadBalancerServiceClient(conn)
+		_, err := service.Delete(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not delete load balancer '%s': %v", c.Args().First(), err)
+		}
+		fmt.Println(fmt.Sprintf("Load balancer '%s' deleted", c.Args().First()))
+
+		return nil
+	},
+}
@@ -17,8 +17,10 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	pb "github.com/CS-SI/SafeScale/broker"
 	utils "github.com/CS-SI/SafeScale/broker/utils"
@@ -34,6 +36,10 @@ var NetworkCmd = cli.Command{
 		networkDelete,
 		networkInspect,
 		networkList,
+		networkPeer,
+		networkUnpeer,
+		networkDNS,
+		networkVPN,
 	},
 }
 
@@ -95,12 +101,23 @@ var networkInspect = cli.Command{
 	Name:      "inspect",
 	Usage:     "inspect NETWORK",
 	ArgsUsage: "<network_name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format",
+			Value: "json",
+			Usage: "Output format of the topology of the network: json or dot (Graphviz)",
+		},
+	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() != 1 {
 			fmt.Println("Missing mandatory argument <network_name>")
 			cli.ShowSubcommandHelp(c)
 			return fmt.Errorf("Network name required")
 		}
+		format := c.String("format")
+		if format != "json" && format != "dot" {
+			return fmt.Errorf("Invalid format '%s', must be json or dot", format)
+		}
 
 		// Network
 		conn := utils.GetConnection()
@@ -108,17 +125,96 @@ var networkInspect = cli.Command{
 		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
 		defer cancel()
 		networkService := pb.NewNetworkServiceClient(conn)
-		network, err := networkService.Inspect(ctx, &pb.Reference{Name: c.Args().First(), TenantID: "TestOvh"})
+		topology, err := networkService.Topology(ctx, &pb.Reference{Name: c.Args().First(), TenantID: "TestOvh"})
 		if err != nil {
 			return fmt.Errorf("Could not inspect network %s: %v", c.Args().First(), err)
 		}
-		out, _ := json.Marshal(network)
+		if format == "dot" {
+			fmt.Print(topologyToDot(topology))
+			return nil
+		}
+		out, _ := json.Marshal(topology)
 		fmt.Println(string(out))
 
 		return nil
 	},
 }
 
+//topologyToDot renders the topology of a network as a Graphviz graph
+func topologyToDot(t *pb.NetworkTopology) string {
+	var b bytes.Buffer
+	netNode := "net:" + t.GetNetwork().GetID()
+	label := t.GetNetwork().GetName() + "\n" + t.GetNetwork().GetCIDR()
+	if t.GetNetwork().GetIPv6CIDR() != "" {
+		label += "\n" + t.GetNetwork().GetIPv6CIDR()
+	}
+	fmt.Fprintf(&b, "graph %q {\n", t.GetNetwork().GetName())
+	fmt.Fprintf(&b, "\t%q [shape=box, style=rounded, label=%q];\n", netNode, label)
+
+	vmLabel := func(vm *pb.NetworkVM) string {
+		label := vm.GetName()
+		for _, ip := range vm.GetPrivateIPs() {
+			label += "\n" + ip
+		}
+		return label
+	}
+	internet := false
+	for _, gw := range t.GetGateways() {
+		fmt.Fprintf(&b, "\t%q [shape=box3d, label=%q];\n", gw.GetID(), vmLabel(gw))
+		fmt.Fprintf(&b, "\t%q -- %q;\n", gw.GetID(), netNode)
+		if gw.GetPublicIP() != "" {
+			internet = true
+			fmt.Fprintf(&b, "\t%q -- \"internet\" [label=%q];\n", gw.GetID(), gw.GetPublicIP())
+		}
+	}
+	if t.GetVIP() != "" {
+		fmt.Fprintf(&b, "\t\"vip\" [shape=circle, label=%q];\n", "VIP\n"+t.GetVIP())
+		fmt.Fprintf(&b, "\t\"vip\" -- %q [style=dashed];\n", netNode)
+	}
+	for _, vm := range t.GetVMs() {
+		fmt.Fprintf(&b, "\t%q [shape=box, label=%q];\n", vm.GetID(), vmLabel(vm))
+		fmt.Fprintf(&b, "\t%q -- %q;\n", vm.GetID(), netNode)
+		if vm.GetPublicIP() != "" {
+			internet = true
+			fmt.Fprintf(&b, "\t%q -- \"internet\" [label=%q];\n", vm.GetID(), vm.GetPublicIP())
+		}
+	}
+	if internet {
+		fmt.Fprintf(&b, "\t\"internet\" [shape=ellipse, style=dashed];\n")
+	}
+	for _, nas := range t.GetNas() {
+		nasNode := "nas:" + nas.GetNas().GetName()
+		if nas.GetIsServer() {
+			fmt.Fprintf(&b, "\t%q [shape=folder, label=%q];\n", nasNode, nas.GetNas().GetName()+"\n"+nas.GetPath())
+			fmt.Fprintf(&b, "\t%q -- %q;\n", nas.GetVM().GetID(), nasNode)
+		} else {
+			fmt.Fprintf(&b, "\t%q -- %q [style=dashed, label=%q];\n", nasNode, nas.GetVM().GetID(), nas.GetPath())
+		}
+	}
+	if len(t.GetSecurityRules()) > 0 {
+		rules := "Security rules\\l"
+		for _, r := range t.GetSecurityRules() {
+			protocol := r.GetProtocol()
+			if protocol == "" {
+				protocol = "any"
+			}
+			ports := "any"
+			if r.GetPortFrom() > 0 {
+				ports = fmt.Sprintf("%d-%d", r.GetPortFrom(), r.GetPortTo())
+			}
+			cidr := r.GetCIDR()
+			if cidr == "" {
+				cidr = "group"
+			}
+			rules += fmt.Sprintf("%s %s %s %s\\l", r.GetDirection(), protocol, ports, cidr)
+		}
+		fmt.Fprintf(&b, "\t\"rules\" [shape=note, label=\"%s\"];\n", rules)
+		fmt.Fprintf(&b, "\t\"rules\" -- %q [style=dotted];\n", netNode)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
 var networkCreate = cli.Command{
 	Name:      "create",
 	Usage:     "create a network",
@@ -126,8 +222,11 @@ var networkCreate = cli.Command{
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "cidr",
-			Value: "192.168.0.0/24",
-			Usage: "cidr of the network",
+			Usage: "cidr of the network, allocated from the network pool of the tenant if not set",
+		},
+		cli.StringFlag{
+			Name:  "ipv6-cidr",
+			Usage: "IPv6 cidr of the network, which is dual-stack if set",
 		},
 		cli.IntFlag{
 			Name:  "cpu",
@@ -148,6 +247,19 @@ var networkCreate = cli.Command{
 			Name:  "os",
 			Value: "Ubuntu 16.04",
 			Usage: "Image name for the gateway",
+		},
+		cli.BoolFlag{
+			Name:  "ha",
+			Usage: "Create a pair of gateways sharing a virtual IP",
+		},
+		cli.StringFlag{
+			Name:  "gateway",
+			Value: "vm",
+			Usage: "Routing of the egress traffic (vm, router or none), router being a NAT gateway on AWS, not available on FlexibleEngine",
+		},
+		cli.BoolFlag{
+			Name:  "bastion",
+			Usage: "Create a bastion VM to reach the network with SSH when there is no gateway VM",
 		}},
 	Action: func(c *cli.Context) error {
 		if c.NArg() != 1 {
@@ -155,22 +267,35 @@ var networkCreate = cli.Command{
 			cli.ShowSubcommandHelp(c)
 			return fmt.Errorf("Network name reqired")
 		}
+		mode, ok := pb.GatewayMode_value["GATEWAY_"+strings.ToUpper(c.String("gateway"))]
+		if !ok {
+			return fmt.Errorf("Invalid gateway mode '%s', must be vm, router or none", c.String("gateway"))
+		}
 		// Network
 		conn := utils.GetConnection()
 		defer conn.Close()
-		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		timeout := utils.TimeoutCtxVM
+		if c.Bool("ha") {
+			// Gateways of a pair are created one after the other
+			timeout = 2 * utils.TimeoutCtxVM
+		}
+		ctx, cancel := utils.GetContext(timeout)
 		defer cancel()
 		networkService := pb.NewNetworkServiceClient(conn)
 		netdef := &pb.NetworkDefinition{
-			CIDR: c.String("cidr"),
-			Name: c.Args().Get(0),
+			CIDR:     c.String("cidr"),
+			IPv6CIDR: c.String("ipv6-cidr"),
+			Name:     c.Args().Get(0),
 			Gateway: &pb.GatewayDefinition{
 				CPU:  int32(c.Int("cpu")),
 				Disk: int32(c.Int("disk")),
 				RAM:  float32(c.Float64("ram")),
 				// CPUFrequency: ??,
 				ImageID: c.String("os"),
+				HA:      c.Bool("ha"),
 			},
+			GatewayMode: pb.GatewayMode(mode),
+			Bastion:     c.Bool("bastion"),
 		}
 		network, err := networkService.Create(ctx, netdef)
 		if err != nil {
@@ -182,3 +307,342 @@ var networkCreate = cli.Command{
 		return nil
 	},
 }
+
+var networkPeer = cli.Command{
+	Name:      "peer",
+	Usage:     "route the traffic between two networks",
+	ArgsUsage: "<network_name> <network_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <network_name> <network_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network names required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		peering, err := networkService.Peer(ctx, &pb.NetworkPeeringDefinition{
+			Network1: &pb.Reference{Name: c.Args().Get(0)},
+			Network2: &pb.Reference{Name: c.Args().Get(1)},
+		})
+		if err != nil {
+			return fmt.Errorf("Could not peer networks %s and %s: %v", c.Args().Get(0), c.Args().Get(1), err)
+		}
+		out, _ := json.Marshal(peering)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var networkUnpeer = cli.Command{
+	Name:      "unpeer",
+	Usage:     "stop routing the traffic between two networks",
+	ArgsUsage: "<network_name> <network_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <network_name> <network_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network names required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		_, err := networkService.Unpeer(ctx, &pb.NetworkPeeringDefinition{
+			Network1: &pb.Reference{Name: c.Args().Get(0)},
+			Network2: &pb.Reference{Name: c.Args().Get(1)},
+		})
+		if err != nil {
+			return fmt.Errorf("Could not unpeer networks %s and %s: %v", c.Args().Get(0), c.Args().Get(1), err)
+		}
+		fmt.Println(fmt.Sprintf("Networks '%s' and '%s' unpeered", c.Args().Get(0), c.Args().Get(1)))
+
+		return nil
+	},
+}
+
+var networkDNS = cli.Command{
+	Name:  "dns",
+	Usage: "manage the records of the private DNS zone <network_name>.safescale of a network",
+	Subcommands: []cli.Command{
+		networkDNSList,
+		networkDNSAdd,
+		networkDNSRemove,
+	},
+}
+
+var networkDNSList = cli.Command{
+	Name:      "list",
+	Usage:     "List the records of the private DNS zone of a network",
+	ArgsUsage: "<network_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <network_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		resp, err := networkService.ListDNSRecords(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not get DNS records of network %s: %v", c.Args().First(), err)
+		}
+		out, _ := json.Marshal(resp.GetRecords())
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var networkDNSAdd = cli.Command{
+	Name:      "add",
+	Usage:     "Add a record to the private DNS zone of a network",
+	ArgsUsage: "<network_name> <name> <value>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "type",
+			Usage: "Type of the record: A, AAAA or CNAME (default: deduced from the value)",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 3 {
+			fmt.Println("Missing mandatory argument <network_name> <name> <value>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name, record name and value required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		_, err := networkService.AddDNSRecord(ctx, &pb.DNSRecordDefinition{
+			Network: &pb.Reference{Name: c.Args().Get(0)},
+			Record: &pb.DNSRecord{
+				Name:  c.Args().Get(1),
+				Type:  c.String("type"),
+				Value: c.Args().Get(2),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Could not add DNS record %s to network %s: %v", c.Args().Get(1), c.Args().Get(0), err)
+		}
+		fmt.Println(fmt.Sprintf("DNS record '%s' added to network '%s'", c.Args().Get(1), c.Args().Get(0)))
+
+		return nil
+	},
+}
+
+var networkDNSRemove = cli.Command{
+	Name:      "remove",
+	Usage:     "Remove the records of a name, or only the one of a value, from the private DNS zone of a network",
+	ArgsUsage: "<network_name> <name> [value]",
+	Action: func(c *cli.Context) error {
+		if c.NArg() < 2 {
+			fmt.Println("Missing mandatory argument <network_name> <name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name and record name required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		_, err := networkService.RemoveDNSRecord(ctx, &pb.DNSRecordDefinition{
+			Network: &pb.Reference{Name: c.Args().Get(0)},
+			Record: &pb.DNSRecord{
+				Name:  c.Args().Get(1),
+				Value: c.Args().Get(2),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Could not remove DNS record %s from network %s: %v", c.Args().Get(1), c.Args().Get(0), err)
+		}
+		fmt.Println(fmt.Sprintf("DNS record '%s' removed from network '%s'", c.Args().Get(1), c.Args().Get(0)))
+
+		return nil
+	},
+}
+
+var networkVPN = cli.Command{
+	Name:  "vpn",
+	Usage: "manage the WireGuard VPN giving access to a network from workstations",
+	Subcommands: []cli.Command{
+		networkVPNEnable,
+		networkVPNInspect,
+		networkVPNConfig,
+		networkVPNRevoke,
+		networkVPNDisable,
+	},
+}
+
+var networkVPNEnable = cli.Command{
+	Name:      "enable",
+	Usage:     "Install WireGuard on the gateway of a network, not available with gateways in high availability",
+	ArgsUsage: "<network_name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "cidr",
+			Value: "10.99.0.0/24",
+			Usage: "Network of the IPs of the workstations in the VPN, must not overlap the network",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <network_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVPN)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		vpn, err := networkService.EnableVPN(ctx, &pb.VPNDefinition{
+			Network: &pb.Reference{Name: c.Args().First()},
+			CIDR:    c.String("cidr"),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not enable VPN of network %s: %v", c.Args().First(), err)
+		}
+		out, _ := json.Marshal(vpn)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var networkVPNInspect = cli.Command{
+	Name:      "inspect",
+	Usage:     "Inspect the VPN of a network and list its peers",
+	ArgsUsage: "<network_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <network_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		vpn, err := networkService.InspectVPN(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not inspect VPN of network %s: %v", c.Args().First(), err)
+		}
+		out, _ := json.Marshal(vpn)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var networkVPNConfig = cli.Command{
+	Name:      "config",
+	Usage:     "Output the WireGuard configuration of the workstation of a user, ready to import",
+	ArgsUsage: "<network_name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "user",
+			Usage: "User of the workstation, its peer is added to the VPN if needed",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 || c.String("user") == "" {
+			fmt.Println("Missing mandatory argument <network_name> or option --user")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name and user required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		config, err := networkService.GetVPNConfig(ctx, &pb.VPNPeerDefinition{
+			Network: &pb.Reference{Name: c.Args().First()},
+			User:    c.String("user"),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not get VPN configuration of user %s of network %s: %v", c.String("user"), c.Args().First(), err)
+		}
+		fmt.Print(config.GetConfig())
+
+		return nil
+	},
+}
+
+var networkVPNRevoke = cli.Command{
+	Name:      "revoke",
+	Usage:     "Revoke the peer of a user from the VPN of a network",
+	ArgsUsage: "<network_name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "user",
+			Usage: "User whose peer is revoked",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 || c.String("user") == "" {
+			fmt.Println("Missing mandatory argument <network_name> or option --user")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name and user required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		_, err := networkService.RevokeVPNPeer(ctx, &pb.VPNPeerDefinition{
+			Network: &pb.Reference{Name: c.Args().First()},
+			User:    c.String("user"),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not revoke VPN peer of user %s of network %s: %v", c.String("user"), c.Args().First(), err)
+		}
+		fmt.Println(fmt.Sprintf("VPN peer of user '%s' revoked from network '%s'", c.String("user"), c.Args().First()))
+
+		return nil
+	},
+}
+
+var networkVPNDisable = cli.Command{
+	Name:      "disable",
+	Usage:     "Stop WireGuard on the gateway of a network, all the peers are revoked",
+	ArgsUsage: "<network_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <network_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Network name required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVM)
+		defer cancel()
+		networkService := pb.NewNetworkServiceClient(conn)
+		_, err := networkService.DisableVPN(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not disable VPN of network %s: %v", c.Args().First(), err)
+		}
+		fmt.Println(fmt.Sprintf("VPN of network '%s' disabled", c.Args().First()))
+
+		return nil
+	},
+}
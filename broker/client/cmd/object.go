@@ -0,0 +1,496 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+	utils "github.com/CS-SI/SafeScale/broker/utils"
+	"github.com/urfave/cli"
+)
+
+//objectChunkSize is the size of the data sent in each message of an object upload
+const objectChunkSize = 1024 * 1024
+
+//ObjectCmd object command
+var ObjectCmd = cli.Command{
+	Name:  "object",
+	Usage: "object COMMAND",
+	Subcommands: []cli.Command{
+		objectPut,
+		objectGet,
+		objectList,
+		objectDelete,
+		objectCopy,
+		objectStat,
+		objectSync,
+	},
+}
+
+var objectPut = cli.Command{
+	Name:      "put",
+	Usage:     "Upload a file in a container",
+	ArgsUsage: "<Container_name> <File_path|->",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "Name of the object (default: name of the file)",
+		},
+		cli.StringSliceFlag{
+			Name:  "metadata",
+			Usage: "Metadata of the object, as key=value (can be repeated)",
+		},
+		cli.StringFlag{
+			Name:  "delete-at",
+			Usage: "Date of expiration of the object (RFC3339 format, ex: 2018-12-31T00:00:00Z)",
+		},
+		cli.DurationFlag{
+			Name:  "delete-after",
+			Usage: "Duration after which the object expires (ex: 24h)",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Container_name> and/or <File_path>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Container name and file path required")
+		}
+		container := c.Args().Get(0)
+		file := c.Args().Get(1)
+		name := c.String("name")
+		if name == "" {
+			if file == "-" {
+				return fmt.Errorf("Object name required when reading from standard input")
+			}
+			name = filepath.Base(file)
+		}
+
+		info := &pb.ObjectInfo{
+			Container: container,
+			Name:      name,
+			Metadata:  map[string]string{},
+		}
+		for _, m := range c.StringSlice("metadata") {
+			kv := strings.SplitN(m, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("Invalid metadata '%s', key=value expected", m)
+			}
+			info.Metadata[kv[0]] = kv[1]
+		}
+		if c.String("delete-at") != "" {
+			deleteAt, err := time.Parse(time.RFC3339, c.String("delete-at"))
+			if err != nil {
+				return fmt.Errorf("Invalid date '%s': %v", c.String("delete-at"), err)
+			}
+			info.DeleteAt = deleteAt.Unix()
+		} else if c.Duration("delete-after") != 0 {
+			info.DeleteAt = time.Now().Add(c.Duration("delete-after")).Unix()
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxObject)
+		defer cancel()
+		service := pb.NewObjectServiceClient(conn)
+
+		resp, err := putObject(ctx, service, info, file)
+		if err != nil {
+			return fmt.Errorf("Could not put object '%s' in container '%s': %v", name, container, err)
+		}
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		return nil
+	},
+}
+
+var objectGet = cli.Command{
+	Name:      "get",
+	Usage:     "Download an object of a container",
+	ArgsUsage: "<Container_name> <Object_name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "File in which the object is written, - for standard output (default: name of the object)",
+		},
+		cli.StringSliceFlag{
+			Name:  "range",
+			Usage: "Range of bytes to download, as from-to, from- or -to for the last bytes (can be repeated)",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Container_name> and/or <Object_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Container and object names required")
+		}
+		container := c.Args().Get(0)
+		name := c.Args().Get(1)
+		output := c.String("output")
+		if output == "" {
+			output = path.Base(name)
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxObject)
+		defer cancel()
+		service := pb.NewObjectServiceClient(conn)
+
+		_, err := getObject(ctx, service, &pb.ObjectDownload{
+			Object: &pb.ObjectRef{Container: container, Name: name},
+			Ranges: c.StringSlice("range"),
+		}, output)
+		if err != nil {
+			return fmt.Errorf("Could not get object '%s' from container '%s': %v", name, container, err)
+		}
+		return nil
+	},
+}
+
+var objectList = cli.Command{
+	Name:      "list",
+	Usage:     "List objects of a container",
+	ArgsUsage: "<Container_name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "List only objects whose name starts with prefix",
+		},
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "List only objects nested in the pseudo path",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <Container_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Container name required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewObjectServiceClient(conn)
+
+		resp, err := service.List(ctx, &pb.ObjectListRequest{
+			Container: c.Args().First(),
+			Prefix:    c.String("prefix"),
+			Path:      c.String("path"),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not list objects of container '%s': %v", c.Args().First(), err)
+		}
+		out, _ := json.Marshal(resp.GetNames())
+		fmt.Println(string(out))
+		return nil
+	},
+}
+
+var objectDelete = cli.Command{
+	Name:      "delete",
+	Usage:     "Delete an object of a container",
+	ArgsUsage: "<Container_name> <Object_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Container_name> and/or <Object_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Container and object names required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewObjectServiceClient(conn)
+
+		_, err := service.Delete(ctx, &pb.ObjectRef{Container: c.Args().Get(0), Name: c.Args().Get(1)})
+		if err != nil {
+			return fmt.Errorf("Could not delete object '%s' from container '%s': %v", c.Args().Get(1), c.Args().Get(0), err)
+		}
+		fmt.Printf("Object '%s' deleted from container '%s'\n", c.Args().Get(1), c.Args().Get(0))
+		return nil
+	},
+}
+
+var objectCopy = cli.Command{
+	Name:      "copy",
+	Usage:     "Copy an object into another object of the same container",
+	ArgsUsage: "<Container_name> <Source_object_name> <Destination_object_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 3 {
+			fmt.Println("Missing mandatory argument <Container_name>, <Source_object_name> and/or <Destination_object_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Container, source and destination object names required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxObject)
+		defer cancel()
+		service := pb.NewObjectServiceClient(conn)
+
+		_, err := service.Copy(ctx, &pb.ObjectCopy{
+			Container:   c.Args().Get(0),
+			Source:      c.Args().Get(1),
+			Destination: c.Args().Get(2),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not copy object '%s' to '%s': %v", c.Args().Get(1), c.Args().Get(2), err)
+		}
+		fmt.Printf("Object '%s' copied to '%s'\n", c.Args().Get(1), c.Args().Get(2))
+		return nil
+	},
+}
+
+var objectStat = cli.Command{
+	Name:      "stat",
+	Usage:     "Display metadata of an object",
+	ArgsUsage: "<Container_name> <Object_name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Container_name> and/or <Object_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Container and object names required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewObjectServiceClient(conn)
+
+		resp, err := service.Stat(ctx, &pb.ObjectRef{Container: c.Args().Get(0), Name: c.Args().Get(1)})
+		if err != nil {
+			return fmt.Errorf("Could not stat object '%s' of container '%s': %v", c.Args().Get(1), c.Args().Get(0), err)
+		}
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		return nil
+	},
+}
+
+var objectSync = cli.Command{
+	Name:      "sync",
+	Usage:     "Synchronize recursively a local directory with a container",
+	ArgsUsage: "<Directory> <Container_name>[:<prefix>] | <Container_name>[:<prefix>] <Directory>",
+	Description: "Files are uploaded (or downloaded) only if they don't exist on the other side or if their size\n" +
+		"   or their modification date differ. The direction is given by the argument having the form <Container_name>:<prefix>,\n" +
+		"   a local directory existing with the same name as a container takes precedence",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <Directory> and/or <Container_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Directory and container name required")
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		service := pb.NewObjectServiceClient(conn)
+
+		src, dst := c.Args().Get(0), c.Args().Get(1)
+		if fi, err := os.Stat(src); err == nil && fi.IsDir() {
+			container, prefix := splitContainerPath(dst)
+			return syncToContainer(service, src, container, prefix)
+		}
+		container, prefix := splitContainerPath(src)
+		return syncFromContainer(service, container, prefix, dst)
+	},
+}
+
+//splitContainerPath splits a <container>[:<prefix>] argument
+func splitContainerPath(arg string) (string, string) {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+//putObject streams the content of file (- for standard input) into the object described by info
+func putObject(ctx context.Context, service pb.ObjectServiceClient, info *pb.ObjectInfo, file string) (*pb.ObjectInfo, error) {
+	var reader io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	stream, err := service.Put(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// First chunk carries object info, even if the content is empty
+	err = stream.Send(&pb.ObjectChunk{Info: info})
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, objectChunkSize)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			serr := stream.Send(&pb.ObjectChunk{Data: buf[:n]})
+			if serr != nil {
+				return nil, serr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+//getObject streams the content of an object into output (- for standard output)
+func getObject(ctx context.Context, service pb.ObjectServiceClient, in *pb.ObjectDownload, output string) (*pb.ObjectInfo, error) {
+	stream, err := service.Get(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	// Receives the first chunk before creating the file to not create it if the object doesn't exist
+	chunk, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	info := chunk.GetInfo()
+
+	var writer io.Writer = os.Stdout
+	if output != "-" {
+		err = os.MkdirAll(filepath.Dir(output), 0755)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		writer = f
+	}
+	for {
+		_, err = writer.Write(chunk.GetData())
+		if err != nil {
+			return nil, err
+		}
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+//syncToContainer uploads recursively the files of dir not up to date in the container
+//The timeout of object transfers applies to each file
+func syncToContainer(service pb.ObjectServiceClient, dir string, container string, prefix string) error {
+	return filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxObject)
+		defer cancel()
+		stat, err := service.Stat(ctx, &pb.ObjectRef{Container: container, Name: name})
+		if err == nil && stat.GetContentLength() == fi.Size() && stat.GetLastModified() >= fi.ModTime().Unix() {
+			return nil
+		}
+		_, err = putObject(ctx, service, &pb.ObjectInfo{Container: container, Name: name}, file)
+		if err != nil {
+			return fmt.Errorf("Could not put '%s' in container '%s': %v", file, container, err)
+		}
+		fmt.Printf("%s -> %s:%s\n", file, container, name)
+		return nil
+	})
+}
+
+//syncFromContainer downloads the objects of the container beginning with prefix not up to date in dir
+//The objects whose name would lead outside of dir are skipped; the timeout of object transfers applies to each object
+func syncFromContainer(service pb.ObjectServiceClient, container string, prefix string, dir string) error {
+	ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+	defer cancel()
+	resp, err := service.List(ctx, &pb.ObjectListRequest{Container: container, Prefix: prefix})
+	if err != nil {
+		return fmt.Errorf("Could not list objects of container '%s': %v", container, err)
+	}
+	for _, name := range resp.GetNames() {
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		file, ok := localPath(dir, rel)
+		if !ok {
+			fmt.Printf("%s:%s skipped, its name leads outside of '%s'\n", container, name, dir)
+			continue
+		}
+		err = syncObject(service, &pb.ObjectRef{Container: container, Name: name}, file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//localPath returns the path of the file named rel in dir, and false if rel leads outside of dir
+func localPath(dir string, rel string) (string, bool) {
+	root := filepath.Clean(dir)
+	file := filepath.Join(root, filepath.FromSlash(rel))
+	r, err := filepath.Rel(root, file)
+	if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return file, true
+}
+
+//syncObject downloads the object into file if file doesn't exist or is not up to date
+func syncObject(service pb.ObjectServiceClient, ref *pb.ObjectRef, file string) error {
+	ctx, cancel := utils.GetContext(utils.TimeoutCtxObject)
+	defer cancel()
+	if fi, err := os.Stat(file); err == nil {
+		stat, err := service.Stat(ctx, ref)
+		if err == nil && stat.GetContentLength() == fi.Size() && fi.ModTime().Unix() >= stat.GetLastModified() {
+			return nil
+		}
+	}
+	_, err := getObject(ctx, service, &pb.ObjectDownload{Object: ref}, file)
+	if err != nil {
+		return fmt.Errorf("Could not get object '%s' from container '%s': %v", ref.GetName(), ref.GetContainer(), err)
+	}
+	fmt.Printf("%s:%s -> %s\n", ref.GetContainer(), ref.GetName(), file)
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_localPath(t *testing.T) {
+	tests := []struct {
+		dir  string
+		rel  string
+		file string
+		ok   bool
+	}{
+		{dir: ".", rel: "a.txt", file: "a.txt", ok: true},
+		{dir: ".", rel: "dir/a.txt", file: filepath.Join("dir", "a.txt"), ok: true},
+		{dir: "./out/", rel: "a.txt", file: filepath.Join("out", "a.txt"), ok: true},
+		{dir: "/", rel: "a.txt", file: filepath.Join("/", "a.txt"), ok: true},
+		{dir: "/tmp/out", rel: "dir/../a.txt", file: filepath.Join("/tmp/out", "a.txt"), ok: true},
+		{dir: "/tmp/out", rel: "..a.txt", file: filepath.Join("/tmp/out", "..a.txt"), ok: true},
+		{dir: "/tmp/out", rel: "/etc/a.txt", file: filepath.Join("/tmp/out", "etc", "a.txt"), ok: true},
+		{dir: "/tmp/out", rel: "dir//a.txt", file: filepath.Join("/tmp/out", "dir", "a.txt"), ok: true},
+		{dir: ".", rel: "../a.txt", ok: false},
+		{dir: "/tmp/out", rel: "../out2/a.txt", ok: false},
+		{dir: "/tmp/out", rel: "dir/../../a.txt", ok: false},
+		{dir: "/tmp/out", rel: "", ok: false},
+		{dir: "/tmp/out", rel: "dir/..", ok: false},
+	}
+	for _, tt := range tests {
+		file, ok := localPath(tt.dir, tt.rel)
+		assert.Equal(t, tt.ok, ok, tt.dir+" "+tt.rel)
+		assert.Equal(t, tt.file, file, tt.dir+" "+tt.rel)
+	}
+}
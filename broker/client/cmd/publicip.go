@@ -0,0 +1,195 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+	utils "github.com/CS-SI/SafeScale/broker/utils"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"github.com/urfave/cli"
+)
+
+//PublicIPCmd public IP command
+var PublicIPCmd = cli.Command{
+	Name:  "publicip",
+	Usage: "publicip COMMAND",
+	Subcommands: []cli.Command{
+		publicIPCreate,
+		publicIPList,
+		publicIPInspect,
+		publicIPAttach,
+		publicIPDetach,
+		publicIPDelete,
+	},
+}
+
+var publicIPCreate = cli.Command{
+	Name:  "create",
+	Usage: "Reserve a public IP, kept until deleted whatever the VMs it is attached to",
+	Action: func(c *cli.Context) error {
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewPublicIPServiceClient(conn)
+		ip, err := service.Create(ctx, &google_protobuf.Empty{})
+		if err != nil {
+			return fmt.Errorf("Could not create public IP: %v", err)
+		}
+
+		out, _ := json.Marshal(ip)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var publicIPList = cli.Command{
+	Name:  "list",
+	Usage: "List reserved public IPs",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "List all public IPs on tenant (not only those reserved with SafeScale)",
+		}},
+	Action: func(c *cli.Context) error {
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewPublicIPServiceClient(conn)
+		resp, err := service.List(ctx, &pb.PublicIPListRequest{
+			All: c.Bool("all"),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not get public IP list: %v", err)
+		}
+
+		out, _ := json.Marshal(resp.GetPublicIPs())
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var publicIPInspect = cli.Command{
+	Name:      "inspect",
+	Usage:     "Inspect public IP",
+	ArgsUsage: "<IP|IP_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <IP|IP_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Public IP or ID required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewPublicIPServiceClient(conn)
+		ip, err := service.Inspect(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not get public IP '%s': %v", c.Args().First(), err)
+		}
+
+		out, _ := json.Marshal(ip)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var publicIPAttach = cli.Command{
+	Name:      "attach",
+	Usage:     "Attach a public IP to a VM",
+	ArgsUsage: "<IP|IP_ID> <VM_name|VM_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <IP|IP_ID> and/or <VM_name|VM_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Public IP and VM required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewPublicIPServiceClient(conn)
+		_, err := service.Attach(ctx, &pb.PublicIPAttachment{
+			PublicIP: &pb.Reference{Name: c.Args().Get(0)},
+			VM:       &pb.Reference{Name: c.Args().Get(1)},
+		})
+		if err != nil {
+			return fmt.Errorf("Could not attach public IP '%s' to VM '%s': %v", c.Args().Get(0), c.Args().Get(1), err)
+		}
+		fmt.Println(fmt.Sprintf("Public IP '%s' attached to VM '%s'", c.Args().Get(0), c.Args().Get(1)))
+
+		return nil
+	},
+}
+
+var publicIPDetach = cli.Command{
+	Name:      "detach",
+	Usage:     "Detach a public IP from its VM",
+	ArgsUsage: "<IP|IP_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <IP|IP_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Public IP or ID required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewPublicIPServiceClient(conn)
+		_, err := service.Detach(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not detach public IP '%s': %v", c.Args().First(), err)
+		}
+		fmt.Println(fmt.Sprintf("Public IP '%s' detached", c.Args().First()))
+
+		return nil
+	},
+}
+
+var publicIPDelete = cli.Command{
+	Name:      "delete",
+	Usage:     "Delete public IP",
+	ArgsUsage: "<IP|IP_ID>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <IP|IP_ID>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Public IP or ID required")
+		}
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxDefault)
+		defer cancel()
+		service := pb.NewPublicIPServiceClient(conn)
+		_, err := service.Delete(ctx, &pb.Reference{Name: c.Args().First()})
+		if err != nil {
+			return fmt.Errorf("Could not delete public IP '%s': %v", c.Args().First(), err)
+		}
+		fmt.Println(fmt.Sprintf("Public IP '%s' deleted", c.Args().First()))
+
+		return nil
+	},
+}
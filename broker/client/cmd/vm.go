@@ -19,6 +19,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	pb "github.com/CS-SI/SafeScale/broker"
 	utils "github.com/CS-SI/SafeScale/broker/utils"
@@ -99,7 +100,7 @@ var vmCreate = cli.Command{
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "net",
-			Usage: "Name or ID of the network to put the VM on",
+			Usage: "Names or IDs of the networks to put the VM on, separated by commas, the first one providing the default route",
 		},
 		cli.IntFlag{
 			Name:  "cpu",
@@ -147,7 +148,7 @@ var vmCreate = cli.Command{
 			CPUNumber: int32(c.Int("cpu")),
 			Disk:      int32(c.Float64("disk")),
 			ImageID:   c.String("os"),
-			Network:   c.String("net"),
+			Networks:  splitList(c.String("net")),
 			Public:    !c.Bool("private"),
 			RAM:       float32(c.Float64("ram")),
 		})
@@ -210,3 +211,14 @@ var vmSsh = cli.Command{
 		return nil
 	},
 }
+
+//splitList splits a list of values separated by commas, ignoring the empty ones
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
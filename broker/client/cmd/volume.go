@@ -35,6 +35,7 @@ var VolumeCmd = cli.Command{
 		volumeList,
 		volumeInspect,
 		volumeDelete,
+		volumeUpdate,
 		volumeCreate,
 		volumeAttach,
 		volumeDetach,
@@ -165,6 +166,60 @@ var volumeCreate = cli.Command{
 	},
 }
 
+var volumeUpdate = cli.Command{
+	Name:      "update",
+	Usage:     "Extend a volume and/or change its speed",
+	ArgsUsage: "<Volume_name|Volume_ID>",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "size",
+			Usage: "New size of the volume (in Go), can't be lower than the current size",
+		},
+		cli.StringFlag{
+			Name:  "speed",
+			Usage: "New speed of the volume, allowed values: SSD, HDD, COLD",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <Volume_name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Volume name required")
+		}
+		speed := c.String("speed")
+		if _, ok := pb.VolumeSpeed_value[speed]; speed != "" && !ok {
+			msg := fmt.Sprintf("Invalid volume speed '%s'", speed)
+			fmt.Println(msg)
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf(msg)
+		}
+		if speed == "" && c.Int("size") == 0 {
+			msg := "Nothing to update, --size and/or --speed required"
+			fmt.Println(msg)
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf(msg)
+		}
+
+		conn := utils.GetConnection()
+		defer conn.Close()
+		ctx, cancel := utils.GetContext(utils.TimeoutCtxVolume)
+		defer cancel()
+		service := pb.NewVolumeServiceClient(conn)
+		volume, err := service.Update(ctx, &pb.VolumeUpdate{
+			Volume: &pb.Reference{Name: c.Args().First()},
+			Size:   int32(c.Int("size")),
+			Speed:  speed,
+		})
+		if err != nil {
+			return fmt.Errorf("Could not update volume '%s': %v", c.Args().First(), err)
+		}
+		out, _ := json.Marshal(volume)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
 var volumeAttach = cli.Command{
 	Name:      "attach",
 	Usage:     "Attach a volume to a VM",
@@ -178,7 +233,16 @@ var volumeAttach = cli.Command{
 		cli.StringFlag{
 			Name:  "format",
 			Value: "ext4",
-			Usage: "Filesystem format",
+			Usage: "Filesystem format, allowed values: ext4, xfs, btrfs (ignored if the volume already contains a filesystem)",
+		},
+		cli.StringFlag{
+			Name:  "mkfs-options",
+			Usage: "Options given to mkfs when the filesystem is created",
+		},
+		cli.StringFlag{
+			Name:  "mount-options",
+			Value: "defaults",
+			Usage: "Options used to mount the filesystem",
 		},
 	},
 	Action: func(c *cli.Context) error {
@@ -194,10 +258,12 @@ var volumeAttach = cli.Command{
 		defer cancel()
 		service := pb.NewVolumeServiceClient(conn)
 		_, err := service.Attach(ctx, &pb.VolumeAttachment{
-			Format:    c.String("format"),
-			MountPath: c.String("path"),
-			VM:        &pb.Reference{Name: c.Args().Get(1)},
-			Volume:    &pb.Reference{Name: c.Args().Get(0)},
+			Format:       c.String("format"),
+			MkfsOptions:  c.String("mkfs-options"),
+			MountOptions: c.String("mount-options"),
+			MountPath:    c.String("path"),
+			VM:           &pb.Reference{Name: c.Args().Get(1)},
+			Volume:       &pb.Reference{Name: c.Args().Get(0)},
 		})
 		if err != nil {
 			return fmt.Errorf("Could not attach volume '%s' to VM '%s': %v", c.Args().Get(0), c.Args().Get(1), err)
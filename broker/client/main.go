@@ -81,9 +81,18 @@ func main() {
 	app.Commands = append(app.Commands, cmd.ContainerCmd)
 	sort.Sort(cli.CommandsByName(cmd.ContainerCmd.Subcommands))
 
+	app.Commands = append(app.Commands, cmd.ObjectCmd)
+	sort.Sort(cli.CommandsByName(cmd.ObjectCmd.Subcommands))
+
 	app.Commands = append(app.Commands, cmd.NasCmd)
 	sort.Sort(cli.CommandsByName(cmd.NasCmd.Subcommands))
 
+	app.Commands = append(app.Commands, cmd.PublicIPCmd)
+	sort.Sort(cli.CommandsByName(cmd.PublicIPCmd.Subcommands))
+
+	app.Commands = append(app.Commands, cmd.LoadBalancerCmd)
+	sort.Sort(cli.CommandsByName(cmd.LoadBalancerCmd.Subcommands))
+
 	sort.Sort(cli.CommandsByName(app.Commands))
 	err := app.Run(os.Args)
 	if err != nil {
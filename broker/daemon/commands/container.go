@@ -30,7 +30,7 @@ import (
 )
 
 // broker container create c1
-// broker container mount c1 vm1 --path="/shared/data" (utilisation de s3ql, par default /containers/c1)
+// broker container mount c1 vm1 --path="/shared/data" --driver="rclone" (par default /containers/c1 et rclone, possible s3ql, rclone, s3fs, goofys)
 // broker container umount c1 vm1
 // broker container delete c1
 // broker container list
@@ -115,7 +115,7 @@ func (s *ContainerServiceServer) Mount(ctx context.Context, in *pb.ContainerMoun
 	}
 
 	service := services.NewContainerService(currentTenant.client)
-	err := service.Mount(in.GetContainer(), in.GetVM().GetName(), in.GetPath())
+	err := service.Mount(in.GetContainer(), in.GetVM().GetName(), in.GetPath(), in.GetDriver())
 
 	log.Println("End Mount container")
 	return &google_protobuf.Empty{}, err
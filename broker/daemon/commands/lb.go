@@ -0,0 +1,189 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+	services "github.com/CS-SI/SafeScale/broker/daemon/services"
+	conv "github.com/CS-SI/SafeScale/broker/utils"
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api/LBProtocol"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// broker lb create lb1 net1 --port=443 --protocol=https --check=/health (HTTPS est transmis tel quel aux backends; HAProxy sur les gateways si le provider n'a pas de load balancer)
+// broker lb list
+// broker lb inspect lb1
+// broker lb add-backend lb1 vm1
+// broker lb remove-backend lb1 vm1
+// broker lb delete lb1
+
+//LoadBalancerServiceServer load balancer service server grpc
+type LoadBalancerServiceServer struct{}
+
+//Create creates a load balancer
+func (s *LoadBalancerServiceServer) Create(ctx context.Context, in *pb.LoadBalancerDefinition) (*pb.LoadBalancer, error) {
+	log.Printf("Create LoadBalancer called")
+
+	net := conv.GetReference(in.GetNetwork())
+	if in.GetName() == "" || net == "" {
+		return nil, fmt.Errorf("Name and network are required")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewLoadBalancerService(currentTenant.client)
+	lb, err := service.Create(in.GetName(), net, LBProtocol.Enum(in.GetProtocol()), int(in.GetPort()), int(in.GetBackendPort()), in.GetHealthCheckPath())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("LoadBalancer '%s' created", lb.Name)
+	return conv.ToPBLoadBalancer(lb), nil
+}
+
+//List lists the load balancers
+func (s *LoadBalancerServiceServer) List(ctx context.Context, in *google_protobuf.Empty) (*pb.LoadBalancerList, error) {
+	log.Printf("List LoadBalancer called")
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewLoadBalancerService(currentTenant.client)
+	lbs, err := service.List()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var pblbs []*pb.LoadBalancer
+	for _, lb := range lbs {
+		pblbs = append(pblbs, conv.ToPBLoadBalancer(&lb))
+	}
+	log.Printf("End List LoadBalancer")
+	return &pb.LoadBalancerList{LoadBalancers: pblbs}, nil
+}
+
+//Inspect returns infos on a load balancer
+func (s *LoadBalancerServiceServer) Inspect(ctx context.Context, in *pb.Reference) (*pb.LoadBalancer, error) {
+	log.Printf("Inspect LoadBalancer called")
+
+	ref := conv.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewLoadBalancerService(currentTenant.client)
+	lb, err := service.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("End Inspect LoadBalancer: '%s'", ref)
+	return conv.ToPBLoadBalancer(lb), nil
+}
+
+//AddBackend adds a VM to the backends of a load balancer
+func (s *LoadBalancerServiceServer) AddBackend(ctx context.Context, in *pb.LoadBalancerBackend) (*google_protobuf.Empty, error) {
+	log.Printf("AddBackend LoadBalancer called")
+
+	ref := conv.GetReference(in.GetLoadBalancer())
+	vm := conv.GetReference(in.GetVM())
+	if ref == "" || vm == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewLoadBalancerService(currentTenant.client)
+	err := service.AddBackend(ref, vm)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("VM '%s' added to LoadBalancer '%s'", vm, ref)
+	return &google_protobuf.Empty{}, nil
+}
+
+//RemoveBackend removes a VM from the backends of a load balancer
+func (s *LoadBalancerServiceServer) RemoveBackend(ctx context.Context, in *pb.LoadBalancerBackend) (*google_protobuf.Empty, error) {
+	log.Printf("RemoveBackend LoadBalancer called")
+
+	ref := conv.GetReference(in.GetLoadBalancer())
+	vm := conv.GetReference(in.GetVM())
+	if ref == "" || vm == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewLoadBalancerService(currentTenant.client)
+	err := service.RemoveBackend(ref, vm)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("VM '%s' removed from LoadBalancer '%s'", vm, ref)
+	return &google_protobuf.Empty{}, nil
+}
+
+//Delete deletes a load balancer
+func (s *LoadBalancerServiceServer) Delete(ctx context.Context, in *pb.Reference) (*google_protobuf.Empty, error) {
+	log.Printf("Delete LoadBalancer called")
+
+	ref := conv.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewLoadBalancerService(currentTenant.client)
+	err := service.Delete(ref)
+	if err != nil {
+		log.Println(err)
+		// The clients tell a load balancer already deleted from a failed deletion by the code of the error
+		if _, ok := err.(providers.ResourceNotFound); ok {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Printf("LoadBalancer '%s' deleted", ref)
+	return &google_protobuf.Empty{}, nil
+}
@@ -24,14 +24,30 @@ import (
 	pb "github.com/CS-SI/SafeScale/broker"
 	services "github.com/CS-SI/SafeScale/broker/daemon/services"
 	utils "github.com/CS-SI/SafeScale/broker/utils"
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
 	google_protobuf "github.com/golang/protobuf/ptypes/empty"
 )
 
-// broker network create net1 --cidr="192.145.0.0/16" --cpu=2 --ram=7 --disk=100 --os="Ubuntu 16.04" (par défault "192.168.0.0/24", on crée une gateway sur chaque réseau: gw_net1)
+// broker network create net1 --cidr="192.145.0.0/16" --cpu=2 --ram=7 --disk=100 --os="Ubuntu 16.04" (par défault le CIDR est alloué dans le pool NetworkCIDRPool du tenant, "192.168.0.0/16" s'il n'est pas défini, on crée une gateway sur chaque réseau: gw_net1)
+// broker network create net1 --ipv6-cidr="fd00:1::/64" (réseau double pile IPv4/IPv6, la gateway route aussi le trafic IPv6)
+// broker network create net1 --ha (on crée une paire de gateways partageant une IP virtuelle: gw_net1 et gw_net1_2)
+// broker network create net1 --gateway=router --bastion (le routeur du provider route le trafic sortant, pas de gateway, une VM bastion_net1 pour SSH; --gateway=none pour un réseau sans sortie)
 // broker network list
 // broker network delete net1
 // broker network inspect net1
+// broker network inspect net1 --format=dot | dot -Tpng > net1.png (topologie du réseau: gateways, VMs, NAS et règles de sécurité, au format json par défaut)
+// broker network peer net1 net2 (le trafic est routé entre net1 et net2, les routes des gateways sont mises à jour)
+// broker network unpeer net1 net2
+// broker network dns list net1 (les VMs sont enregistrées automatiquement: vm1.net1.safescale)
+// broker network dns add net1 www 192.168.0.12 --type=A (type A, AAAA ou CNAME, déduit de la valeur par défaut)
+// broker network dns remove net1 www
+// broker network vpn enable net1 --cidr="10.99.0.0/24" (WireGuard est installé sur la gateway, port UDP 51820, réseau des postes de travail par défaut "10.99.0.0/24")
+// broker network vpn inspect net1
+// broker network vpn config net1 --user=alice > alice.conf (le pair d'alice est créé si besoin, configuration à importer dans WireGuard)
+// broker network vpn revoke net1 --user=alice (la configuration d'alice ne permet plus de se connecter)
+// broker network vpn disable net1
 
 //NetworkServiceServer network service server grpc
 type NetworkServiceServer struct{}
@@ -45,8 +61,9 @@ func (s *NetworkServiceServer) Create(ctx context.Context, in *pb.NetworkDefinit
 	}
 
 	networkAPI := services.NewNetworkService(currentTenant.client)
-	network, err := networkAPI.Create(in.GetName(), in.GetCIDR(), IPVersion.IPv4,
-		int(in.Gateway.GetCPU()), in.GetGateway().GetRAM(), int(in.GetGateway().GetDisk()), in.GetGateway().GetImageID())
+	network, err := networkAPI.Create(in.GetName(), in.GetCIDR(), IPVersion.IPv4, in.GetIPv6CIDR(),
+		int(in.Gateway.GetCPU()), in.GetGateway().GetRAM(), int(in.GetGateway().GetDisk()), in.GetGateway().GetImageID(), in.GetGateway().GetHA(),
+		GatewayMode.Enum(in.GetGatewayMode()), in.GetBastion())
 
 	if err != nil {
 		log.Println(err)
@@ -55,9 +72,10 @@ func (s *NetworkServiceServer) Create(ctx context.Context, in *pb.NetworkDefinit
 
 	log.Println("Network created")
 	return &pb.Network{
-		ID:   network.ID,
-		Name: network.Name,
-		CIDR: network.CIDR,
+		ID:       network.ID,
+		Name:     network.Name,
+		CIDR:     network.CIDR,
+		IPv6CIDR: network.IPv6CIDR,
 	}, nil
 }
 
@@ -81,9 +99,10 @@ func (s *NetworkServiceServer) List(ctx context.Context, in *pb.NWListRequest) (
 	// Map api.Network to pb.Network
 	for _, network := range networks {
 		pbnetworks = append(pbnetworks, &pb.Network{
-			ID:   network.ID,
-			Name: network.Name,
-			CIDR: network.CIDR,
+			ID:       network.ID,
+			Name:     network.Name,
+			CIDR:     network.CIDR,
+			IPv6CIDR: network.IPv6CIDR,
 		})
 	}
 	rv := &pb.NetworkList{Networks: pbnetworks}
@@ -112,12 +131,36 @@ func (s *NetworkServiceServer) Inspect(ctx context.Context, in *pb.Reference) (*
 
 	log.Printf("End Inspect Network: '%s'", ref)
 	return &pb.Network{
-		ID:   network.ID,
-		Name: network.Name,
-		CIDR: network.CIDR,
+		ID:       network.ID,
+		Name:     network.Name,
+		CIDR:     network.CIDR,
+		IPv6CIDR: network.IPv6CIDR,
 	}, nil
 }
 
+//Topology returns a network with its gateway, its VMs, the NAS running on them and its security rules
+func (s *NetworkServiceServer) Topology(ctx context.Context, in *pb.Reference) (*pb.NetworkTopology, error) {
+	log.Printf("Topology Network called")
+
+	ref := utils.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	networkAPI := services.NewNetworkService(currentTenant.client)
+	topology, err := networkAPI.Topology(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("End Topology Network: '%s'", ref)
+	return utils.ToPBNetworkTopology(topology), nil
+}
+
 //Delete a network
 func (s *NetworkServiceServer) Delete(ctx context.Context, in *pb.Reference) (*google_protobuf.Empty, error) {
 	log.Printf("Delete Network called for network '%s'", in.GetName())
@@ -140,3 +183,256 @@ func (s *NetworkServiceServer) Delete(ctx context.Context, in *pb.Reference) (*g
 	log.Printf("Network '%s' deleted", ref)
 	return &google_protobuf.Empty{}, nil
 }
+
+//Peer routes the traffic between two networks
+func (s *NetworkServiceServer) Peer(ctx context.Context, in *pb.NetworkPeeringDefinition) (*pb.NetworkPeering, error) {
+	log.Printf("Peer Network called")
+
+	ref1 := utils.GetReference(in.GetNetwork1())
+	ref2 := utils.GetReference(in.GetNetwork2())
+	if ref1 == "" || ref2 == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	networkAPI := services.NewNetworkService(currentTenant.client)
+	peering, err := networkAPI.Peer(ref1, ref2)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("Networks '%s' and '%s' peered", ref1, ref2)
+	return &pb.NetworkPeering{
+		ID:         peering.ID,
+		NetworkIDs: peering.NetworkIDs,
+	}, nil
+}
+
+//Unpeer stops routing the traffic between two networks
+func (s *NetworkServiceServer) Unpeer(ctx context.Context, in *pb.NetworkPeeringDefinition) (*google_protobuf.Empty, error) {
+	log.Printf("Unpeer Network called")
+
+	ref1 := utils.GetReference(in.GetNetwork1())
+	ref2 := utils.GetReference(in.GetNetwork2())
+	if ref1 == "" || ref2 == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	networkAPI := services.NewNetworkService(currentTenant.client)
+	err := networkAPI.Unpeer(ref1, ref2)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("Networks '%s' and '%s' unpeered", ref1, ref2)
+	return &google_protobuf.Empty{}, nil
+}
+
+//ListDNSRecords lists the records of the private DNS zone of a network
+func (s *NetworkServiceServer) ListDNSRecords(ctx context.Context, in *pb.Reference) (*pb.DNSRecordList, error) {
+	log.Printf("ListDNSRecords Network called")
+
+	ref := utils.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	dnsAPI := services.NewDNSService(currentTenant.client)
+	records, err := dnsAPI.List(ref)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var pbrecords []*pb.DNSRecord
+	for _, r := range records {
+		pbrecords = append(pbrecords, utils.ToPBDNSRecord(&r))
+	}
+	log.Printf("End ListDNSRecords Network")
+	return &pb.DNSRecordList{Records: pbrecords}, nil
+}
+
+//AddDNSRecord adds a record to the private DNS zone of a network
+func (s *NetworkServiceServer) AddDNSRecord(ctx context.Context, in *pb.DNSRecordDefinition) (*google_protobuf.Empty, error) {
+	log.Printf("AddDNSRecord Network called")
+
+	ref := utils.GetReference(in.GetNetwork())
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	dnsAPI := services.NewDNSService(currentTenant.client)
+	err := dnsAPI.Add(ref, api.DNSRecord{
+		Name:  in.GetRecord().GetName(),
+		Type:  in.GetRecord().GetType(),
+		Value: in.GetRecord().GetValue(),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("DNS record '%s' added to network '%s'", in.GetRecord().GetName(), ref)
+	return &google_protobuf.Empty{}, nil
+}
+
+//RemoveDNSRecord removes records from the private DNS zone of a network
+func (s *NetworkServiceServer) RemoveDNSRecord(ctx context.Context, in *pb.DNSRecordDefinition) (*google_protobuf.Empty, error) {
+	log.Printf("RemoveDNSRecord Network called")
+
+	ref := utils.GetReference(in.GetNetwork())
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	dnsAPI := services.NewDNSService(currentTenant.client)
+	err := dnsAPI.Remove(ref, in.GetRecord().GetName(), in.GetRecord().GetValue())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("DNS record '%s' removed from network '%s'", in.GetRecord().GetName(), ref)
+	return &google_protobuf.Empty{}, nil
+}
+
+//EnableVPN installs WireGuard on the gateway of a network
+func (s *NetworkServiceServer) EnableVPN(ctx context.Context, in *pb.VPNDefinition) (*pb.VPN, error) {
+	log.Printf("EnableVPN Network called")
+
+	ref := utils.GetReference(in.GetNetwork())
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	vpnAPI := services.NewVPNService(currentTenant.client)
+	vpn, err := vpnAPI.Enable(ref, in.GetCIDR())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("VPN of network '%s' enabled", ref)
+	return utils.ToPBVPN(vpn), nil
+}
+
+//InspectVPN returns the VPN of a network and its peers
+func (s *NetworkServiceServer) InspectVPN(ctx context.Context, in *pb.Reference) (*pb.VPN, error) {
+	log.Printf("InspectVPN Network called")
+
+	ref := utils.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	vpnAPI := services.NewVPNService(currentTenant.client)
+	vpn, err := vpnAPI.Get(ref)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("End InspectVPN Network")
+	return utils.ToPBVPN(vpn), nil
+}
+
+//GetVPNConfig returns the WireGuard configuration of the workstation of a user, adding its peer to the VPN of a network if needed
+func (s *NetworkServiceServer) GetVPNConfig(ctx context.Context, in *pb.VPNPeerDefinition) (*pb.VPNConfig, error) {
+	log.Printf("GetVPNConfig Network called")
+
+	ref := utils.GetReference(in.GetNetwork())
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	vpnAPI := services.NewVPNService(currentTenant.client)
+	config, err := vpnAPI.Config(ref, in.GetUser())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("VPN configuration of user '%s' of network '%s' generated", in.GetUser(), ref)
+	return &pb.VPNConfig{Config: config}, nil
+}
+
+//RevokeVPNPeer removes the peer of a user from the VPN of a network
+func (s *NetworkServiceServer) RevokeVPNPeer(ctx context.Context, in *pb.VPNPeerDefinition) (*google_protobuf.Empty, error) {
+	log.Printf("RevokeVPNPeer Network called")
+
+	ref := utils.GetReference(in.GetNetwork())
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	vpnAPI := services.NewVPNService(currentTenant.client)
+	err := vpnAPI.Revoke(ref, in.GetUser())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("VPN peer of user '%s' revoked from network '%s'", in.GetUser(), ref)
+	return &google_protobuf.Empty{}, nil
+}
+
+//DisableVPN stops WireGuard on the gateway of a network
+func (s *NetworkServiceServer) DisableVPN(ctx context.Context, in *pb.Reference) (*google_protobuf.Empty, error) {
+	log.Printf("DisableVPN Network called")
+
+	ref := utils.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	vpnAPI := services.NewVPNService(currentTenant.client)
+	err := vpnAPI.Disable(ref)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("VPN of network '%s' disabled", ref)
+	return &google_protobuf.Empty{}, nil
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+	services "github.com/CS-SI/SafeScale/broker/daemon/services"
+	conv "github.com/CS-SI/SafeScale/broker/utils"
+	"github.com/CS-SI/SafeScale/providers/api"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+)
+
+// broker object put c1 ./file.txt --name="dir/file.txt" --metadata="key=value" --delete-at="2018-12-31T00:00:00Z" (par default le nom du fichier)
+// broker object get c1 dir/file.txt --output="./file.txt" --range="0-99" (par default le nom de l'objet)
+// broker object list c1 --prefix="dir/"
+// broker object delete c1 dir/file.txt
+// broker object copy c1 dir/file.txt dir/copy.txt
+// broker object stat c1 dir/file.txt
+// broker object sync ./dir c1:dir/ (ou c1:dir/ ./dir pour récupérer le contenu d'un conteneur)
+
+//objectChunkSize is the size of the data sent in each message of an object download
+const objectChunkSize = 1024 * 1024
+
+//ObjectServiceServer is the object service grpc server
+type ObjectServiceServer struct{}
+
+//Put stores an object streamed by the client in a container
+func (s *ObjectServiceServer) Put(stream pb.ObjectService_PutServer) error {
+	log.Printf("Object put called")
+	if GetCurrentTenant() == nil {
+		return fmt.Errorf("No tenant set")
+	}
+
+	// The content is buffered in a temporary file as providers need a seekable content
+	tmp, err := ioutil.TempFile("", "broker-object-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var info *pb.ObjectInfo
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			info = chunk.GetInfo()
+			if info == nil {
+				return fmt.Errorf("Object info required in first chunk")
+			}
+		}
+		_, err = tmp.Write(chunk.GetData())
+		if err != nil {
+			return err
+		}
+	}
+	if info == nil {
+		return fmt.Errorf("No object received")
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	obj := conv.ToAPIObject(info)
+	obj.Content = tmp
+	service := services.NewObjectService(currentTenant.client)
+	err = service.Put(info.GetContainer(), obj)
+	if err != nil {
+		return err
+	}
+
+	stat, err := service.Stat(info.GetContainer(), info.GetName())
+	if err != nil {
+		log.Printf("Failed to get metadata of object '%s': %s", info.GetName(), err)
+		stat = &obj
+	}
+	log.Printf("End object put '%s' in container '%s'", info.GetName(), info.GetContainer())
+	return stream.SendAndClose(conv.ToPBObjectInfo(info.GetContainer(), stat))
+}
+
+//Get streams the content of an object to the client
+func (s *ObjectServiceServer) Get(in *pb.ObjectDownload, stream pb.ObjectService_GetServer) error {
+	log.Printf("Object get called")
+	if GetCurrentTenant() == nil {
+		return fmt.Errorf("No tenant set")
+	}
+
+	ranges, err := conv.ToAPIRanges(in.GetRanges())
+	if err != nil {
+		return err
+	}
+	container := in.GetObject().GetContainer()
+	service := services.NewObjectService(currentTenant.client)
+	obj, err := service.Get(container, in.GetObject().GetName(), ranges)
+	if err != nil {
+		return err
+	}
+	// The content is streamed from the object storage while it is sent
+	if closer, ok := obj.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	err = stream.Send(&pb.ObjectChunk{Info: conv.ToPBObjectInfo(container, obj)})
+	if err != nil {
+		return err
+	}
+	if obj.Content != nil {
+		buf := make([]byte, objectChunkSize)
+		for {
+			n, err := obj.Content.Read(buf)
+			if n > 0 {
+				serr := stream.Send(&pb.ObjectChunk{Data: buf[:n]})
+				if serr != nil {
+					return serr
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("End object get '%s' from container '%s'", in.GetObject().GetName(), container)
+	return nil
+}
+
+//List the objects of a container
+func (s *ObjectServiceServer) List(ctx context.Context, in *pb.ObjectListRequest) (*pb.ObjectList, error) {
+	log.Printf("Object list called")
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewObjectService(currentTenant.client)
+	names, err := service.List(in.GetContainer(), api.ObjectFilter{
+		Prefix: in.GetPrefix(),
+		Path:   in.GetPath(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("End object list")
+	return &pb.ObjectList{Names: names}, nil
+}
+
+//Delete an object of a container
+func (s *ObjectServiceServer) Delete(ctx context.Context, in *pb.ObjectRef) (*google_protobuf.Empty, error) {
+	log.Printf("Object delete called")
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewObjectService(currentTenant.client)
+	err := service.Delete(in.GetContainer(), in.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Object '%s' deleted from container '%s'", in.GetName(), in.GetContainer())
+	return &google_protobuf.Empty{}, nil
+}
+
+//Copy an object into another object of the same container
+func (s *ObjectServiceServer) Copy(ctx context.Context, in *pb.ObjectCopy) (*google_protobuf.Empty, error) {
+	log.Printf("Object copy called")
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewObjectService(currentTenant.client)
+	err := service.Copy(in.GetContainer(), in.GetSource(), in.GetDestination())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Object '%s' copied to '%s' in container '%s'", in.GetSource(), in.GetDestination(), in.GetContainer())
+	return &google_protobuf.Empty{}, nil
+}
+
+//Stat returns the metadata of an object
+func (s *ObjectServiceServer) Stat(ctx context.Context, in *pb.ObjectRef) (*pb.ObjectInfo, error) {
+	log.Printf("Object stat called")
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewObjectService(currentTenant.client)
+	obj, err := service.Stat(in.GetContainer(), in.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("End object stat")
+	return conv.ToPBObjectInfo(in.GetContainer(), obj), nil
+}
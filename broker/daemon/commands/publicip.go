@@ -0,0 +1,174 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+	services "github.com/CS-SI/SafeScale/broker/daemon/services"
+	conv "github.com/CS-SI/SafeScale/broker/utils"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+)
+
+// broker publicip create
+// broker publicip list --all (par défaut seulement les IPs réservées avec broker publicip create)
+// broker publicip inspect 1.2.3.4
+// broker publicip attach 1.2.3.4 vm1
+// broker publicip detach 1.2.3.4
+// broker publicip delete 1.2.3.4
+
+//PublicIPServiceServer public IP service server grpc
+type PublicIPServiceServer struct{}
+
+//Create reserves a public IP
+func (s *PublicIPServiceServer) Create(ctx context.Context, in *google_protobuf.Empty) (*pb.PublicIP, error) {
+	log.Printf("Create PublicIP called")
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewPublicIPService(currentTenant.client)
+	ip, err := service.Create()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("PublicIP '%s' created", ip.IP)
+	return conv.ToPBPublicIP(ip), nil
+}
+
+//List lists the public IPs
+func (s *PublicIPServiceServer) List(ctx context.Context, in *pb.PublicIPListRequest) (*pb.PublicIPList, error) {
+	log.Printf("List PublicIP called")
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewPublicIPService(currentTenant.client)
+	ips, err := service.List(in.GetAll())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var pbips []*pb.PublicIP
+	for _, ip := range ips {
+		pbips = append(pbips, conv.ToPBPublicIP(&ip))
+	}
+	log.Printf("End List PublicIP")
+	return &pb.PublicIPList{PublicIPs: pbips}, nil
+}
+
+//Inspect returns infos on a public IP
+func (s *PublicIPServiceServer) Inspect(ctx context.Context, in *pb.Reference) (*pb.PublicIP, error) {
+	log.Printf("Inspect PublicIP called")
+
+	ref := conv.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither address nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewPublicIPService(currentTenant.client)
+	ip, err := service.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("End Inspect PublicIP: '%s'", ref)
+	return conv.ToPBPublicIP(ip), nil
+}
+
+//Attach attaches a public IP to a VM
+func (s *PublicIPServiceServer) Attach(ctx context.Context, in *pb.PublicIPAttachment) (*google_protobuf.Empty, error) {
+	log.Printf("Attach PublicIP called")
+
+	ref := conv.GetReference(in.GetPublicIP())
+	vm := conv.GetReference(in.GetVM())
+	if ref == "" || vm == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewPublicIPService(currentTenant.client)
+	err := service.Attach(ref, vm)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("PublicIP '%s' attached to VM '%s'", ref, vm)
+	return &google_protobuf.Empty{}, nil
+}
+
+//Detach detaches a public IP from its VM
+func (s *PublicIPServiceServer) Detach(ctx context.Context, in *pb.Reference) (*google_protobuf.Empty, error) {
+	log.Printf("Detach PublicIP called")
+
+	ref := conv.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither address nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewPublicIPService(currentTenant.client)
+	err := service.Detach(ref)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("PublicIP '%s' detached", ref)
+	return &google_protobuf.Empty{}, nil
+}
+
+//Delete releases a public IP
+func (s *PublicIPServiceServer) Delete(ctx context.Context, in *pb.Reference) (*google_protobuf.Empty, error) {
+	log.Printf("Delete PublicIP called")
+
+	ref := conv.GetReference(in)
+	if ref == "" {
+		return nil, fmt.Errorf("Neither address nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	service := services.NewPublicIPService(currentTenant.client)
+	err := service.Delete(ref)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	log.Printf("PublicIP '%s' deleted", ref)
+	return &google_protobuf.Empty{}, nil
+}
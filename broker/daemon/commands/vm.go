@@ -32,6 +32,7 @@ import (
 // broker vm list --all=false
 // broker vm inspect vm1
 // broker vm create vm2 --net="net1" --cpu=2 --ram=7 --disk=100 --os="Ubuntu 16.04" --public=false
+// broker vm create vm3 --net="net1,net2" (la VM est connectée aux deux réseaux, la route par défaut passe par la gateway de net1)
 
 //VMServiceServer VM service server grpc
 type VMServiceServer struct{}
@@ -55,17 +56,7 @@ func (s *VMServiceServer) List(ctx context.Context, in *pb.VMListRequest) (*pb.V
 
 	// Map api.VM to pb.VM
 	for _, vm := range vms {
-		pbvm = append(pbvm, &pb.VM{
-			CPU:        int32(vm.Size.Cores),
-			Disk:       int32(vm.Size.DiskSize),
-			GatewayID:  vm.GatewayID,
-			ID:         vm.ID,
-			IP:         vm.GetAccessIP(),
-			Name:       vm.Name,
-			PrivateKey: vm.PrivateKey,
-			RAM:        vm.Size.RAMSize,
-			State:      pb.VMState(vm.State),
-		})
+		pbvm = append(pbvm, conv.ToPBVM(&vm))
 	}
 	rv := &pb.VMList{VMs: pbvm}
 	log.Printf("End List VM")
@@ -79,8 +70,14 @@ func (s *VMServiceServer) Create(ctx context.Context, in *pb.VMDefinition) (*pb.
 		return nil, fmt.Errorf("No tenant set")
 	}
 
+	// Networks supersedes Network, kept for clients connecting a VM to a single network
+	nets := in.GetNetworks()
+	if len(nets) == 0 && in.GetNetwork() != "" {
+		nets = []string{in.GetNetwork()}
+	}
+
 	vmService := services.NewVMService(currentTenant.client)
-	vm, err := vmService.Create(in.GetName(), in.GetNetwork(),
+	vm, err := vmService.Create(in.GetName(), nets,
 		int(in.GetCPUNumber()), in.GetRAM(), int(in.GetDisk()), in.GetImageID(), in.GetPublic())
 
 	if err != nil {
@@ -89,17 +86,7 @@ func (s *VMServiceServer) Create(ctx context.Context, in *pb.VMDefinition) (*pb.
 	}
 
 	log.Printf("VM '%s' created", in.GetName())
-	return &pb.VM{
-		CPU:        int32(vm.Size.Cores),
-		Disk:       int32(vm.Size.DiskSize),
-		GatewayID:  vm.GatewayID,
-		ID:         vm.ID,
-		IP:         vm.GetAccessIP(),
-		Name:       vm.Name,
-		PrivateKey: vm.PrivateKey,
-		RAM:        vm.Size.RAMSize,
-		State:      pb.VMState(vm.State),
-	}, nil
+	return conv.ToPBVM(vm), nil
 }
 
 //Inspect a VM
@@ -122,17 +109,7 @@ func (s *VMServiceServer) Inspect(ctx context.Context, in *pb.Reference) (*pb.VM
 	}
 
 	log.Printf("End Inspect VM: '%s'", in.GetName())
-	return &pb.VM{
-		CPU:        int32(vm.Size.Cores),
-		Disk:       int32(vm.Size.DiskSize),
-		GatewayID:  vm.GatewayID,
-		ID:         vm.ID,
-		IP:         vm.GetAccessIP(),
-		Name:       vm.Name,
-		PrivateKey: vm.PrivateKey,
-		RAM:        vm.Size.RAMSize,
-		State:      pb.VMState(vm.State),
-	}, nil
+	return conv.ToPBVM(vm), nil
 }
 
 //Delete a VM
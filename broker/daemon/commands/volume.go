@@ -87,7 +87,7 @@ func (s *VolumeServiceServer) Attach(ctx context.Context, in *pb.VolumeAttachmen
 	}
 
 	service := services.NewVolumeService(currentTenant.client)
-	err := service.Attach(in.GetVolume().GetName(), in.GetVM().GetName(), in.GetMountPath(), in.GetFormat())
+	err := service.Attach(in.GetVolume().GetName(), in.GetVM().GetName(), in.GetMountPath(), in.GetFormat(), in.GetMkfsOptions(), in.GetMountOptions())
 
 	if err != nil {
 		log.Println(err)
@@ -160,3 +160,36 @@ func (s *VolumeServiceServer) Inspect(ctx context.Context, in *pb.Reference) (*p
 	log.Printf("End Inspect volume: '%s'", ref)
 	return conv.ToPbVolume(*vol), nil
 }
+
+//Update extends and/or changes the speed of a volume
+func (s *VolumeServiceServer) Update(ctx context.Context, in *pb.VolumeUpdate) (*pb.Volume, error) {
+	log.Printf("Update Volume called")
+
+	ref := utils.GetReference(in.GetVolume())
+	if ref == "" {
+		return nil, fmt.Errorf("Neither name nor id given as reference")
+	}
+
+	if GetCurrentTenant() == nil {
+		return nil, fmt.Errorf("No tenant set")
+	}
+
+	var speed *VolumeSpeed.Enum
+	if in.GetSpeed() != "" {
+		value, ok := pb.VolumeSpeed_value[in.GetSpeed()]
+		if !ok {
+			return nil, fmt.Errorf("Invalid speed '%s'", in.GetSpeed())
+		}
+		vs := VolumeSpeed.Enum(value)
+		speed = &vs
+	}
+
+	service := services.NewVolumeService(currentTenant.client)
+	vol, err := service.Update(ref, int(in.GetSize()), speed)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Volume '%s' updated: %v", ref, vol)
+	return conv.ToPbVolume(*vol), nil
+}
@@ -39,15 +39,30 @@ broker tenant list
 broker tenant get ovh1
 broker tenant set ovh1
 
-broker network create net1 --cidr="192.145.0.0/16" --cpu=2 --ram=7 --disk=100 --os="Ubuntu 16.04" (par défault "192.168.0.0/24", on crée une gateway sur chaque réseau: gw_net1)
+broker network create net1 --cidr="192.145.0.0/16" --cpu=2 --ram=7 --disk=100 --os="Ubuntu 16.04" (par défault le CIDR est alloué dans le pool NetworkCIDRPool du tenant, "192.168.0.0/16" s'il n'est pas défini, on crée une gateway sur chaque réseau: gw_net1)
+broker network create net1 --ipv6-cidr="fd00:1::/64" (réseau double pile IPv4/IPv6, la gateway route aussi le trafic IPv6)
+broker network create net1 --ha (on crée une paire de gateways partageant une IP virtuelle: gw_net1 et gw_net1_2)
+broker network create net1 --gateway=router --bastion (le routeur du provider route le trafic sortant, pas de gateway, une VM bastion_net1 pour SSH; --gateway=none pour un réseau sans sortie)
 broker network list
 broker network delete net1
 broker network inspect net1
+broker network inspect net1 --format=dot | dot -Tpng > net1.png (topologie du réseau: gateways, VMs, NAS et règles de sécurité, au format json par défaut)
+broker network peer net1 net2 (le trafic est routé entre net1 et net2, les routes des gateways sont mises à jour)
+broker network unpeer net1 net2
+broker network dns list net1 (les VMs sont enregistrées automatiquement: vm1.net1.safescale)
+broker network dns add net1 www 192.168.0.12 --type=A (type A, AAAA ou CNAME, déduit de la valeur par défaut)
+broker network dns remove net1 www
+broker network vpn enable net1 --cidr="10.99.0.0/24" (WireGuard est installé sur la gateway, port UDP 51820, réseau des postes de travail par défaut "10.99.0.0/24")
+broker network vpn inspect net1
+broker network vpn config net1 --user=alice > alice.conf (le pair d'alice est créé si besoin, configuration à importer dans WireGuard)
+broker network vpn revoke net1 --user=alice (la configuration d'alice ne permet plus de se connecter)
+broker network vpn disable net1
 
 broker vm create vm1 --net="net1" --cpu=2 --ram=7 --disk=100 --os="Ubuntu 16.04" --public=true
 broker vm list
 broker vm inspect vm1
 broker vm create vm2 --net="net1" --cpu=2 --ram=7 --disk=100 --os="Ubuntu 16.04" --public=false
+broker vm create vm3 --net="net1,net2" (la VM est connectée aux deux réseaux, la route par défaut passe par la gateway de net1)
 
 broker ssh connect vm2
 broker ssh run vm2 -c "uname -a"
@@ -55,19 +70,41 @@ broker ssh copy /file/test.txt vm1://tmp
 broker ssh copy vm1:/file/test.txt /tmp
 
 broker volume create v1 --speed="SSD" --size=2000 (par default HDD, possible SSD, HDD, COLD)
-broker volume attach v1 vm1 --path="/shared/data" --format="xfs" (par default /shared/v1 et ext4)
+broker volume attach v1 vm1 --path="/shared/data" --format="xfs" (par default /shared/v1 et ext4, possible ext4, xfs, btrfs)
 broker volume detach v1
 broker volume delete v1
 broker volume inspect v1
 broker volume update v1 --speed="HDD" --size=1000
 
 broker container create c1
-broker container mount c1 vm1 --path="/shared/data" (utilisation de s3ql, par default /containers/c1)
+broker container mount c1 vm1 --path="/shared/data" --driver="rclone" (par default /containers/c1 et rclone, possible s3ql, rclone, s3fs, goofys)
 broker container umount c1 vm1
 broker container delete c1
 broker container list
 broker container inspect C1
 
+broker object put c1 ./file.txt --name="dir/file.txt" --metadata="key=value" --delete-at="2018-12-31T00:00:00Z" (par default le nom du fichier)
+broker object get c1 dir/file.txt --output="./file.txt" --range="0-99" (par default le nom de l'objet)
+broker object list c1 --prefix="dir/"
+broker object delete c1 dir/file.txt
+broker object copy c1 dir/file.txt dir/copy.txt
+broker object stat c1 dir/file.txt
+broker object sync ./dir c1:dir/ (ou c1:dir/ ./dir pour récupérer le contenu d'un conteneur)
+
+broker publicip create
+broker publicip list --all (par défaut seulement les IPs réservées avec broker publicip create)
+broker publicip inspect 1.2.3.4
+broker publicip attach 1.2.3.4 vm1
+broker publicip detach 1.2.3.4
+broker publicip delete 1.2.3.4
+
+broker lb create lb1 net1 --port=443 --protocol=https --check=/health (HTTPS est transmis tel quel aux backends; HAProxy sur les gateways si le provider n'a pas de load balancer)
+broker lb list
+broker lb inspect lb1
+broker lb add-backend lb1 vm1
+broker lb remove-backend lb1 vm1
+broker lb delete lb1
+
 broker nas create nas1 vm1 --path="/shared/data"
 broker nas delete nas1
 broker nas mount nas1 vm2 --path="/data"
@@ -93,7 +130,10 @@ func main() {
 	pb.RegisterVolumeServiceServer(s, &commands.VolumeServiceServer{})
 	pb.RegisterSshServiceServer(s, &commands.SSHServiceServer{})
 	pb.RegisterContainerServiceServer(s, &commands.ContainerServiceServer{})
+	pb.RegisterObjectServiceServer(s, &commands.ObjectServiceServer{})
 	pb.RegisterNasServiceServer(s, &commands.NasServiceServer{})
+	pb.RegisterPublicIPServiceServer(s, &commands.PublicIPServiceServer{})
+	pb.RegisterLoadBalancerServiceServer(s, &commands.LoadBalancerServiceServer{})
 
 	// log.Println("Initializing service factory")
 	// commands.InitServiceFactory()
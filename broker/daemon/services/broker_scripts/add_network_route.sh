@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# add_network_route.sh
+# Routes, on a gateway, the traffic to the peered network {{.CIDR}} through {{.NextHop}}
+# The routes are kept in /etc/safescale/peering_routes and restored at boot by the peering-routes service
+
+mkdir -p /etc/safescale
+touch /etc/safescale/peering_routes
+grep -q "^{{.CIDR}} {{.NextHop}}$" /etc/safescale/peering_routes || echo "{{.CIDR}} {{.NextHop}}" >> /etc/safescale/peering_routes
+
+# The traffic between the network and its peer enters and leaves the gateway by its private interface
+cat <<- 'EOF' > /sbin/peering-routes
+#!/bin/bash
+while read CIDR NEXTHOP; do
+    [ -z "${CIDR}" ] && continue
+    IF=$(ip -o route get ${NEXTHOP} | sed -n 's/.* dev \([^ ]*\).*/\1/p')
+    ip route replace ${CIDR} via ${NEXTHOP}
+    iptables -C FORWARD -i ${IF} -o ${IF} -d ${CIDR} -j ACCEPT 2>/dev/null || iptables -A FORWARD -i ${IF} -o ${IF} -d ${CIDR} -j ACCEPT
+    iptables -C FORWARD -i ${IF} -o ${IF} -s ${CIDR} -j ACCEPT 2>/dev/null || iptables -A FORWARD -i ${IF} -o ${IF} -s ${CIDR} -j ACCEPT
+done < /etc/safescale/peering_routes
+EOF
+chmod u+x /sbin/peering-routes
+
+if [ ! -f /etc/systemd/system/peering-routes.service ]; then
+    cat <<- EOF > /etc/systemd/system/peering-routes.service
+[Unit]
+Description=restore the routes to the peered networks
+After=network.target routing.service
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/sbin/peering-routes
+
+[Install]
+WantedBy=multi-user.target
+EOF
+    systemctl enable peering-routes
+fi
+
+/sbin/peering-routes
@@ -0,0 +1,41 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# common_tools.sh
+# Helpers included by the broker scripts needing them
+
+# install_packages installs the packages given as parameters, whatever the linux distribution
+install_packages() {
+    if which apt-get &>/dev/null; then
+        export DEBIAN_FRONTEND=noninteractive
+        apt-get update >/dev/null && apt-get install -qqy "$@" >/dev/null
+    elif which yum &>/dev/null; then
+        yum install -y "$@" >/dev/null
+    else
+        echo "Unsupported operating system" >&2
+        return 1
+    fi
+}
+
+# wait_cloud_init waits, 5 minutes at most, for cloud-init to finish configuring a VM just created, packages can't be installed meanwhile
+wait_cloud_init() {
+    for i in $(seq 60); do
+        [ -f /var/lib/cloud/instance/boot-finished ] && return 0
+        sleep 5
+    done
+    return 1
+}
@@ -0,0 +1,44 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# configure_dns_client.sh
+# Resolves the private DNS zone {{.Domain}} of the network of the VM with {{range .Nameservers}}{{.}} {{end}}
+# {{.Domain}} is added to the search domains so the VMs of the network are known by their name
+
+if systemctl is-active systemd-resolved &>/dev/null; then
+    mkdir -p /etc/systemd/resolved.conf.d
+    cat <<- 'EOF' > /etc/systemd/resolved.conf.d/safescale.conf
+[Resolve]
+DNS={{range .Nameservers}}{{.}} {{end}}
+Domains={{.Domain}}
+EOF
+    systemctl restart systemd-resolved
+elif [ -d /etc/resolvconf/resolv.conf.d ]; then
+    cat <<- 'EOF' > /etc/resolvconf/resolv.conf.d/head
+{{range .Nameservers}}nameserver {{.}}
+{{end -}}
+search {{.Domain}}
+EOF
+    resolvconf -u
+else
+    # resolv.conf is written by dhclient, the nameservers are prepended at each lease
+    grep -q "{{.Domain}}" /etc/dhcp/dhclient.conf 2>/dev/null || cat <<- 'EOF' >> /etc/dhcp/dhclient.conf
+prepend domain-name-servers {{range $i, $ns := .Nameservers}}{{if $i}}, {{end}}{{$ns}}{{end}};
+supersede domain-search "{{.Domain}}";
+EOF
+    grep -q "^search {{.Domain}}$" /etc/resolv.conf || sed -i '/^search/d;1i search {{.Domain}}{{range .Nameservers}}\nnameserver {{.}}{{end}}' /etc/resolv.conf
+fi
@@ -0,0 +1,48 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# configure_dnsmasq.sh
+# Serves with dnsmasq, on a gateway, the private DNS zone {{.Domain}} of its network
+# The other names are forwarded to the resolvers of the gateway
+# dnsmasq only listens on the private IPs of the gateway, the virtual IP may be held by the other gateway hence bind-dynamic
+
+{{template "common_tools.sh"}}
+
+mkdir -p /etc/safescale /etc/dnsmasq.d
+cat <<- 'EOF' > /etc/safescale/dns_hosts
+{{range .Hosts}}{{.}}
+{{end -}}
+EOF
+
+# The targets of the CNAME records must be names of the zone, dnsmasq does not resolve them from upstream
+cat <<- 'EOF' > /etc/dnsmasq.d/safescale.conf
+{{range .ListenIPs}}listen-address={{.}}
+{{end -}}
+bind-dynamic
+no-hosts
+addn-hosts=/etc/safescale/dns_hosts
+expand-hosts
+domain={{.Domain}}
+local=/{{.Domain}}/
+{{range .CNAMEs}}cname={{.}}
+{{end -}}
+EOF
+
+# The configuration is written first so dnsmasq doesn't listen on all the interfaces when it is started by its installation
+which dnsmasq &>/dev/null || { wait_cloud_init; install_packages dnsmasq; } || exit $?
+systemctl enable dnsmasq
+systemctl restart dnsmasq
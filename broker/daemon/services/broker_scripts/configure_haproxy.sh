@@ -0,0 +1,63 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# configure_haproxy.sh
+# Configures HAProxy on a gateway to balance the traffic of the load balancers of its network
+# HAProxy listens on the virtual IP of the gateways, which may be held by the other gateway, hence the non local bind
+
+{{template "common_tools.sh"}}
+
+{{if .Frontends}}
+which haproxy &>/dev/null || install_packages haproxy || exit $?
+
+echo "net.ipv4.ip_nonlocal_bind=1" > /etc/sysctl.d/90-haproxy.conf
+sysctl -p /etc/sysctl.d/90-haproxy.conf >/dev/null
+
+cat <<- 'EOF' > /etc/haproxy/haproxy.cfg
+global
+    log /dev/log local0
+    maxconn 4096
+    daemon
+
+defaults
+    log global
+    timeout connect 5s
+    timeout client 1m
+    timeout server 1m
+{{range $f := .Frontends}}
+listen {{$f.Name}}
+    bind {{$f.VIP}}:{{$f.Port}}
+    mode {{$f.Mode}}
+    balance roundrobin
+{{- if $f.HealthCheckPath}}
+    option httpchk GET {{$f.HealthCheckPath}}
+{{- end}}
+{{- range $id, $ip := $f.Backends}}
+    server {{$id}} {{$ip}}:{{$f.BackendPort}} {{$f.CheckOptions}}
+{{- end}}
+{{end}}
+EOF
+
+haproxy -c -f /etc/haproxy/haproxy.cfg >/dev/null || exit $?
+systemctl enable haproxy
+systemctl reload-or-restart haproxy
+{{else}}
+# No load balancer left in the network
+systemctl disable haproxy 2>/dev/null
+systemctl stop haproxy 2>/dev/null
+exit 0
+{{end}}
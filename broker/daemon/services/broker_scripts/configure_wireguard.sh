@@ -0,0 +1,60 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# configure_wireguard.sh
+# Configures WireGuard on a gateway to give access to its network to the peers of the VPN
+# The whole configuration is rewritten and WireGuard restarted each time a peer is added or revoked
+
+{{template "common_tools.sh"}}
+
+wait_cloud_init
+
+if ! which wg &>/dev/null; then
+    if which apt-get &>/dev/null; then
+        which add-apt-repository &>/dev/null || install_packages software-properties-common || exit $?
+        add-apt-repository -y ppa:wireguard/wireguard >/dev/null || exit $?
+        install_packages wireguard || exit $?
+    else
+        curl -sLo /etc/yum.repos.d/wireguard.repo https://copr.fedorainfracloud.org/coprs/jdoss/wireguard/repo/epel-7/jdoss-wireguard-epel-7.repo || exit $?
+        install_packages epel-release && install_packages wireguard-dkms wireguard-tools || exit $?
+    fi
+fi
+
+echo "net.ipv4.ip_forward=1" > /etc/sysctl.d/90-wireguard.conf
+sysctl -p /etc/sysctl.d/90-wireguard.conf >/dev/null
+
+mkdir -p /etc/wireguard
+chmod 700 /etc/wireguard
+umask 077
+# The traffic of the peers is masqueraded, the VMs reply to the gateway whatever their routes
+cat <<- 'EOF' > /etc/wireguard/wg0.conf
+[Interface]
+Address = {{.Address}}
+ListenPort = {{.Port}}
+PrivateKey = {{.PrivateKey}}
+PostUp = iptables -A FORWARD -i %i -j ACCEPT; iptables -A FORWARD -o %i -j ACCEPT; iptables -t nat -A POSTROUTING -s {{.CIDR}} ! -o %i -j MASQUERADE
+PostDown = iptables -D FORWARD -i %i -j ACCEPT; iptables -D FORWARD -o %i -j ACCEPT; iptables -t nat -D POSTROUTING -s {{.CIDR}} ! -o %i -j MASQUERADE
+{{range .Peers}}
+# {{.User}}
+[Peer]
+PublicKey = {{.PublicKey}}
+AllowedIPs = {{.IP}}/32
+{{end}}
+EOF
+
+systemctl enable wg-quick@wg0 >/dev/null 2>&1
+systemctl restart wg-quick@wg0
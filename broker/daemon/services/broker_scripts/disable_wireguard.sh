@@ -0,0 +1,24 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# disable_wireguard.sh
+# Stops WireGuard on a gateway and removes its configuration, the peers can't connect anymore
+
+systemctl disable wg-quick@wg0 >/dev/null 2>&1
+systemctl stop wg-quick@wg0
+rm -f /etc/wireguard/wg0.conf
+exit 0
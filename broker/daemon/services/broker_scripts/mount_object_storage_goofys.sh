@@ -0,0 +1,57 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# mount_object_storage_goofys.sh
+# Mounts a container with goofys, objects are exposed as plain files
+
+{{template "common_tools.sh"}}
+
+install_packages fuse curl || exit $?
+if ! which goofys &>/dev/null; then
+    curl -sL -o /usr/local/bin/goofys https://github.com/kahing/goofys/releases/latest/download/goofys || exit $?
+    chmod +x /usr/local/bin/goofys
+fi
+
+mkdir -p /etc/goofys
+
+# Create credentials file, using credentials restricted to object storage
+cat <<- EOF > /etc/goofys/{{.Container}}.credentials
+[default]
+aws_access_key_id = {{.AccessKey}}
+aws_secret_access_key = {{.SecretKey}}
+EOF
+chmod 0600 /etc/goofys/{{.Container}}.credentials
+
+# Create MountPoint
+mkdir -p {{.MountPoint}}
+
+# Create script to mount container
+cat <<- EOF > /usr/local/bin/mount-{{.Container}}
+#!/bin/bash
+sudo AWS_SHARED_CREDENTIALS_FILE=/etc/goofys/{{.Container}}.credentials goofys --endpoint {{.Endpoint}} --region {{.Region}} -o allow_other {{.Container}} {{.MountPoint}}
+EOF
+chmod +x /usr/local/bin/mount-{{.Container}}
+
+# Create script to umount container
+cat <<- EOF > /usr/local/bin/umount-{{.Container}}
+#!/bin/bash
+sudo fusermount -u {{.MountPoint}}
+sudo rm -f /etc/goofys/{{.Container}}.credentials
+EOF
+chmod +x /usr/local/bin/umount-{{.Container}}
+
+/usr/local/bin/mount-{{.Container}} || exit $?
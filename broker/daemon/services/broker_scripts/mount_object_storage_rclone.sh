@@ -0,0 +1,61 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# mount_object_storage_rclone.sh
+# Mounts a container with rclone, objects are exposed as plain files
+
+{{template "common_tools.sh"}}
+
+install_packages fuse curl unzip || exit $?
+if ! which rclone &>/dev/null; then
+    curl -s https://rclone.org/install.sh | bash >/dev/null || exit $?
+fi
+
+mkdir -p /etc/rclone
+
+# Create configuration file, using credentials restricted to object storage
+cat <<- EOF > /etc/rclone/{{.Container}}.conf
+[{{.Container}}]
+type = s3
+provider = Other
+env_auth = false
+access_key_id = {{.AccessKey}}
+secret_access_key = {{.SecretKey}}
+endpoint = {{.Endpoint}}
+region = {{.Region}}
+EOF
+chmod 0600 /etc/rclone/{{.Container}}.conf
+
+# Create MountPoint
+mkdir -p {{.MountPoint}}
+
+# Create script to mount container
+cat <<- EOF > /usr/local/bin/mount-{{.Container}}
+#!/bin/bash
+sudo rclone mount --config /etc/rclone/{{.Container}}.conf --allow-other --vfs-cache-mode writes --daemon {{.Container}}:{{.Container}} {{.MountPoint}}
+EOF
+chmod +x /usr/local/bin/mount-{{.Container}}
+
+# Create script to umount container
+cat <<- EOF > /usr/local/bin/umount-{{.Container}}
+#!/bin/bash
+sudo fusermount -u {{.MountPoint}}
+sudo rm -f /etc/rclone/{{.Container}}.conf
+EOF
+chmod +x /usr/local/bin/umount-{{.Container}}
+
+/usr/local/bin/mount-{{.Container}} || exit $?
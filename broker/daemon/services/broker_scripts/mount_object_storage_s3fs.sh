@@ -0,0 +1,47 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# mount_object_storage_s3fs.sh
+# Mounts a container with s3fs, objects are exposed as plain files
+
+{{template "common_tools.sh"}}
+
+install_packages s3fs fuse || exit $?
+
+# Create password file, using credentials restricted to object storage
+echo "{{.AccessKey}}:{{.SecretKey}}" > /etc/passwd-s3fs-{{.Container}}
+chmod 0600 /etc/passwd-s3fs-{{.Container}}
+
+# Create MountPoint
+mkdir -p {{.MountPoint}}
+
+# Create script to mount container
+cat <<- EOF > /usr/local/bin/mount-{{.Container}}
+#!/bin/bash
+sudo s3fs {{.Container}} {{.MountPoint}} -o passwd_file=/etc/passwd-s3fs-{{.Container}},url={{.Endpoint}},endpoint={{.Region}},use_path_request_style,allow_other
+EOF
+chmod +x /usr/local/bin/mount-{{.Container}}
+
+# Create script to umount container
+cat <<- EOF > /usr/local/bin/umount-{{.Container}}
+#!/bin/bash
+sudo fusermount -u {{.MountPoint}}
+sudo rm -f /etc/passwd-s3fs-{{.Container}}
+EOF
+chmod +x /usr/local/bin/umount-{{.Container}}
+
+/usr/local/bin/mount-{{.Container}} || exit $?
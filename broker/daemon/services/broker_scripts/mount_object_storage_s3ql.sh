@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# mount_object_storage_s3ql.sh
+# Mounts a container with s3ql
+# s3ql stores its own filesystem format in the container: objects are not readable by other S3/Swift clients
+
+{{template "common_tools.sh"}}
+
+install_packages s3ql || exit $?
+
+mkdir -p /etc/s3ql
+
+# Create auth file, using credentials restricted to object storage
+cat <<- EOF > /etc/s3ql/auth.{{.Container}}
+[s3c]
+storage-url: s3c://{{.EndpointHost}}/{{.Container}}
+backend-login: {{.AccessKey}}
+backend-password: {{.SecretKey}}
+EOF
+chmod 0600 /etc/s3ql/auth.{{.Container}}
+
+BACKEND_OPTIONS="{{if not .UseSSL}}--backend-options no-ssl{{end}}"
+
+# Format filesystem (without encryption) if the container doesn't contain one yet
+OUT=$(mkfs.s3ql --plain --quiet $BACKEND_OPTIONS --authfile /etc/s3ql/auth.{{.Container}} s3c://{{.EndpointHost}}/{{.Container}} 2>&1 </dev/null)
+if [ $? -ne 0 ] && ! echo "$OUT" | grep -q "existing file system"; then
+    echo "$OUT" >&2
+    exit 1
+fi
+
+# Create MountPoint
+mkdir -p {{.MountPoint}}
+
+# Create script to mount container
+cat <<- EOF > /usr/local/bin/mount-{{.Container}}
+#!/bin/bash
+sudo mount.s3ql --allow-other $BACKEND_OPTIONS --authfile /etc/s3ql/auth.{{.Container}} s3c://{{.EndpointHost}}/{{.Container}} {{.MountPoint}}
+EOF
+chmod +x /usr/local/bin/mount-{{.Container}}
+
+# Create script to umount container
+cat <<- EOF > /usr/local/bin/umount-{{.Container}}
+#!/bin/bash
+sudo umount.s3ql {{.MountPoint}}
+sudo rm -f /etc/s3ql/auth.{{.Container}}
+EOF
+chmod +x /usr/local/bin/umount-{{.Container}}
+
+/usr/local/bin/mount-{{.Container}} || exit $?
+chmod a+w {{.MountPoint}}
@@ -0,0 +1,29 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+#
+# remove_network_route.sh
+# Removes, on a gateway, the route to the peered network {{.CIDR}} through {{.NextHop}} set by add_network_route.sh
+
+[ -f /etc/safescale/peering_routes ] && sed -i "\#^{{.CIDR}} {{.NextHop}}\$#d" /etc/safescale/peering_routes
+
+IF=$(ip -o route get {{.NextHop}} | sed -n 's/.* dev \([^ ]*\).*/\1/p')
+ip route del {{.CIDR}} via {{.NextHop}} 2>/dev/null
+if [ ! -z "${IF}" ]; then
+    iptables -D FORWARD -i ${IF} -o ${IF} -d {{.CIDR}} -j ACCEPT 2>/dev/null
+    iptables -D FORWARD -i ${IF} -o ${IF} -s {{.CIDR}} -j ACCEPT 2>/dev/null
+fi
+exit 0
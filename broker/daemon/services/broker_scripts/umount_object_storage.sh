@@ -14,12 +14,11 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-/usr/local/bin/umount-{{.Container}}
-echo "umount : $?" > /tmp/umount.log
+#
+# umount_object_storage.sh
+# Unmounts a container whatever the driver used to mount it: the umount script generated
+# when mounting removes the configuration files specific to the driver
+
+/usr/local/bin/umount-{{.Container}} || exit $?
 
-rm /etc/s3ql/auth.{{.Container}}
-echo "rm auth : $?" >> /tmp/umount.log
-rm /usr/local/bin/mount-{{.Container}}
-echo "rm mount : $?" >> /tmp/umount.log
-rm /usr/local/bin/umount-{{.Container}}
-echo "rm umount : $?" >> /tmp/umount.log
+rm -f /usr/local/bin/mount-{{.Container}} /usr/local/bin/umount-{{.Container}}
@@ -17,8 +17,11 @@
 package services
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
-	"regexp"
+	"log"
+	"net/url"
 
 	"github.com/CS-SI/SafeScale/providers"
 	"github.com/CS-SI/SafeScale/providers/api"
@@ -30,10 +33,22 @@ type ContainerAPI interface {
 	Create(string) error
 	Delete(string) error
 	Inspect(string) (*api.ContainerInfo, error)
-	Mount(string, string, string) error
+	Mount(string, string, string, string) error
 	UMount(string, string) error
 }
 
+//DefaultContainerMountDriver is the driver used to mount a container when none is given
+const DefaultContainerMountDriver = "rclone"
+
+//containerMountDrivers associates each driver available to mount a container with its mount script
+//s3ql uses its own format in the container, the others expose objects as plain files
+var containerMountDrivers = map[string]string{
+	"s3ql":   "mount_object_storage_s3ql.sh",
+	"rclone": "mount_object_storage_rclone.sh",
+	"s3fs":   "mount_object_storage_s3fs.sh",
+	"goofys": "mount_object_storage_goofys.sh",
+}
+
 //NewContainerService creates a Container service
 func NewContainerService(api api.ClientAPI) ContainerAPI {
 	return &ContainerService{
@@ -70,8 +85,16 @@ func (srv *ContainerService) Inspect(name string) (*api.ContainerInfo, error) {
 	return srv.provider.GetContainer(name)
 }
 
-//Mount a container on a VM on the given mount point
-func (srv *ContainerService) Mount(containerName, vmName, path string) error {
+//Mount a container on a VM on the given mount point, using the given driver (rclone by default)
+func (srv *ContainerService) Mount(containerName, vmName, path, driver string) error {
+	if driver == "" {
+		driver = DefaultContainerMountDriver
+	}
+	script, ok := containerMountDrivers[driver]
+	if !ok {
+		return fmt.Errorf("Unsupported mount driver '%s'", driver)
+	}
+
 	// Check container existence
 	_, err := srv.Inspect(containerName)
 	if err != nil {
@@ -85,50 +108,71 @@ func (srv *ContainerService) Mount(containerName, vmName, path string) error {
 		return fmt.Errorf("No VM found with name or id '%s'", vmName)
 	}
 
+	cm, _ := srv.readContainerMount(containerName, vm.ID)
+	if cm != nil {
+		return fmt.Errorf("Container '%s' is already mounted on VM '%s'", containerName, vm.Name)
+	}
+
 	// Create mount point
 	mountPoint := path
 	if path == api.DefaultContainerMountPoint {
 		mountPoint = api.DefaultContainerMountPoint + containerName
 	}
 
-	authOpts, _ := srv.provider.GetAuthOpts()
-	authurlCfg, _ := authOpts.Config("AuthUrl")
-	authurl := authurlCfg.(string)
-	authurl = regexp.MustCompile("https?:/+(.*)/.*").FindStringSubmatch(authurl)[1]
-	tenantCfg, _ := authOpts.Config("TenantName")
-	tenant := tenantCfg.(string)
-	loginCfg, _ := authOpts.Config("Login")
-	login := loginCfg.(string)
-	passwordCfg, _ := authOpts.Config("Password")
-	password := passwordCfg.(string)
-	regionCfg, _ := authOpts.Config("Region")
-	region := regionCfg.(string)
-
-	cfgOpts, _ := srv.provider.GetCfgOpts()
-	objStorageProtocolCfg, _ := cfgOpts.Config("S3Protocol")
-	objStorageProtocol := objStorageProtocolCfg.(string)
+	// The account password is never sent to the VM, credentials restricted to the container are used instead
+	creds, err := srv.provider.CreateObjectStorageCredentials(containerName)
+	if err != nil {
+		return err
+	}
+	endpoint, err := url.Parse(creds.Endpoint)
+	if err != nil {
+		srv.provider.DeleteObjectStorageCredentials(creds.ID)
+		return fmt.Errorf("Invalid object storage endpoint '%s': %s", creds.Endpoint, err)
+	}
 
 	data := struct {
-		Container  string
-		Tenant     string
-		Login      string
-		Password   string
-		AuthURL    string
-		Region     string
-		MountPoint string
-		S3Protocol string
+		Container    string
+		MountPoint   string
+		Endpoint     string
+		EndpointHost string
+		UseSSL       bool
+		Region       string
+		AccessKey    string
+		SecretKey    string
 	}{
-		Container:  containerName,
-		Tenant:     tenant,
-		Login:      login,
-		Password:   password,
-		AuthURL:    authurl,
-		Region:     region,
-		MountPoint: mountPoint,
-		S3Protocol: objStorageProtocol,
+		Container:    containerName,
+		MountPoint:   mountPoint,
+		Endpoint:     creds.Endpoint,
+		EndpointHost: endpoint.Host,
+		UseSSL:       endpoint.Scheme == "https",
+		Region:       creds.Region,
+		AccessKey:    creds.AccessKey,
+		SecretKey:    creds.SecretKey,
 	}
 
-	return exec("mount_object_storage.sh", data, vm.ID, srv.provider)
+	err = exec(script, data, vm.ID, srv.provider)
+	if err != nil {
+		srv.provider.DeleteObjectStorageCredentials(creds.ID)
+		return err
+	}
+
+	err = srv.saveContainerMount(containerMount{
+		Container:     containerName,
+		VMID:          vm.ID,
+		MountPoint:    mountPoint,
+		Driver:        driver,
+		CredentialsID: creds.ID,
+	})
+	if err != nil {
+		// Without its metadata the mount could never be removed, so it is undone with its credentials
+		uerr := exec("umount_object_storage.sh", struct{ Container string }{Container: containerName}, vm.ID, srv.provider)
+		if uerr != nil {
+			log.Printf("Failed to unmount container '%s' from VM '%s': %s", containerName, vm.Name, uerr)
+		}
+		srv.provider.DeleteObjectStorageCredentials(creds.ID)
+		return err
+	}
+	return nil
 }
 
 //UMount a container
@@ -152,5 +196,67 @@ func (srv *ContainerService) UMount(containerName, vmName string) error {
 		Container: containerName,
 	}
 
-	return exec("umount_object_storage.sh", data, vm.ID, srv.provider)
+	err = exec("umount_object_storage.sh", data, vm.ID, srv.provider)
+	if err != nil {
+		return err
+	}
+
+	cm, err := srv.readContainerMount(containerName, vm.ID)
+	if err != nil {
+		log.Printf("No mount metadata found for container '%s' on VM '%s': %s", containerName, vm.Name, err)
+		return nil
+	}
+	if cm.CredentialsID != "" {
+		err = srv.provider.DeleteObjectStorageCredentials(cm.CredentialsID)
+		if err != nil {
+			log.Printf("Failed to revoke object storage credentials of container '%s' mount: %s", containerName, err)
+		}
+	}
+	return srv.removeContainerMount(containerName, vm.ID)
+}
+
+//containerMount describes the mount of a container on a VM
+type containerMount struct {
+	Container     string
+	VMID          string
+	MountPoint    string
+	Driver        string
+	CredentialsID string
+}
+
+func (srv *ContainerService) saveContainerMount(cm containerMount) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(cm)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s/%s", cm.Container, cm.VMID)
+	log.Printf("Saving container mount: %s", name)
+	return srv.provider.PutObject(api.MountContainerName, api.Object{
+		Name:    name,
+		Content: bytes.NewReader(buffer.Bytes()),
+	})
+}
+
+func (srv *ContainerService) removeContainerMount(containerName string, vmID string) error {
+	name := fmt.Sprintf("%s/%s", containerName, vmID)
+	log.Printf("Removing container mount: %s", name)
+	return srv.provider.DeleteObject(api.MountContainerName, name)
+}
+
+func (srv *ContainerService) readContainerMount(containerName string, vmID string) (*containerMount, error) {
+	o, err := srv.provider.GetObject(api.MountContainerName, fmt.Sprintf("%s/%s", containerName, vmID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	dec := gob.NewDecoder(&buffer)
+	var cm containerMount
+	err = dec.Decode(&cm)
+	if err != nil {
+		return nil, err
+	}
+	return &cm, nil
 }
@@ -0,0 +1,493 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
+	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
+)
+
+//DNSDomain is the parent domain of the private DNS zones of the networks
+const DNSDomain = "safescale"
+
+//DNSAPI defines API to manage the records of the private DNS zones of the networks
+type DNSAPI interface {
+	List(net string) ([]api.DNSRecord, error)
+	Add(net string, record api.DNSRecord) error
+	Remove(net string, name string, value string) error
+}
+
+//NewDNSService creates a DNS service
+func NewDNSService(api api.ClientAPI) DNSAPI {
+	return newDNSService(providers.FromClient(api))
+}
+
+func newDNSService(provider *providers.Service) *DNSService {
+	return &DNSService{
+		provider: provider,
+	}
+}
+
+//DNSService private DNS service
+//The zone <network>.safescale of a network is served by the DNS service of the provider when available,
+//otherwise by dnsmasq on the gateways of the network
+type DNSService struct {
+	provider *providers.Service
+}
+
+//zoneLock serializes the updates of the zones, which are read then written in metadata
+var zoneLock sync.Mutex
+
+var invalidLabelChars = regexp.MustCompile("[^a-z0-9-]+")
+
+//dnsLabel converts name into a valid DNS label
+func dnsLabel(name string) string {
+	return strings.Trim(invalidLabelChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+//recordType returns the type of the record of value: A or AAAA for an IP, CNAME otherwise
+func recordType(value string) string {
+	if net.ParseIP(value) == nil {
+		return "CNAME"
+	}
+	if IPVersion.IPv6.Is(value) {
+		return "AAAA"
+	}
+	return "A"
+}
+
+//List returns the records of the private DNS zone of the network referenced by net
+func (srv *DNSService) List(net string) ([]api.DNSRecord, error) {
+	n, err := NewNetworkService(srv.provider).Get(net)
+	if err != nil {
+		return nil, err
+	}
+	zone, err := srv.getZone(n, false)
+	if err != nil || zone == nil {
+		return nil, err
+	}
+	return zone.Records, nil
+}
+
+//Add adds record to the private DNS zone of the network referenced by net
+//The type of the record is deduced from its value if it is empty
+func (srv *DNSService) Add(net string, record api.DNSRecord) error {
+	record.Name = dnsLabel(record.Name)
+	if record.Name == "" || record.Value == "" {
+		return fmt.Errorf("A DNS record requires a name and a value")
+	}
+	if record.Type == "" {
+		record.Type = recordType(record.Value)
+	}
+	record.Type = strings.ToUpper(record.Type)
+	if record.Type != recordType(record.Value) {
+		return fmt.Errorf("Invalid value '%s' for a DNS record of type %s", record.Value, record.Type)
+	}
+	record.VMID = ""
+	n, err := NewNetworkService(srv.provider).Get(net)
+	if err != nil {
+		return err
+	}
+	zoneLock.Lock()
+	defer zoneLock.Unlock()
+
+	zone, err := srv.getZone(n, true)
+	if err != nil {
+		return err
+	}
+	for _, r := range zone.Records {
+		if r.Name == record.Name && r.Type == record.Type && r.Value == record.Value {
+			return fmt.Errorf("DNS record %s %s %s already exists", r.Name, r.Type, r.Value)
+		}
+	}
+	return srv.addRecords(zone, record)
+}
+
+//Remove removes the records named name from the private DNS zone of the network referenced by net
+//Only the record of value is removed if value is not empty, the records of the VMs can't be removed
+func (srv *DNSService) Remove(net string, name string, value string) error {
+	n, err := NewNetworkService(srv.provider).Get(net)
+	if err != nil {
+		return err
+	}
+	zoneLock.Lock()
+	defer zoneLock.Unlock()
+
+	zone, err := srv.getZone(n, false)
+	if err != nil {
+		return err
+	}
+	if zone == nil {
+		return fmt.Errorf("Network %s has no DNS zone", n.Name)
+	}
+	name = dnsLabel(name)
+	found, err := srv.removeRecords(zone, func(r api.DNSRecord) bool {
+		return r.VMID == "" && r.Name == name && (value == "" || r.Value == value)
+	})
+	if err == nil && !found {
+		return fmt.Errorf("No DNS record %s in network %s", name, n.Name)
+	}
+	return err
+}
+
+//getZone returns the private DNS zone of the network n, which is created if create is true and the zone does not exist
+//A nil zone is returned if the zone does not exist and create is false
+func (srv *DNSService) getZone(n *api.Network, create bool) (*api.DNSZone, error) {
+	names, err := srv.provider.ListObjects(api.DNSContainerName, api.ObjectFilter{
+		Prefix: n.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if name == n.ID {
+			return srv.readZone(n.ID)
+		}
+	}
+	if !create {
+		return nil, nil
+	}
+	return srv.createZone(n)
+}
+
+//createZone creates the private DNS zone of the network n, with the record gw of its gateway
+func (srv *DNSService) createZone(n *api.Network) (*api.DNSZone, error) {
+	domain := dnsLabel(n.Name) + "." + DNSDomain
+	zone, err := srv.provider.CreateDNSZone(n.ID, domain)
+	if _, ok := err.(*api.NotAvailableError); ok {
+		log.Printf("%s, the zone %s is served by the gateways of network %s", err.Error(), domain, n.Name)
+		zone, err = srv.createGatewayZone(n, domain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []api.DNSRecord
+	ip, err := srv.gatewayIP(n)
+	if err == nil && ip != "" {
+		records = append(records, api.DNSRecord{Name: "gw", Type: recordType(ip), Value: ip})
+	}
+	err = srv.addRecords(zone, records...)
+	if err != nil {
+		srv.deleteZone(zone)
+		return nil, err
+	}
+	return zone, nil
+}
+
+//gatewayIP returns the IP of the gateway of the network n, the virtual IP of the gateways in high availability
+//An empty IP is returned if the network has no gateway VM
+func (srv *DNSService) gatewayIP(n *api.Network) (string, error) {
+	gw, err := srv.provider.GetGateway(n.ID)
+	if err != nil {
+		return "", err
+	}
+	if gw.Mode != GatewayMode.VM || len(gw.VMIDs) == 0 {
+		return "", nil
+	}
+	if gw.VIP != "" {
+		return gw.VIP, nil
+	}
+	vm, err := srv.provider.GetVM(gw.VMIDs[0])
+	if err != nil {
+		return "", err
+	}
+	return networkIP(vm, n.CIDR), nil
+}
+
+//createGatewayZone creates the zone domain of the network n served by dnsmasq on its gateways
+func (srv *DNSService) createGatewayZone(n *api.Network, domain string) (*api.DNSZone, error) {
+	gw, err := srv.provider.GetGateway(n.ID)
+	if err != nil {
+		return nil, err
+	}
+	if gw.Mode != GatewayMode.VM || len(gw.VMIDs) == 0 {
+		return nil, fmt.Errorf("Error creating DNS zone: the provider has no DNS service and the network has no gateway to run dnsmasq")
+	}
+	ip, err := srv.gatewayIP(n)
+	if err != nil {
+		return nil, err
+	}
+	return &api.DNSZone{
+		NetworkID:    n.ID,
+		Domain:       domain,
+		Nameservers:  []string{ip},
+		GatewayVMIDs: gw.VMIDs,
+	}, nil
+}
+
+//addRecords adds records to zone, in the DNS service of the provider or in the configuration of dnsmasq, and saves zone
+func (srv *DNSService) addRecords(zone *api.DNSZone, records ...api.DNSRecord) error {
+	for _, r := range records {
+		if zone.ID != "" {
+			err := srv.provider.AddDNSRecord(zone.ID, r)
+			if err != nil {
+				return err
+			}
+		}
+		zone.Records = append(zone.Records, r)
+	}
+	if len(zone.GatewayVMIDs) > 0 {
+		err := srv.configureDnsmasq(zone)
+		if err != nil {
+			return err
+		}
+	}
+	return srv.saveZone(*zone)
+}
+
+//removeRecords removes the records of zone matched by match and saves zone, returns true if a record has been removed
+func (srv *DNSService) removeRecords(zone *api.DNSZone, match func(api.DNSRecord) bool) (bool, error) {
+	var records []api.DNSRecord
+	found := false
+	for _, r := range zone.Records {
+		if !match(r) {
+			records = append(records, r)
+			continue
+		}
+		found = true
+		if zone.ID != "" {
+			err := srv.provider.RemoveDNSRecord(zone.ID, r)
+			if err != nil {
+				return found, err
+			}
+		}
+	}
+	if !found {
+		return false, nil
+	}
+	zone.Records = records
+	if len(zone.GatewayVMIDs) > 0 {
+		err := srv.configureDnsmasq(zone)
+		if err != nil {
+			return found, err
+		}
+	}
+	return found, srv.saveZone(*zone)
+}
+
+//configureDnsmasq writes the records of zone in the configuration of dnsmasq on the gateways of the zone
+func (srv *DNSService) configureDnsmasq(zone *api.DNSZone) error {
+	n, err := srv.provider.GetNetwork(zone.NetworkID)
+	if err != nil {
+		return err
+	}
+	var hosts, cnames []string
+	for _, r := range zone.Records {
+		switch r.Type {
+		case "CNAME":
+			target := r.Value
+			if !strings.Contains(target, ".") {
+				target = target + "." + zone.Domain
+			}
+			cnames = append(cnames, fmt.Sprintf("%s.%s,%s", r.Name, zone.Domain, target))
+		default:
+			hosts = append(hosts, fmt.Sprintf("%s %s", r.Value, r.Name))
+		}
+	}
+	for _, id := range zone.GatewayVMIDs {
+		vm, err := srv.provider.GetVM(id)
+		if err != nil {
+			return err
+		}
+		listenIPs := []string{networkIP(vm, n.CIDR)}
+		for _, ns := range zone.Nameservers {
+			if ns != listenIPs[0] {
+				listenIPs = append(listenIPs, ns)
+			}
+		}
+		data := struct {
+			Domain    string
+			ListenIPs []string
+			Hosts     []string
+			CNAMEs    []string
+		}{
+			Domain:    zone.Domain,
+			ListenIPs: listenIPs,
+			Hosts:     hosts,
+			CNAMEs:    cnames,
+		}
+		err = srv.waitSSH(id)
+		if err != nil {
+			return err
+		}
+		err = exec("configure_dnsmasq.sh", data, id, srv.provider)
+		if err != nil {
+			return fmt.Errorf("Error configuring dnsmasq on gateway %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+//waitSSH waits for the SSH server of the VM identified by vmID, which may have just been created
+func (srv *DNSService) waitSSH(vmID string) error {
+	ssh, err := srv.provider.GetSSHConfig(vmID)
+	if err != nil {
+		return err
+	}
+	return ssh.WaitServerReady(2 * time.Minute)
+}
+
+//registerVM adds the records of vm to the zones of the networks identified by networkIDs
+//vm resolves the zone of the first network, which provides its default route
+func (srv *DNSService) registerVM(vm *api.VM, networkIDs []string) error {
+	for i, id := range networkIDs {
+		n, err := srv.provider.GetNetwork(id)
+		if err != nil {
+			return err
+		}
+		zone, err := srv.addVMRecords(vm, n)
+		if err != nil {
+			return err
+		}
+		if i > 0 || len(zone.Nameservers) == 0 {
+			continue
+		}
+		err = srv.waitSSH(vm.ID)
+		if err != nil {
+			return err
+		}
+		data := struct {
+			Domain      string
+			Nameservers []string
+		}{
+			Domain:      zone.Domain,
+			Nameservers: zone.Nameservers,
+		}
+		err = exec("configure_dns_client.sh", data, vm.ID, srv.provider)
+		if err != nil {
+			return fmt.Errorf("Error configuring the resolver of VM %s: %v", vm.Name, err)
+		}
+	}
+	return nil
+}
+
+//addVMRecords adds the records of vm to the zone of the network n and returns the zone
+func (srv *DNSService) addVMRecords(vm *api.VM, n *api.Network) (*api.DNSZone, error) {
+	zoneLock.Lock()
+	defer zoneLock.Unlock()
+
+	zone, err := srv.getZone(n, true)
+	if err != nil {
+		return nil, err
+	}
+	ips := []string{networkIP(vm, n.CIDR)}
+	// A VM of a dual-stack network has an AAAA record too
+	if n.IPv6CIDR != "" {
+		if ip := networkIP(vm, n.IPv6CIDR); IPVersion.IPv6.Is(ip) {
+			ips = append(ips, ip)
+		}
+	}
+	var records []api.DNSRecord
+	for _, ip := range ips {
+		records = append(records, api.DNSRecord{
+			Name:  dnsLabel(vm.Name),
+			Type:  recordType(ip),
+			Value: ip,
+			VMID:  vm.ID,
+		})
+	}
+	return zone, srv.addRecords(zone, records...)
+}
+
+//unregisterVM removes the records of the VM identified by vmID from the zones of all the networks
+func (srv *DNSService) unregisterVM(vmID string) error {
+	zoneLock.Lock()
+	defer zoneLock.Unlock()
+
+	ids, err := srv.provider.ListObjects(api.DNSContainerName, api.ObjectFilter{})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		zone, err := srv.readZone(id)
+		if err != nil {
+			return err
+		}
+		_, err = srv.removeRecords(zone, func(r api.DNSRecord) bool {
+			return r.VMID == vmID
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//deleteNetworkZone deletes the private DNS zone of the network identified by networkID if it has one
+func (srv *DNSService) deleteNetworkZone(networkID string) error {
+	zoneLock.Lock()
+	defer zoneLock.Unlock()
+
+	zone, err := srv.readZone(networkID)
+	if err != nil {
+		// Networks created before private DNS have no zone
+		return nil
+	}
+	return srv.deleteZone(zone)
+}
+
+//deleteZone deletes zone from the DNS service of the provider, the gateways are deleted with the network
+func (srv *DNSService) deleteZone(zone *api.DNSZone) error {
+	if zone.ID != "" {
+		err := srv.provider.DeleteDNSZone(zone.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return srv.provider.DeleteObject(api.DNSContainerName, zone.NetworkID)
+}
+
+func (srv *DNSService) saveZone(zone api.DNSZone) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(zone)
+	if err != nil {
+		return err
+	}
+	return srv.provider.PutObject(api.DNSContainerName, api.Object{
+		Name:    zone.NetworkID,
+		Content: bytes.NewReader(buffer.Bytes()),
+	})
+}
+
+func (srv *DNSService) readZone(networkID string) (*api.DNSZone, error) {
+	o, err := srv.provider.GetObject(api.DNSContainerName, networkID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	dec := gob.NewDecoder(&buffer)
+	var zone api.DNSZone
+	err = dec.Decode(&zone)
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
@@ -0,0 +1,405 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
+	"github.com/CS-SI/SafeScale/providers/api/LBProtocol"
+	uuid "github.com/satori/go.uuid"
+)
+
+//LoadBalancerAPI defines API to manipulate load balancers
+type LoadBalancerAPI interface {
+	Create(name string, net string, protocol LBProtocol.Enum, port int, backendPort int, healthCheckPath string) (*api.LoadBalancer, error)
+	List() ([]api.LoadBalancer, error)
+	Get(ref string) (*api.LoadBalancer, error)
+	AddBackend(ref string, vm string) error
+	RemoveBackend(ref string, vm string) error
+	Delete(ref string) error
+}
+
+//NewLoadBalancerService creates a load balancer service
+func NewLoadBalancerService(api api.ClientAPI) LoadBalancerAPI {
+	return &LoadBalancerService{
+		provider:  providers.FromClient(api),
+		network:   NewNetworkService(api),
+		vmService: NewVMService(api),
+	}
+}
+
+//LoadBalancerService load balancer service
+//The load balancers of the provider are used when available, otherwise HAProxy is deployed on the gateways of the network
+type LoadBalancerService struct {
+	provider  *providers.Service
+	network   NetworkAPI
+	vmService VMAPI
+}
+
+//Create creates a load balancer receiving the traffic of the network referenced by net on port and balancing it on backendPort of its backends
+//If healthCheckPath is not empty the backends are checked with HTTP requests on it, otherwise with TCP connections
+func (srv *LoadBalancerService) Create(name string, net string, protocol LBProtocol.Enum, port int, backendPort int, healthCheckPath string) (*api.LoadBalancer, error) {
+	if _, err := srv.Get(name); err == nil {
+		return nil, fmt.Errorf("Load balancer %s already exists", name)
+	}
+	n, err := srv.network.Get(net)
+	if err != nil {
+		return nil, err
+	}
+	if backendPort == 0 {
+		backendPort = port
+	}
+	req := api.LoadBalancerRequest{
+		Name:            name,
+		NetworkID:       n.ID,
+		Protocol:        protocol,
+		Port:            port,
+		BackendPort:     backendPort,
+		HealthCheckPath: healthCheckPath,
+	}
+	lb, err := srv.provider.CreateLoadBalancer(req)
+	if _, ok := err.(*api.NotAvailableError); ok {
+		log.Printf("%s, deploying HAProxy on the gateways of network %s", err.Error(), n.Name)
+		lb, err = srv.createHAProxy(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Only the definition saved by SafeScale keeps the request of the load balancer whatever the provider
+	lb.Protocol = protocol
+	lb.Port = port
+	lb.BackendPort = backendPort
+	lb.HealthCheckPath = healthCheckPath
+	err = srv.saveLoadBalancer(*lb)
+	if err != nil {
+		srv.delete(lb)
+		return nil, err
+	}
+	return lb, nil
+}
+
+//createHAProxy creates a load balancer run by HAProxy on the gateways of the network req.NetworkID
+//The load balancer receives the traffic on the virtual IP of the gateways in high availability
+func (srv *LoadBalancerService) createHAProxy(req api.LoadBalancerRequest) (*api.LoadBalancer, error) {
+	gw, err := srv.provider.GetGateway(req.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	if gw.Mode != GatewayMode.VM || len(gw.VMIDs) == 0 {
+		return nil, fmt.Errorf("Error creating load balancer: the provider has no load balancer and the network has no gateway to run HAProxy")
+	}
+	lbs, err := srv.listNetworkLoadBalancers(req.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	for _, lb := range lbs {
+		if lb.Port == req.Port {
+			return nil, fmt.Errorf("Error creating load balancer: port %d is already used by load balancer %s", req.Port, lb.Name)
+		}
+	}
+	vip := gw.VIP
+	if vip == "" {
+		n, err := srv.network.Get(req.NetworkID)
+		if err != nil {
+			return nil, err
+		}
+		gwVM, err := srv.provider.GetVM(gw.VMIDs[0])
+		if err != nil {
+			return nil, err
+		}
+		vip = networkIP(gwVM, n.CIDR)
+	}
+	id, _ := uuid.NewV4()
+	lb := api.LoadBalancer{
+		ID:              id.String(),
+		Name:            req.Name,
+		NetworkID:       req.NetworkID,
+		Protocol:        req.Protocol,
+		Port:            req.Port,
+		BackendPort:     req.BackendPort,
+		HealthCheckPath: req.HealthCheckPath,
+		VIP:             vip,
+		Backends:        map[string]string{},
+		GatewayVMIDs:    gw.VMIDs,
+	}
+	err = srv.configureHAProxy(lb.NetworkID, lb.GatewayVMIDs, append(lbs, lb))
+	if err != nil {
+		return nil, err
+	}
+	return &lb, nil
+}
+
+//haproxyFrontend is the configuration of a load balancer given to configure_haproxy.sh
+type haproxyFrontend struct {
+	Name            string
+	VIP             string
+	Port            int
+	BackendPort     int
+	Mode            string
+	HealthCheckPath string
+	CheckOptions    string
+	Backends        map[string]string
+}
+
+//toHAProxyFrontend converts a load balancer into its HAProxy configuration
+//HTTPS traffic is balanced in TCP mode to pass TLS through to the backends
+func toHAProxyFrontend(lb api.LoadBalancer) haproxyFrontend {
+	f := haproxyFrontend{
+		Name:            lb.Name,
+		VIP:             lb.VIP,
+		Port:            lb.Port,
+		BackendPort:     lb.BackendPort,
+		Mode:            "tcp",
+		HealthCheckPath: lb.HealthCheckPath,
+		CheckOptions:    "check inter 5s fall 3 rise 2",
+		Backends:        lb.Backends,
+	}
+	if lb.Protocol == LBProtocol.HTTP {
+		f.Mode = "http"
+	}
+	if lb.Protocol == LBProtocol.HTTPS && lb.HealthCheckPath != "" {
+		f.CheckOptions += " check-ssl verify none"
+	}
+	if lb.Protocol == LBProtocol.TCP {
+		f.HealthCheckPath = ""
+	}
+	return f
+}
+
+//configureHAProxy configures HAProxy on the gateways gwVMIDs of the network identified by networkID to run lbs
+//HAProxy is stopped if lbs is empty
+func (srv *LoadBalancerService) configureHAProxy(networkID string, gwVMIDs []string, lbs []api.LoadBalancer) error {
+	var frontends []haproxyFrontend
+	for _, lb := range lbs {
+		frontends = append(frontends, toHAProxyFrontend(lb))
+	}
+	data := struct {
+		Frontends []haproxyFrontend
+	}{
+		Frontends: frontends,
+	}
+	for _, id := range gwVMIDs {
+		err := exec("configure_haproxy.sh", data, id, srv.provider)
+		if err != nil {
+			return fmt.Errorf("Error configuring HAProxy on gateway %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+//reconfigure applies the load balancers of the network of lb, with lb as it is now, to HAProxy if lb is run by HAProxy
+func (srv *LoadBalancerService) reconfigure(lb *api.LoadBalancer, deleted bool) error {
+	if len(lb.GatewayVMIDs) == 0 {
+		return nil
+	}
+	lbs, err := srv.listNetworkLoadBalancers(lb.NetworkID)
+	if err != nil {
+		return err
+	}
+	var list []api.LoadBalancer
+	for _, l := range lbs {
+		if l.ID != lb.ID {
+			list = append(list, l)
+		}
+	}
+	if !deleted {
+		list = append(list, *lb)
+	}
+	return srv.configureHAProxy(lb.NetworkID, lb.GatewayVMIDs, list)
+}
+
+//networkIP returns the private IP of vm in the network cidr
+func networkIP(vm *api.VM, cidr string) string {
+	_, n, err := net.ParseCIDR(cidr)
+	if err == nil {
+		for _, ip := range append(vm.PrivateIPsV4, vm.PrivateIPsV6...) {
+			if n.Contains(net.ParseIP(ip)) {
+				return ip
+			}
+		}
+	}
+	if len(vm.PrivateIPsV4) > 0 {
+		return vm.PrivateIPsV4[0]
+	}
+	return ""
+}
+
+//List returns the load balancers of the tenant
+func (srv *LoadBalancerService) List() ([]api.LoadBalancer, error) {
+	names, err := srv.provider.ListObjects(api.LoadBalancerContainerName, api.ObjectFilter{})
+	if err != nil {
+		return nil, err
+	}
+	var lbs []api.LoadBalancer
+	for _, name := range names {
+		lb, err := srv.readLoadBalancer(name)
+		if err != nil {
+			return nil, err
+		}
+		lbs = append(lbs, *lb)
+	}
+	return lbs, nil
+}
+
+//listNetworkLoadBalancers returns the load balancers of the network identified by networkID
+func (srv *LoadBalancerService) listNetworkLoadBalancers(networkID string) ([]api.LoadBalancer, error) {
+	lbs, err := srv.List()
+	if err != nil {
+		return nil, err
+	}
+	var list []api.LoadBalancer
+	for _, lb := range lbs {
+		if lb.NetworkID == networkID && len(lb.GatewayVMIDs) > 0 {
+			list = append(list, lb)
+		}
+	}
+	return list, nil
+}
+
+//Get returns the load balancer referenced by ref, ref can be the name or the id
+func (srv *LoadBalancerService) Get(ref string) (*api.LoadBalancer, error) {
+	lbs, err := srv.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, lb := range lbs {
+		if lb.ID == ref || lb.Name == ref {
+			return &lb, nil
+		}
+	}
+	return nil, providers.ResourceNotFoundError("load balancer", ref)
+}
+
+//AddBackend adds the VM referenced by vm to the backends of the load balancer referenced by ref
+func (srv *LoadBalancerService) AddBackend(ref string, vm string) error {
+	lb, err := srv.Get(ref)
+	if err != nil {
+		return err
+	}
+	_vm, err := srv.vmService.Get(vm)
+	if err != nil {
+		return err
+	}
+	if _, ok := lb.Backends[_vm.ID]; ok {
+		return fmt.Errorf("VM %s is already a backend of load balancer %s", _vm.Name, lb.Name)
+	}
+	n, err := srv.network.Get(lb.NetworkID)
+	if err != nil {
+		return err
+	}
+	ip := networkIP(_vm, n.CIDR)
+	if lb.Backends == nil {
+		lb.Backends = map[string]string{}
+	}
+	lb.Backends[_vm.ID] = ip
+	if len(lb.GatewayVMIDs) > 0 {
+		err = srv.reconfigure(lb, false)
+	} else {
+		err = srv.provider.AddLoadBalancerBackend(lb.ID, _vm.ID, ip, lb.BackendPort)
+	}
+	if err != nil {
+		return err
+	}
+	return srv.saveLoadBalancer(*lb)
+}
+
+//RemoveBackend removes the VM referenced by vm from the backends of the load balancer referenced by ref
+func (srv *LoadBalancerService) RemoveBackend(ref string, vm string) error {
+	lb, err := srv.Get(ref)
+	if err != nil {
+		return err
+	}
+	// The VM may have been deleted, so it is looked for in the backends first
+	vmID := vm
+	if _, ok := lb.Backends[vmID]; !ok {
+		_vm, err := srv.vmService.Get(vm)
+		if err != nil {
+			return err
+		}
+		vmID = _vm.ID
+	}
+	if _, ok := lb.Backends[vmID]; !ok {
+		return fmt.Errorf("VM %s is not a backend of load balancer %s", vm, lb.Name)
+	}
+	delete(lb.Backends, vmID)
+	if len(lb.GatewayVMIDs) > 0 {
+		err = srv.reconfigure(lb, false)
+	} else {
+		err = srv.provider.RemoveLoadBalancerBackend(lb.ID, vmID)
+	}
+	if err != nil {
+		return err
+	}
+	return srv.saveLoadBalancer(*lb)
+}
+
+//Delete deletes the load balancer referenced by ref
+func (srv *LoadBalancerService) Delete(ref string) error {
+	lb, err := srv.Get(ref)
+	if err != nil {
+		return err
+	}
+	err = srv.delete(lb)
+	if err != nil {
+		return err
+	}
+	return srv.provider.DeleteObject(api.LoadBalancerContainerName, lb.ID)
+}
+
+//delete deletes the provider load balancer or the HAProxy configuration of lb
+func (srv *LoadBalancerService) delete(lb *api.LoadBalancer) error {
+	if len(lb.GatewayVMIDs) > 0 {
+		return srv.reconfigure(lb, true)
+	}
+	return srv.provider.DeleteLoadBalancer(lb.ID)
+}
+
+func (srv *LoadBalancerService) saveLoadBalancer(lb api.LoadBalancer) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(lb)
+	if err != nil {
+		return err
+	}
+	return srv.provider.PutObject(api.LoadBalancerContainerName, api.Object{
+		Name:    lb.ID,
+		Content: bytes.NewReader(buffer.Bytes()),
+	})
+}
+
+func (srv *LoadBalancerService) readLoadBalancer(id string) (*api.LoadBalancer, error) {
+	o, err := srv.provider.GetObject(api.LoadBalancerContainerName, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	dec := gob.NewDecoder(&buffer)
+	var lb api.LoadBalancer
+	err = dec.Decode(&lb)
+	if err != nil {
+		return nil, err
+	}
+	return &lb, nil
+}
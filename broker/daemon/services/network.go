@@ -17,20 +17,41 @@
 package services
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
 	"fmt"
+	"log"
+	"net"
+	"path"
 	"strings"
+	"sync"
 
 	"github.com/CS-SI/SafeScale/providers"
 	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
 )
 
+const (
+	//DefaultNetworkCIDRPool is the range the CIDRs of the networks are allocated from when the tenant defines no NetworkCIDRPool
+	DefaultNetworkCIDRPool = "192.168.0.0/16"
+	//NetworkCIDRPrefixLength is the prefix length of the CIDRs allocated to the networks
+	NetworkCIDRPrefixLength = 24
+)
+
+//cidrLock serializes the reservations of the ranges of the networks, which are read then written in metadata
+var cidrLock sync.Mutex
+
 //NetworkAPI defines API to manage networks
 type NetworkAPI interface {
-	Create(net string, cidr string, ipVersion IPVersion.Enum, cpu int, ram float32, disk int, os string) (*api.Network, error)
+	Create(net string, cidr string, ipVersion IPVersion.Enum, ipv6CIDR string, cpu int, ram float32, disk int, os string, ha bool, mode GatewayMode.Enum, bastion bool) (*api.Network, error)
 	List(all bool) ([]api.Network, error)
 	Get(ref string) (*api.Network, error)
+	Topology(ref string) (*api.NetworkTopology, error)
 	Delete(ref string) error
+	Peer(ref1 string, ref2 string) (*api.NetworkPeering, error)
+	Unpeer(ref1 string, ref2 string) error
 }
 
 //NetworkService an instance of NetworkAPI
@@ -46,8 +67,33 @@ func NewNetworkService(api api.ClientAPI) NetworkAPI {
 	}
 }
 
-//Create creates a network
-func (srv *NetworkService) Create(net string, cidr string, ipVersion IPVersion.Enum, cpu int, ram float32, disk int, os string) (*api.Network, error) {
+//isIPv6CIDR tells if cidr is an IPv6 /64 network in CIDR notation
+func isIPv6CIDR(cidr string) bool {
+	ip, n, err := net.ParseCIDR(cidr)
+	if err != nil || !IPVersion.IPv6.Is(ip.String()) {
+		return false
+	}
+	ones, _ := n.Mask.Size()
+	return ones == 64
+}
+
+//Create creates a network, with a pair of gateways if ha is true
+//If mode is not GatewayMode.VM no gateway VM is created, but a bastion is created if bastion is true
+//The network is dual-stack if ipv6CIDR is not empty
+//If cidr is empty a free range is allocated from the network pool of the tenant
+func (srv *NetworkService) Create(net string, cidr string, ipVersion IPVersion.Enum, ipv6CIDR string, cpu int, ram float32, disk int, os string, ha bool, mode GatewayMode.Enum, bastion bool) (*api.Network, error) {
+	if ha && mode != GatewayMode.VM {
+		return nil, fmt.Errorf("High availability requires gateway VMs")
+	}
+	if ipv6CIDR != "" {
+		if !isIPv6CIDR(ipv6CIDR) {
+			return nil, fmt.Errorf("Invalid IPv6 CIDR '%s', a /64 is required by IPv6 autoconfiguration", ipv6CIDR)
+		}
+		if mode == GatewayMode.NONE {
+			return nil, fmt.Errorf("A dual-stack network requires a gateway VM or a router to route its IPv6 traffic")
+		}
+	}
+
 	// Check that no network with same name already exists
 	_net, err := srv.Get(net)
 	if _net != nil {
@@ -57,16 +103,47 @@ func (srv *NetworkService) Create(net string, cidr string, ipVersion IPVersion.E
 		return nil, fmt.Errorf("Network %s already exists", net)
 	}
 
+	// Reserve the ranges of the network, they must not overlap the ones of the other networks
+	cidr, err = srv.reserveCIDR(net, cidr, ipv6CIDR)
+	if err != nil {
+		return nil, err
+	}
+	network, err := srv.create(net, cidr, ipVersion, ipv6CIDR, cpu, ram, disk, os, mode, ha, bastion)
+	if err != nil {
+		srv.releaseCIDR(net)
+		return nil, err
+	}
+	return network, nil
+}
+
+//create creates the network and its gateway once its ranges are reserved
+func (srv *NetworkService) create(net string, cidr string, ipVersion IPVersion.Enum, ipv6CIDR string, cpu int, ram float32, disk int, os string, mode GatewayMode.Enum, ha bool, bastion bool) (*api.Network, error) {
 	// Create the network
 	network, err := srv.provider.CreateNetwork(api.NetworkRequest{
-		Name:      net,
-		IPVersion: ipVersion,
-		CIDR:      cidr,
+		Name:        net,
+		IPVersion:   ipVersion,
+		CIDR:        cidr,
+		IPv6CIDR:    ipv6CIDR,
+		GatewayMode: mode,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	// Without gateway VM nor bastion, only the gateway mode of the network is recorded
+	if mode != GatewayMode.VM && !bastion {
+		err = srv.provider.CreateGateway(api.GWRequest{
+			NetworkID: network.ID,
+			Mode:      mode,
+		})
+		if err != nil {
+			srv.provider.DeleteNetwork(network.ID)
+			return nil, err
+		}
+		srv.createDNSZone(network)
+		return network, nil
+	}
+
 	// Create a gateway
 	tpls, err := srv.provider.SelectTemplatesBySize(api.SizingRequirements{
 		MinCores:    cpu,
@@ -92,6 +169,9 @@ func (srv *NetworkService) Create(net string, cidr string, ipVersion IPVersion.E
 		NetworkID:  network.ID,
 		KeyPair:    keypair,
 		TemplateID: tpls[0].ID,
+		HA:         ha,
+		Mode:       mode,
+		Bastion:    bastion,
 	}
 
 	err = srv.provider.CreateGateway(gwRequest)
@@ -100,9 +180,180 @@ func (srv *NetworkService) Create(net string, cidr string, ipVersion IPVersion.E
 		return nil, err
 	}
 
+	srv.createDNSZone(network)
 	return network, nil
 }
 
+//allocateCIDR returns the first network of prefixLength bits in pool that overlaps none of the used CIDRs
+func allocateCIDR(pool string, prefixLength int, used []string) (string, error) {
+	_, poolNet, err := net.ParseCIDR(pool)
+	if err != nil {
+		return "", fmt.Errorf("Invalid network pool '%s': %s", pool, err.Error())
+	}
+	base := poolNet.IP.To4()
+	ones, _ := poolNet.Mask.Size()
+	if base == nil || prefixLength < ones || prefixLength > 30 {
+		return "", fmt.Errorf("Can't allocate /%d networks from pool '%s'", prefixLength, pool)
+	}
+	for n := uint64(0); n < uint64(1)<<uint(prefixLength-ones); n++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(base)+uint32(n<<uint(32-prefixLength)))
+		cidr := fmt.Sprintf("%s/%d", ip.String(), prefixLength)
+		free := true
+		for _, u := range used {
+			overlap, err := api.CIDROverlap(cidr, u)
+			if err == nil && overlap {
+				free = false
+				break
+			}
+		}
+		if free {
+			return cidr, nil
+		}
+	}
+	return "", fmt.Errorf("No free /%d network left in pool '%s'", prefixLength, pool)
+}
+
+//cidrReservation records the ranges used by a network
+type cidrReservation struct {
+	Network  string
+	CIDR     string
+	IPv6CIDR string
+}
+
+//cidrPool returns the range the CIDRs of the networks are allocated from
+func (srv *NetworkService) cidrPool() string {
+	cfg, err := srv.provider.GetCfgOpts()
+	if err == nil {
+		if pool := cfg.GetString("NetworkCIDRPool"); pool != "" {
+			return pool
+		}
+	}
+	return DefaultNetworkCIDRPool
+}
+
+//reservations returns the ranges reserved in metadata and the ones of the networks created before they were reserved
+func (srv *NetworkService) reservations() ([]cidrReservation, error) {
+	var reservations []cidrReservation
+	names, err := srv.provider.ListObjects(api.CIDRContainerName, api.ObjectFilter{})
+	if err != nil {
+		log.Printf("Error listing network CIDR reservations: %v", err)
+	}
+	reserved := map[string]bool{}
+	for _, name := range names {
+		r, err := srv.readReservation(name)
+		if err != nil {
+			continue
+		}
+		reservations = append(reservations, *r)
+		reserved[r.Network] = true
+	}
+	nets, err := srv.provider.ListNetworks(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nets {
+		if !reserved[n.Name] {
+			reservations = append(reservations, cidrReservation{Network: n.Name, CIDR: n.CIDR, IPv6CIDR: n.IPv6CIDR})
+		}
+	}
+	return reservations, nil
+}
+
+//reserveCIDR reserves the ranges of the network name in metadata, cidr is allocated from the pool of the tenant if empty
+//The ranges of a network must not overlap the ones of the other networks
+func (srv *NetworkService) reserveCIDR(name string, cidr string, ipv6CIDR string) (string, error) {
+	cidrLock.Lock()
+	defer cidrLock.Unlock()
+
+	reservations, err := srv.reservations()
+	if err != nil {
+		return "", err
+	}
+	if cidr == "" {
+		var used []string
+		for _, r := range reservations {
+			used = append(used, r.CIDR)
+		}
+		cidr, err = allocateCIDR(srv.cidrPool(), NetworkCIDRPrefixLength, used)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, r := range reservations {
+		for _, c := range []string{cidr, ipv6CIDR} {
+			for _, u := range []string{r.CIDR, r.IPv6CIDR} {
+				if c == "" || u == "" {
+					continue
+				}
+				overlap, err := api.CIDROverlap(c, u)
+				if err != nil {
+					return "", err
+				}
+				if overlap {
+					return "", fmt.Errorf("CIDR %s overlaps the range %s of network '%s'", c, u, r.Network)
+				}
+			}
+		}
+	}
+	err = srv.saveReservation(cidrReservation{Network: name, CIDR: cidr, IPv6CIDR: ipv6CIDR})
+	if err != nil {
+		return "", fmt.Errorf("Error reserving CIDR %s of network '%s': %v", cidr, name, err)
+	}
+	return cidr, nil
+}
+
+//releaseCIDR forgets the ranges reserved by the network name
+func (srv *NetworkService) releaseCIDR(name string) {
+	cidrLock.Lock()
+	defer cidrLock.Unlock()
+
+	if _, err := srv.readReservation(name); err != nil {
+		return
+	}
+	err := srv.provider.DeleteObject(api.CIDRContainerName, name)
+	if err != nil {
+		log.Printf("Error releasing CIDR of network '%s': %v", name, err)
+	}
+}
+
+func (srv *NetworkService) saveReservation(r cidrReservation) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(r)
+	if err != nil {
+		return err
+	}
+	return srv.provider.PutObject(api.CIDRContainerName, api.Object{
+		Name:    r.Network,
+		Content: bytes.NewReader(buffer.Bytes()),
+	})
+}
+
+func (srv *NetworkService) readReservation(name string) (*cidrReservation, error) {
+	o, err := srv.provider.GetObject(api.CIDRContainerName, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	dec := gob.NewDecoder(&buffer)
+	var r cidrReservation
+	err = dec.Decode(&r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+//createDNSZone creates the private DNS zone of network, the network is kept even if its zone can't be created
+func (srv *NetworkService) createDNSZone(network *api.Network) {
+	_, err := newDNSService(srv.provider).createZone(network)
+	if err != nil {
+		log.Printf("Error creating private DNS zone of network '%s': %v", network.Name, err)
+	}
+}
+
 //List returns the network list
 func (srv *NetworkService) List(all bool) ([]api.Network, error) {
 
@@ -123,11 +374,240 @@ func (srv *NetworkService) Get(ref string) (*api.Network, error) {
 	return nil, fmt.Errorf("Network '%s' does not exists", ref)
 }
 
-//Delete deletes network referenced by ref
+//Topology returns the network referenced by ref with its gateway, its VMs, the NAS running on them and its security rules
+//The VMs of the network are the ones registered in the network by the provider, or else the ones having an IP in its ranges
+func (srv *NetworkService) Topology(ref string) (*api.NetworkTopology, error) {
+	n, err := srv.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	topology := api.NetworkTopology{Network: *n}
+
+	gwIDs := map[string]bool{}
+	gw, err := srv.provider.GetGateway(n.ID)
+	if err == nil {
+		topology.Gateway = gw
+		for _, id := range gw.VMIDs {
+			vm, err := srv.provider.GetVM(id)
+			if err != nil {
+				log.Printf("Error getting gateway '%s' of network '%s': %v", id, n.Name, err)
+				continue
+			}
+			topology.GatewayVMs = append(topology.GatewayVMs, *vm)
+			gwIDs[id] = true
+		}
+	}
+
+	vms, err := srv.networkVMs(n)
+	if err != nil {
+		return nil, err
+	}
+	vmIDs := map[string]bool{}
+	for _, vm := range vms {
+		vmIDs[vm.ID] = true
+		if !gwIDs[vm.ID] {
+			topology.VMs = append(topology.VMs, vm)
+		}
+	}
+
+	names, err := srv.provider.ListObjects(api.NasContainerName, api.ObjectFilter{})
+	if err != nil {
+		log.Printf("Error listing NAS: %v", err)
+	}
+	nasSrv := &NasService{provider: srv.provider}
+	for _, name := range names {
+		nas, err := nasSrv.readNasDefinition(name)
+		if err == nil && (vmIDs[nas.ServerID] || gwIDs[nas.ServerID]) {
+			topology.Nas = append(topology.Nas, *nas)
+		}
+	}
+
+	topology.SecurityRules, err = srv.provider.ListSecurityRules(n.ID)
+	if err != nil {
+		log.Printf("Error listing security rules of network '%s': %v", n.Name, err)
+	}
+	return &topology, nil
+}
+
+//networkVMs returns the VMs registered in the network n, or else the ones having an IP in its ranges
+func (srv *NetworkService) networkVMs(n *api.Network) ([]api.VM, error) {
+	var vms []api.VM
+	names, err := srv.provider.ListObjects(api.NetworkContainerName, api.ObjectFilter{
+		Prefix: fmt.Sprintf("%s/vm/", n.ID),
+	})
+	if err == nil && len(names) > 0 {
+		for _, name := range names {
+			vm, err := srv.provider.GetVM(path.Base(name))
+			if err != nil {
+				log.Printf("Error getting VM '%s' of network '%s': %v", path.Base(name), n.Name, err)
+				continue
+			}
+			vms = append(vms, *vm)
+		}
+		return vms, nil
+	}
+
+	all, err := srv.provider.ListVMs(false)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []*net.IPNet
+	for _, cidr := range []string{n.CIDR, n.IPv6CIDR} {
+		if _, r, err := net.ParseCIDR(cidr); err == nil {
+			ranges = append(ranges, r)
+		}
+	}
+	for _, vm := range all {
+		for _, ip := range append(vm.PrivateIPsV4, vm.PrivateIPsV6...) {
+			if inRanges(net.ParseIP(ip), ranges) {
+				vms = append(vms, vm)
+				break
+			}
+		}
+	}
+	return vms, nil
+}
+
+//inRanges tells if ip belongs to one of the ranges
+func inRanges(ip net.IP, ranges []*net.IPNet) bool {
+	for _, r := range ranges {
+		if ip != nil && r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//Delete deletes network referenced by ref with its private DNS zone and releases its ranges
+//The routes to the network are removed from the gateways of its peers
 func (srv *NetworkService) Delete(ref string) error {
 	n, err := srv.Get(ref)
 	if err != nil {
 		return fmt.Errorf("Network %s does not exists", ref)
 	}
-	return srv.provider.DeleteNetwork(n.ID)
+	peerings, err := srv.provider.ListNetworkPeerings(n.ID)
+	if err != nil {
+		return err
+	}
+	err = srv.provider.DeleteNetwork(n.ID)
+	if err != nil {
+		return err
+	}
+	err = newDNSService(srv.provider).deleteNetworkZone(n.ID)
+	if err != nil {
+		log.Printf("Error deleting private DNS zone of network '%s': %v", n.Name, err)
+	}
+	err = (&VPNService{provider: srv.provider}).deleteNetworkVPN(n.ID)
+	if err != nil {
+		log.Printf("Error deleting VPN of network '%s': %v", n.Name, err)
+	}
+	srv.releaseCIDR(n.Name)
+	for _, peering := range peerings {
+		peerID := peering.NetworkIDs[0]
+		if peerID == n.ID {
+			peerID = peering.NetworkIDs[1]
+		}
+		if nextHop, ok := peering.NextHops[peerID]; ok {
+			srv.route(peerID, n.CIDR, nextHop, "remove_network_route.sh")
+		}
+	}
+	return nil
+}
+
+//Peer routes the traffic between the networks referenced by ref1 and ref2
+//The VMs get the routes to the other network from their network, the gateways are updated at once
+func (srv *NetworkService) Peer(ref1 string, ref2 string) (*api.NetworkPeering, error) {
+	nets, err := srv.getPair(ref1, ref2)
+	if err != nil {
+		return nil, err
+	}
+	peering, err := srv.provider.PeerNetworks(nets[0].ID, nets[1].ID)
+	if err != nil {
+		return nil, err
+	}
+	err = srv.routePeering(peering, nets, "add_network_route.sh")
+	if err != nil {
+		srv.routePeering(peering, nets, "remove_network_route.sh")
+		srv.provider.UnpeerNetworks(nets[0].ID, nets[1].ID)
+		return nil, err
+	}
+	return peering, nil
+}
+
+//Unpeer stops routing the traffic between the networks referenced by ref1 and ref2
+func (srv *NetworkService) Unpeer(ref1 string, ref2 string) error {
+	nets, err := srv.getPair(ref1, ref2)
+	if err != nil {
+		return err
+	}
+	peerings, err := srv.provider.ListNetworkPeerings(nets[0].ID)
+	if err != nil {
+		return err
+	}
+	for _, peering := range peerings {
+		if peering.NetworkIDs[0] != nets[1].ID && peering.NetworkIDs[1] != nets[1].ID {
+			continue
+		}
+		// The peering is removed even if a gateway can not be reached
+		routeErr := srv.routePeering(&peering, nets, "remove_network_route.sh")
+		err = srv.provider.UnpeerNetworks(nets[0].ID, nets[1].ID)
+		if err != nil {
+			return err
+		}
+		return routeErr
+	}
+	return fmt.Errorf("Networks %s and %s are not peered", ref1, ref2)
+}
+
+//getPair returns the networks referenced by ref1 and ref2
+func (srv *NetworkService) getPair(ref1 string, ref2 string) ([]*api.Network, error) {
+	var nets []*api.Network
+	for _, ref := range []string{ref1, ref2} {
+		n, err := srv.Get(ref)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+//routePeering runs script on the gateways of each network of the peering to add or remove the route to the other network
+func (srv *NetworkService) routePeering(peering *api.NetworkPeering, nets []*api.Network, script string) error {
+	for i, n := range nets {
+		nextHop, ok := peering.NextHops[n.ID]
+		if !ok {
+			continue
+		}
+		err := srv.route(n.ID, nets[1-i].CIDR, nextHop, script)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//route runs script on the gateway VMs of the network identified by networkID to add or remove the route to cidr through nextHop
+func (srv *NetworkService) route(networkID string, cidr string, nextHop string, script string) error {
+	gw, err := srv.provider.GetGateway(networkID)
+	if err != nil {
+		return err
+	}
+	if gw.Mode != GatewayMode.VM {
+		return nil
+	}
+	data := struct {
+		CIDR    string
+		NextHop string
+	}{
+		CIDR:    cidr,
+		NextHop: nextHop,
+	}
+	for _, id := range gw.VMIDs {
+		err = exec(script, data, id, srv.provider)
+		if err != nil {
+			return fmt.Errorf("Error routing %s on gateway %s: %v", cidr, id, err)
+		}
+	}
+	return nil
 }
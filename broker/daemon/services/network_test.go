@@ -0,0 +1,57 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_allocateCIDR(t *testing.T) {
+	tests := []struct {
+		pool   string
+		length int
+		used   []string
+		cidr   string
+		err    bool
+	}{
+		{pool: "192.168.0.0/16", length: 24, cidr: "192.168.0.0/24"},
+		{pool: "192.168.5.3/16", length: 24, cidr: "192.168.0.0/24"},
+		{pool: "192.168.0.0/16", length: 24, used: []string{"192.168.0.0/24", "192.168.1.0/24"}, cidr: "192.168.2.0/24"},
+		{pool: "192.168.0.0/16", length: 24, used: []string{"192.168.1.0/24"}, cidr: "192.168.0.0/24"},
+		{pool: "192.168.0.0/16", length: 24, used: []string{"192.168.0.0/23"}, cidr: "192.168.2.0/24"},
+		{pool: "192.168.0.0/16", length: 22, used: []string{"192.168.2.0/24"}, cidr: "192.168.4.0/22"},
+		{pool: "192.168.0.0/16", length: 24, used: []string{"10.0.0.0/8", "invalid"}, cidr: "192.168.0.0/24"},
+		{pool: "192.168.0.0/16", length: 16, cidr: "192.168.0.0/16"},
+		{pool: "10.0.0.0/30", length: 30, used: []string{"10.0.0.0/30"}, err: true},
+		{pool: "192.168.0.0/16", length: 24, used: []string{"192.168.0.0/16"}, err: true},
+		{pool: "192.168.0.0/16", length: 8, err: true},
+		{pool: "192.168.0.0/16", length: 31, err: true},
+		{pool: "fd00::/8", length: 64, err: true},
+		{pool: "192.168.0.0", length: 24, err: true},
+	}
+	for _, tt := range tests {
+		cidr, err := allocateCIDR(tt.pool, tt.length, tt.used)
+		if tt.err {
+			assert.NotNil(t, err, tt.pool)
+			continue
+		}
+		assert.Nil(t, err, tt.pool)
+		assert.Equal(t, tt.cidr, cidr, tt.pool)
+	}
+}
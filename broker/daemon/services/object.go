@@ -0,0 +1,117 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"fmt"
+
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api"
+)
+
+//ObjectAPI defines API to manipulate objects of a container
+type ObjectAPI interface {
+	Put(container string, obj api.Object) error
+	Get(container string, name string, ranges []api.Range) (*api.Object, error)
+	Stat(container string, name string) (*api.Object, error)
+	List(container string, filter api.ObjectFilter) ([]string, error)
+	Delete(container string, name string) error
+	Copy(container string, source string, destination string) error
+}
+
+//NewObjectService creates an Object service
+func NewObjectService(api api.ClientAPI) ObjectAPI {
+	return &ObjectService{
+		provider: providers.FromClient(api),
+	}
+}
+
+//ObjectService object service
+type ObjectService struct {
+	provider *providers.Service
+}
+
+//checkContainer returns an error if the container doesn't exist
+func (srv *ObjectService) checkContainer(container string) error {
+	containers, err := srv.provider.ListContainers()
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if c == container {
+			return nil
+		}
+	}
+	return providers.ResourceNotFoundError("Container", container)
+}
+
+//Put stores an object in a container
+func (srv *ObjectService) Put(container string, obj api.Object) error {
+	if obj.Name == "" {
+		return fmt.Errorf("Object name required")
+	}
+	err := srv.checkContainer(container)
+	if err != nil {
+		return err
+	}
+	return srv.provider.PutObject(container, obj)
+}
+
+//Get returns the object of a container with its content, limited to ranges if given
+func (srv *ObjectService) Get(container string, name string, ranges []api.Range) (*api.Object, error) {
+	err := srv.checkContainer(container)
+	if err != nil {
+		return nil, err
+	}
+	return srv.provider.GetObject(container, name, ranges)
+}
+
+//Stat returns the metadata of an object of a container
+func (srv *ObjectService) Stat(container string, name string) (*api.Object, error) {
+	err := srv.checkContainer(container)
+	if err != nil {
+		return nil, err
+	}
+	return srv.provider.GetObjectMetadata(container, name)
+}
+
+//List returns the names of the objects of a container matching filter
+func (srv *ObjectService) List(container string, filter api.ObjectFilter) ([]string, error) {
+	err := srv.checkContainer(container)
+	if err != nil {
+		return nil, err
+	}
+	return srv.provider.ListObjects(container, filter)
+}
+
+//Delete deletes an object of a container
+func (srv *ObjectService) Delete(container string, name string) error {
+	err := srv.checkContainer(container)
+	if err != nil {
+		return err
+	}
+	return srv.provider.DeleteObject(container, name)
+}
+
+//Copy copies an object of a container into another object of the same container
+func (srv *ObjectService) Copy(container string, source string, destination string) error {
+	err := srv.checkContainer(container)
+	if err != nil {
+		return err
+	}
+	return srv.provider.CopyObject(container, source, destination)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api"
+)
+
+//PublicIPAPI defines API to manipulate public IPs
+type PublicIPAPI interface {
+	Create() (*api.PublicIP, error)
+	List(all bool) ([]api.PublicIP, error)
+	Get(ref string) (*api.PublicIP, error)
+	Attach(ref string, vm string) error
+	Detach(ref string) error
+	Delete(ref string) error
+}
+
+//NewPublicIPService creates a public IP service
+func NewPublicIPService(api api.ClientAPI) PublicIPAPI {
+	return &PublicIPService{
+		provider: providers.FromClient(api),
+	}
+}
+
+//PublicIPService public IP service
+type PublicIPService struct {
+	provider *providers.Service
+}
+
+//Create reserves a public IP, which is kept until it is deleted whatever the VMs it is attached to
+func (srv *PublicIPService) Create() (*api.PublicIP, error) {
+	ip, err := srv.provider.CreatePublicIP()
+	if err != nil {
+		return nil, err
+	}
+	err = srv.provider.PutObject(api.PublicIPContainerName, api.Object{
+		Name:    ip.ID,
+		Content: bytes.NewReader([]byte(ip.IP)),
+	})
+	if err != nil {
+		srv.provider.DeletePublicIP(ip.ID)
+		return nil, err
+	}
+	return ip, nil
+}
+
+//List returns the reserved public IPs, or all the public IPs of the tenant if all is true
+func (srv *PublicIPService) List(all bool) ([]api.PublicIP, error) {
+	ips, err := srv.provider.ListPublicIPs()
+	if err != nil || all {
+		return ips, err
+	}
+	ids, err := srv.provider.ListObjects(api.PublicIPContainerName, api.ObjectFilter{})
+	if err != nil {
+		return nil, err
+	}
+	reserved := map[string]bool{}
+	for _, id := range ids {
+		reserved[id] = true
+	}
+	var list []api.PublicIP
+	for _, ip := range ips {
+		if reserved[ip.ID] {
+			list = append(list, ip)
+		}
+	}
+	return list, nil
+}
+
+//Get returns the public IP identified by ref, ref can be the address or the id
+func (srv *PublicIPService) Get(ref string) (*api.PublicIP, error) {
+	ips, err := srv.List(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if ip.ID == ref || ip.IP == ref {
+			return &ip, nil
+		}
+	}
+	return nil, fmt.Errorf("Public IP '%s' does not exists", ref)
+}
+
+//Attach attaches the public IP referenced by ref to the VM referenced by vm
+func (srv *PublicIPService) Attach(ref string, vm string) error {
+	ip, err := srv.Get(ref)
+	if err != nil {
+		return err
+	}
+	vmService := NewVMService(srv.provider)
+	_vm, err := vmService.Get(vm)
+	if err != nil {
+		return err
+	}
+	return srv.provider.AttachPublicIP(ip.ID, _vm.ID)
+}
+
+//Detach detaches the public IP referenced by ref from its VM
+func (srv *PublicIPService) Detach(ref string) error {
+	ip, err := srv.Get(ref)
+	if err != nil {
+		return err
+	}
+	return srv.provider.DetachPublicIP(ip.ID)
+}
+
+//Delete releases the public IP referenced by ref
+func (srv *PublicIPService) Delete(ref string) error {
+	ip, err := srv.Get(ref)
+	if err != nil {
+		return err
+	}
+	err = srv.provider.DeletePublicIP(ip.ID)
+	if err != nil {
+		return err
+	}
+	// Public IPs created with a VM are not reserved
+	srv.provider.DeleteObject(api.PublicIPContainerName, ip.ID)
+	return nil
+}
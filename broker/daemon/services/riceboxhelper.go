@@ -18,7 +18,6 @@ package services
 
 import (
 	"bytes"
-	"fmt"
 	"text/template"
 
 	"github.com/CS-SI/SafeScale/providers"
@@ -45,6 +44,15 @@ func getBoxContent(script string, data interface{}) (string, error) {
 		// TODO Use more explicit error
 		return "", err
 	}
+	// Helpers shared by scripts are made available with {{template "common_tools.sh"}}
+	commonTools, err := box.String("common_tools.sh")
+	if err != nil {
+		return "", err
+	}
+	_, err = tpl.New("common_tools.sh").Parse(commonTools)
+	if err != nil {
+		return "", err
+	}
 
 	var buffer bytes.Buffer
 	if err = tpl.Execute(&buffer, data); err != nil {
@@ -52,9 +60,8 @@ func getBoxContent(script string, data interface{}) (string, error) {
 		return "", err
 	}
 
-	tplcmd := buffer.String()
-	fmt.Println(tplcmd)
-	return tplcmd, nil
+	// Script content is not logged as it may contain credentials
+	return buffer.String(), nil
 }
 
 // Execute the given script (embeded in a rice-box) wit the given data on the VM identified by vmid
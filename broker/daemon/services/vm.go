@@ -18,6 +18,7 @@ package services
 
 import (
 	"fmt"
+	"log"
 	"strings"
 
 	"github.com/CS-SI/SafeScale/providers"
@@ -27,7 +28,7 @@ import (
 
 //VMAPI defines API to manipulate VMs
 type VMAPI interface {
-	Create(name string, net string, cpu int, ram float32, disk int, os string, public bool) (*api.VM, error)
+	Create(name string, nets []string, cpu int, ram float32, disk int, os string, public bool) (*api.VM, error)
 	List(all bool) ([]api.VM, error)
 	Get(ref string) (*api.VM, error)
 	Delete(ref string) error
@@ -48,16 +49,24 @@ type VMService struct {
 	network  NetworkAPI
 }
 
-//Create creates a network
-func (srv *VMService) Create(name string, net string, cpu int, ram float32, disk int, os string, public bool) (*api.VM, error) {
+//Create creates a VM connected to the networks nets, named <name>.<network>.safescale in their private DNS
+//The first network provides the default route and the gateway of the VM if it is not public
+func (srv *VMService) Create(name string, nets []string, cpu int, ram float32, disk int, os string, public bool) (*api.VM, error) {
 	_vm, err := srv.Get(name)
 	if _vm != nil || (err != nil && !strings.Contains(err.Error(), "does not exists")) {
 		return nil, fmt.Errorf("VM '%s' already exists", name)
 	}
 
-	n, err := srv.network.Get(net)
-	if err != nil {
-		return nil, err
+	if len(nets) == 0 {
+		return nil, fmt.Errorf("VM '%s' must be connected to a network", name)
+	}
+	var networkIDs []string
+	for _, net := range nets {
+		n, err := srv.network.Get(net)
+		if err != nil {
+			return nil, err
+		}
+		networkIDs = append(networkIDs, n.ID)
 	}
 	tpls, err := srv.provider.SelectTemplatesBySize(api.SizingRequirements{
 		MinCores:    cpu,
@@ -74,12 +83,17 @@ func (srv *VMService) Create(name string, net string, cpu int, ram float32, disk
 		TemplateID: tpls[0].ID,
 		// IsGateway:  false,
 		PublicIP:   public,
-		NetworkIDs: []string{n.ID},
+		NetworkIDs: networkIDs,
 	}
 	vm, err := srv.provider.CreateVM(vmRequest)
 	if err != nil {
 		return nil, err
 	}
+	// The VM is kept even if it can't be registered in the private DNS of its networks
+	err = newDNSService(srv.provider).registerVM(vm, networkIDs)
+	if err != nil {
+		log.Printf("Error registering VM '%s' in private DNS: %v", vm.Name, err)
+	}
 	return vm, nil
 
 }
@@ -103,13 +117,34 @@ func (srv *VMService) Get(ref string) (*api.VM, error) {
 	return nil, fmt.Errorf("VM %s does not exists", ref)
 }
 
-//Delete deletes network referenced by ref
+//Delete deletes VM referenced by ref
+//The reserved public IPs attached to the VM are detached first to outlive it
+//The records of the VM are removed from the private DNS of its networks
 func (srv *VMService) Delete(ref string) error {
 	vm, err := srv.Get(ref)
 	if err != nil {
 		return fmt.Errorf("VM '%s' does not exists", ref)
 	}
-	return srv.provider.DeleteVM(vm.ID)
+	// Providers without public IPs fail to list them, their VMs have no reserved public IP
+	ips, _ := NewPublicIPService(srv.provider).List(false)
+	for _, ip := range ips {
+		if ip.VMID != vm.ID {
+			continue
+		}
+		err = srv.provider.DetachPublicIP(ip.ID)
+		if err != nil {
+			return err
+		}
+	}
+	err = srv.provider.DeleteVM(vm.ID)
+	if err != nil {
+		return err
+	}
+	err = newDNSService(srv.provider).unregisterVM(vm.ID)
+	if err != nil {
+		log.Printf("Error removing VM '%s' from private DNS: %v", vm.Name, err)
+	}
+	return nil
 }
 
 // SSH returns ssh parameters to access the vm referenced by ref
@@ -17,12 +17,17 @@
 package services
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/CS-SI/SafeScale/providers"
 	"github.com/CS-SI/SafeScale/providers/api"
 	"github.com/CS-SI/SafeScale/providers/api/VolumeSpeed"
+	"github.com/CS-SI/SafeScale/providers/api/VolumeState"
 	"github.com/CS-SI/SafeScale/system/nfs"
 )
 
@@ -32,8 +37,10 @@ type VolumeAPI interface {
 	Get(ref string) (*api.Volume, error)
 	List() ([]api.Volume, error)
 	Create(name string, size int, speed VolumeSpeed.Enum) (*api.Volume, error)
-	Attach(volume string, vm string, path string, format string) error
+	Update(ref string, size int, speed *VolumeSpeed.Enum) (*api.Volume, error)
+	Attach(volume string, vm string, path string, format string, mkfsOptions string, mountOptions string) error
 	Detach(volume string, vm string) error
+	GetAttachment(volume string) (*api.VolumeAttachment, error)
 }
 
 //NewVolumeService creates a Volume service
@@ -95,8 +102,84 @@ func (srv *VolumeService) Create(name string, size int, speed VolumeSpeed.Enum)
 	return volume, nil
 }
 
+//Update extends the volume identified by ref to size GB and/or changes its speed, ref can be the name or the id
+//A size of 0 or a nil speed leaves the corresponding property unchanged. If the volume is attached, its
+//filesystem is grown on the VM once the volume has been extended
+func (srv *VolumeService) Update(ref string, size int, speed *VolumeSpeed.Enum) (*api.Volume, error) {
+	volume, err := srv.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	if size != 0 && size < volume.Size {
+		return nil, fmt.Errorf("Volume '%s' can't be shrunk from %d GB to %d GB", volume.Name, volume.Size, size)
+	}
+
+	// The volume must come back to its current state after each operation
+	state := volume.State
+	if state != VolumeState.USED {
+		state = VolumeState.AVAILABLE
+	}
+
+	if speed != nil && *speed != volume.Speed {
+		err = srv.provider.RetypeVolume(volume.ID, *speed)
+		if err != nil {
+			return nil, err
+		}
+		volume, err = srv.provider.WaitVolumeState(volume.ID, state, 2*time.Minute)
+		if err != nil {
+			return nil, fmt.Errorf("Error waiting for volume '%s' to be retyped: %s", ref, err)
+		}
+	}
+
+	if size != 0 && size != volume.Size {
+		err = srv.provider.ExtendVolume(volume.ID, size)
+		if err != nil {
+			return nil, err
+		}
+		volume, err = srv.provider.WaitVolumeState(volume.ID, state, 2*time.Minute)
+		if err != nil {
+			return nil, fmt.Errorf("Error waiting for volume '%s' to be extended: %s", ref, err)
+		}
+		if state == VolumeState.USED {
+			err = srv.growFileSystem(volume)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return volume, nil
+}
+
+//growFileSystem grows the filesystem of an attached volume to the size of the volume
+func (srv *VolumeService) growFileSystem(volume *api.Volume) error {
+	volatt, err := srv.GetAttachment(volume.ID)
+	if err != nil {
+		log.Printf("No attachment metadata found for volume '%s', filesystem not resized: %s", volume.Name, err)
+		return nil
+	}
+	// The device may have changed since attachment, ask the provider
+	pva, err := srv.provider.GetVolumeAttachment(volatt.ServerID, volume.ID)
+	if err != nil {
+		return fmt.Errorf("Error getting volume attachment: %s", err)
+	}
+
+	sshConfig, err := srv.provider.GetSSHConfig(volatt.ServerID)
+	if err != nil {
+		return err
+	}
+	server, err := nfs.NewServer(sshConfig)
+	if err != nil {
+		return err
+	}
+	return server.ResizeBlockDevice(pva.Device, volatt.MountPoint, volatt.Format)
+}
+
 // Attach a volume to a VM
-func (srv *VolumeService) Attach(volumename string, vmname string, path string, format string) error {
+func (srv *VolumeService) Attach(volumename string, vmname string, path string, format string, mkfsOptions string, mountOptions string) error {
+	if format != "" && !nfs.IsFileSystemSupported(format) {
+		return fmt.Errorf("Unsupported filesystem '%s'", format)
+	}
+
 	// Get volume ID
 	volume, err := srv.Get(volumename)
 	if err != nil {
@@ -135,8 +218,20 @@ func (srv *VolumeService) Attach(volumename string, vmname string, path string,
 	if err != nil {
 		return err
 	}
-	err = server.MountBlockDevice(volatt.Device, mountPoint)
+	fs, err := server.MountBlockDevice(volatt.Device, mountPoint, format, mkfsOptions, mountOptions)
+	if err != nil {
+		srv.Detach(volumename, vmname)
+		return err
+	}
 
+	volatt.Name = fmt.Sprintf("%s-%s", volume.Name, vm.Name)
+	volatt.MountPoint = mountPoint
+	volatt.Format = fs
+	volatt.MountOptions = mountOptions
+	if volatt.MountOptions == "" {
+		volatt.MountOptions = nfs.DefaultMountOptions
+	}
+	err = srv.saveVolumeAttachment(*volatt)
 	if err != nil {
 		srv.Detach(volumename, vmname)
 		return err
@@ -179,5 +274,69 @@ func (srv *VolumeService) Detach(volumename string, vmname string) error {
 	}
 
 	// Finaly delete the attachment
-	return srv.provider.DeleteVolumeAttachment(vm.ID, vol.ID)
+	err = srv.provider.DeleteVolumeAttachment(vm.ID, vol.ID)
+	if err != nil {
+		return err
+	}
+	err = srv.removeVolumeAttachment(vol.ID, vm.ID)
+	if err != nil {
+		log.Printf("Failed to remove attachment metadata of volume '%s': %s", vol.Name, err)
+	}
+	return nil
+}
+
+//GetAttachment returns the attachment metadata of the volume identified by ref, ref can be the name or the id
+func (srv *VolumeService) GetAttachment(ref string) (*api.VolumeAttachment, error) {
+	vol, err := srv.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	names, err := srv.provider.ListObjects(api.VolumeContainerName, api.ObjectFilter{
+		Path:   "",
+		Prefix: vol.ID + "/",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, providers.ResourceNotFoundError("Volume attachment", ref)
+	}
+	return srv.readVolumeAttachment(names[0])
+}
+
+func (srv *VolumeService) saveVolumeAttachment(va api.VolumeAttachment) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(va)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s/%s", va.VolumeID, va.ServerID)
+	log.Printf("Saving volume attachment: %s", name)
+	return srv.provider.PutObject(api.VolumeContainerName, api.Object{
+		Name:    name,
+		Content: bytes.NewReader(buffer.Bytes()),
+	})
+}
+
+func (srv *VolumeService) removeVolumeAttachment(volumeID string, vmID string) error {
+	name := fmt.Sprintf("%s/%s", volumeID, vmID)
+	log.Printf("Removing volume attachment: %s", name)
+	return srv.provider.DeleteObject(api.VolumeContainerName, name)
+}
+
+func (srv *VolumeService) readVolumeAttachment(name string) (*api.VolumeAttachment, error) {
+	o, err := srv.provider.GetObject(api.VolumeContainerName, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	dec := gob.NewDecoder(&buffer)
+	var va api.VolumeAttachment
+	err = dec.Decode(&va)
+	if err != nil {
+		return nil, err
+	}
+	return &va, nil
 }
@@ -0,0 +1,360 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
+	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	//VPNDefaultCIDR is the default network of the IPs of the gateway and the peers in a VPN
+	VPNDefaultCIDR = "10.99.0.0/24"
+	//VPNPort is the UDP port WireGuard listens on
+	VPNPort = 51820
+)
+
+//VPNAPI defines API to manage the WireGuard VPNs giving access to the networks from workstations
+type VPNAPI interface {
+	Enable(net string, cidr string) (*api.VPN, error)
+	Get(net string) (*api.VPN, error)
+	Config(net string, user string) (string, error)
+	Revoke(net string, user string) error
+	Disable(net string) error
+}
+
+//NewVPNService creates a VPN service
+func NewVPNService(api api.ClientAPI) VPNAPI {
+	return &VPNService{
+		provider: providers.FromClient(api),
+	}
+}
+
+//VPNService VPN service
+//WireGuard runs on the single gateway of the network, the traffic of the peers is masqueraded so the VMs reply to the gateway whatever their routes
+type VPNService struct {
+	provider *providers.Service
+}
+
+//wireguardKeys generates a WireGuard private key and its public key, both base64 encoded
+func wireguardKeys() (string, string, error) {
+	var private, public [32]byte
+	_, err := rand.Read(private[:])
+	if err != nil {
+		return "", "", err
+	}
+	// Clamping of Curve25519 private keys
+	private[0] &= 248
+	private[31] &= 127
+	private[31] |= 64
+	curve25519.ScalarBaseMult(&public, &private)
+	return base64.StdEncoding.EncodeToString(private[:]), base64.StdEncoding.EncodeToString(public[:]), nil
+}
+
+//vpnIP returns the n-th IP of the IPv4 network cidr
+func vpnIP(cidr string, n int) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	base := ipNet.IP.To4()
+	if base == nil {
+		return "", fmt.Errorf("VPN network %s is not an IPv4 network", cidr)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if n <= 0 || n >= (1<<uint(bits-ones))-1 {
+		return "", fmt.Errorf("VPN network %s is full", cidr)
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(base)+uint32(n))
+	return ip.String(), nil
+}
+
+//Enable installs WireGuard on the gateway of the network referenced by net, the peers get IPs in cidr
+//Networks with gateways in high availability are rejected
+func (srv *VPNService) Enable(net string, cidr string) (*api.VPN, error) {
+	n, err := NewNetworkService(srv.provider).Get(net)
+	if err != nil {
+		return nil, err
+	}
+	if vpn, _ := srv.readVPN(n.ID); vpn != nil {
+		return nil, fmt.Errorf("VPN of network %s is already enabled", n.Name)
+	}
+	if cidr == "" {
+		cidr = VPNDefaultCIDR
+	}
+	if _, err := vpnIP(cidr, 1); err != nil {
+		return nil, err
+	}
+	overlap, err := api.CIDROverlap(cidr, n.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	if overlap {
+		return nil, fmt.Errorf("VPN network %s overlaps the network %s", cidr, n.CIDR)
+	}
+	gw, err := srv.provider.GetGateway(n.ID)
+	if err != nil {
+		return nil, err
+	}
+	if gw.Mode != GatewayMode.VM || len(gw.VMIDs) == 0 {
+		return nil, fmt.Errorf("Error enabling VPN: network %s has no gateway to run WireGuard", n.Name)
+	}
+	// The peers would lose the VPN on a failover, the VIP being only reachable from the network
+	if len(gw.VMIDs) > 1 || gw.VIP != "" {
+		return nil, fmt.Errorf("Error enabling VPN: network %s has gateways in high availability, which do not support WireGuard", n.Name)
+	}
+	vm, err := srv.provider.GetVM(gw.VMIDs[0])
+	if err != nil {
+		return nil, err
+	}
+	endpoint := vm.GetAccessIP()
+	if IPVersion.IPv6.Is(endpoint) {
+		endpoint = "[" + endpoint + "]"
+	}
+	private, public, err := wireguardKeys()
+	if err != nil {
+		return nil, err
+	}
+	vpn := api.VPN{
+		NetworkID:   n.ID,
+		GatewayVMID: vm.ID,
+		Endpoint:    fmt.Sprintf("%s:%d", endpoint, VPNPort),
+		CIDR:        cidr,
+		PrivateKey:  private,
+		PublicKey:   public,
+	}
+	err = srv.configureWireGuard(&vpn)
+	if err != nil {
+		return nil, err
+	}
+	err = srv.saveVPN(vpn)
+	if err != nil {
+		return nil, err
+	}
+	return &vpn, nil
+}
+
+//Get returns the VPN of the network referenced by net
+func (srv *VPNService) Get(net string) (*api.VPN, error) {
+	n, err := NewNetworkService(srv.provider).Get(net)
+	if err != nil {
+		return nil, err
+	}
+	vpn, err := srv.readVPN(n.ID)
+	if err != nil {
+		return nil, fmt.Errorf("VPN of network %s is not enabled", n.Name)
+	}
+	return vpn, nil
+}
+
+//Config returns the WireGuard configuration of the workstation of user, the peer of user is added to the VPN of the network referenced by net if needed
+func (srv *VPNService) Config(net string, user string) (string, error) {
+	if user == "" {
+		return "", fmt.Errorf("A VPN peer requires a user")
+	}
+	vpn, err := srv.Get(net)
+	if err != nil {
+		return "", err
+	}
+	var peer *api.VPNPeer
+	for i := range vpn.Peers {
+		if vpn.Peers[i].User == user {
+			peer = &vpn.Peers[i]
+		}
+	}
+	if peer == nil {
+		peer, err = srv.addPeer(vpn, user)
+		if err != nil {
+			return "", err
+		}
+	}
+	n, err := srv.provider.GetNetwork(vpn.NetworkID)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{
+		"[Interface]",
+		"PrivateKey = " + peer.PrivateKey,
+		"Address = " + peer.IP + "/32",
+	}
+	zone, err := newDNSService(srv.provider).getZone(n, false)
+	if err == nil && zone != nil && len(zone.Nameservers) > 0 {
+		lines = append(lines, "DNS = "+strings.Join(zone.Nameservers, ", "))
+	}
+	lines = append(lines,
+		"",
+		"[Peer]",
+		"PublicKey = "+vpn.PublicKey,
+		"Endpoint = "+vpn.Endpoint,
+		"AllowedIPs = "+n.CIDR,
+		"PersistentKeepalive = 25",
+	)
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+//addPeer adds the peer of user to vpn, with the first free IP of the VPN network
+func (srv *VPNService) addPeer(vpn *api.VPN, user string) (*api.VPNPeer, error) {
+	used := map[string]bool{}
+	for _, p := range vpn.Peers {
+		used[p.IP] = true
+	}
+	// The first IP is the one of the gateway
+	var ip string
+	for i := 2; ; i++ {
+		candidate, err := vpnIP(vpn.CIDR, i)
+		if err != nil {
+			return nil, err
+		}
+		if !used[candidate] {
+			ip = candidate
+			break
+		}
+	}
+	private, public, err := wireguardKeys()
+	if err != nil {
+		return nil, err
+	}
+	vpn.Peers = append(vpn.Peers, api.VPNPeer{
+		User:       user,
+		IP:         ip,
+		PrivateKey: private,
+		PublicKey:  public,
+	})
+	err = srv.configureWireGuard(vpn)
+	if err != nil {
+		return nil, err
+	}
+	err = srv.saveVPN(*vpn)
+	if err != nil {
+		return nil, err
+	}
+	return &vpn.Peers[len(vpn.Peers)-1], nil
+}
+
+//Revoke removes the peer of user from the VPN of the network referenced by net, its configuration can't connect anymore
+func (srv *VPNService) Revoke(net string, user string) error {
+	vpn, err := srv.Get(net)
+	if err != nil {
+		return err
+	}
+	var peers []api.VPNPeer
+	for _, p := range vpn.Peers {
+		if p.User != user {
+			peers = append(peers, p)
+		}
+	}
+	if len(peers) == len(vpn.Peers) {
+		return fmt.Errorf("User %s is not a peer of the VPN", user)
+	}
+	vpn.Peers = peers
+	err = srv.configureWireGuard(vpn)
+	if err != nil {
+		return err
+	}
+	return srv.saveVPN(*vpn)
+}
+
+//Disable stops WireGuard on the gateway of the network referenced by net, all the peers are revoked
+func (srv *VPNService) Disable(net string) error {
+	vpn, err := srv.Get(net)
+	if err != nil {
+		return err
+	}
+	err = exec("disable_wireguard.sh", nil, vpn.GatewayVMID, srv.provider)
+	if err != nil {
+		return fmt.Errorf("Error disabling WireGuard on gateway %s: %v", vpn.GatewayVMID, err)
+	}
+	return srv.provider.DeleteObject(api.VPNContainerName, vpn.NetworkID)
+}
+
+//configureWireGuard writes the configuration of vpn on its gateway and restarts WireGuard
+func (srv *VPNService) configureWireGuard(vpn *api.VPN) error {
+	address, err := vpnIP(vpn.CIDR, 1)
+	if err != nil {
+		return err
+	}
+	_, ipNet, _ := net.ParseCIDR(vpn.CIDR)
+	ones, _ := ipNet.Mask.Size()
+	data := struct {
+		Address    string
+		CIDR       string
+		Port       int
+		PrivateKey string
+		Peers      []api.VPNPeer
+	}{
+		Address:    fmt.Sprintf("%s/%d", address, ones),
+		CIDR:       vpn.CIDR,
+		Port:       VPNPort,
+		PrivateKey: vpn.PrivateKey,
+		Peers:      vpn.Peers,
+	}
+	err = exec("configure_wireguard.sh", data, vpn.GatewayVMID, srv.provider)
+	if err != nil {
+		return fmt.Errorf("Error configuring WireGuard on gateway %s: %v", vpn.GatewayVMID, err)
+	}
+	return nil
+}
+
+//deleteNetworkVPN forgets the VPN of the network identified by networkID if it has one, its gateway is deleted with the network
+func (srv *VPNService) deleteNetworkVPN(networkID string) error {
+	if _, err := srv.readVPN(networkID); err != nil {
+		return nil
+	}
+	return srv.provider.DeleteObject(api.VPNContainerName, networkID)
+}
+
+func (srv *VPNService) saveVPN(vpn api.VPN) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(vpn)
+	if err != nil {
+		return err
+	}
+	return srv.provider.PutObject(api.VPNContainerName, api.Object{
+		Name:    vpn.NetworkID,
+		Content: bytes.NewReader(buffer.Bytes()),
+	})
+}
+
+func (srv *VPNService) readVPN(networkID string) (*api.VPN, error) {
+	o, err := srv.provider.GetObject(api.VPNContainerName, networkID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	dec := gob.NewDecoder(&buffer)
+	var vpn api.VPN
+	err = dec.Decode(&vpn)
+	if err != nil {
+		return nil, err
+	}
+	return &vpn, nil
+}
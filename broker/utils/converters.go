@@ -17,6 +17,8 @@
 package utils
 
 import (
+	"time"
+
 	pb "github.com/CS-SI/SafeScale/broker"
 	"github.com/CS-SI/SafeScale/providers/api"
 	"github.com/CS-SI/SafeScale/system"
@@ -96,3 +98,166 @@ func ToPBNas(in *api.Nas) *pb.NasDefinition {
 		IsServer: in.IsServer,
 	}
 }
+
+//ToPBPublicIP converts an api.PublicIP into a PublicIP
+func ToPBPublicIP(in *api.PublicIP) *pb.PublicIP {
+	return &pb.PublicIP{
+		ID:   in.ID,
+		IP:   in.IP,
+		VMID: in.VMID,
+	}
+}
+
+//ToPBLoadBalancer converts an api.LoadBalancer into a LoadBalancer
+func ToPBLoadBalancer(in *api.LoadBalancer) *pb.LoadBalancer {
+	return &pb.LoadBalancer{
+		ID:              in.ID,
+		Name:            in.Name,
+		NetworkID:       in.NetworkID,
+		Protocol:        pb.LBProtocol(in.Protocol),
+		Port:            int32(in.Port),
+		BackendPort:     int32(in.BackendPort),
+		HealthCheckPath: in.HealthCheckPath,
+		VIP:             in.VIP,
+		Backends:        in.Backends,
+		HAProxy:         len(in.GatewayVMIDs) > 0,
+	}
+}
+
+//ToPBDNSRecord converts an api.DNSRecord into a DNSRecord
+func ToPBDNSRecord(in *api.DNSRecord) *pb.DNSRecord {
+	return &pb.DNSRecord{
+		Name:  in.Name,
+		Type:  in.Type,
+		Value: in.Value,
+		VMID:  in.VMID,
+	}
+}
+
+//ToPBVPN converts an api.VPN into a VPN, without the keys of the peers
+func ToPBVPN(in *api.VPN) *pb.VPN {
+	var peers []*pb.VPNPeer
+	for _, p := range in.Peers {
+		peers = append(peers, &pb.VPNPeer{
+			User: p.User,
+			IP:   p.IP,
+		})
+	}
+	return &pb.VPN{
+		NetworkID: in.NetworkID,
+		Endpoint:  in.Endpoint,
+		CIDR:      in.CIDR,
+		PublicKey: in.PublicKey,
+		Peers:     peers,
+	}
+}
+
+//ToPBVM converts an api.VM into a VM
+func ToPBVM(in *api.VM) *pb.VM {
+	return &pb.VM{
+		CPU:        int32(in.Size.Cores),
+		Disk:       int32(in.Size.DiskSize),
+		GatewayID:  in.GatewayID,
+		ID:         in.ID,
+		IP:         in.GetAccessIP(),
+		PrivateIP:  in.GetPrivateIP(),
+		Name:       in.Name,
+		PrivateKey: in.PrivateKey,
+		RAM:        in.Size.RAMSize,
+		State:      pb.VMState(in.State),
+	}
+}
+
+//ToPBNetworkVM converts an api.VM into a NetworkVM
+func ToPBNetworkVM(in *api.VM) *pb.NetworkVM {
+	publicIP := in.AccessIPv4
+	if publicIP == "" {
+		publicIP = in.AccessIPv6
+	}
+	return &pb.NetworkVM{
+		ID:         in.ID,
+		Name:       in.Name,
+		PrivateIPs: append(append([]string{}, in.PrivateIPsV4...), in.PrivateIPsV6...),
+		PublicIP:   publicIP,
+		State:      pb.VMState(in.State),
+	}
+}
+
+//ToPBNetworkTopology converts an api.NetworkTopology into a NetworkTopology
+func ToPBNetworkTopology(in *api.NetworkTopology) *pb.NetworkTopology {
+	out := &pb.NetworkTopology{
+		Network: &pb.Network{
+			ID:       in.Network.ID,
+			Name:     in.Network.Name,
+			CIDR:     in.Network.CIDR,
+			IPv6CIDR: in.Network.IPv6CIDR,
+		},
+	}
+	if in.Gateway != nil {
+		out.GatewayMode = pb.GatewayMode(in.Gateway.Mode)
+		out.VIP = in.Gateway.VIP
+	}
+	for i := range in.GatewayVMs {
+		out.Gateways = append(out.Gateways, ToPBNetworkVM(&in.GatewayVMs[i]))
+	}
+	for i := range in.VMs {
+		out.VMs = append(out.VMs, ToPBNetworkVM(&in.VMs[i]))
+	}
+	for i := range in.Nas {
+		out.Nas = append(out.Nas, ToPBNas(&in.Nas[i]))
+	}
+	for _, r := range in.SecurityRules {
+		out.SecurityRules = append(out.SecurityRules, &pb.SecurityRule{
+			Direction: r.Direction,
+			Protocol:  r.Protocol,
+			PortFrom:  int32(r.PortFrom),
+			PortTo:    int32(r.PortTo),
+			CIDR:      r.CIDR,
+		})
+	}
+	return out
+}
+
+//ToPBObjectInfo converts an api.Object (without its content) into an ObjectInfo
+func ToPBObjectInfo(container string, in *api.Object) *pb.ObjectInfo {
+	info := &pb.ObjectInfo{
+		Container:     container,
+		Name:          in.Name,
+		Metadata:      in.Metadata,
+		ContentType:   in.ContentType,
+		ContentLength: in.ContentLength,
+	}
+	if !in.DeleteAt.IsZero() {
+		info.DeleteAt = in.DeleteAt.Unix()
+	}
+	if !in.LastModified.IsZero() {
+		info.LastModified = in.LastModified.Unix()
+	}
+	return info
+}
+
+//ToAPIObject converts an ObjectInfo into an api.Object without content
+func ToAPIObject(in *pb.ObjectInfo) api.Object {
+	obj := api.Object{
+		Name:        in.GetName(),
+		Metadata:    in.GetMetadata(),
+		ContentType: in.GetContentType(),
+	}
+	if in.GetDeleteAt() != 0 {
+		obj.DeleteAt = time.Unix(in.GetDeleteAt(), 0)
+	}
+	return obj
+}
+
+//ToAPIRanges converts ranges given as strings into api.Range
+func ToAPIRanges(in []string) ([]api.Range, error) {
+	var ranges []api.Range
+	for _, s := range in {
+		r, err := api.ParseRange(s)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
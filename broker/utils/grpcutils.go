@@ -32,6 +32,14 @@ const (
 	TimeoutCtxDefault = 20 * time.Second
 	//TimeoutCtxVM timeout for grpc command relative to VM creation
 	TimeoutCtxVM = 2 * time.Minute
+	//TimeoutCtxVolume timeout for grpc command relative to volume resize or retype
+	TimeoutCtxVolume = 5 * time.Minute
+	//TimeoutCtxObject timeout for grpc command relative to object upload or download
+	TimeoutCtxObject = 30 * time.Minute
+	//TimeoutCtxLoadBalancer timeout for grpc command relative to load balancer creation or backend changes
+	TimeoutCtxLoadBalancer = 10 * time.Minute
+	//TimeoutCtxVPN timeout for grpc command relative to VPN enabling, WireGuard may have to be built on the gateway
+	TimeoutCtxVPN = 10 * time.Minute
 )
 
 //GetConnection returns a connection to GRPC server
@@ -16,11 +16,41 @@
 
 package Flavor
 
+import (
+	"fmt"
+	"strings"
+)
+
 //go:generate stringer -type=Enum
 
 //Enum represents the flavor of a cluster, in other words what technology is used behind the scene
 type Enum int
 
 const (
+	//DCOS is a cluster managed by Mesosphere DC/OS
 	DCOS Enum = iota
+	//K8S is a Kubernetes cluster installed with kubeadm
+	K8S
+	//Swarm is a Docker Swarm cluster
+	Swarm
+	//Slurm is a Slurm HPC cluster sharing its storage through NAS
+	Slurm
 )
+
+//FromString returns a Flavor.Enum corresponding to String
+func FromString(flavor string) (Enum, error) {
+	lowered := strings.ToLower(flavor)
+	if lowered == "dcos" {
+		return DCOS, nil
+	}
+	if lowered == "k8s" || lowered == "kubernetes" {
+		return K8S, nil
+	}
+	if lowered == "swarm" {
+		return Swarm, nil
+	}
+	if lowered == "slurm" {
+		return Slurm, nil
+	}
+	return 0, fmt.Errorf("incorrect flavor '%s'", flavor)
+}
@@ -17,11 +17,14 @@
 package api
 
 import (
+	"time"
+
 	providerapi "github.com/CS-SI/SafeScale/providers/api"
 
 	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
 	"github.com/CS-SI/SafeScale/perform/cluster/api/Complexity"
 	"github.com/CS-SI/SafeScale/perform/cluster/api/Flavor"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeState"
 	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
 
 	pb "github.com/CS-SI/SafeScale/broker"
@@ -46,6 +49,12 @@ type Request struct {
 	NetworkID string
 	//Tenant contains the name of the tenant
 	Tenant string
+	//KeepOnFailure keeps the infrastructure already created if the creation fails, for debugging
+	KeepOnFailure bool
+	//Spec contains the templates of the nodes and the resources to create with the cluster
+	Spec Spec
+	//Operation is the operation of performd creating the cluster, if any
+	Operation Operation
 }
 
 //ClusterAPI is an interface of methods associated to Cluster-like structs
@@ -56,23 +65,37 @@ type ClusterAPI interface {
 	Stop() error
 	//GetState returns the current state of the cluster
 	GetState() (ClusterState.Enum, error)
+	//GetHealthReport returns the health of each node collected with the last state of the cluster
+	GetHealthReport() []NodeHealth
 	//GetNetworkID returns the ID of the network used by the cluster
 	GetNetworkID() string
+	//GetLoad returns the load of the scheduler of the cluster
+	GetLoad() (*Load, error)
 
 	//AddNode adds a node
 	AddNode(NodeType.Enum, *pb.VMDefinition) (*pb.VM, error)
-	//DeleteNode deletes a node
+	//DeleteNode deletes a node based on its name or ID
 	DeleteNode(string) error
+	//ListMasters lists the masters in the cluster
+	ListMasters() ([]*pb.VM, error)
 	//ListNodes lists the nodes in the cluster
 	ListNodes() ([]*pb.VM, error)
-	//getNode returns a node based on its ID
+	//CountPrivateNodes returns the number of private nodes in the cluster, the nodes scaled by the autoscaler
+	CountPrivateNodes() int
+	//getNode returns a node based on its name or ID
 	GetNode(string) (*pb.VM, error)
 
+	//ResumeCreation creates what the interrupted creation of the cluster didn't create, then configures it
+	ResumeCreation() error
 	//Delete allows to destroy infrastructure of cluster
 	Delete() error
 
 	//GetDefinition
 	GetDefinition() Cluster
+	//SetAutoScaling replaces the autoscaling configuration of the cluster, WriteDefinition saves it
+	SetAutoScaling(AutoScaling)
+	//SetOperation replaces the operation in progress on the cluster, WriteDefinition saves it
+	SetOperation(Operation)
 	//SaveClusterDefinition
 	WriteDefinition() error
 	//ReadClusterDefinition
@@ -99,9 +122,127 @@ type Cluster struct {
 	Tenant string
 	//NetworkID is the ID of the network to use
 	NetworkID string
+	//AutoScaling configures the automatic addition and removal of nodes
+	AutoScaling AutoScaling
+	//Spec contains the templates of the nodes and the resources created with the cluster
+	Spec Spec
+	//Operation is the operation of performd in progress on the cluster, kept so an interrupted operation can be resumed
+	Operation Operation
+	//KeepOnFailure keeps the infrastructure already created if the creation fails, kept for a resumed creation
+	KeepOnFailure bool
+	//LastStateCollection contains the date of the last state collection
+	LastStateCollection time.Time
+	//NodesHealth contains the health of the nodes reported by the last state collection
+	NodesHealth []NodeHealth
+}
+
+//Operation is an asynchronous operation of performd on a cluster
+type Operation struct {
+	//ID identifies the operation, empty if no operation is in progress
+	ID string
+	//Type is the type of the operation; can be create, delete, start, stop, add-node or remove-node
+	Type string
+	//Node references the node added or removed by the operation
+	Node string
+	//Started contains the date the operation was started
+	Started time.Time
+}
+
+//AutoScaling configures the autoscaler of a cluster, which adds private nodes while tasks are pending
+//and removes the idle ones, within bounds and respecting cooldowns
+type AutoScaling struct {
+	//Enabled is true if the autoscaler manages the nodes of the cluster
+	Enabled bool
+	//MinNodes is the number of private nodes under which nodes are added whatever the load
+	MinNodes int
+	//MaxNodes is the number of private nodes the autoscaler never goes beyond
+	MaxNodes int
+	//ScaleUpCooldown is the time after a scaling before a node can be added
+	ScaleUpCooldown time.Duration
+	//ScaleDownCooldown is the time after a scaling before a node can be removed
+	ScaleDownCooldown time.Duration
+	//CPU is the number of cores of the nodes added
+	CPU int32
+	//RAM is the memory in GB of the nodes added
+	RAM float32
+	//Disk is the disk size in GB of the nodes added
+	Disk int32
+	//LastScaling contains the date of the last addition or removal of a node by the autoscaler
+	LastScaling time.Time
+}
+
+//Load reports the load of the scheduler of a cluster
+type Load struct {
+	//PendingTasks is the number of tasks (Marathon tasks, pods, services tasks or jobs) waiting for resources
+	PendingTasks int
+	//IdleNodes contains the IDs of the private nodes running no task, which can be removed
+	IdleNodes []string
+}
+
+//NodeHealth reports the health of a node of the cluster
+type NodeHealth struct {
+	//ID is the ID of the VM of the node
+	ID string
+	//Name is the name of the VM of the node
+	Name string
+	//Type is the role of the node in the cluster
+	Type NodeType.Enum
+	//State is Started if the services of the node are healthy, Disabled if they are not, Stopped if its VM is stopped
+	State NodeState.Enum
+	//Message explains why the node is not healthy
+	Message string
 }
 
 //GetNetworkID returns the ID of the Network used by the cluster
 func (c *Cluster) GetNetworkID() string {
 	return c.NetworkID
 }
+
+//GetDefinition returns the public properties of the cluster
+func (c *Cluster) GetDefinition() Cluster {
+	return *c
+}
+
+//GetHealthReport returns the health of each node collected with the last state of the cluster
+func (c *Cluster) GetHealthReport() []NodeHealth {
+	return c.NodesHealth
+}
+
+//SetAutoScaling replaces the autoscaling configuration of the cluster, WriteDefinition saves it
+func (c *Cluster) SetAutoScaling(autoScaling AutoScaling) {
+	c.AutoScaling = autoScaling
+}
+
+//SetOperation replaces the operation in progress on the cluster, WriteDefinition saves it
+func (c *Cluster) SetOperation(operation Operation) {
+	c.Operation = operation
+}
+
+//StateFromHealth computes the state of the cluster from the health of its nodes
+//The cluster is in error if a quorum of masters is not healthy, and degraded if any of its nodes is not healthy
+func StateFromHealth(report []NodeHealth) ClusterState.Enum {
+	masters, healthyMasters, stopped, healthy := 0, 0, 0, 0
+	for _, h := range report {
+		if h.Type == NodeType.Master {
+			masters++
+			if h.State == NodeState.Started {
+				healthyMasters++
+			}
+		}
+		switch h.State {
+		case NodeState.Stopped:
+			stopped++
+		case NodeState.Started:
+			healthy++
+		}
+	}
+	switch {
+	case stopped == len(report):
+		return ClusterState.Stopped
+	case healthyMasters <= masters/2:
+		return ClusterState.Error
+	case healthy < len(report):
+		return ClusterState.Degraded
+	}
+	return ClusterState.Nominal
+}
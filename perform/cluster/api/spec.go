@@ -0,0 +1,139 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+//Spec contains what a cluster definition file specifies besides the name, flavor, complexity and CIDR of the cluster
+type Spec struct {
+	//Templates size the nodes of each role
+	Templates Templates `yaml:"templates,omitempty"`
+	//Nodes are the numbers of agent nodes created with the cluster
+	Nodes NodeCounts `yaml:"nodes,omitempty"`
+	//Volumes are attached to the nodes of their role
+	Volumes []VolumeSpec `yaml:"volumes,omitempty"`
+	//Nas are exported by the first master and mounted on every agent node
+	Nas []NasSpec `yaml:"nas,omitempty"`
+	//Components are deployed once the cluster is created
+	Components []string `yaml:"components,omitempty"`
+	//Labels are free key/value pairs kept with the cluster
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+//NodeTemplate sizes the VMs of the nodes of a role, the fields not set are given by the flavor of the cluster
+type NodeTemplate struct {
+	//CPU is the number of cores
+	CPU int32 `yaml:"cpu,omitempty"`
+	//RAM is the memory in GB
+	RAM float32 `yaml:"ram,omitempty"`
+	//Disk is the size of the system disk in GB
+	Disk int32 `yaml:"disk,omitempty"`
+	//OS is the name of the image
+	OS string `yaml:"os,omitempty"`
+}
+
+//Templates contains the templates of the nodes of each role
+type Templates struct {
+	//Bootstrap sizes the bootstrap server of DCOS clusters
+	Bootstrap NodeTemplate `yaml:"bootstrap,omitempty"`
+	//Master sizes the masters (the managers of Swarm clusters, the controller of Slurm clusters)
+	Master NodeTemplate `yaml:"master,omitempty"`
+	//PrivateNode sizes the private agent nodes
+	PrivateNode NodeTemplate `yaml:"private_node,omitempty"`
+	//PublicNode sizes the public agent nodes
+	PublicNode NodeTemplate `yaml:"public_node,omitempty"`
+}
+
+//NodeCounts contains the numbers of agent nodes by type
+type NodeCounts struct {
+	//Private is the number of private agent nodes
+	Private int `yaml:"private,omitempty"`
+	//Public is the number of public agent nodes
+	Public int `yaml:"public,omitempty"`
+}
+
+//VolumeSpec describes a volume attached to each node of a role, named after the node
+type VolumeSpec struct {
+	//Name is the suffix of the name of the volumes, '<node name>-<name>'
+	Name string `yaml:"name"`
+	//Role is the role of the nodes; can be master, private or public
+	Role string `yaml:"role"`
+	//Size is the size of the volumes in GB
+	Size int32 `yaml:"size"`
+	//Speed is the speed of the volumes; can be COLD, HDD or SSD
+	Speed string `yaml:"speed,omitempty"`
+	//Path is the mount point of the volumes
+	Path string `yaml:"path"`
+	//Format is the filesystem of the volumes
+	Format string `yaml:"format,omitempty"`
+}
+
+//NasSpec describes a path of the first master exported as NAS and mounted on the same path of every agent node
+type NasSpec struct {
+	//Name is the suffix of the name of the NAS, '<cluster name>-<name>'
+	Name string `yaml:"name"`
+	//Path is the exported path and the mount point
+	Path string `yaml:"path"`
+}
+
+//Or returns the template with the fields not set taken from defaults
+func (t NodeTemplate) Or(defaults NodeTemplate) NodeTemplate {
+	if t.CPU == 0 {
+		t.CPU = defaults.CPU
+	}
+	if t.RAM == 0 {
+		t.RAM = defaults.RAM
+	}
+	if t.Disk == 0 {
+		t.Disk = defaults.Disk
+	}
+	if t.OS == "" {
+		t.OS = defaults.OS
+	}
+	return t
+}
+
+//Complete sets the sizing not set of req and its image from the template
+func (t NodeTemplate) Complete(req *pb.VMDefinition) {
+	if req.CPUNumber == 0 {
+		req.CPUNumber = t.CPU
+	}
+	if req.RAM == 0 {
+		req.RAM = t.RAM
+	}
+	if req.Disk == 0 {
+		req.Disk = t.Disk
+	}
+	req.ImageID = t.OS
+}
+
+//ForNodeType returns the template of the agent nodes of type nodeType, the masters one for other types
+func (t Templates) ForNodeType(nodeType NodeType.Enum) NodeTemplate {
+	switch nodeType {
+	case NodeType.PrivateAgent:
+		return t.PrivateNode
+	case NodeType.PublicAgent:
+		return t.PublicNode
+	case NodeType.Bootstrap:
+		return t.Bootstrap
+	}
+	return t.Master
+}
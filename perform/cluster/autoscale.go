@@ -0,0 +1,168 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+//Locker reserves the clusters for the autoscaler, so that a cluster is never modified by the autoscaler
+//and by another action at the same time
+type Locker interface {
+	//TryLock reserves the cluster named name, it returns false if the cluster is busy
+	TryLock(name string) bool
+	//Unlock releases the cluster named name
+	Unlock(name string)
+}
+
+//RunAutoscaler autoscales every interval the clusters with autoscaling enabled, until stop is closed
+//The clusters are reserved with locker while they are autoscaled
+func RunAutoscaler(interval time.Duration, stop <-chan struct{}, locker Locker) {
+	for {
+		autoscaleAll(locker)
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+//autoscaleAll autoscales the clusters with autoscaling enabled, the failures are only logged so the other clusters are still managed
+func autoscaleAll(locker Locker) {
+	clusters, err := List()
+	if err != nil {
+		log.Printf("failed to list clusters: %s", err.Error())
+		return
+	}
+	for _, c := range clusters {
+		if !c.AutoScaling.Enabled {
+			continue
+		}
+		err = autoscaleCluster(c.Name, locker)
+		if err != nil {
+			log.Printf("failed to autoscale cluster '%s': %s", c.Name, err.Error())
+		}
+	}
+}
+
+//autoscaleCluster autoscales the cluster named name if it's not busy
+//The nodes of a cluster are left to the operation in progress on it, if any
+func autoscaleCluster(name string, locker Locker) error {
+	if !locker.TryLock(name) {
+		return nil
+	}
+	defer locker.Unlock(name)
+	// The cluster is read once reserved, the operation of another process may still be in progress
+	instance, err := Get(name)
+	if err != nil || instance == nil {
+		return err
+	}
+	if instance.GetDefinition().Operation.ID != "" {
+		return nil
+	}
+	return Autoscale(instance)
+}
+
+//Autoscale adds or removes at most one private node of the cluster following the load of its scheduler
+//A node is added while tasks are pending, an idle node is removed when no task is pending, once the cooldown
+//following the last scaling is over; the bounds of the configuration are enforced whatever the cooldowns
+func Autoscale(instance clusterapi.ClusterAPI) error {
+	autoScaling := instance.GetDefinition().AutoScaling
+	if !autoScaling.Enabled {
+		return nil
+	}
+	// Nodes can be added or removed only if the scheduler is running
+	state, err := instance.GetState()
+	if err != nil {
+		return err
+	}
+	if state != ClusterState.Nominal && state != ClusterState.Degraded {
+		return nil
+	}
+
+	// The public nodes are not scaled, the bounds apply to the private nodes only
+	count := instance.CountPrivateNodes()
+	if count < autoScaling.MinNodes {
+		return scaleUp(instance, fmt.Sprintf("%d private nodes, minimum is %d", count, autoScaling.MinNodes))
+	}
+
+	load, err := instance.GetLoad()
+	if err != nil {
+		return err
+	}
+	if count > autoScaling.MaxNodes && len(load.IdleNodes) > 0 {
+		return scaleDown(instance, load.IdleNodes[0], fmt.Sprintf("%d private nodes, maximum is %d", count, autoScaling.MaxNodes))
+	}
+
+	now := time.Now()
+	switch {
+	case load.PendingTasks > 0 && count < autoScaling.MaxNodes:
+		if now.Before(autoScaling.LastScaling.Add(autoScaling.ScaleUpCooldown)) {
+			return nil
+		}
+		return scaleUp(instance, fmt.Sprintf("%d pending tasks", load.PendingTasks))
+	case load.PendingTasks == 0 && len(load.IdleNodes) > 0 && count > autoScaling.MinNodes:
+		if now.Before(autoScaling.LastScaling.Add(autoScaling.ScaleDownCooldown)) {
+			return nil
+		}
+		return scaleDown(instance, load.IdleNodes[0], fmt.Sprintf("%d idle nodes", len(load.IdleNodes)))
+	}
+	return nil
+}
+
+//scaleUp adds a private node sized following the autoscaling configuration, then records the date of the scaling
+func scaleUp(instance clusterapi.ClusterAPI, reason string) error {
+	name := instance.GetDefinition().Name
+	autoScaling := instance.GetDefinition().AutoScaling
+	log.Printf("Adding a node to cluster '%s': %s", name, reason)
+	_, err := AddNode(instance, NodeType.PrivateAgent, &pb.VMDefinition{
+		CPUNumber: autoScaling.CPU,
+		RAM:       autoScaling.RAM,
+		Disk:      autoScaling.Disk,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add node: %s", err.Error())
+	}
+	// AddNode updated the definition, the autoscaling configuration is read again
+	autoScaling = instance.GetDefinition().AutoScaling
+	autoScaling.LastScaling = time.Now()
+	instance.SetAutoScaling(autoScaling)
+	return instance.WriteDefinition()
+}
+
+//scaleDown removes the idle node identified by id, then records the date of the scaling
+func scaleDown(instance clusterapi.ClusterAPI, id string, reason string) error {
+	name := instance.GetDefinition().Name
+	log.Printf("Removing node '%s' from cluster '%s': %s", id, name, reason)
+	err := DeleteNode(instance, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove node '%s': %s", id, err.Error())
+	}
+	autoScaling := instance.GetDefinition().AutoScaling
+	autoScaling.LastScaling = time.Now()
+	instance.SetAutoScaling(autoScaling)
+	return instance.WriteDefinition()
+}
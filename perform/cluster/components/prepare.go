@@ -19,6 +19,7 @@ package components
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"text/template"
 
 	rice "github.com/GeertJohan/go.rice"
@@ -73,3 +74,49 @@ func RealizeBuildScript(component string, data map[string]interface{}) (string,
 	}
 	return dataBuffer.String(), nil
 }
+
+//installScriptName returns the name of the script deploying component on a cluster of flavor
+func installScriptName(flavor string, component string) string {
+	return strings.ToLower(flavor) + "_install_" + component + ".sh"
+}
+
+//CheckInstallScript returns an error if component can't be deployed on a cluster of flavor
+func CheckInstallScript(flavor string, component string) error {
+	b, err := getTemplateBox()
+	if err != nil {
+		return err
+	}
+	_, err = b.String(installScriptName(flavor, component))
+	if err != nil {
+		return fmt.Errorf("component '%s' not available for flavor '%s'", component, flavor)
+	}
+	return nil
+}
+
+//RealizeInstallScript creates the string corresponding to the script
+// deploying component on a cluster of flavor, executed on its first master
+func RealizeInstallScript(flavor string, component string, data map[string]interface{}) (string, error) {
+	// find the rice.Box
+	b, err := getTemplateBox()
+	if err != nil {
+		return "", err
+	}
+	scriptName := installScriptName(flavor, component)
+	// get file contents as string
+	tmplString, err := b.String(scriptName)
+	if err != nil {
+		return "", fmt.Errorf("error loading script template '%s': %s", scriptName, err.Error())
+	}
+	// Parse the template
+	tmplPrepared, err := template.New(scriptName).Parse(tmplString)
+	if err != nil {
+		return "", fmt.Errorf("error parsing script template '%s': %s", scriptName, err.Error())
+	}
+	// realize the template
+	dataBuffer := bytes.NewBufferString("")
+	err = tmplPrepared.Execute(dataBuffer, data)
+	if err != nil {
+		return "", fmt.Errorf("error realizing script template '%s': %s", scriptName, err.Error())
+	}
+	return dataBuffer.String(), nil
+}
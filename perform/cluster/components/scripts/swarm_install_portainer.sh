@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+##################################################
+# Deploys Portainer on the managers of the swarm #
+##################################################
+
+# This script must be executed on a manager node.
+docker service inspect portainer >/dev/null 2>&1 && exit 0
+
+docker service create --name portainer \
+    --publish 9000:9000 \
+    --constraint node.role==manager \
+    --mount type=bind,src=/var/run/docker.sock,dst=/var/run/docker.sock \
+    --label cluster={{.ClusterName}} \
+    portainer/portainer -H unix:///var/run/docker.sock
+exit $?
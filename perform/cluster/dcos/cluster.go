@@ -17,14 +17,9 @@
 package dcos
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"log"
-	"os/exec"
 	"strconv"
-	"syscall"
-	"text/template"
 	"time"
 
 	rice "github.com/GeertJohan/go.rice"
@@ -32,9 +27,12 @@ import (
 	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
 	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
 	"github.com/CS-SI/SafeScale/perform/cluster/api/Complexity"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeState"
 	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
 	"github.com/CS-SI/SafeScale/perform/cluster/components"
 	"github.com/CS-SI/SafeScale/perform/utils"
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api/VMState"
 
 	pb "github.com/CS-SI/SafeScale/broker"
 )
@@ -45,14 +43,34 @@ const (
 	dcosVersion string = "1.11.1"
 
 	timeoutCtxVM = 10 * time.Minute
+
+	//defaultStateCollectInterval is the time the collected state of a new cluster is kept before being collected again
+	defaultStateCollectInterval = 5 * time.Minute
+
+	//bootstrapHealthURL is served by the nginx of the bootstrap server
+	bootstrapHealthURL = "http://localhost:80/dcos_install.sh"
+	//mesosMasterHealthURL is the health endpoint of the Mesos master running on the masters
+	mesosMasterHealthURL = "http://localhost:5050/health"
+	//mesosAgentHealthURL is the health endpoint of the Mesos agent running on the agents
+	mesosAgentHealthURL = "http://localhost:5051/health"
+
+	//timeoutServices is the time the DCOS services are given to be healthy once their VMs are started
+	timeoutServices = 10 * time.Minute
 )
 
 var (
-	// templateBox is the rice box to use in this package
-	templateBox *rice.Box
-
-	//installCommonsContent contains the script to install/configure common components
-	installCommonsContent *string
+	//scripts gives the script templates of the package
+	scripts = utils.NewScriptBox(func() (*rice.Box, error) {
+		return rice.FindBox("../dcos/scripts")
+	}, "dcos_install_node_commons.sh", map[string]interface{}{})
+
+	//defaultTemplates size the nodes whose template is not set in the definition of the cluster
+	defaultTemplates = clusterapi.Templates{
+		Bootstrap:   clusterapi.NodeTemplate{CPU: 4, RAM: 32.0, Disk: 120, OS: "CentOS 7.3"},
+		Master:      clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 60, OS: "CentOS 7.3"},
+		PrivateNode: clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "CentOS 7.3"},
+		PublicNode:  clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "CentOS 7.3"},
+	}
 )
 
 //Definition defines the values we want to keep in Object Storage
@@ -84,7 +102,13 @@ type Definition struct {
 	//PrivateAvgentIPs contains a list of IP of the Private Agent Nodes
 	PrivateAgentIPs []string
 
-	//StateCollectInterval in seconds
+	//LastAgentIndex is the index in the name of the last agent created, so that each agent gets a new name
+	LastAgentIndex int
+
+	//Configured is true once the bootstrap and master servers are configured
+	Configured bool
+
+	//StateCollectInterval is the time the collected state is kept before being collected again
 	StateCollectInterval time.Duration
 }
 
@@ -92,193 +116,276 @@ type Definition struct {
 type Cluster struct {
 	//Definition contains data defining the cluster
 	*Definition
-
-	//LastStateCollect contains the date of the last state collection
-	lastStateCollection time.Time
-}
-
-//GetNetworkID returns the ID of the network used by the cluster
-func (c *Cluster) GetNetworkID() string {
-	return c.Definition.Cluster.GetNetworkID()
 }
 
 //NewCluster creates the necessary infrastructure of cluster
+//If the creation fails, the infrastructure already created is deleted unless req.KeepOnFailure is set
 func NewCluster(req clusterapi.Request) (clusterapi.ClusterAPI, error) {
-	// Create a KeyPair for the cluster
-	svc, err := utils.GetProviderService()
-	if err != nil {
-		return nil, err
-	}
-	kpName := "cluster_" + req.Name + "_key"
-	svc.DeleteKeyPair(kpName)
-	kp, err := svc.CreateKeyPair(kpName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Key Pair: %s", err.Error())
-	}
-	defer svc.DeleteKeyPair(kpName)
-
-	var masterCount int
-	//	var keypair *providerapi.KeyPair
-
-	// Saving cluster parameters, with status 'Creating'
+	// Saving cluster parameters, with status 'Creating', so the infrastructure can be deleted if anything fails
 	instance := Cluster{
 		Definition: &Definition{
 			Cluster: clusterapi.Cluster{
-				Name:       req.Name,
-				State:      ClusterState.Creating,
-				Complexity: req.Complexity,
-				Tenant:     req.Tenant,
-				NetworkID:  req.NetworkID,
-				Keypair:    kp,
+				Name:          req.Name,
+				CIDR:          req.CIDR,
+				State:         ClusterState.Creating,
+				Complexity:    req.Complexity,
+				Tenant:        req.Tenant,
+				NetworkID:     req.NetworkID,
+				Spec:          req.Spec,
+				Operation:     req.Operation,
+				KeepOnFailure: req.KeepOnFailure,
 			},
+			StateCollectInterval: defaultStateCollectInterval,
 		},
 	}
-
-	// Creates bootstrap/upgrade server
-	log.Printf("Creating DCOS Bootstrap server")
-	_, err = instance.addBootstrap()
-	if err != nil {
-		err = fmt.Errorf("failed to create DCOS bootstrap server: %s", err.Error())
-		goto cleanNetwork
-	}
-
-	err = instance.WriteDefinition()
+	err := instance.WriteDefinition()
 	if err != nil {
 		err = fmt.Errorf("failed to create cluster '%s': %s", req.Name, err.Error())
-		goto cleanBootstrap
+		goto cleanup
 	}
 
-	switch req.Complexity {
-	case Complexity.Dev:
-		masterCount = 1
-	case Complexity.Normal:
-		masterCount = 3
-	case Complexity.Volume:
-		masterCount = 5
-	}
-
-	log.Printf("Creating DCOS Master servers (%d)", masterCount)
-	for i := 1; i <= masterCount; i++ {
-		// Creates Master Node
-		_, err = instance.addMaster()
-		if err != nil {
-			err = fmt.Errorf("failed to add DCOS Master %d: %s", i, err.Error())
-			goto cleanMasters
-		}
-	}
-
-	log.Printf("Configuring cluster")
-	err = instance.configure()
+	err = instance.create()
 	if err != nil {
-		err = fmt.Errorf("failed to configure DCOS cluster: %s", err.Error())
-		goto cleanMasters
-	}
-
-	// Cluster created and configured successfully, saving again to Object Storage
-	instance.Definition.Cluster.State = ClusterState.Created
-	err = instance.WriteDefinition()
-	if err != nil {
-		goto cleanMasters
+		goto cleanup
 	}
 
 	log.Printf("Cluster '%s' created and initialized successfully", req.Name)
 	return &instance, nil
 
-cleanMasters:
-	//for _, id := range instance.definition.MasterIDs {
-	//	utils.DeleteVM(id)
-	//}
-cleanBootstrap:
-	//utils.DeleteVM(instance.definition.BootstrapID)
-cleanNetwork:
-	//utils.DeleteNetwork(instance.definition.Common.NetworkID)
-	//instance.RemoveDefinition()
+cleanup:
+	utils.AbortCreation(&instance, req.KeepOnFailure)
 	return nil, err
 }
 
-//GetName returns the name of the cluster
-func (c *Cluster) GetName() string {
-	return c.Definition.Cluster.Name
+//ResumeCreation creates what the interrupted creation of the cluster didn't create, then configures it
+func (c *Cluster) ResumeCreation() error {
+	return c.create()
 }
 
-//getTemplateBox
-func getTemplateBox() (*rice.Box, error) {
-	if templateBox == nil {
-		b, err := rice.FindBox("../dcos/scripts")
+//create creates the servers missing from the definition of the cluster, then configures it if it isn't already
+//Each step is saved in the definition, so an interrupted creation resumes from the last step done
+func (c *Cluster) create() error {
+	var masterCount int
+	var err error
+
+	// Create a KeyPair for the cluster
+	if c.Definition.Cluster.Keypair == nil {
+		c.Definition.Cluster.Keypair, err = utils.CreateKeyPair(c.Definition.Cluster.Name)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		templateBox = b
 	}
-	return templateBox, nil
-}
 
-//getInstallCommons returns the string corresponding to the script dcos_install_node_commons.sh
-// which installs common components (docker in particular)
-func getInstallCommons() (*string, error) {
-	if installCommonsContent == nil {
-		// find the rice.Box
-		b, err := getTemplateBox()
+	// Creates bootstrap/upgrade server
+	if c.Definition.BootstrapID == "" {
+		log.Printf("Creating DCOS Bootstrap server")
+		_, err = c.addBootstrap()
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to create DCOS bootstrap server: %s", err.Error())
 		}
+	}
+
+	switch c.Definition.Cluster.Complexity {
+	case Complexity.Dev:
+		masterCount = 1
+	case Complexity.Normal:
+		masterCount = 3
+	case Complexity.Volume:
+		masterCount = 5
+	}
 
-		// get file contents as string
-		tmplString, err := b.String("dcos_install_node_commons.sh")
+	if len(c.Definition.MasterIDs) < masterCount {
+		log.Printf("Creating DCOS Master servers (%d)", masterCount-len(c.Definition.MasterIDs))
+	}
+	for i := len(c.Definition.MasterIDs) + 1; i <= masterCount; i++ {
+		// Creates Master Node
+		_, err = c.addMaster()
 		if err != nil {
-			return nil, fmt.Errorf("error loading script template: %s", err.Error())
+			return fmt.Errorf("failed to add DCOS Master %d: %s", i, err.Error())
 		}
+	}
 
-		// parse then execute the template
-		tmplPrepared, err := template.New("install_commons").Parse(tmplString)
+	if !c.Definition.Configured {
+		log.Printf("Configuring cluster")
+		err = c.configure()
 		if err != nil {
-			return nil, fmt.Errorf("error parsing script template: %s", err.Error())
+			return fmt.Errorf("failed to configure DCOS cluster: %s", err.Error())
 		}
-		dataBuffer := bytes.NewBufferString("")
-		err = tmplPrepared.Execute(dataBuffer, map[string]interface{}{})
+		c.Definition.Configured = true
+		err = c.WriteDefinition()
 		if err != nil {
-			return nil, fmt.Errorf("error realizing script template: %s", err.Error())
+			return err
 		}
-		result := dataBuffer.String()
-		installCommonsContent = &result
 	}
-	return installCommonsContent, nil
+
+	// Cluster created and configured successfully, saving again to Object Storage
+	c.Definition.Cluster.State = ClusterState.Created
+	return c.WriteDefinition()
 }
 
-//Start starts the cluster named 'name'
+//GetName returns the name of the cluster
+func (c *Cluster) GetName() string {
+	return c.Definition.Cluster.Name
+}
+
+//Start starts the bootstrap server, then the masters, then the agents once a quorum of masters is healthy
+//The cluster is Nominal when Start returns without error
 func (c *Cluster) Start() error {
-	state, _ := c.ForceGetState()
-	if state == ClusterState.Stopped {
-		// 1st starts the masters
-		// 2nd start the agents
-		// 3nd start the nodes
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Nominal:
+		return fmt.Errorf("Can't start an already started cluster")
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't start a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("Can't start an already started cluster")
+	log.Printf("Starting DCOS Bootstrap server")
+	err = utils.SetNodesState(svc, []string{c.Definition.BootstrapID}, VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting DCOS Master servers")
+	err = utils.SetNodesState(svc, c.Definition.MasterIDs, VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	err = c.waitMastersQuorum(svc)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting DCOS Agent nodes")
+	err = utils.SetNodesState(svc, append(append([]string{}, c.Definition.PrivateAgentIDs...), c.Definition.PublicAgentIDs...), VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	return utils.WaitNominal(c.ForceGetState, timeoutServices)
 }
 
-//Stop stops the cluster is its current state is compatible
+//Stop stops the agents, then the masters, then the bootstrap server
 func (c *Cluster) Stop() error {
-	state, _ := c.ForceGetState()
-	if state != ClusterState.Stopped && state != ClusterState.Creating {
-		return c.Stop()
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Stopped:
+		return nil
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't stop a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping DCOS Agent nodes")
+	err = utils.SetNodesState(svc, append(append([]string{}, c.Definition.PrivateAgentIDs...), c.Definition.PublicAgentIDs...), VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping DCOS Master servers")
+	err = utils.SetNodesState(svc, c.Definition.MasterIDs, VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping DCOS Bootstrap server")
+	err = utils.SetNodesState(svc, []string{c.Definition.BootstrapID}, VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	state, err = c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	if state != ClusterState.Stopped {
+		return fmt.Errorf("cluster still in state '%s' once its nodes are stopped", state.String())
 	}
 	return nil
 }
 
-//GetState returns the current state of the cluster
-func (c *Cluster) GetState() (ClusterState.Enum, error) {
-	now := time.Now()
-	if now.After(c.lastStateCollection.Add(c.Definition.StateCollectInterval)) {
-		return c.ForceGetState()
+//waitMastersQuorum waits for a quorum of masters to be healthy, so the agents can join the cluster
+func (c *Cluster) waitMastersQuorum(svc *providers.Service) error {
+	deadline := time.Now().Add(timeoutServices)
+	for {
+		healthy := 0
+		for _, id := range c.Definition.MasterIDs {
+			if utils.CheckNode(svc, id, NodeType.Master, mesosMasterHealthURL).State == NodeState.Started {
+				healthy++
+			}
+		}
+		if healthy > len(c.Definition.MasterIDs)/2 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("only %d of %d masters healthy after %v", healthy, len(c.Definition.MasterIDs), timeoutServices)
+		}
+		time.Sleep(utils.HealthCheckDelay)
 	}
-	return c.Definition.Cluster.State, nil
+}
+
+//GetState returns the last collected state of the cluster, collected again if older than StateCollectInterval
+func (c *Cluster) GetState() (ClusterState.Enum, error) {
+	return utils.GetState(&c.Definition.Cluster, c.Definition.StateCollectInterval, c.ForceGetState)
 }
 
 //ForceGetState returns the current state of the cluster
 // This method will trigger a effective state collection at each call
 func (c *Cluster) ForceGetState() (ClusterState.Enum, error) {
-	// Do effective state collection
-	return ClusterState.Error, nil
+	state := c.Definition.Cluster.State
+	if state == ClusterState.Creating || state == ClusterState.Removed {
+		return state, nil
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return ClusterState.Error, err
+	}
+	report := []clusterapi.NodeHealth{
+		utils.CheckNode(svc, c.Definition.BootstrapID, NodeType.Bootstrap, bootstrapHealthURL),
+	}
+	for _, id := range c.Definition.MasterIDs {
+		report = append(report, utils.CheckNode(svc, id, NodeType.Master, mesosMasterHealthURL))
+	}
+	for _, id := range c.Definition.PrivateAgentIDs {
+		report = append(report, utils.CheckNode(svc, id, NodeType.PrivateAgent, mesosAgentHealthURL))
+	}
+	for _, id := range c.Definition.PublicAgentIDs {
+		report = append(report, utils.CheckNode(svc, id, NodeType.PublicAgent, mesosAgentHealthURL))
+	}
+
+	c.Definition.Cluster.State = clusterapi.StateFromHealth(report)
+	c.Definition.Cluster.NodesHealth = report
+	c.Definition.Cluster.LastStateCollection = time.Now()
+	err = c.WriteDefinition()
+	if err != nil {
+		log.Printf("failed to save state of cluster '%s': %s", c.Definition.Cluster.Name, err.Error())
+	}
+	return c.Definition.Cluster.State, nil
+}
+
+//GetLoad returns the number of Marathon tasks waiting for Mesos offers, the idle nodes being the private agents without used resources
+func (c *Cluster) GetLoad() (*clusterapi.Load, error) {
+	retcode, output, err := scripts.Execute(c.Definition.MasterIDs[0], "dcos_get_load.sh", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if retcode != 0 {
+		return nil, fmt.Errorf("scripted load collection failed with error code %d:\n%s", retcode, *output)
+	}
+	addresses := map[string]string{}
+	for i, ip := range c.Definition.PrivateAgentIPs {
+		addresses[ip] = c.Definition.PrivateAgentIDs[i]
+	}
+	return utils.ParseLoad(*output, addresses)
 }
 
 //AddNode adds a node
@@ -298,12 +405,13 @@ func (c *Cluster) AddNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*pb.VM,
 //addBootstrap
 func (c *Cluster) addBootstrap() (*pb.VM, error) {
 	name := c.Definition.Cluster.Name + "-dcosbootstrap"
-	bootstrapVM, err := utils.CreateVM(&pb.VMDefinition{
+	tpl := c.Definition.Cluster.Spec.Templates.Bootstrap.Or(defaultTemplates.Bootstrap)
+	bootstrapVM, err := utils.AdoptOrCreateVM(&pb.VMDefinition{
 		Name:      name,
-		CPUNumber: 4,
-		RAM:       32.0,
-		Disk:      120,
-		ImageID:   "CentOS 7.3",
+		CPUNumber: tpl.CPU,
+		RAM:       tpl.RAM,
+		Disk:      tpl.Disk,
+		ImageID:   tpl.OS,
 		Network:   c.Definition.Cluster.NetworkID,
 		Public:    true,
 	})
@@ -331,13 +439,14 @@ func (c *Cluster) addBootstrap() (*pb.VM, error) {
 func (c *Cluster) addMaster() (*pb.VM, error) {
 	i := len(c.Definition.MasterIDs) + 1
 	name := c.Definition.Cluster.Name + "-dcosmaster-" + strconv.Itoa(i)
+	tpl := c.Definition.Cluster.Spec.Templates.Master.Or(defaultTemplates.Master)
 
-	masterVM, err := utils.CreateVM(&pb.VMDefinition{
+	masterVM, err := utils.AdoptOrCreateVM(&pb.VMDefinition{
 		Name:      name,
-		CPUNumber: 4,
-		RAM:       16.0,
-		Disk:      60,
-		ImageID:   "CentOS 7.3",
+		CPUNumber: tpl.CPU,
+		RAM:       tpl.RAM,
+		Disk:      tpl.Disk,
+		ImageID:   tpl.OS,
 		Network:   c.Definition.Cluster.NetworkID,
 		Public:    true,
 	})
@@ -345,18 +454,10 @@ func (c *Cluster) addMaster() (*pb.VM, error) {
 		return nil, fmt.Errorf("failed to create Master server %d: %s", i, err.Error())
 	}
 
-	// Registers the new Master in the cluster struct
-	c.Definition.MasterIDs = append(c.Definition.MasterIDs, masterVM.ID)
-	c.Definition.MasterIPs = append(c.Definition.MasterIPs, masterVM.IP)
-
-	// Update cluster definition in Object Storage
-	err = c.WriteDefinition()
+	// Registers the new Master in the cluster struct and updates the cluster definition in Object Storage
+	err = utils.RegisterNode(masterVM.ID, masterVM.IP, &c.Definition.MasterIDs, &c.Definition.MasterIPs, c.WriteDefinition)
 	if err != nil {
-		// Object Storage failed, removes the ID we just added to the cluster struct
-		c.Definition.MasterIDs = c.Definition.MasterIDs[:len(c.Definition.MasterIDs)-1]
-		c.Definition.MasterIPs = c.Definition.MasterIPs[:len(c.Definition.MasterIPs)-1]
-		utils.DeleteVM(masterVM.ID)
-		return nil, fmt.Errorf("failed to update Cluster definition: %s", err.Error())
+		return nil, err
 	}
 
 	return masterVM, nil
@@ -374,14 +475,20 @@ func (c *Cluster) addAgentNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*p
 		coreName = "priv" + coreName
 	}
 
-	i := len(c.Definition.PublicAgentIDs) + 1
+	// Definitions written before LastAgentIndex existed have named at most as many agents as they count
+	if c.Definition.LastAgentIndex == 0 {
+		c.Definition.LastAgentIndex = len(c.Definition.PublicAgentIDs) + len(c.Definition.PrivateAgentIDs)
+	}
+	c.Definition.LastAgentIndex++
+	i := c.Definition.LastAgentIndex
 	req.Public = publicIP
 	req.Network = c.Definition.Cluster.NetworkID
 	req.Name = c.Definition.Cluster.Name + "-dcos" + coreName + "-" + strconv.Itoa(i)
-	req.ImageID = "CentOS 7.3"
-	agentVM, err := utils.CreateVM(req)
+	tpl := c.Definition.Cluster.Spec.Templates.ForNodeType(nodeType).Or(defaultTemplates.ForNodeType(nodeType))
+	tpl.Complete(req)
+	agentVM, err := utils.AdoptOrCreateVM(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Master server %d: %s", i, err.Error())
+		return nil, fmt.Errorf("failed to create Agent node %d: %s", i, err.Error())
 	}
 
 	// Installs DCOS on agent node
@@ -391,28 +498,14 @@ func (c *Cluster) addAgentNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*p
 		return nil, fmt.Errorf("failed to install DCOS on Agent Node: %s", err.Error())
 	}
 
-	// Registers the new Agent in the cluster struct
+	// Registers the new Agent in the cluster struct and updates the cluster definition in Object Storage
+	ids, ips := &c.Definition.PrivateAgentIDs, &c.Definition.PrivateAgentIPs
 	if nodeType == NodeType.PublicAgent {
-		c.Definition.PublicAgentIDs = append(c.Definition.PublicAgentIDs, agentVM.ID)
-		c.Definition.PublicAgentIPs = append(c.Definition.PublicAgentIPs, agentVM.IP)
-	} else {
-		c.Definition.PrivateAgentIDs = append(c.Definition.PrivateAgentIDs, agentVM.ID)
-		c.Definition.PrivateAgentIPs = append(c.Definition.PrivateAgentIPs, agentVM.IP)
+		ids, ips = &c.Definition.PublicAgentIDs, &c.Definition.PublicAgentIPs
 	}
-
-	// Update cluster definition in Object Storage
-	err = c.WriteDefinition()
+	err = utils.RegisterNode(agentVM.ID, agentVM.IP, ids, ips, c.WriteDefinition)
 	if err != nil {
-		// Removes the ID we just added to the cluster struct
-		if nodeType == NodeType.PublicAgent {
-			c.Definition.PublicAgentIDs = c.Definition.PublicAgentIDs[:len(c.Definition.PublicAgentIDs)-1]
-			c.Definition.PublicAgentIPs = c.Definition.PublicAgentIPs[:len(c.Definition.PublicAgentIPs)-1]
-		} else {
-			c.Definition.PrivateAgentIDs = c.Definition.PrivateAgentIDs[:len(c.Definition.PrivateAgentIDs)-1]
-			c.Definition.PrivateAgentIPs = c.Definition.PrivateAgentIPs[:len(c.Definition.PrivateAgentIPs)-1]
-		}
-		utils.DeleteVM(agentVM.ID)
-		return nil, fmt.Errorf("failed to update Cluster definition: %s", err.Error())
+		return nil, err
 	}
 
 	return agentVM, nil
@@ -437,7 +530,7 @@ func (c *Cluster) configure() error {
 	if err == nil {
 		dnsServers = cfg.GetSliceOfStrings("DNSList")
 	}
-	retcode, output, err := c.executeScript(c.Definition.BootstrapID, "dcos_install_bootstrap_node.sh", map[string]interface{}{
+	retcode, output, err := scripts.Execute(c.Definition.BootstrapID, "dcos_install_bootstrap_node.sh", map[string]interface{}{
 		"DCOSVersion":         dcosVersion,
 		"BootstrapIP":         c.Definition.BootstrapIP,
 		"BootstrapPort":       "80",
@@ -457,7 +550,7 @@ func (c *Cluster) configure() error {
 
 	log.Printf("Configuring Master servers")
 	for _, m := range c.Definition.MasterIDs {
-		retcode, output, err := c.executeScript(m, "dcos_install_master_node.sh", map[string]interface{}{
+		retcode, output, err := scripts.Execute(m, "dcos_install_master_node.sh", map[string]interface{}{
 			"BootstrapIP":   c.Definition.BootstrapIP,
 			"BootstrapPort": "80",
 		})
@@ -485,31 +578,14 @@ func realizePrepareDockerImages() (string, error) {
 		return "", nil
 	}
 
-	// find the rice.Box
-	b, err := getTemplateBox()
+	b, err := scripts.Box()
 	if err != nil {
 		return "", err
 	}
-	// get file contents as string
-	tmplString, err := b.String("dcos_docker_prepare_images.sh")
-	if err != nil {
-		return "", fmt.Errorf("error loading script template: %s", err.Error())
-	}
-	// Parse the template
-	tmplPrepared, err := template.New("prepare_docker_images").Parse(tmplString)
-	if err != nil {
-		return "", fmt.Errorf("error parsing script template: %s", err.Error())
-	}
-	// realize the template
-	dataBuffer := bytes.NewBufferString("")
-	err = tmplPrepared.Execute(dataBuffer, map[string]interface{}{
+	return utils.RealizeScript(b, "dcos_docker_prepare_images.sh", map[string]interface{}{
 		"PrepareImageGuacamole": realizedPrepareImageGuacamole,
 		"PrepareImageProxy":     realizedPrepareImageProxy,
 	})
-	if err != nil {
-		return "", fmt.Errorf("error realizing script template: %s", err.Error())
-	}
-	return dataBuffer.String(), nil
 }
 
 //configureAgent installs and configure DCOS agent on targetVM
@@ -521,7 +597,7 @@ func (c *Cluster) configureAgent(targetVM *pb.VM, nodeType NodeType.Enum) error
 		typeStr = "no"
 	}
 
-	retcode, output, err := c.executeScript(targetVM.ID, "dcos_install_agent_node.sh", map[string]interface{}{
+	retcode, output, err := scripts.Execute(targetVM.ID, "dcos_install_agent_node.sh", map[string]interface{}{
 		"PublicNode":    typeStr,
 		"BootstrapIP":   c.Definition.BootstrapIP,
 		"BootstrapPort": "80",
@@ -537,152 +613,131 @@ func (c *Cluster) configureAgent(targetVM *pb.VM, nodeType NodeType.Enum) error
 	return nil
 }
 
-//executeScript executes the script template with the parameters on targetVM
-func (c *Cluster) executeScript(targetID string, script string, data map[string]interface{}) (int, *string, error) {
-	svc, err := utils.GetProviderService()
+//DeleteNode drains the agent node referenced by ref (name or ID) through DCOS, then deletes its VM
+//Masters can't be deleted, the set of masters of DCOS is static
+func (c *Cluster) DeleteNode(ref string) error {
+	vm, err := utils.GetVM(ref)
 	if err != nil {
-		return 0, nil, err
-	}
-	ssh, err := svc.GetSSHConfig(targetID)
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to read SSH config: %s", err.Error())
+		return err
 	}
-	ssh.WaitServerReady(60 * time.Second)
-
-	// Configures IncludeInstallCommons var
-	installCommons, err := getInstallCommons()
-	if err != nil {
-		return 0, nil, err
+	ids, ips := &c.Definition.PrivateAgentIDs, &c.Definition.PrivateAgentIPs
+	publicNode := "no"
+	index := utils.IndexOf(*ids, vm.ID)
+	if index < 0 {
+		ids, ips = &c.Definition.PublicAgentIDs, &c.Definition.PublicAgentIPs
+		publicNode = "yes"
+		index = utils.IndexOf(*ids, vm.ID)
 	}
-	data["IncludeInstallCommons"] = *installCommons
-
-	b, err := getTemplateBox()
-	if err != nil {
-		return 0, nil, err
+	if index < 0 {
+		return fmt.Errorf("'%s' is not an agent node of cluster '%s'", ref, c.Definition.Cluster.Name)
 	}
 
-	// get file contents as string
-	tmplString, err := b.String(script)
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to load script template: %s", err.Error())
+	if vm.State == pb.VMState_STARTED {
+		log.Printf("Draining DCOS Agent node '%s'", vm.Name)
+		retcode, output, err := scripts.Execute(vm.ID, "dcos_drain_agent_node.sh", map[string]interface{}{
+			"PublicNode": publicNode,
+		})
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted Agent draining failed with error code %d:\n%s", retcode, *output)
+		}
 	}
-	// parse and execute the template
-	tmplCmd, err := template.New("cmd").Parse(tmplString)
+	err = utils.DeleteVMIfExists(vm.ID)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to parse script template: %s", err.Error())
+		return err
 	}
 
-	dataBuffer := bytes.NewBufferString("")
-	err = tmplCmd.Execute(dataBuffer, data)
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to realize script template: %s", err.Error())
+	*ids = append((*ids)[:index], (*ids)[index+1:]...)
+	if len(*ips) > index {
+		*ips = append((*ips)[:index], (*ips)[index+1:]...)
 	}
-	cmd := dataBuffer.String()
-
-	cmdResult, err := ssh.SudoCommand(cmd)
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to execute script '%s': %s", script, err.Error())
-	}
-	retcode := 0
-	out, err := cmdResult.CombinedOutput()
-	if err != nil {
-		if ee, ok := err.(*exec.ExitError); ok {
-			if status, ok := ee.Sys().(syscall.WaitStatus); ok {
-				retcode = status.ExitStatus()
-			}
-		} else {
-			return 0, nil, fmt.Errorf("failed to fetch output of script '%s': %s", script, err.Error())
-		}
-	}
-
-	strOut := string(out)
-	return retcode, &strOut, nil
-}
-
-//DeleteNode deletes an Agent node
-func (c *Cluster) DeleteNode(ID string) error {
-	return fmt.Errorf("DeleteNode not yet implemented")
+	return c.WriteDefinition()
 }
 
 //ListMasters lists the master nodes in the cluster
 func (c *Cluster) ListMasters() ([]*pb.VM, error) {
-	return nil, fmt.Errorf("ListMasters not yet implemented")
+	return utils.GetVMs(c.Definition.MasterIDs)
 }
 
-//ListNodes lists the nodes in the cluster
+//ListNodes lists the agent nodes in the cluster, private ones first
 func (c *Cluster) ListNodes() ([]*pb.VM, error) {
-	return nil, fmt.Errorf("ListNodes not yet implemented")
+	return utils.GetVMs(append(append([]string{}, c.Definition.PrivateAgentIDs...), c.Definition.PublicAgentIDs...))
 }
 
-//GetNode returns a node based on its ID
-func (*Cluster) GetNode(ID string) (*pb.VM, error) {
-	return nil, fmt.Errorf("ListNodes not yet implemented")
+//CountPrivateNodes returns the number of private agent nodes in the cluster
+func (c *Cluster) CountPrivateNodes() int {
+	return len(c.Definition.PrivateAgentIDs)
 }
 
-//GetDefinition returns the public properties of the cluster
-func (c *Cluster) GetDefinition() clusterapi.Cluster {
-	return c.Definition.Cluster
+//GetNode returns the node referenced by ref (name or ID), which can be the bootstrap server, a master or an agent
+func (c *Cluster) GetNode(ref string) (*pb.VM, error) {
+	vm, err := utils.GetVM(ref)
+	if err != nil {
+		return nil, err
+	}
+	if vm.ID == c.Definition.BootstrapID ||
+		utils.IndexOf(c.Definition.MasterIDs, vm.ID) >= 0 ||
+		utils.IndexOf(c.Definition.PrivateAgentIDs, vm.ID) >= 0 ||
+		utils.IndexOf(c.Definition.PublicAgentIDs, vm.ID) >= 0 {
+		return vm, nil
+	}
+	return nil, fmt.Errorf("'%s' is not a node of cluster '%s'", ref, c.Definition.Cluster.Name)
 }
 
 //WriteDefinition writes cluster definition in Object Storage
 func (c *Cluster) WriteDefinition() error {
-	//var buffer bytes.Buffer
-	//enc := gob.NewEncoder(&buffer)
-	//err := enc.Encode(c.definition)
-	//if err != nil {
-	//	return err
-	//}
-	//content := bytes.NewReader(buffer.Bytes()
-
-	utils.CreateMetadataContainer()
-
-	// writes  the data in Object Storage
-	return utils.WriteMetadata(clusterapi.ClusterMetadataPrefix, c.Definition.Cluster.Name, c.Definition)
+	return utils.WriteDefinition(c.Definition.Cluster.Name, c.Definition)
 }
 
 //ReadDefinition reads definition of cluster named 'name' from Metadata
 // Returns (true, nil) if found and loaded, (false, nil) if not found, and (false, error) in case of error
 func (c *Cluster) ReadDefinition() (bool, error) {
-	utils.CreateMetadataContainer()
-
-	ok, err := utils.FindMetadata(clusterapi.ClusterMetadataPrefix, c.Definition.Cluster.Name)
-	if err != nil {
-		return false, err
-	}
-	if !ok {
-		return false, nil
-	}
-
-	// reads the data in Object Storage
 	var d Definition
-	err = utils.ReadMetadata(clusterapi.ClusterMetadataPrefix, c.Definition.Cluster.Name, func(buf *bytes.Buffer) error {
-		return gob.NewDecoder(buf).Decode(&d)
-	})
-	if err != nil {
-		return false, err
+	ok, err := utils.ReadDefinition(c.Definition.Cluster.Name, &d)
+	if ok {
+		c.Definition = &d
 	}
-	c.Definition = &d
-	return true, nil
+	return ok, err
 }
 
 //RemoveDefinition removes definition of cluster from Object Storage
 func (c *Cluster) RemoveDefinition() error {
-	if len(c.Definition.MasterIDs) > 0 ||
+	running := len(c.Definition.MasterIDs) > 0 ||
 		len(c.Definition.PublicAgentIDs) > 0 ||
-		len(c.Definition.PrivateAgentIDs) > 0 ||
-		c.Definition.Cluster.NetworkID != "" {
-		return fmt.Errorf("can't remove a definition of a cluster with infrastructure still running")
-	}
+		len(c.Definition.PrivateAgentIDs) > 0
+	return utils.RemoveDefinition(&c.Definition.Cluster, running)
+}
 
-	err := utils.DeleteMetadata(clusterapi.ClusterMetadataPrefix, c.Definition.Cluster.Name)
+//Delete destroys the agents, the masters, the bootstrap server, the key pair and the network of the cluster
+//The definition is updated after each deletion, so a failed deletion can be retried
+func (c *Cluster) Delete() error {
+	err := utils.DeleteNodes(&c.Definition.PublicAgentIDs, &c.Definition.PublicAgentIPs, c.WriteDefinition)
 	if err != nil {
-		return fmt.Errorf("failed to remove cluster definition in Object Storage: %s", err.Error())
+		return err
+	}
+	err = utils.DeleteNodes(&c.Definition.PrivateAgentIDs, &c.Definition.PrivateAgentIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+	err = utils.DeleteNodes(&c.Definition.MasterIDs, &c.Definition.MasterIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+	if c.Definition.BootstrapID != "" {
+		err = utils.DeleteVMIfExists(c.Definition.BootstrapID)
+		if err != nil {
+			return err
+		}
+		c.Definition.BootstrapID = ""
+		c.Definition.BootstrapIP = ""
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
 	}
-	c.Definition.Cluster.State = ClusterState.Removed
-	return nil
-}
 
-//Delete destroys everything related to the infrastructure built for the cluster
-func (c *Cluster) Delete() error {
-	return fmt.Errorf("dcos.Cluster.Delete not yet implemented")
+	return utils.DeleteKeyPairAndNetwork(&c.Definition.Cluster, c.WriteDefinition)
 }
+
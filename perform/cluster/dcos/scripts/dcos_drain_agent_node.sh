@@ -0,0 +1,32 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Drains a DCOS agent node before its removal
+# The Mesos agent unregisters from the masters on SIGUSR1, its tasks are then
+# killed and rescheduled by their frameworks on the other agents
+# This script must be executed on agent node.
+
+if [ "{{.PublicNode}}" = "yes" ]; then
+    SERVICE=dcos-mesos-slave-public
+else
+    SERVICE=dcos-mesos-slave
+fi
+
+# Nothing to drain if the agent is not running
+systemctl is-active --quiet $SERVICE || exit 0
+
+systemctl kill -s SIGUSR1 $SERVICE && systemctl stop $SERVICE
+exit $?
@@ -0,0 +1,36 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Prints the load of the cluster for the autoscaler: a line 'PENDING <count>' with the
+# number of Marathon tasks waiting for offers, then a line 'IDLE <IP>' per agent running no task
+# This script must be executed on a master node.
+
+curl -sf http://marathon.mesos:8080/v2/queue >/tmp/marathon_queue.json || exit $?
+curl -sf http://leader.mesos:5050/slaves >/tmp/mesos_slaves.json || exit $?
+
+python - <<'PYTHON'
+import json
+
+queue = json.load(open("/tmp/marathon_queue.json"))["queue"]
+print("PENDING %d" % sum(q.get("count", 0) for q in queue))
+
+for slave in json.load(open("/tmp/mesos_slaves.json"))["slaves"]:
+    if slave.get("active") and slave.get("used_resources", {}).get("cpus", 0) == 0:
+        print("IDLE %s" % slave["hostname"])
+PYTHON
+retcode=$?
+rm -f /tmp/marathon_queue.json /tmp/mesos_slaves.json
+exit $retcode
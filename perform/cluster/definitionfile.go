@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/Complexity"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/Flavor"
+	"github.com/CS-SI/SafeScale/perform/cluster/components"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+//DefinitionFile is the content of a cluster definition file, used by 'perform cluster create -f'
+//and regenerated by 'perform cluster export'
+type DefinitionFile struct {
+	//Name is the name of the cluster
+	Name string `yaml:"name,omitempty"`
+	//Flavor is the flavor of the cluster; can be DCOS, K8S, SWARM or SLURM
+	Flavor string `yaml:"flavor"`
+	//Complexity is the complexity of the cluster; can be DEV, NORMAL or VOLUME
+	Complexity string `yaml:"complexity"`
+	//CIDR is the CIDR of the network, allocated from the network pool of the tenant if not set
+	CIDR string `yaml:"cidr,omitempty"`
+
+	clusterapi.Spec `yaml:",inline"`
+}
+
+//ReadDefinitionFile reads the cluster definition file at path
+func ReadDefinitionFile(path string) (*DefinitionFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster definition file: %s", err.Error())
+	}
+	file, err := ParseDefinitionFile(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster definition file '%s': %s", path, err.Error())
+	}
+	return file, nil
+}
+
+//ParseDefinitionFile parses the content of a cluster definition file
+func ParseDefinitionFile(content []byte) (*DefinitionFile, error) {
+	var file DefinitionFile
+	err := yaml.UnmarshalStrict(content, &file)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+//Bytes returns the content of the file
+func (f *DefinitionFile) Bytes() ([]byte, error) {
+	return yaml.Marshal(f)
+}
+
+//Request validates the content of the file and returns the corresponding request
+func (f *DefinitionFile) Request() (clusterapi.Request, error) {
+	req := clusterapi.Request{
+		Name: f.Name,
+		CIDR: f.CIDR,
+		Spec: f.Spec,
+	}
+	if f.Name == "" {
+		return req, fmt.Errorf("cluster name required")
+	}
+	flavor, err := Flavor.FromString(f.Flavor)
+	if err != nil {
+		return req, err
+	}
+	req.Flavor = flavor
+	complexity, err := Complexity.FromString(f.Complexity)
+	if err != nil {
+		return req, err
+	}
+	req.Complexity = complexity
+
+	if f.Nodes.Private < 0 || f.Nodes.Public < 0 {
+		return req, fmt.Errorf("invalid negative count of nodes")
+	}
+	names := map[string]bool{}
+	for _, v := range f.Volumes {
+		if v.Name == "" || v.Path == "" || v.Size <= 0 {
+			return req, fmt.Errorf("volume '%s': name, path and size required", v.Name)
+		}
+		if names[v.Role+"/"+v.Name] {
+			return req, fmt.Errorf("volume '%s' defined twice for role '%s'", v.Name, v.Role)
+		}
+		names[v.Role+"/"+v.Name] = true
+		if v.Role != roleMaster && v.Role != rolePrivate && v.Role != rolePublic {
+			return req, fmt.Errorf("volume '%s': invalid role '%s', must be master, private or public", v.Name, v.Role)
+		}
+		if _, ok := pb.VolumeSpeed_value[strings.ToUpper(v.Speed)]; v.Speed != "" && !ok {
+			return req, fmt.Errorf("volume '%s': invalid speed '%s', must be COLD, HDD or SSD", v.Name, v.Speed)
+		}
+	}
+	for _, n := range f.Nas {
+		if n.Name == "" || n.Path == "" {
+			return req, fmt.Errorf("NAS '%s': name and path required", n.Name)
+		}
+	}
+	for _, c := range f.Components {
+		err = components.CheckInstallScript(req.Flavor.String(), c)
+		if err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+//Export returns the definition file of the cluster described by definition
+func Export(definition clusterapi.Cluster) ([]byte, error) {
+	file := DefinitionFile{
+		Name:       definition.Name,
+		Flavor:     strings.ToUpper(definition.Flavor.String()),
+		Complexity: strings.ToUpper(definition.Complexity.String()),
+		CIDR:       definition.CIDR,
+		Spec:       definition.Spec,
+	}
+	return file.Bytes()
+}
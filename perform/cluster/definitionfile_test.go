@@ -0,0 +1,127 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/Complexity"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/Flavor"
+)
+
+func Test_ParseDefinitionFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{name: "minimal", content: "name: c1\nflavor: K8S\ncomplexity: DEV\n"},
+		{name: "spec", content: "name: c1\nflavor: SWARM\ncomplexity: NORMAL\nnodes:\n  private: 2\nnas:\n  - name: shared\n    path: /shared\n"},
+		{name: "unknown field", content: "name: c1\nflavor: K8S\ncomplexity: DEV\nworkers: 3\n", err: true},
+		{name: "invalid yaml", content: "name: [c1\n", err: true},
+	}
+	for _, tt := range tests {
+		file, err := ParseDefinitionFile([]byte(tt.content))
+		if tt.err {
+			assert.NotNil(t, err, tt.name)
+			continue
+		}
+		assert.Nil(t, err, tt.name)
+		assert.Equal(t, "c1", file.Name, tt.name)
+	}
+}
+
+func Test_DefinitionFile_Request(t *testing.T) {
+	valid := func() DefinitionFile {
+		return DefinitionFile{
+			Name:       "c1",
+			Flavor:     "K8S",
+			Complexity: "NORMAL",
+			Spec: clusterapi.Spec{
+				Nodes:   clusterapi.NodeCounts{Private: 2, Public: 1},
+				Volumes: []clusterapi.VolumeSpec{{Name: "data", Role: "private", Size: 100, Speed: "ssd", Path: "/data"}},
+				Nas:     []clusterapi.NasSpec{{Name: "shared", Path: "/shared"}},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(f *DefinitionFile)
+		err    bool
+	}{
+		{name: "valid", change: func(f *DefinitionFile) {}},
+		{name: "no name", change: func(f *DefinitionFile) { f.Name = "" }, err: true},
+		{name: "invalid flavor", change: func(f *DefinitionFile) { f.Flavor = "MESOS" }, err: true},
+		{name: "invalid complexity", change: func(f *DefinitionFile) { f.Complexity = "HUGE" }, err: true},
+		{name: "negative nodes", change: func(f *DefinitionFile) { f.Nodes.Private = -1 }, err: true},
+		{name: "volume without path", change: func(f *DefinitionFile) { f.Volumes[0].Path = "" }, err: true},
+		{name: "volume without size", change: func(f *DefinitionFile) { f.Volumes[0].Size = 0 }, err: true},
+		{name: "volume defined twice", change: func(f *DefinitionFile) { f.Volumes = append(f.Volumes, f.Volumes[0]) }, err: true},
+		{name: "same volume on two roles", change: func(f *DefinitionFile) {
+			v := f.Volumes[0]
+			v.Role = "master"
+			f.Volumes = append(f.Volumes, v)
+		}},
+		{name: "invalid role", change: func(f *DefinitionFile) { f.Volumes[0].Role = "gateway" }, err: true},
+		{name: "invalid speed", change: func(f *DefinitionFile) { f.Volumes[0].Speed = "FAST" }, err: true},
+		{name: "NAS without path", change: func(f *DefinitionFile) { f.Nas[0].Path = "" }, err: true},
+		{name: "component", change: func(f *DefinitionFile) { f.Components = []string{"dashboard"} }},
+		{name: "component of another flavor", change: func(f *DefinitionFile) { f.Components = []string{"portainer"} }, err: true},
+	}
+	for _, tt := range tests {
+		f := valid()
+		tt.change(&f)
+		req, err := f.Request()
+		if tt.err {
+			assert.NotNil(t, err, tt.name)
+			continue
+		}
+		assert.Nil(t, err, tt.name)
+		assert.Equal(t, Flavor.K8S, req.Flavor, tt.name)
+		assert.Equal(t, Complexity.Normal, req.Complexity, tt.name)
+		assert.Equal(t, f.Spec, req.Spec, tt.name)
+	}
+}
+
+func Test_Export(t *testing.T) {
+	definition := clusterapi.Cluster{
+		Name:       "c1",
+		CIDR:       "192.168.10.0/24",
+		Flavor:     Flavor.Swarm,
+		Complexity: Complexity.Volume,
+		Spec: clusterapi.Spec{
+			Templates: clusterapi.Templates{Master: clusterapi.NodeTemplate{CPU: 4, RAM: 8}},
+			Nodes:     clusterapi.NodeCounts{Private: 3},
+			Volumes:   []clusterapi.VolumeSpec{{Name: "data", Role: "public", Size: 50, Path: "/data", Format: "xfs"}},
+			Labels:    map[string]string{"project": "p1"},
+		},
+	}
+	content, err := Export(definition)
+	assert.Nil(t, err)
+	file, err := ParseDefinitionFile(content)
+	assert.Nil(t, err)
+	req, err := file.Request()
+	assert.Nil(t, err)
+	assert.Equal(t, definition.Name, req.Name)
+	assert.Equal(t, definition.CIDR, req.CIDR)
+	assert.Equal(t, definition.Flavor, req.Flavor)
+	assert.Equal(t, definition.Complexity, req.Complexity)
+	assert.Equal(t, definition.Spec, req.Spec)
+}
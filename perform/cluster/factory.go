@@ -26,13 +26,39 @@ import (
 	pb "github.com/CS-SI/SafeScale/broker"
 
 	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
 	"github.com/CS-SI/SafeScale/perform/cluster/api/Flavor"
 	"github.com/CS-SI/SafeScale/perform/cluster/dcos"
+	"github.com/CS-SI/SafeScale/perform/cluster/k8s"
+	"github.com/CS-SI/SafeScale/perform/cluster/slurm"
+	"github.com/CS-SI/SafeScale/perform/cluster/swarm"
 	"github.com/CS-SI/SafeScale/perform/utils"
 )
 
-//Get returns the ClusterAPI instance corresponding to the cluster named 'name'
+//definition is the part of the definitions of all the flavors common to all of them
+//The definitions embed clusterapi.Cluster, which gob encodes as a field named Cluster
+type definition struct {
+	Cluster clusterapi.Cluster
+}
+
+//Get returns the ClusterAPI instance corresponding to the cluster named 'name', its state collected again if older
+//than the interval of collection of the flavor
+//The collected state is saved in the definition of the cluster, Read doesn't collect it
 func Get(name string) (clusterapi.ClusterAPI, error) {
+	instance, err := Read(name)
+	if err != nil || instance == nil {
+		return nil, err
+	}
+	_, err = instance.GetState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state of the cluster: %s", err.Error())
+	}
+	return instance, nil
+}
+
+//Read returns the ClusterAPI instance corresponding to the cluster named 'name', with the state collected last
+//Read doesn't write the definition of the cluster, it can be called while an operation is in progress on the cluster
+func Read(name string) (clusterapi.ClusterAPI, error) {
 	tenant, err := utils.GetCurrentTenant()
 	if err != nil {
 		return nil, err
@@ -42,13 +68,6 @@ func Get(name string) (clusterapi.ClusterAPI, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get Cluster '%s': %s", name, err.Error())
 	}
-	if instance == nil {
-		return nil, nil
-	}
-	_, err = instance.GetState()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get state of the cluster: %s", err.Error())
-	}
 	return instance, nil
 }
 
@@ -59,18 +78,54 @@ func readDefinition(tenant string, name string) (clusterapi.ClusterAPI, error) {
 		return nil, err
 	}
 
-	var d clusterapi.Cluster
+	var d definition
 	err = utils.ReadMetadata(clusterapi.ClusterMetadataPrefix, name, func(buf *bytes.Buffer) error {
 		return gob.NewDecoder(buf).Decode(&d)
 	})
 	if err != nil {
 		return nil, err
 	}
-	switch d.Flavor {
+	switch d.Cluster.Flavor {
 	case Flavor.DCOS:
 		instance := &dcos.Cluster{
 			Definition: &dcos.Definition{
-				Cluster: d,
+				Cluster: d.Cluster,
+			},
+		}
+		// Re-read the definition with complete data unserialization
+		ok, err := instance.ReadDefinition()
+		if !ok {
+			return nil, err
+		}
+		return instance, nil
+	case Flavor.K8S:
+		instance := &k8s.Cluster{
+			Definition: &k8s.Definition{
+				Cluster: d.Cluster,
+			},
+		}
+		// Re-read the definition with complete data unserialization
+		ok, err := instance.ReadDefinition()
+		if !ok {
+			return nil, err
+		}
+		return instance, nil
+	case Flavor.Swarm:
+		instance := &swarm.Cluster{
+			Definition: &swarm.Definition{
+				Cluster: d.Cluster,
+			},
+		}
+		// Re-read the definition with complete data unserialization
+		ok, err := instance.ReadDefinition()
+		if !ok {
+			return nil, err
+		}
+		return instance, nil
+	case Flavor.Slurm:
+		instance := &slurm.Cluster{
+			Definition: &slurm.Definition{
+				Cluster: d.Cluster,
 			},
 		}
 		// Re-read the definition with complete data unserialization
@@ -89,9 +144,6 @@ func Create(req clusterapi.Request) (clusterapi.ClusterAPI, error) {
 	if req.Name == "" {
 		return nil, fmt.Errorf("Invalid parameter req.Name: can't be empty")
 	}
-	if req.CIDR == "" {
-		return nil, fmt.Errorf("Invalid parameter req.CIDR: can't be empty")
-	}
 
 	// We need at first the Metadata container to be present
 	err := utils.CreateMetadataContainer()
@@ -118,18 +170,73 @@ func Create(req clusterapi.Request) (clusterapi.ClusterAPI, error) {
 		return nil, err
 	}
 
+	req.CIDR = network.CIDR
+	req.NetworkID = network.ID
+	req.Tenant = tenant
+
+	// The network is deleted with the rest of the infrastructure if the creation fails
 	switch req.Flavor {
 	case Flavor.DCOS:
-		req.NetworkID = network.ID
-		req.Tenant = tenant
 		instance, err = dcos.NewCluster(req)
+	case Flavor.K8S:
+		instance, err = k8s.NewCluster(req)
+	case Flavor.Swarm:
+		instance, err = swarm.NewCluster(req)
+	case Flavor.Slurm:
+		instance, err = slurm.NewCluster(req)
+	default:
+		utils.DeleteNetwork(network.ID)
+		return nil, fmt.Errorf("unmanaged cluster flavor '%s (%d)'", req.Flavor.String(), req.Flavor)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Creates the nodes, storage and components of the definition, the cluster is deleted if it fails
+	err = deploySpec(instance)
+	if err != nil {
+		return nil, abortDeployment(instance, err)
+	}
+
+	log.Printf("Cluster '%s' created and initialized successfully", req.Name)
+	return instance, nil
+}
+
+//abortDeployment deletes the cluster whose deployment failed with err, unless it is kept on failure, and returns err
+func abortDeployment(instance clusterapi.ClusterAPI, err error) error {
+	definition := instance.GetDefinition()
+	err = fmt.Errorf("failed to deploy definition of cluster '%s': %s", definition.Name, err.Error())
+	if definition.KeepOnFailure {
+		log.Printf("Keeping infrastructure of cluster '%s' for debugging, 'perform cluster delete %s' removes it", definition.Name, definition.Name)
+		return err
+	}
+	derr := Destroy(instance)
+	if derr != nil {
+		log.Printf("failed to delete cluster '%s': %s", definition.Name, derr.Error())
+	}
+	return err
+}
+
+//ResumeCreation resumes the creation of a cluster interrupted with its infrastructure partially created
+//The creation goes on from the last step saved in the definition, and fails as the interrupted one would have
+func ResumeCreation(instance clusterapi.ClusterAPI) (clusterapi.ClusterAPI, error) {
+	definition := instance.GetDefinition()
+	if definition.State == ClusterState.Creating {
+		log.Printf("Resuming creation of infrastructure of cluster '%s'", definition.Name)
+		err := instance.ResumeCreation()
 		if err != nil {
-			//utils.DeleteNetwork(network.ID)
+			utils.AbortCreation(instance, definition.KeepOnFailure)
 			return nil, err
 		}
 	}
 
-	log.Printf("Cluster '%s' created and initialized successfully", req.Name)
+	log.Printf("Resuming deployment of definition of cluster '%s'", definition.Name)
+	err := deploySpec(instance)
+	if err != nil {
+		return nil, abortDeployment(instance, err)
+	}
+
+	log.Printf("Cluster '%s' created and initialized successfully", definition.Name)
 	return instance, nil
 }
 
@@ -139,13 +246,30 @@ func Delete(name string) error {
 	if err != nil {
 		return fmt.Errorf("failed to find a cluster named '%s': %s", name, err.Error())
 	}
-	err = instance.Delete()
-	if err != nil {
-		return fmt.Errorf("failed to delete infrastructure of cluster '%s': %s", name, err.Error())
+	if instance == nil {
+		return fmt.Errorf("cluster '%s' not found", name)
 	}
 
-	// Deletes the network and related stuff
-	utils.DeleteNetwork(instance.GetNetworkID())
+	return Destroy(instance)
+}
+
+//Destroy deletes the storage, the infrastructure and the definition of the cluster instance
+//The definition of instance is updated along the deletion, so instance can be saved if the deletion fails
+func Destroy(instance clusterapi.ClusterAPI) error {
+	definition := instance.GetDefinition()
+	released := releaseSpec(instance)
+
+	// Deletes the VMs and the network, deletion can be retried if it fails
+	err := instance.Delete()
+	if err != nil {
+		return fmt.Errorf("failed to delete infrastructure of cluster '%s': %s", definition.Name, err.Error())
+	}
+	for _, n := range released {
+		err = deleteVolumes(definition, n.vm, n.role)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Cleanup Object Storage data
 	return instance.RemoveDefinition()
@@ -155,12 +279,12 @@ func Delete(name string) error {
 func List() ([]clusterapi.Cluster, error) {
 	var clusterList []clusterapi.Cluster
 	err := utils.BrowseMetadataContent(clusterapi.ClusterMetadataPrefix, func(buf *bytes.Buffer) error {
-		var c clusterapi.Cluster
-		err := gob.NewDecoder(buf).Decode(&c)
+		var d definition
+		err := gob.NewDecoder(buf).Decode(&d)
 		if err != nil {
 			return err
 		}
-		clusterList = append(clusterList, c)
+		clusterList = append(clusterList, d.Cluster)
 		return nil
 	})
 	return clusterList, err
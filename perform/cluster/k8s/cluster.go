@@ -0,0 +1,837 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	rice "github.com/GeertJohan/go.rice"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/Complexity"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+	"github.com/CS-SI/SafeScale/perform/utils"
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api/VMState"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+//go:generate rice embed-go
+
+const (
+	k8sVersion string = "1.15.3"
+
+	//apiServerPort is the port of the API server, on the masters, the load balancer and the gateways
+	apiServerPort = 6443
+	//podSubnet is the network of the pods, managed by flannel
+	podSubnet = "10.244.0.0/16"
+	//podNetworkManifest installs flannel as pod network
+	podNetworkManifest = "https://raw.githubusercontent.com/coreos/flannel/v0.11.0/Documentation/kube-flannel.yml"
+
+	//defaultStateCollectInterval is the time the collected state of a new cluster is kept before being collected again
+	defaultStateCollectInterval = 5 * time.Minute
+
+	//apiServerHealthURL is the health endpoint of the API server running on the masters
+	apiServerHealthURL = "https://localhost:6443/healthz"
+	//kubeletHealthURL is the health endpoint of the kubelet running on the workers
+	kubeletHealthURL = "http://localhost:10248/healthz"
+
+	//timeoutServices is the time the Kubernetes services are given to be healthy once their VMs are started
+	timeoutServices = 10 * time.Minute
+)
+
+var (
+	//scripts gives the script templates of the package
+	scripts = utils.NewScriptBox(func() (*rice.Box, error) {
+		return rice.FindBox("../k8s/scripts")
+	}, "k8s_install_node_commons.sh", map[string]interface{}{
+		"KubernetesVersion": k8sVersion,
+	})
+
+	//defaultTemplates size the nodes whose template is not set in the definition of the cluster
+	defaultTemplates = clusterapi.Templates{
+		Master:      clusterapi.NodeTemplate{CPU: 2, RAM: 8.0, Disk: 60, OS: "Ubuntu 16.04"},
+		PrivateNode: clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "Ubuntu 16.04"},
+		PublicNode:  clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "Ubuntu 16.04"},
+	}
+)
+
+//Definition defines the values we want to keep in Object Storage
+type Definition struct {
+	// common cluster data
+	clusterapi.Cluster
+
+	//MasterIDs is a slice of VMIDs of the masters, the first one initialized the control plane
+	MasterIDs []string
+
+	//MasterIPs contains a list of IP of the master servers
+	MasterIPs []string
+
+	//PublicNodeIDs is a slice of VMIDs of the workers with a public IP
+	PublicNodeIDs []string
+
+	//PublicNodeIPs contains a list of the IPs of the public workers in the network of the cluster
+	PublicNodeIPs []string
+
+	//PrivateNodeIDs is a slice of VMIDs of the workers without public IP
+	PrivateNodeIDs []string
+
+	//PrivateNodeIPs contains a list of IP of the private workers
+	PrivateNodeIPs []string
+
+	//LastNodeIndex is the index in the name of the last worker created, so that each worker gets a new name
+	LastNodeIndex int
+
+	//LoadBalancerID is the ID of the load balancer in front of the API servers, empty if the cluster has a single master
+	LoadBalancerID string
+
+	//BackendIDs contains the IDs of the masters already added to the backends of the load balancer
+	BackendIDs []string
+
+	//ControlPlaneEndpoint is the IP the nodes reach the API server on, the VIP of the load balancer or the IP of the only master
+	ControlPlaneEndpoint string
+
+	//CertificateKey is the key the masters exchange the certificates of the control plane with, kept so an interrupted
+	//configuration is resumed with the key of the certificates already uploaded
+	CertificateKey string
+
+	//Configured is true once the control plane is initialized on the masters
+	Configured bool
+
+	//Kubeconfig is the kubeconfig of the administrator of the cluster, reaching the API server through the gateway
+	Kubeconfig string
+
+	//StateCollectInterval is the time the collected state is kept before being collected again
+	StateCollectInterval time.Duration
+}
+
+//Cluster is the object describing a cluster created by ClusterManagerAPI.CreateCluster
+type Cluster struct {
+	//Definition contains data defining the cluster
+	*Definition
+}
+
+//NewCluster creates the necessary infrastructure of cluster
+//If the creation fails, the infrastructure already created is deleted unless req.KeepOnFailure is set
+func NewCluster(req clusterapi.Request) (clusterapi.ClusterAPI, error) {
+	// Saving cluster parameters, with status 'Creating', so the infrastructure can be deleted if anything fails
+	instance := Cluster{
+		Definition: &Definition{
+			Cluster: clusterapi.Cluster{
+				Name:          req.Name,
+				CIDR:          req.CIDR,
+				Flavor:        req.Flavor,
+				State:         ClusterState.Creating,
+				Complexity:    req.Complexity,
+				Tenant:        req.Tenant,
+				NetworkID:     req.NetworkID,
+				Spec:          req.Spec,
+				Operation:     req.Operation,
+				KeepOnFailure: req.KeepOnFailure,
+			},
+			StateCollectInterval: defaultStateCollectInterval,
+		},
+	}
+	err := instance.WriteDefinition()
+	if err != nil {
+		err = fmt.Errorf("failed to create cluster '%s': %s", req.Name, err.Error())
+		goto cleanup
+	}
+
+	err = instance.create()
+	if err != nil {
+		goto cleanup
+	}
+
+	log.Printf("Cluster '%s' created and initialized successfully", req.Name)
+	return &instance, nil
+
+cleanup:
+	utils.AbortCreation(&instance, req.KeepOnFailure)
+	return nil, err
+}
+
+//ResumeCreation creates what the interrupted creation of the cluster didn't create, then configures it
+func (c *Cluster) ResumeCreation() error {
+	return c.create()
+}
+
+//create creates the servers and the load balancer missing from the definition of the cluster, then configures it
+//and exposes its API server if it isn't already
+//Each step is saved in the definition, so an interrupted creation resumes from the last step done
+func (c *Cluster) create() error {
+	var masterCount int
+	var err error
+
+	// Create a KeyPair for the cluster
+	if c.Definition.Cluster.Keypair == nil {
+		c.Definition.Cluster.Keypair, err = utils.CreateKeyPair(c.Definition.Cluster.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The control plane tolerates the failure of a minority of its masters
+	switch c.Definition.Cluster.Complexity {
+	case Complexity.Dev:
+		masterCount = 1
+	case Complexity.Normal:
+		masterCount = 3
+	case Complexity.Volume:
+		masterCount = 5
+	}
+
+	if len(c.Definition.MasterIDs) < masterCount {
+		log.Printf("Creating Kubernetes Master servers (%d)", masterCount-len(c.Definition.MasterIDs))
+	}
+	for i := len(c.Definition.MasterIDs) + 1; i <= masterCount; i++ {
+		_, err = c.addMaster()
+		if err != nil {
+			return fmt.Errorf("failed to add Kubernetes Master %d: %s", i, err.Error())
+		}
+	}
+
+	if masterCount > 1 {
+		if len(c.Definition.BackendIDs) < masterCount {
+			log.Printf("Creating Load Balancer of the Kubernetes API servers")
+		}
+		err = c.addLoadBalancer()
+		if err != nil {
+			return fmt.Errorf("failed to create Load Balancer of the API servers: %s", err.Error())
+		}
+	} else {
+		c.Definition.ControlPlaneEndpoint = c.Definition.MasterIPs[0]
+	}
+
+	gateways, err := c.getGateways()
+	if err != nil {
+		return err
+	}
+
+	if !c.Definition.Configured {
+		log.Printf("Configuring cluster")
+		err = c.configure(gateways)
+		if err != nil {
+			return fmt.Errorf("failed to configure Kubernetes cluster: %s", err.Error())
+		}
+		c.Definition.Configured = true
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Definition.Kubeconfig == "" {
+		log.Printf("Exposing Kubernetes API server on the gateways")
+		err = c.exposeAPIServer(gateways)
+		if err != nil {
+			return fmt.Errorf("failed to expose Kubernetes API server: %s", err.Error())
+		}
+	}
+
+	// Cluster created and configured successfully, saving again to Object Storage
+	c.Definition.Cluster.State = ClusterState.Created
+	return c.WriteDefinition()
+}
+
+//newCertificateKey returns a random key, used by the masters to exchange the certificates of the control plane
+func newCertificateKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate certificate key: %s", err.Error())
+	}
+	return hex.EncodeToString(key), nil
+}
+
+//GetName returns the name of the cluster
+func (c *Cluster) GetName() string {
+	return c.Definition.Cluster.Name
+}
+
+//Start starts the masters, then the workers once a quorum of masters is healthy
+//The cluster is Nominal when Start returns without error
+func (c *Cluster) Start() error {
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Nominal:
+		return fmt.Errorf("Can't start an already started cluster")
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't start a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting Kubernetes Master servers")
+	err = utils.SetNodesState(svc, c.Definition.MasterIDs, VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	err = c.waitMastersQuorum(svc)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting Kubernetes Worker nodes")
+	err = utils.SetNodesState(svc, c.workerIDs(), VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	return utils.WaitNominal(c.ForceGetState, timeoutServices)
+}
+
+//Stop stops the workers, then the masters
+func (c *Cluster) Stop() error {
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Stopped:
+		return nil
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't stop a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping Kubernetes Worker nodes")
+	err = utils.SetNodesState(svc, c.workerIDs(), VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping Kubernetes Master servers")
+	err = utils.SetNodesState(svc, c.Definition.MasterIDs, VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	state, err = c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	if state != ClusterState.Stopped {
+		return fmt.Errorf("cluster still in state '%s' once its nodes are stopped", state.String())
+	}
+	return nil
+}
+
+//workerIDs returns the IDs of the workers, private ones first
+func (c *Cluster) workerIDs() []string {
+	return append(append([]string{}, c.Definition.PrivateNodeIDs...), c.Definition.PublicNodeIDs...)
+}
+
+//waitMastersQuorum waits for a quorum of API servers to be healthy, so the workers can join the cluster
+func (c *Cluster) waitMastersQuorum(svc *providers.Service) error {
+	deadline := time.Now().Add(timeoutServices)
+	for {
+		healthy := 0
+		for _, id := range c.Definition.MasterIDs {
+			if utils.CheckNode(svc, id, NodeType.Master, apiServerHealthURL).State == NodeState.Started {
+				healthy++
+			}
+		}
+		if healthy > len(c.Definition.MasterIDs)/2 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("only %d of %d masters healthy after %v", healthy, len(c.Definition.MasterIDs), timeoutServices)
+		}
+		time.Sleep(utils.HealthCheckDelay)
+	}
+}
+
+//GetState returns the last collected state of the cluster, collected again if older than StateCollectInterval
+func (c *Cluster) GetState() (ClusterState.Enum, error) {
+	return utils.GetState(&c.Definition.Cluster, c.Definition.StateCollectInterval, c.ForceGetState)
+}
+
+//ForceGetState returns the current state of the cluster
+// This method will trigger a effective state collection at each call
+func (c *Cluster) ForceGetState() (ClusterState.Enum, error) {
+	state := c.Definition.Cluster.State
+	if state == ClusterState.Creating || state == ClusterState.Removed {
+		return state, nil
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return ClusterState.Error, err
+	}
+	var report []clusterapi.NodeHealth
+	for _, id := range c.Definition.MasterIDs {
+		report = append(report, utils.CheckNode(svc, id, NodeType.Master, apiServerHealthURL))
+	}
+	for _, id := range c.Definition.PrivateNodeIDs {
+		report = append(report, utils.CheckNode(svc, id, NodeType.PrivateAgent, kubeletHealthURL))
+	}
+	for _, id := range c.Definition.PublicNodeIDs {
+		report = append(report, utils.CheckNode(svc, id, NodeType.PublicAgent, kubeletHealthURL))
+	}
+
+	c.Definition.Cluster.State = clusterapi.StateFromHealth(report)
+	c.Definition.Cluster.NodesHealth = report
+	c.Definition.Cluster.LastStateCollection = time.Now()
+	err = c.WriteDefinition()
+	if err != nil {
+		log.Printf("failed to save state of cluster '%s': %s", c.Definition.Cluster.Name, err.Error())
+	}
+	return c.Definition.Cluster.State, nil
+}
+
+//GetLoad returns the number of pending pods no node can host, the idle nodes being the private workers running only daemon sets pods
+func (c *Cluster) GetLoad() (*clusterapi.Load, error) {
+	retcode, output, err := scripts.Execute(c.Definition.MasterIDs[0], "k8s_get_load.sh", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if retcode != 0 {
+		return nil, fmt.Errorf("scripted load collection failed with error code %d:\n%s", retcode, *output)
+	}
+	addresses := map[string]string{}
+	for i, ip := range c.Definition.PrivateNodeIPs {
+		addresses[ip] = c.Definition.PrivateNodeIDs[i]
+	}
+	return utils.ParseLoad(*output, addresses)
+}
+
+//AddNode adds a worker node, public if nodeType is PublicAgent
+//Masters can't be added, the size of the control plane is given by the complexity of the cluster
+func (c *Cluster) AddNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*pb.VM, error) {
+	switch nodeType {
+	case NodeType.PublicAgent:
+		fallthrough
+	case NodeType.PrivateAgent:
+		if c.Definition.Cluster.State == ClusterState.Creating {
+			return nil, fmt.Errorf("The Kubernetes flavor of Cluster needs to be in state 'Created' at least to allow node addition.")
+		}
+		return c.addWorkerNode(nodeType, req)
+	case NodeType.Master:
+		return nil, fmt.Errorf("the control plane of a Kubernetes cluster is sized by its complexity, masters can't be added")
+	}
+	return nil, fmt.Errorf("unmanaged node type '%s (%d)'", nodeType.String(), nodeType)
+}
+
+//addMaster adds a master node
+func (c *Cluster) addMaster() (*pb.VM, error) {
+	i := len(c.Definition.MasterIDs) + 1
+	name := c.Definition.Cluster.Name + "-k8smaster-" + strconv.Itoa(i)
+	tpl := c.Definition.Cluster.Spec.Templates.Master.Or(defaultTemplates.Master)
+
+	masterVM, err := utils.AdoptOrCreateVM(&pb.VMDefinition{
+		Name:      name,
+		CPUNumber: tpl.CPU,
+		RAM:       tpl.RAM,
+		Disk:      tpl.Disk,
+		ImageID:   tpl.OS,
+		Network:   c.Definition.Cluster.NetworkID,
+		Public:    false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Master server %d: %s", i, err.Error())
+	}
+
+	// Registers the new Master in the cluster struct and updates the cluster definition in Object Storage
+	err = utils.RegisterNode(masterVM.ID, masterVM.PrivateIP, &c.Definition.MasterIDs, &c.Definition.MasterIPs, c.WriteDefinition)
+	if err != nil {
+		return nil, err
+	}
+
+	return masterVM, nil
+}
+
+//addLoadBalancer creates the load balancer spreading the requests to the API server on the masters, if not already created,
+//then adds to it the masters which aren't already its backends
+func (c *Cluster) addLoadBalancer() error {
+	if c.Definition.LoadBalancerID == "" {
+		lb, err := utils.CreateLoadBalancer(&pb.LoadBalancerDefinition{
+			Name:        c.Definition.Cluster.Name + "-k8sapiserver",
+			Network:     &pb.Reference{ID: c.Definition.Cluster.NetworkID},
+			Protocol:    pb.LBProtocol_LB_TCP,
+			Port:        apiServerPort,
+			BackendPort: apiServerPort,
+		})
+		if err != nil {
+			return err
+		}
+		c.Definition.LoadBalancerID = lb.ID
+		c.Definition.ControlPlaneEndpoint = lb.VIP
+		err = c.WriteDefinition()
+		if err != nil {
+			return fmt.Errorf("failed to update Cluster definition: %s", err.Error())
+		}
+	}
+
+	for _, id := range c.Definition.MasterIDs {
+		if utils.IndexOf(c.Definition.BackendIDs, id) != -1 {
+			continue
+		}
+		err := utils.AddLoadBalancerBackend(c.Definition.LoadBalancerID, id)
+		if err != nil {
+			return err
+		}
+		c.Definition.BackendIDs = append(c.Definition.BackendIDs, id)
+		err = c.WriteDefinition()
+		if err != nil {
+			return fmt.Errorf("failed to update Cluster definition: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+//addWorkerNode adds a worker node to the cluster
+func (c *Cluster) addWorkerNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*pb.VM, error) {
+	var publicIP bool
+	coreName := "node"
+	if nodeType == NodeType.PublicAgent {
+		publicIP = true
+		coreName = "pub" + coreName
+	} else {
+		publicIP = false
+		coreName = "priv" + coreName
+	}
+
+	c.Definition.LastNodeIndex++
+	i := c.Definition.LastNodeIndex
+	req.Public = publicIP
+	req.Network = c.Definition.Cluster.NetworkID
+	req.Name = c.Definition.Cluster.Name + "-k8s" + coreName + "-" + strconv.Itoa(i)
+	tpl := c.Definition.Cluster.Spec.Templates.ForNodeType(nodeType).Or(defaultTemplates.ForNodeType(nodeType))
+	tpl.Complete(req)
+	workerVM, err := utils.AdoptOrCreateVM(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Worker node %d: %s", i, err.Error())
+	}
+
+	// Installs Kubernetes on worker node and joins the cluster
+	err = c.configureWorker(workerVM)
+	if err != nil {
+		utils.DeleteVM(workerVM.ID)
+		return nil, fmt.Errorf("failed to install Kubernetes on Worker Node: %s", err.Error())
+	}
+
+	// Registers the new Worker in the cluster struct and updates the cluster definition in Object Storage
+	ids, ips := &c.Definition.PrivateNodeIDs, &c.Definition.PrivateNodeIPs
+	if nodeType == NodeType.PublicAgent {
+		ids, ips = &c.Definition.PublicNodeIDs, &c.Definition.PublicNodeIPs
+	}
+	err = utils.RegisterNode(workerVM.ID, workerVM.PrivateIP, ids, ips, c.WriteDefinition)
+	if err != nil {
+		return nil, err
+	}
+
+	return workerVM, nil
+}
+
+//getGateways returns the gateways of the network of the cluster having a public IP
+func (c *Cluster) getGateways() ([]*pb.NetworkVM, error) {
+	topology, err := utils.GetNetworkTopology(c.Definition.Cluster.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	var gateways []*pb.NetworkVM
+	for _, gw := range topology.Gateways {
+		if gw.PublicIP != "" {
+			gateways = append(gateways, gw)
+		}
+	}
+	if len(gateways) == 0 {
+		return nil, fmt.Errorf("network of cluster '%s' has no gateway with a public IP to expose the API server", c.Definition.Cluster.Name)
+	}
+	return gateways, nil
+}
+
+//configure initializes the control plane on the first master, then joins the other masters to it
+//The public IPs of the gateways are added to the certificate of the API server, which is reached through them
+func (c *Cluster) configure(gateways []*pb.NetworkVM) error {
+	if c.Definition.CertificateKey == "" {
+		certificateKey, err := newCertificateKey()
+		if err != nil {
+			return err
+		}
+		c.Definition.CertificateKey = certificateKey
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
+	}
+	certSANs := []string{c.Definition.ControlPlaneEndpoint}
+	for _, gw := range gateways {
+		certSANs = append(certSANs, gw.PublicIP)
+	}
+	data := map[string]interface{}{
+		"FirstMaster":          "yes",
+		"KubernetesVersion":    k8sVersion,
+		"ClusterName":          c.Definition.Cluster.Name,
+		"ControlPlaneEndpoint": c.Definition.ControlPlaneEndpoint,
+		"CertSANs":             certSANs,
+		"PodSubnet":            podSubnet,
+		"PodNetworkManifest":   podNetworkManifest,
+		"CertificateKey":       c.Definition.CertificateKey,
+		"NodeIP":               c.Definition.MasterIPs[0],
+		"JoinCommand":          "",
+	}
+
+	log.Printf("Initializing control plane on first Master server")
+	retcode, output, err := scripts.Execute(c.Definition.MasterIDs[0], "k8s_install_master_node.sh", data)
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted Master initialization failed with error code %d:\n%s", retcode, *output)
+	}
+	if len(c.Definition.MasterIDs) == 1 {
+		return nil
+	}
+
+	log.Printf("Joining Master servers to the control plane")
+	joinCommand, err := c.getJoinCommand()
+	if err != nil {
+		return err
+	}
+	data["FirstMaster"] = "no"
+	data["JoinCommand"] = joinCommand
+	for i, m := range c.Definition.MasterIDs[1:] {
+		data["NodeIP"] = c.Definition.MasterIPs[i+1]
+		retcode, output, err := scripts.Execute(m, "k8s_install_master_node.sh", data)
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted Master configuration failed with error code %d:\n%s", retcode, *output)
+		}
+	}
+	return nil
+}
+
+//getJoinCommand returns the command joining a node to the cluster, with a bootstrap token created for it
+func (c *Cluster) getJoinCommand() (string, error) {
+	retcode, output, err := scripts.Execute(c.Definition.MasterIDs[0], "k8s_join_command.sh", map[string]interface{}{})
+	if err != nil {
+		return "", err
+	}
+	if retcode != 0 {
+		return "", fmt.Errorf("failed to create bootstrap token, error code %d:\n%s", retcode, *output)
+	}
+	lines := strings.Split(strings.TrimSpace(*output), "\n")
+	return lines[len(lines)-1], nil
+}
+
+//configureWorker installs Kubernetes on targetVM and joins it to the cluster
+func (c *Cluster) configureWorker(targetVM *pb.VM) error {
+	joinCommand, err := c.getJoinCommand()
+	if err != nil {
+		return err
+	}
+	retcode, output, err := scripts.Execute(targetVM.ID, "k8s_install_worker_node.sh", map[string]interface{}{
+		"JoinCommand": joinCommand,
+	})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted Worker configuration failed with error code %d:\n%s", retcode, *output)
+	}
+	return nil
+}
+
+//exposeAPIServer forwards the port of the API server on the gateways to the control plane endpoint,
+//then keeps the kubeconfig of the administrator with the API server reached through the first gateway
+//The forward is needed as well when the load balancer is run by HAProxy on the gateways, HAProxy only listening on the
+//virtual IP of the network
+func (c *Cluster) exposeAPIServer(gateways []*pb.NetworkVM) error {
+	for _, gw := range gateways {
+		retcode, output, err := scripts.Execute(gw.ID, "k8s_expose_apiserver.sh", map[string]interface{}{
+			"ClusterName": c.Definition.Cluster.Name,
+			"Endpoint":    c.Definition.ControlPlaneEndpoint,
+		})
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted exposure on gateway '%s' failed with error code %d:\n%s", gw.Name, retcode, *output)
+		}
+	}
+
+	retcode, output, err := scripts.Execute(c.Definition.MasterIDs[0], "k8s_get_kubeconfig.sh", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("failed to read kubeconfig, error code %d:\n%s", retcode, *output)
+	}
+	internal := fmt.Sprintf("https://%s:%d", c.Definition.ControlPlaneEndpoint, apiServerPort)
+	external := fmt.Sprintf("https://%s:%d", gateways[0].PublicIP, apiServerPort)
+	c.Definition.Kubeconfig = strings.Replace(*output, internal, external, -1)
+	return c.WriteDefinition()
+}
+
+//GetKubeconfig returns the kubeconfig of the administrator of the cluster, reaching the API server through the gateway
+func (c *Cluster) GetKubeconfig() (string, error) {
+	if c.Definition.Kubeconfig == "" {
+		return "", fmt.Errorf("no kubeconfig for cluster '%s', its creation didn't complete", c.Definition.Cluster.Name)
+	}
+	return c.Definition.Kubeconfig, nil
+}
+
+//DeleteNode drains the worker node referenced by ref (name or ID) through Kubernetes, then deletes its VM
+//Masters can't be deleted, the size of the control plane is given by the complexity of the cluster
+func (c *Cluster) DeleteNode(ref string) error {
+	vm, err := utils.GetVM(ref)
+	if err != nil {
+		return err
+	}
+	ids, ips := &c.Definition.PrivateNodeIDs, &c.Definition.PrivateNodeIPs
+	index := utils.IndexOf(*ids, vm.ID)
+	if index < 0 {
+		ids, ips = &c.Definition.PublicNodeIDs, &c.Definition.PublicNodeIPs
+		index = utils.IndexOf(*ids, vm.ID)
+	}
+	if index < 0 {
+		return fmt.Errorf("'%s' is not a worker node of cluster '%s'", ref, c.Definition.Cluster.Name)
+	}
+
+	// The node is drained from the first master, if the control plane is running
+	master, err := utils.GetVM(c.Definition.MasterIDs[0])
+	if err != nil {
+		return err
+	}
+	if master.State == pb.VMState_STARTED {
+		log.Printf("Draining Kubernetes Worker node '%s'", vm.Name)
+		retcode, output, err := scripts.Execute(master.ID, "k8s_drain_node.sh", map[string]interface{}{
+			"NodeIP": vm.PrivateIP,
+		})
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted Worker draining failed with error code %d:\n%s", retcode, *output)
+		}
+	}
+	err = utils.DeleteVMIfExists(vm.ID)
+	if err != nil {
+		return err
+	}
+
+	*ids = append((*ids)[:index], (*ids)[index+1:]...)
+	if len(*ips) > index {
+		*ips = append((*ips)[:index], (*ips)[index+1:]...)
+	}
+	return c.WriteDefinition()
+}
+
+//ListMasters lists the master nodes in the cluster
+func (c *Cluster) ListMasters() ([]*pb.VM, error) {
+	return utils.GetVMs(c.Definition.MasterIDs)
+}
+
+//ListNodes lists the worker nodes in the cluster, private ones first
+func (c *Cluster) ListNodes() ([]*pb.VM, error) {
+	return utils.GetVMs(c.workerIDs())
+}
+
+//CountPrivateNodes returns the number of private worker nodes in the cluster
+func (c *Cluster) CountPrivateNodes() int {
+	return len(c.Definition.PrivateNodeIDs)
+}
+
+//GetNode returns the node referenced by ref (name or ID), which can be a master or a worker
+func (c *Cluster) GetNode(ref string) (*pb.VM, error) {
+	vm, err := utils.GetVM(ref)
+	if err != nil {
+		return nil, err
+	}
+	if utils.IndexOf(c.Definition.MasterIDs, vm.ID) >= 0 ||
+		utils.IndexOf(c.Definition.PrivateNodeIDs, vm.ID) >= 0 ||
+		utils.IndexOf(c.Definition.PublicNodeIDs, vm.ID) >= 0 {
+		return vm, nil
+	}
+	return nil, fmt.Errorf("'%s' is not a node of cluster '%s'", ref, c.Definition.Cluster.Name)
+}
+
+//WriteDefinition writes cluster definition in Object Storage
+func (c *Cluster) WriteDefinition() error {
+	return utils.WriteDefinition(c.Definition.Cluster.Name, c.Definition)
+}
+
+//ReadDefinition reads definition of cluster named 'name' from Metadata
+// Returns (true, nil) if found and loaded, (false, nil) if not found, and (false, error) in case of error
+func (c *Cluster) ReadDefinition() (bool, error) {
+	var d Definition
+	ok, err := utils.ReadDefinition(c.Definition.Cluster.Name, &d)
+	if ok {
+		c.Definition = &d
+	}
+	return ok, err
+}
+
+//RemoveDefinition removes definition of cluster from Object Storage
+func (c *Cluster) RemoveDefinition() error {
+	running := len(c.Definition.MasterIDs) > 0 ||
+		len(c.Definition.PublicNodeIDs) > 0 ||
+		len(c.Definition.PrivateNodeIDs) > 0 ||
+		c.Definition.LoadBalancerID != ""
+	return utils.RemoveDefinition(&c.Definition.Cluster, running)
+}
+
+//Delete destroys the workers, the masters, the load balancer, the key pair and the network of the cluster
+//The definition is updated after each deletion, so a failed deletion can be retried
+func (c *Cluster) Delete() error {
+	err := utils.DeleteNodes(&c.Definition.PublicNodeIDs, &c.Definition.PublicNodeIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+	err = utils.DeleteNodes(&c.Definition.PrivateNodeIDs, &c.Definition.PrivateNodeIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+	err = utils.DeleteNodes(&c.Definition.MasterIDs, &c.Definition.MasterIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+	if c.Definition.LoadBalancerID != "" {
+		err = utils.DeleteLoadBalancer(c.Definition.LoadBalancerID)
+		if err != nil && !utils.IsNotFound(err) {
+			return fmt.Errorf("failed to delete Load Balancer '%s': %s", c.Definition.LoadBalancerID, err.Error())
+		}
+		c.Definition.LoadBalancerID = ""
+		c.Definition.BackendIDs = nil
+		c.Definition.ControlPlaneEndpoint = ""
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
+	}
+
+	return utils.DeleteKeyPairAndNetwork(&c.Definition.Cluster, c.WriteDefinition)
+}
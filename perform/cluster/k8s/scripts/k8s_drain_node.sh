@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Drains the node with IP {{.NodeIP}}, then removes it from the cluster
+# Its pods are evicted and rescheduled by their controllers on the other nodes
+# This script must be executed on the first master node.
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+
+NODE=$(kubectl get nodes -o jsonpath='{range .items[*]}{.metadata.name} {.status.addresses[?(@.type=="InternalIP")].address}{"\n"}{end}' | awk '$2 == "{{.NodeIP}}" { print $1 }')
+
+# Nothing to drain if the node is not registered
+[ -z "$NODE" ] && exit 0
+
+kubectl drain $NODE --ignore-daemonsets --delete-local-data --force --timeout=300s || exit $?
+kubectl delete node $NODE
+exit $?
@@ -0,0 +1,41 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Forwards the port 6443 of the gateway to the Kubernetes API server of the cluster,
+# so the cluster can be managed with kubectl from outside the network
+# This script must be executed on gateway of the network of the cluster.
+
+SERVICE=k8s-apiserver-{{.ClusterName}}
+
+cat >/etc/systemd/system/$SERVICE.service <<- EOF
+[Unit]
+Description=Forwards port 6443 to the Kubernetes API server of cluster {{.ClusterName}}
+After=network-online.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/sbin/iptables -t nat -A PREROUTING -p tcp --dport 6443 -j DNAT --to-destination {{.Endpoint}}:6443
+ExecStart=/sbin/iptables -I FORWARD -p tcp -d {{.Endpoint}} --dport 6443 -j ACCEPT
+ExecStop=/sbin/iptables -t nat -D PREROUTING -p tcp --dport 6443 -j DNAT --to-destination {{.Endpoint}}:6443
+ExecStop=/sbin/iptables -D FORWARD -p tcp -d {{.Endpoint}} --dport 6443 -j ACCEPT
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+systemctl daemon-reload && systemctl enable $SERVICE && systemctl restart $SERVICE
+exit $?
@@ -0,0 +1,32 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Prints the load of the cluster for the autoscaler: a line 'PENDING <count>' with the
+# number of pods no node can host, then a line 'IDLE <IP>' per worker running only daemon sets pods
+# This script must be executed on the first master node.
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+
+PENDING=$(kubectl get pods --all-namespaces --field-selector=status.phase=Pending -o jsonpath='{range .items[*]}{.status.conditions[?(@.type=="PodScheduled")].reason}{"\n"}{end}' | grep -c Unschedulable)
+echo "PENDING $PENDING"
+
+# The static pods of the masters are owned by their Node
+BUSY=$(kubectl get pods --all-namespaces --field-selector=status.phase=Running -o jsonpath='{range .items[*]}{.spec.nodeName} {.metadata.ownerReferences[0].kind}{"\n"}{end}' | awk '$2 != "DaemonSet" && $2 != "Node" { print $1 }' | sort -u)
+
+kubectl get nodes -l '!node-role.kubernetes.io/master' -o jsonpath='{range .items[*]}{.metadata.name} {.status.addresses[?(@.type=="InternalIP")].address}{"\n"}{end}' | while read NODE IP; do
+    echo "$BUSY" | grep -qx "$NODE" || echo "IDLE $IP"
+done
+exit ${PIPESTATUS[0]}
@@ -0,0 +1,66 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Installs and configure a Kubernetes master node
+# The first master initializes the control plane and uploads its certificates,
+# the other ones join it with the certificate key to fetch them
+# This script must be executed on server to configure as master node
+
+# Installs and configures everything needed on any node
+{{.IncludeInstallCommons}}
+
+if [ "{{.FirstMaster}}" = "yes" ]; then
+    mkdir -p /etc/kubernetes
+    cat >/etc/kubernetes/kubeadm.yaml <<- EOF
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: InitConfiguration
+certificateKey: {{.CertificateKey}}
+localAPIEndpoint:
+  advertiseAddress: {{.NodeIP}}
+  bindPort: 6443
+---
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+kubernetesVersion: v{{.KubernetesVersion}}
+clusterName: {{.ClusterName}}
+controlPlaneEndpoint: {{.ControlPlaneEndpoint}}:6443
+apiServer:
+  certSANs:
+{{- range .CertSANs}}
+  - {{.}}
+{{- end}}
+networking:
+  podSubnet: {{.PodSubnet}}
+EOF
+    # The control plane may be initialized already if the configuration of the cluster was interrupted,
+    # its certificates are uploaded again for the masters still to join, the uploaded ones expiring after 2 hours
+    if [ -f /etc/kubernetes/admin.conf ]; then
+        kubeadm init phase upload-certs --upload-certs --config /etc/kubernetes/kubeadm.yaml || exit 1
+    else
+        kubeadm init --config /etc/kubernetes/kubeadm.yaml --upload-certs || exit 1
+    fi
+
+    # Installs the pod network
+    export KUBECONFIG=/etc/kubernetes/admin.conf
+    kubectl apply -f {{.PodNetworkManifest}}
+    exit $?
+fi
+
+# The master may have joined the control plane already if the configuration of the cluster was interrupted
+[ -f /etc/kubernetes/admin.conf ] && exit 0
+
+{{.JoinCommand}} --control-plane --certificate-key {{.CertificateKey}} --apiserver-advertise-address {{.NodeIP}}
+exit $?
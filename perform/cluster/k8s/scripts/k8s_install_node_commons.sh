@@ -0,0 +1,52 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+#### Installs and configure common tools for any kind of nodes ####
+
+export LANG=C
+export DEBIAN_FRONTEND=noninteractive
+
+(
+
+    # kubelet refuses to run with swap enabled
+    swapoff -a
+    sed -i '/\sswap\s/d' /etc/fstab
+
+    # Lets iptables see the bridged traffic of the pods
+    modprobe br_netfilter
+    echo br_netfilter >/etc/modules-load.d/10-br_netfilter.conf
+    cat >/etc/sysctl.d/10-kubernetes.conf <<- EOF
+net.bridge.bridge-nf-call-iptables = 1
+net.bridge.bridge-nf-call-ip6tables = 1
+net.ipv4.ip_forward = 1
+EOF
+    sysctl --system
+
+    # Installs docker
+    apt-get update
+    apt-get install -y apt-transport-https ca-certificates curl docker.io
+    systemctl enable docker.service
+    systemctl start docker
+
+    # Installs kubelet, kubeadm and kubectl, held at the version of the cluster
+    curl -s https://packages.cloud.google.com/apt/doc/apt-key.gpg | apt-key add -
+    echo "deb https://apt.kubernetes.io/ kubernetes-xenial main" >/etc/apt/sources.list.d/kubernetes.list
+    apt-get update
+    apt-get install -y kubelet={{.KubernetesVersion}}-00 kubeadm={{.KubernetesVersion}}-00 kubectl={{.KubernetesVersion}}-00
+    apt-mark hold kubelet kubeadm kubectl
+
+) >/dev/null
+####
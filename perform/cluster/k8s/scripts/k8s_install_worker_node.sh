@@ -0,0 +1,27 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Installs and configure a Kubernetes worker node
+# This script must be executed on worker node.
+
+# Installs and configures everything needed on any node
+{{.IncludeInstallCommons}}
+
+# The node may have joined the cluster already if it was created before an interruption
+[ -f /etc/kubernetes/kubelet.conf ] && exit 0
+
+{{.JoinCommand}}
+exit $?
@@ -0,0 +1,326 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+	"github.com/CS-SI/SafeScale/perform/cluster/components"
+	"github.com/CS-SI/SafeScale/perform/utils"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+const (
+	//roleMaster is the role of the masters in the volumes of a definition file
+	roleMaster = "master"
+	//rolePrivate is the role of the private agent nodes in the volumes of a definition file
+	rolePrivate = "private"
+	//rolePublic is the role of the public agent nodes in the volumes of a definition file
+	rolePublic = "public"
+)
+
+//roleOf returns the role of the nodes of type nodeType
+func roleOf(nodeType NodeType.Enum) string {
+	switch nodeType {
+	case NodeType.PrivateAgent:
+		return rolePrivate
+	case NodeType.PublicAgent:
+		return rolePublic
+	}
+	return roleMaster
+}
+
+//agentRole returns the role of the agent node vm, only the private VMs reach the internet through a gateway
+func agentRole(vm *pb.VM) string {
+	if vm.GatewayID == "" {
+		return rolePublic
+	}
+	return rolePrivate
+}
+
+//AddNode adds a node of type nodeType to the cluster, then attaches the volumes of its role and mounts the NAS
+//of the cluster definition; the node is removed if its storage can't be set up
+func AddNode(instance clusterapi.ClusterAPI, nodeType NodeType.Enum, req *pb.VMDefinition) (*pb.VM, error) {
+	vm, err := instance.AddNode(nodeType, req)
+	if err != nil {
+		return nil, err
+	}
+	err = setupNode(instance.GetDefinition(), vm, roleOf(nodeType))
+	if err != nil {
+		derr := DeleteNode(instance, vm.ID)
+		if derr != nil {
+			log.Printf("failed to remove node '%s': %s", vm.Name, derr.Error())
+		}
+		return nil, err
+	}
+	return vm, nil
+}
+
+//DeleteNode releases the storage of the agent node referenced by ref (name or ID), then removes it from the cluster
+func DeleteNode(instance clusterapi.ClusterAPI, ref string) error {
+	vm, err := instance.GetNode(ref)
+	if err != nil {
+		return err
+	}
+	definition := instance.GetDefinition()
+	role := agentRole(vm)
+	releaseNode(definition, vm, role)
+	err = instance.DeleteNode(vm.ID)
+	if err != nil {
+		return err
+	}
+	return deleteVolumes(definition, vm, role)
+}
+
+//nasName returns the name of the NAS nas of the cluster
+func nasName(definition clusterapi.Cluster, nas clusterapi.NasSpec) string {
+	return definition.Name + "-" + nas.Name
+}
+
+//volumeName returns the name of the volume of vm described by volume
+func volumeName(vm *pb.VM, volume clusterapi.VolumeSpec) string {
+	return vm.Name + "-" + volume.Name
+}
+
+//setupNode creates and attaches the volumes of the role of vm, then mounts the NAS of the cluster on agent nodes
+func setupNode(definition clusterapi.Cluster, vm *pb.VM, role string) error {
+	for _, v := range definition.Spec.Volumes {
+		if v.Role != role {
+			continue
+		}
+		name := volumeName(vm, v)
+		speed := pb.VolumeSpeed_HDD
+		if v.Speed != "" {
+			speed = pb.VolumeSpeed(pb.VolumeSpeed_value[strings.ToUpper(v.Speed)])
+		}
+		_, err := utils.CreateVolume(name, v.Size, speed)
+		if err != nil {
+			if !strings.Contains(err.Error(), "already exists") {
+				return err
+			}
+			// The volume was created before an interrupted deployment, which may have stopped before attaching it
+			attached, err := utils.IsVolumeAttached(name, vm.ID)
+			if err != nil {
+				return err
+			}
+			if attached {
+				continue
+			}
+		}
+		err = utils.AttachVolume(name, vm.Name, v.Path, v.Format)
+		if err != nil {
+			return err
+		}
+	}
+	if role == roleMaster {
+		return nil
+	}
+	for _, n := range definition.Spec.Nas {
+		// The NAS may have been mounted before an interrupted deployment
+		mounted, err := utils.IsNasMounted(nasName(definition, n), vm.ID)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			continue
+		}
+		err = utils.MountNas(nasName(definition, n), vm.Name, n.Path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//releaseNode unmounts the NAS and detaches the volumes of vm, failures are only logged so a node can always be removed
+func releaseNode(definition clusterapi.Cluster, vm *pb.VM, role string) {
+	if role != roleMaster {
+		for _, n := range definition.Spec.Nas {
+			err := utils.UMountNas(nasName(definition, n), vm.Name)
+			if err != nil {
+				log.Printf("%s", err.Error())
+			}
+		}
+	}
+	for _, v := range definition.Spec.Volumes {
+		if v.Role != role {
+			continue
+		}
+		err := utils.DetachVolume(volumeName(vm, v), vm.Name)
+		if err != nil {
+			log.Printf("%s", err.Error())
+		}
+	}
+}
+
+//deleteVolumes deletes the volumes of the role of vm, a volume already deleted is not an error
+func deleteVolumes(definition clusterapi.Cluster, vm *pb.VM, role string) error {
+	for _, v := range definition.Spec.Volumes {
+		if v.Role != role {
+			continue
+		}
+		err := utils.DeleteVolume(volumeName(vm, v))
+		if err != nil && !strings.Contains(err.Error(), "does not exists") {
+			return fmt.Errorf("failed to delete volume '%s': %s", volumeName(vm, v), err.Error())
+		}
+	}
+	return nil
+}
+
+//deploySpec creates what the definition of a newly created cluster specifies besides its masters:
+//the NAS exported by the first master, the volumes of the masters, the initial agent nodes and the components
+//What already exists is kept, so an interrupted deployment can be resumed
+func deploySpec(instance clusterapi.ClusterAPI) error {
+	definition := instance.GetDefinition()
+	masters, err := instance.ListMasters()
+	if err != nil {
+		return err
+	}
+	if len(masters) == 0 {
+		return fmt.Errorf("no master in cluster '%s'", definition.Name)
+	}
+	for _, n := range definition.Spec.Nas {
+		err = utils.CreateNas(nasName(definition, n), masters[0].Name, n.Path)
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			return err
+		}
+	}
+	for _, master := range masters {
+		err = setupNode(definition, master, roleMaster)
+		if err != nil {
+			return err
+		}
+	}
+
+	nodes, err := instance.ListNodes()
+	if err != nil {
+		return err
+	}
+	private, public := 0, 0
+	for _, vm := range nodes {
+		if agentRole(vm) == rolePublic {
+			public++
+		} else {
+			private++
+		}
+	}
+	for i := private; i < definition.Spec.Nodes.Private; i++ {
+		_, err = AddNode(instance, NodeType.PrivateAgent, &pb.VMDefinition{})
+		if err != nil {
+			return fmt.Errorf("failed to add private node %d: %s", i+1, err.Error())
+		}
+	}
+	for i := public; i < definition.Spec.Nodes.Public; i++ {
+		_, err = AddNode(instance, NodeType.PublicAgent, &pb.VMDefinition{})
+		if err != nil {
+			return fmt.Errorf("failed to add public node %d: %s", i+1, err.Error())
+		}
+	}
+
+	for _, c := range definition.Spec.Components {
+		log.Printf("Deploying component '%s'", c)
+		script, err := components.RealizeInstallScript(definition.Flavor.String(), c, map[string]interface{}{
+			"ClusterName": definition.Name,
+		})
+		if err != nil {
+			return err
+		}
+		retcode, output, err := runScript(masters[0].ID, script)
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("deployment of component '%s' failed with error code %d:\n%s", c, retcode, output)
+		}
+	}
+	return nil
+}
+
+//releasedNode is a node whose storage was released, its volumes are deleted once its VM is deleted
+type releasedNode struct {
+	vm   *pb.VM
+	role string
+}
+
+//releaseSpec releases the storage of the nodes and deletes the NAS of the cluster before the deletion of its infrastructure
+//The nodes which can't be listed anymore are skipped
+func releaseSpec(instance clusterapi.ClusterAPI) []releasedNode {
+	definition := instance.GetDefinition()
+	if len(definition.Spec.Volumes) == 0 && len(definition.Spec.Nas) == 0 {
+		return nil
+	}
+	var released []releasedNode
+	masters, err := instance.ListMasters()
+	if err != nil {
+		log.Printf("failed to list masters, their volumes may have to be deleted: %s", err.Error())
+	}
+	for _, vm := range masters {
+		released = append(released, releasedNode{vm: vm, role: roleMaster})
+	}
+	nodes, err := instance.ListNodes()
+	if err != nil {
+		log.Printf("failed to list nodes, their volumes may have to be deleted: %s", err.Error())
+	}
+	for _, vm := range nodes {
+		released = append(released, releasedNode{vm: vm, role: agentRole(vm)})
+	}
+	for _, n := range released {
+		releaseNode(definition, n.vm, n.role)
+	}
+	for _, n := range definition.Spec.Nas {
+		err = utils.DeleteNas(nasName(definition, n))
+		if err != nil && !strings.Contains(err.Error(), "does not exists") {
+			log.Printf("failed to delete NAS '%s': %s", nasName(definition, n), err.Error())
+		}
+	}
+	return released
+}
+
+//runScript executes script with sudo on the VM identified by id
+func runScript(id string, script string) (int, string, error) {
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return 0, "", err
+	}
+	ssh, err := svc.GetSSHConfig(id)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read SSH config: %s", err.Error())
+	}
+	cmd, err := ssh.SudoCommand(script)
+	if err != nil {
+		return 0, "", err
+	}
+	retcode := 0
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			if status, ok := ee.Sys().(syscall.WaitStatus); ok {
+				retcode = status.ExitStatus()
+			}
+		} else {
+			return 0, "", err
+		}
+	}
+	return retcode, string(out), nil
+}
@@ -0,0 +1,884 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slurm
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	rice "github.com/GeertJohan/go.rice"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+	"github.com/CS-SI/SafeScale/perform/utils"
+	"github.com/CS-SI/SafeScale/providers"
+	providerapi "github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/VMState"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+//go:generate rice embed-go
+
+const (
+	//defaultStateCollectInterval is the time the collected state of a new cluster is kept before being collected again
+	defaultStateCollectInterval = 5 * time.Minute
+
+	//controllerHealthCommand succeeds on a controller answering to the slurm commands
+	controllerHealthCommand = "scontrol ping | grep -q UP"
+	//computeHealthCommand succeeds on a compute node running slurmd
+	computeHealthCommand = "systemctl is-active --quiet munge && systemctl is-active --quiet slurmd"
+
+	//defaultPartition is the partition containing all the compute nodes, used by the jobs not asking for a partition
+	defaultPartition = "all"
+
+	//timeoutServices is the time the slurm daemons are given to be healthy once their VMs are started
+	timeoutServices = 10 * time.Minute
+)
+
+var (
+	//scripts gives the script templates of the package
+	scripts = utils.NewScriptBox(func() (*rice.Box, error) {
+		return rice.FindBox("../slurm/scripts")
+	}, "slurm_install_node_commons.sh", map[string]interface{}{})
+
+	//defaultTemplates size the nodes whose template is not set in the definition of the cluster
+	defaultTemplates = clusterapi.Templates{
+		Master:      clusterapi.NodeTemplate{CPU: 4, RAM: 8.0, Disk: 200, OS: "Ubuntu 16.04"},
+		PrivateNode: clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "Ubuntu 16.04"},
+		PublicNode:  clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "Ubuntu 16.04"},
+	}
+
+	//sharedPaths are the paths of the controller exported as NAS and mounted on every compute node, by suffix of NAS name
+	sharedPaths = []struct{ Suffix, Path string }{
+		{"home", "/shared/home"},
+		{"scratch", "/shared/scratch"},
+	}
+
+	//invalidPartitionChars are the characters of a template name not kept in the name of its partition
+	invalidPartitionChars = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+)
+
+//ComputeNode describes a compute node of the cluster
+type ComputeNode struct {
+	//ID is the ID of the VM of the node
+	ID string
+	//Name is the name of the VM of the node, also its hostname and its name in slurm
+	Name string
+	//IP is the private IP of the node
+	IP string
+	//CPU is the number of cores of the node
+	CPU int32
+	//RAM is the memory of the node in GB
+	RAM float32
+	//Public is true if the node has a public IP
+	Public bool
+	//Partition is the partition of the node, named after the template of its VM
+	Partition string
+}
+
+//Definition defines the values we want to keep in Object Storage
+type Definition struct {
+	// common cluster data
+	clusterapi.Cluster
+
+	//ControllerID is the identifier of the VM running slurmctld, also exporting the shared storage
+	ControllerID string
+
+	//ControllerName is the name of the controller, also its hostname
+	ControllerName string
+
+	//ControllerIP contains the IP of the controller reachable by all compute nodes
+	ControllerIP string
+
+	//ControllerInstalled is true once slurmctld is installed on the controller
+	ControllerInstalled bool
+
+	//Nodes are the compute nodes of the cluster
+	Nodes []ComputeNode
+
+	//LastNodeIndex is the index in the name of the last compute node created, so that each node gets a new name
+	LastNodeIndex int
+
+	//SharedNas contains the names of the NAS exported by the controller
+	SharedNas []string
+
+	//StateCollectInterval is the time the collected state is kept before being collected again
+	StateCollectInterval time.Duration
+}
+
+//Cluster is the object describing a cluster created by ClusterManagerAPI.CreateCluster
+type Cluster struct {
+	//Definition contains data defining the cluster
+	*Definition
+}
+
+//NewCluster creates the necessary infrastructure of cluster
+//A Slurm cluster has a single controller whatever its complexity, the compute nodes are added with AddNode
+//If the creation fails, the infrastructure already created is deleted unless req.KeepOnFailure is set
+func NewCluster(req clusterapi.Request) (clusterapi.ClusterAPI, error) {
+	// Saving cluster parameters, with status 'Creating', so the infrastructure can be deleted if anything fails
+	instance := Cluster{
+		Definition: &Definition{
+			Cluster: clusterapi.Cluster{
+				Name:          req.Name,
+				CIDR:          req.CIDR,
+				Flavor:        req.Flavor,
+				State:         ClusterState.Creating,
+				Complexity:    req.Complexity,
+				Tenant:        req.Tenant,
+				NetworkID:     req.NetworkID,
+				Spec:          req.Spec,
+				Operation:     req.Operation,
+				KeepOnFailure: req.KeepOnFailure,
+			},
+			StateCollectInterval: defaultStateCollectInterval,
+		},
+	}
+	err := instance.WriteDefinition()
+	if err != nil {
+		err = fmt.Errorf("failed to create cluster '%s': %s", req.Name, err.Error())
+		goto cleanup
+	}
+
+	err = instance.create()
+	if err != nil {
+		goto cleanup
+	}
+
+	log.Printf("Cluster '%s' created and initialized successfully", req.Name)
+	return &instance, nil
+
+cleanup:
+	utils.AbortCreation(&instance, req.KeepOnFailure)
+	return nil, err
+}
+
+//ResumeCreation creates what the interrupted creation of the cluster didn't create, then configures it
+func (c *Cluster) ResumeCreation() error {
+	return c.create()
+}
+
+//create creates and installs the controller if it isn't already, exports the shared storage not exported yet,
+//then configures the cluster
+//Each step is saved in the definition, so an interrupted creation resumes from the last step done
+func (c *Cluster) create() error {
+	var err error
+
+	// Create a KeyPair for the cluster
+	if c.Definition.Cluster.Keypair == nil {
+		c.Definition.Cluster.Keypair, err = utils.CreateKeyPair(c.Definition.Cluster.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Definition.ControllerID == "" {
+		log.Printf("Creating Slurm Controller server")
+		err = c.addController()
+		if err != nil {
+			return fmt.Errorf("failed to create Slurm Controller: %s", err.Error())
+		}
+	}
+	if !c.Definition.ControllerInstalled {
+		log.Printf("Installing Slurm Controller")
+		err = c.installController()
+		if err != nil {
+			return fmt.Errorf("failed to install Slurm Controller: %s", err.Error())
+		}
+	}
+
+	log.Printf("Exporting shared storage of the cluster")
+	err = c.createSharedNas()
+	if err != nil {
+		return fmt.Errorf("failed to export shared storage: %s", err.Error())
+	}
+
+	// The configuration is rewritten as a whole, so it is done again when the creation is resumed
+	log.Printf("Configuring cluster")
+	err = c.reconfigure()
+	if err != nil {
+		return fmt.Errorf("failed to configure Slurm cluster: %s", err.Error())
+	}
+
+	// Cluster created and configured successfully, saving again to Object Storage
+	c.Definition.Cluster.State = ClusterState.Created
+	return c.WriteDefinition()
+}
+
+//GetName returns the name of the cluster
+func (c *Cluster) GetName() string {
+	return c.Definition.Cluster.Name
+}
+
+//Start starts the controller, then the compute nodes once the controller is healthy
+//The cluster is Nominal when Start returns without error
+func (c *Cluster) Start() error {
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Nominal:
+		return fmt.Errorf("Can't start an already started cluster")
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't start a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting Slurm Controller server")
+	err = utils.SetNodesState(svc, []string{c.Definition.ControllerID}, VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	err = c.waitController(svc)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting Slurm Compute nodes")
+	err = utils.SetNodesState(svc, c.nodeIDs(), VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	return utils.WaitNominal(c.ForceGetState, timeoutServices)
+}
+
+//Stop stops the compute nodes, then the controller
+func (c *Cluster) Stop() error {
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Stopped:
+		return nil
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't stop a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping Slurm Compute nodes")
+	err = utils.SetNodesState(svc, c.nodeIDs(), VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping Slurm Controller server")
+	err = utils.SetNodesState(svc, []string{c.Definition.ControllerID}, VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	state, err = c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	if state != ClusterState.Stopped {
+		return fmt.Errorf("cluster still in state '%s' once its nodes are stopped", state.String())
+	}
+	return nil
+}
+
+//nodeIDs returns the IDs of the compute nodes
+func (c *Cluster) nodeIDs() []string {
+	var ids []string
+	for _, n := range c.Definition.Nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+//waitController waits for the controller to be healthy, so the compute nodes can register to it
+func (c *Cluster) waitController(svc *providers.Service) error {
+	deadline := time.Now().Add(timeoutServices)
+	for {
+		health := utils.CheckNodeCommand(svc, c.Definition.ControllerID, NodeType.Master, controllerHealthCommand)
+		if health.Message == "" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("controller not healthy after %v: %s", timeoutServices, health.Message)
+		}
+		time.Sleep(utils.HealthCheckDelay)
+	}
+}
+
+//GetState returns the last collected state of the cluster, collected again if older than StateCollectInterval
+func (c *Cluster) GetState() (ClusterState.Enum, error) {
+	return utils.GetState(&c.Definition.Cluster, c.Definition.StateCollectInterval, c.ForceGetState)
+}
+
+//ForceGetState returns the current state of the cluster
+// This method will trigger a effective state collection at each call
+func (c *Cluster) ForceGetState() (ClusterState.Enum, error) {
+	state := c.Definition.Cluster.State
+	if state == ClusterState.Creating || state == ClusterState.Removed {
+		return state, nil
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return ClusterState.Error, err
+	}
+	report := []clusterapi.NodeHealth{
+		utils.CheckNodeCommand(svc, c.Definition.ControllerID, NodeType.Master, controllerHealthCommand),
+	}
+	for _, n := range c.Definition.Nodes {
+		nodeType := NodeType.PrivateAgent
+		if n.Public {
+			nodeType = NodeType.PublicAgent
+		}
+		report = append(report, utils.CheckNodeCommand(svc, n.ID, nodeType, computeHealthCommand))
+	}
+
+	c.Definition.Cluster.State = clusterapi.StateFromHealth(report)
+	c.Definition.Cluster.NodesHealth = report
+	c.Definition.Cluster.LastStateCollection = time.Now()
+	err = c.WriteDefinition()
+	if err != nil {
+		log.Printf("failed to save state of cluster '%s': %s", c.Definition.Cluster.Name, err.Error())
+	}
+	return c.Definition.Cluster.State, nil
+}
+
+//GetLoad returns the number of jobs waiting for resources, the idle nodes being the private compute nodes running no job
+func (c *Cluster) GetLoad() (*clusterapi.Load, error) {
+	retcode, output, err := scripts.Execute(c.Definition.ControllerID, "slurm_get_load.sh", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if retcode != 0 {
+		return nil, fmt.Errorf("scripted load collection failed with error code %d:\n%s", retcode, *output)
+	}
+	addresses := map[string]string{}
+	for _, n := range c.Definition.Nodes {
+		if !n.Public {
+			addresses[n.Name] = n.ID
+		}
+	}
+	return utils.ParseLoad(*output, addresses)
+}
+
+//AddNode adds a compute node, public if nodeType is PublicAgent, in the partition of the template of its VM
+func (c *Cluster) AddNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*pb.VM, error) {
+	switch nodeType {
+	case NodeType.PublicAgent:
+		fallthrough
+	case NodeType.PrivateAgent:
+		if c.Definition.Cluster.State == ClusterState.Creating {
+			return nil, fmt.Errorf("The Slurm flavor of Cluster needs to be in state 'Created' at least to allow compute node addition.")
+		}
+		return c.addComputeNode(nodeType == NodeType.PublicAgent, req)
+	case NodeType.Master:
+		return nil, fmt.Errorf("a Slurm cluster has a single controller, masters can't be added")
+	}
+	return nil, fmt.Errorf("unmanaged node type '%s (%d)'", nodeType.String(), nodeType)
+}
+
+//addController creates the VM of the controller
+func (c *Cluster) addController() error {
+	name := c.Definition.Cluster.Name + "-slurmctl"
+	tpl := c.Definition.Cluster.Spec.Templates.Master.Or(defaultTemplates.Master)
+	controllerVM, err := utils.AdoptOrCreateVM(&pb.VMDefinition{
+		Name:      name,
+		CPUNumber: tpl.CPU,
+		RAM:       tpl.RAM,
+		Disk:      tpl.Disk,
+		ImageID:   tpl.OS,
+		Network:   c.Definition.Cluster.NetworkID,
+		Public:    false,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Controller server: %s", err.Error())
+	}
+
+	c.Definition.ControllerID = controllerVM.ID
+	c.Definition.ControllerName = controllerVM.Name
+	c.Definition.ControllerIP = controllerVM.PrivateIP
+
+	// Update cluster definition in Object Storage
+	err = c.WriteDefinition()
+	if err != nil {
+		// Removes the ID we just added to the cluster struct
+		c.Definition.ControllerID = ""
+		c.Definition.ControllerName = ""
+		c.Definition.ControllerIP = ""
+		utils.DeleteVM(controllerVM.ID)
+		return fmt.Errorf("failed to update Cluster definition: %s", err.Error())
+	}
+	return nil
+}
+
+//installController installs slurmctld on the controller
+func (c *Cluster) installController() error {
+	retcode, output, err := scripts.Execute(c.Definition.ControllerID, "slurm_install_controller.sh", map[string]interface{}{
+		"NodeName": c.Definition.ControllerName,
+		"NodeIP":   c.Definition.ControllerIP,
+	})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted Controller installation failed with error code %d:\n%s", retcode, *output)
+	}
+	c.Definition.ControllerInstalled = true
+	return c.WriteDefinition()
+}
+
+//createSharedNas exports the shared paths of the controller not exported yet through the NAS service of the broker
+func (c *Cluster) createSharedNas() error {
+	for _, shared := range sharedPaths {
+		name := c.Definition.Cluster.Name + "-" + shared.Suffix
+		if utils.IndexOf(c.Definition.SharedNas, name) != -1 {
+			continue
+		}
+		err := utils.CreateNas(name, c.Definition.ControllerName, shared.Path)
+		if err != nil {
+			return err
+		}
+		c.Definition.SharedNas = append(c.Definition.SharedNas, name)
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//addComputeNode adds a compute node to the cluster
+func (c *Cluster) addComputeNode(public bool, req *pb.VMDefinition) (*pb.VM, error) {
+	c.Definition.LastNodeIndex++
+	i := c.Definition.LastNodeIndex
+	req.Public = public
+	req.Network = c.Definition.Cluster.NetworkID
+	req.Name = c.Definition.Cluster.Name + "-slurmnode-" + strconv.Itoa(i)
+	nodeType := NodeType.PrivateAgent
+	if public {
+		nodeType = NodeType.PublicAgent
+	}
+	tpl := c.Definition.Cluster.Spec.Templates.ForNodeType(nodeType).Or(defaultTemplates.ForNodeType(nodeType))
+	tpl.Complete(req)
+	partition, err := partitionName(req)
+	if err != nil {
+		return nil, err
+	}
+	nodeVM, err := utils.AdoptOrCreateVM(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Compute node %d: %s", i, err.Error())
+	}
+
+	// Installs slurm on the compute node and mounts the shared storage
+	err = c.configureComputeNode(nodeVM)
+	if err != nil {
+		c.rollbackSharedNas(nodeVM.ID)
+		utils.DeleteVM(nodeVM.ID)
+		return nil, fmt.Errorf("failed to install Slurm on Compute Node: %s", err.Error())
+	}
+
+	// Registers the new node in the cluster struct
+	c.Definition.Nodes = append(c.Definition.Nodes, ComputeNode{
+		ID:        nodeVM.ID,
+		Name:      nodeVM.Name,
+		IP:        nodeVM.PrivateIP,
+		CPU:       nodeVM.CPU,
+		RAM:       nodeVM.RAM,
+		Public:    public,
+		Partition: partition,
+	})
+
+	// Update cluster definition in Object Storage
+	err = c.WriteDefinition()
+	if err != nil {
+		// Removes the node we just added to the cluster struct
+		c.Definition.Nodes = c.Definition.Nodes[:len(c.Definition.Nodes)-1]
+		c.rollbackSharedNas(nodeVM.ID)
+		utils.DeleteVM(nodeVM.ID)
+		return nil, fmt.Errorf("failed to update Cluster definition: %s", err.Error())
+	}
+
+	// Registers the new node in slurm.conf of all the nodes
+	err = c.reconfigure()
+	if err != nil {
+		return nil, err
+	}
+	return nodeVM, nil
+}
+
+//partitionName returns the name of the partition of the nodes created with req, named after the template selected for them
+func partitionName(req *pb.VMDefinition) (string, error) {
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return "", err
+	}
+	tpls, err := svc.SelectTemplatesBySize(providerapi.SizingRequirements{
+		MinCores:    int(req.CPUNumber),
+		MinRAMSize:  req.RAM,
+		MinDiskSize: int(req.Disk),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to select template of Compute node: %s", err.Error())
+	}
+	if len(tpls) == 0 {
+		return "", fmt.Errorf("no template with %d cores, %.1f GB of RAM and %d GB of disk", req.CPUNumber, req.RAM, req.Disk)
+	}
+	return strings.Trim(invalidPartitionChars.ReplaceAllString(tpls[0].Name, "_"), "_"), nil
+}
+
+//configureComputeNode installs slurm on targetVM with the munge key of the controller, then mounts the shared storage
+func (c *Cluster) configureComputeNode(targetVM *pb.VM) error {
+	retcode, output, err := scripts.Execute(c.Definition.ControllerID, "slurm_get_munge_key.sh", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("failed to read munge key, error code %d:\n%s", retcode, *output)
+	}
+	lines := strings.Split(strings.TrimSpace(*output), "\n")
+
+	retcode, output, err = scripts.Execute(targetVM.ID, "slurm_install_compute_node.sh", map[string]interface{}{
+		"NodeName": targetVM.Name,
+		"NodeIP":   targetVM.PrivateIP,
+		"MungeKey": lines[len(lines)-1],
+	})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted Compute node installation failed with error code %d:\n%s", retcode, *output)
+	}
+
+	for i, name := range c.Definition.SharedNas {
+		err = utils.MountNas(name, targetVM.Name, sharedPaths[i].Path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//unmountSharedNas unmounts the shared storage mounted on the VM identified by vmID, which is started if needed
+//brokerd keeps a NAS registered as mounted until it's unmounted from the running VM, and refuses to delete it meanwhile
+func (c *Cluster) unmountSharedNas(vmID string) error {
+	started := false
+	for _, name := range c.Definition.SharedNas {
+		mounted, err := utils.IsNasMounted(name, vmID)
+		if err != nil {
+			return err
+		}
+		if !mounted {
+			continue
+		}
+		if !started {
+			svc, err := utils.GetProviderService()
+			if err != nil {
+				return err
+			}
+			err = utils.SetNodesState(svc, []string{vmID}, VMState.STARTED, utils.TimeoutVMState)
+			if err != nil {
+				return err
+			}
+			started = true
+		}
+		err = utils.UMountNas(name, vmID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//rollbackSharedNas unmounts the shared storage from the VM identified by vmID before its deletion, failures are only logged
+func (c *Cluster) rollbackSharedNas(vmID string) {
+	err := c.unmountSharedNas(vmID)
+	if err != nil {
+		log.Printf("%s", err.Error())
+	}
+}
+
+//slurmPartition is a partition of slurm.conf
+type slurmPartition struct {
+	Name    string
+	Nodes   string
+	Default bool
+}
+
+//realizeSlurmConf returns slurm.conf describing the controller, the compute nodes and their partitions
+//Each template of the compute nodes gives a partition, the partition 'all' containing all the nodes is the default one
+func (c *Cluster) realizeSlurmConf() (string, error) {
+	type slurmNode struct {
+		Name       string
+		IP         string
+		CPU        int32
+		RealMemory int
+	}
+	var nodes []slurmNode
+	var all []string
+	byPartition := map[string][]string{}
+	for _, n := range c.Definition.Nodes {
+		// Leaves some memory to the system, slurm refuses a node with less memory than RealMemory
+		nodes = append(nodes, slurmNode{
+			Name:       n.Name,
+			IP:         n.IP,
+			CPU:        n.CPU,
+			RealMemory: int(n.RAM * 1024 * 0.9),
+		})
+		all = append(all, n.Name)
+		byPartition[n.Partition] = append(byPartition[n.Partition], n.Name)
+	}
+	var partitions []slurmPartition
+	if len(all) > 0 {
+		partitions = append(partitions, slurmPartition{Name: defaultPartition, Nodes: strings.Join(all, ","), Default: true})
+	}
+	var names []string
+	for name := range byPartition {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		partitions = append(partitions, slurmPartition{Name: name, Nodes: strings.Join(byPartition[name], ",")})
+	}
+
+	b, err := scripts.Box()
+	if err != nil {
+		return "", err
+	}
+	return utils.RealizeScript(b, "slurm.conf", map[string]interface{}{
+		"ClusterName":    c.Definition.Cluster.Name,
+		"ControllerName": c.Definition.ControllerName,
+		"ControllerIP":   c.Definition.ControllerIP,
+		"Nodes":          nodes,
+		"Partitions":     partitions,
+	})
+}
+
+//reconfigure writes slurm.conf on the controller then on the started compute nodes, restarting their slurm daemon
+func (c *Cluster) reconfigure() error {
+	slurmConf, err := c.realizeSlurmConf()
+	if err != nil {
+		return err
+	}
+	retcode, output, err := scripts.Execute(c.Definition.ControllerID, "slurm_configure.sh", map[string]interface{}{
+		"SlurmConf": slurmConf,
+		"Daemon":    "slurmctld",
+	})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted Controller configuration failed with error code %d:\n%s", retcode, *output)
+	}
+
+	for _, n := range c.Definition.Nodes {
+		vm, err := utils.GetVM(n.ID)
+		if err != nil {
+			return err
+		}
+		if vm.State != pb.VMState_STARTED {
+			continue
+		}
+		retcode, output, err := scripts.Execute(n.ID, "slurm_configure.sh", map[string]interface{}{
+			"SlurmConf": slurmConf,
+			"Daemon":    "slurmd",
+		})
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted configuration of Compute node '%s' failed with error code %d:\n%s", n.Name, retcode, *output)
+		}
+	}
+	return nil
+}
+
+//DeleteNode drains the compute node referenced by ref (name or ID) in slurm, then deletes its VM
+//and removes it from slurm.conf of the other nodes
+func (c *Cluster) DeleteNode(ref string) error {
+	vm, err := utils.GetVM(ref)
+	if err != nil {
+		return err
+	}
+	index := c.indexOfNode(vm.ID)
+	if index < 0 {
+		return fmt.Errorf("'%s' is not a compute node of cluster '%s'", ref, c.Definition.Cluster.Name)
+	}
+
+	// The node is drained from the controller, if the controller is running
+	controller, err := utils.GetVM(c.Definition.ControllerID)
+	if err != nil {
+		return err
+	}
+	if controller.State == pb.VMState_STARTED {
+		log.Printf("Draining Slurm Compute node '%s'", vm.Name)
+		retcode, output, err := scripts.Execute(controller.ID, "slurm_drain_node.sh", map[string]interface{}{
+			"NodeName": vm.Name,
+		})
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted Compute node draining failed with error code %d:\n%s", retcode, *output)
+		}
+	}
+	err = c.deleteNode(index)
+	if err != nil {
+		return err
+	}
+	if controller.State != pb.VMState_STARTED {
+		return nil
+	}
+	return c.reconfigure()
+}
+
+//deleteNode unmounts the shared storage from the compute node at index, whatever its state, then deletes its VM and removes
+//it from the definition
+func (c *Cluster) deleteNode(index int) error {
+	n := c.Definition.Nodes[index]
+	_, err := utils.GetVM(n.ID)
+	if err == nil {
+		err = c.unmountSharedNas(n.ID)
+		if err != nil {
+			return err
+		}
+	}
+	err = utils.DeleteVMIfExists(n.ID)
+	if err != nil {
+		return err
+	}
+	c.Definition.Nodes = append(c.Definition.Nodes[:index], c.Definition.Nodes[index+1:]...)
+	return c.WriteDefinition()
+}
+
+//indexOfNode returns the index of the compute node identified by id, -1 if it's not a compute node of the cluster
+func (c *Cluster) indexOfNode(id string) int {
+	for i, n := range c.Definition.Nodes {
+		if n.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+//ListMasters lists the controller of the cluster
+func (c *Cluster) ListMasters() ([]*pb.VM, error) {
+	return utils.GetVMs([]string{c.Definition.ControllerID})
+}
+
+//ListNodes lists the compute nodes in the cluster
+func (c *Cluster) ListNodes() ([]*pb.VM, error) {
+	return utils.GetVMs(c.nodeIDs())
+}
+
+//CountPrivateNodes returns the number of private compute nodes in the cluster
+func (c *Cluster) CountPrivateNodes() int {
+	count := 0
+	for _, n := range c.Definition.Nodes {
+		if !n.Public {
+			count++
+		}
+	}
+	return count
+}
+
+//GetNode returns the node referenced by ref (name or ID), which can be the controller or a compute node
+func (c *Cluster) GetNode(ref string) (*pb.VM, error) {
+	vm, err := utils.GetVM(ref)
+	if err != nil {
+		return nil, err
+	}
+	if vm.ID == c.Definition.ControllerID || c.indexOfNode(vm.ID) >= 0 {
+		return vm, nil
+	}
+	return nil, fmt.Errorf("'%s' is not a node of cluster '%s'", ref, c.Definition.Cluster.Name)
+}
+
+//WriteDefinition writes cluster definition in Object Storage
+func (c *Cluster) WriteDefinition() error {
+	return utils.WriteDefinition(c.Definition.Cluster.Name, c.Definition)
+}
+
+//ReadDefinition reads definition of cluster named 'name' from Metadata
+// Returns (true, nil) if found and loaded, (false, nil) if not found, and (false, error) in case of error
+func (c *Cluster) ReadDefinition() (bool, error) {
+	var d Definition
+	ok, err := utils.ReadDefinition(c.Definition.Cluster.Name, &d)
+	if ok {
+		c.Definition = &d
+	}
+	return ok, err
+}
+
+//RemoveDefinition removes definition of cluster from Object Storage
+func (c *Cluster) RemoveDefinition() error {
+	running := len(c.Definition.Nodes) > 0 ||
+		len(c.Definition.SharedNas) > 0 ||
+		c.Definition.ControllerID != ""
+	return utils.RemoveDefinition(&c.Definition.Cluster, running)
+}
+
+//Delete destroys the compute nodes, the shared storage, the controller, the key pair and the network of the cluster
+//The definition is updated after each deletion, so a failed deletion can be retried
+func (c *Cluster) Delete() error {
+	for len(c.Definition.Nodes) > 0 {
+		err := c.deleteNode(len(c.Definition.Nodes) - 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The exports disappear with the controller, a NAS still registered as mounted is only reported
+	for len(c.Definition.SharedNas) > 0 {
+		last := len(c.Definition.SharedNas) - 1
+		err := utils.DeleteNas(c.Definition.SharedNas[last])
+		if err != nil && !strings.Contains(err.Error(), "does not exists") {
+			log.Printf("failed to delete NAS '%s': %s", c.Definition.SharedNas[last], err.Error())
+		}
+		c.Definition.SharedNas = c.Definition.SharedNas[:last]
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Definition.ControllerID != "" {
+		err := utils.DeleteVMIfExists(c.Definition.ControllerID)
+		if err != nil {
+			return err
+		}
+		c.Definition.ControllerID = ""
+		c.Definition.ControllerName = ""
+		c.Definition.ControllerIP = ""
+		c.Definition.ControllerInstalled = false
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
+	}
+
+	return utils.DeleteKeyPairAndNetwork(&c.Definition.Cluster, c.WriteDefinition)
+}
@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Drains the compute node {{.NodeName}} before its removal
+# No job is scheduled on the node anymore, the running ones are given 5 minutes to end
+# This script must be executed on controller node.
+
+# Nothing to drain if the node is not known by the controller
+scontrol show node {{.NodeName}} >/dev/null 2>&1 || exit 0
+
+scontrol update NodeName={{.NodeName}} State=DRAIN Reason="removed from cluster" || exit $?
+for i in $(seq 60); do
+    [ -z "$(squeue -h -w {{.NodeName}})" ] && exit 0
+    sleep 5
+done
+echo "jobs still running on {{.NodeName}}, removing it anyway"
+exit 0
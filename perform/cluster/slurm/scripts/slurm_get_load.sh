@@ -0,0 +1,28 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Prints the load of the cluster for the autoscaler: a line 'PENDING <count>' with the number of
+# jobs waiting for resources, then a line 'IDLE <name>' per compute node running no job
+# This script must be executed on controller node.
+
+PENDING=$(squeue -h -t PD -o %r) || exit $?
+echo "PENDING $(echo "$PENDING" | grep -c -E '^(Resources|Priority)$')"
+
+IDLE=$(sinfo -h -N -t idle -o %N) || exit $?
+for NODE in $(echo "$IDLE" | sort -u); do
+    echo "IDLE $NODE"
+done
+exit 0
@@ -0,0 +1,33 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Installs and configure a Slurm compute node, with the munge key of the cluster
+# This script must be executed on compute node.
+
+# Installs and configures everything needed on any node
+{{.IncludeInstallCommons}}
+
+# slurm identifies the nodes by their hostname
+hostnamectl set-hostname {{.NodeName}}
+grep -q " {{.NodeName}}$" /etc/hosts || echo "{{.NodeIP}} {{.NodeName}}" >>/etc/hosts
+
+echo "{{.MungeKey}}" | base64 -d >/etc/munge/munge.key
+chown munge:munge /etc/munge/munge.key && chmod 0400 /etc/munge/munge.key
+systemctl enable munge && systemctl restart munge || exit $?
+
+# slurmd is started once slurm.conf is written
+systemctl enable slurmd
+exit $?
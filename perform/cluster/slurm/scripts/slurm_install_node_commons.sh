@@ -0,0 +1,31 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+#### Installs and configure common tools for any kind of nodes ####
+
+export LANG=C
+export DEBIAN_FRONTEND=noninteractive
+
+(
+
+    # Installs munge, authenticating the slurm daemons, and slurm
+    apt-get update
+    apt-get install -y munge slurm-wlm
+    mkdir -p /var/lib/slurm-llnl/slurmctld /var/lib/slurm-llnl/slurmd /var/log/slurm-llnl /var/run/slurm-llnl
+    chown -R slurm:slurm /var/lib/slurm-llnl /var/log/slurm-llnl /var/run/slurm-llnl
+
+) >/dev/null
+####
@@ -0,0 +1,700 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package swarm
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	rice "github.com/GeertJohan/go.rice"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/Complexity"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+	"github.com/CS-SI/SafeScale/perform/utils"
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api/VMState"
+	"github.com/CS-SI/SafeScale/system"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+//go:generate rice embed-go
+
+const (
+	//defaultStateCollectInterval is the time the collected state of a new cluster is kept before being collected again
+	defaultStateCollectInterval = 5 * time.Minute
+
+	//managerHealthCommand succeeds on a manager reachable by the other managers, with a leader elected
+	managerHealthCommand = "docker node ls -q >/dev/null"
+	//workerHealthCommand succeeds on a worker which joined the swarm
+	workerHealthCommand = "docker info --format '{{.Swarm.LocalNodeState}}' | grep -q active"
+
+	//timeoutServices is the time the swarm is given to be healthy once its VMs are started
+	timeoutServices = 10 * time.Minute
+)
+
+var (
+	//scripts gives the script templates of the package
+	scripts = utils.NewScriptBox(func() (*rice.Box, error) {
+		return rice.FindBox("../swarm/scripts")
+	}, "", nil)
+
+	//dockerScripts gives the scripts deploying docker, shared with deploy
+	dockerScripts = utils.NewScriptBox(func() (*rice.Box, error) {
+		return rice.FindBox("../../../deploy/docker/scripts")
+	}, "", nil)
+
+	//defaultTemplates size the nodes whose template is not set in the definition of the cluster
+	defaultTemplates = clusterapi.Templates{
+		Master:      clusterapi.NodeTemplate{CPU: 2, RAM: 4.0, Disk: 60, OS: "Ubuntu 16.04"},
+		PrivateNode: clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "Ubuntu 16.04"},
+		PublicNode:  clusterapi.NodeTemplate{CPU: 4, RAM: 16.0, Disk: 100, OS: "Ubuntu 16.04"},
+	}
+)
+
+//Definition defines the values we want to keep in Object Storage
+type Definition struct {
+	// common cluster data
+	clusterapi.Cluster
+
+	//ManagerIDs is a slice of VMIDs of the managers, the first one initialized the swarm
+	ManagerIDs []string
+
+	//ManagerIPs contains a list of IP of the managers
+	ManagerIPs []string
+
+	//PublicNodeIDs is a slice of VMIDs of the workers with a public IP
+	PublicNodeIDs []string
+
+	//PublicNodeIPs contains a list of the IPs of the public workers in the network of the cluster
+	PublicNodeIPs []string
+
+	//PrivateNodeIDs is a slice of VMIDs of the workers without public IP
+	PrivateNodeIDs []string
+
+	//PrivateNodeIPs contains a list of IP of the private workers
+	PrivateNodeIPs []string
+
+	//LastNodeIndex is the index in the name of the last worker created, so that each worker gets a new name
+	LastNodeIndex int
+
+	//Configured is true once the swarm is initialized on the managers
+	Configured bool
+
+	//StateCollectInterval is the time the collected state is kept before being collected again
+	StateCollectInterval time.Duration
+}
+
+//Cluster is the object describing a cluster created by ClusterManagerAPI.CreateCluster
+type Cluster struct {
+	//Definition contains data defining the cluster
+	*Definition
+}
+
+//NewCluster creates the necessary infrastructure of cluster
+//If the creation fails, the infrastructure already created is deleted unless req.KeepOnFailure is set
+func NewCluster(req clusterapi.Request) (clusterapi.ClusterAPI, error) {
+	// Saving cluster parameters, with status 'Creating', so the infrastructure can be deleted if anything fails
+	instance := Cluster{
+		Definition: &Definition{
+			Cluster: clusterapi.Cluster{
+				Name:          req.Name,
+				CIDR:          req.CIDR,
+				Flavor:        req.Flavor,
+				State:         ClusterState.Creating,
+				Complexity:    req.Complexity,
+				Tenant:        req.Tenant,
+				NetworkID:     req.NetworkID,
+				Spec:          req.Spec,
+				Operation:     req.Operation,
+				KeepOnFailure: req.KeepOnFailure,
+			},
+			StateCollectInterval: defaultStateCollectInterval,
+		},
+	}
+	err := instance.WriteDefinition()
+	if err != nil {
+		err = fmt.Errorf("failed to create cluster '%s': %s", req.Name, err.Error())
+		goto cleanup
+	}
+
+	err = instance.create()
+	if err != nil {
+		goto cleanup
+	}
+
+	log.Printf("Cluster '%s' created and initialized successfully", req.Name)
+	return &instance, nil
+
+cleanup:
+	utils.AbortCreation(&instance, req.KeepOnFailure)
+	return nil, err
+}
+
+//ResumeCreation creates what the interrupted creation of the cluster didn't create, then configures it
+func (c *Cluster) ResumeCreation() error {
+	return c.create()
+}
+
+//create creates the servers missing from the definition of the cluster, then configures it if it isn't already
+//Each step is saved in the definition, so an interrupted creation resumes from the last step done
+func (c *Cluster) create() error {
+	var managerCount int
+	var err error
+
+	// Create a KeyPair for the cluster
+	if c.Definition.Cluster.Keypair == nil {
+		c.Definition.Cluster.Keypair, err = utils.CreateKeyPair(c.Definition.Cluster.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The swarm tolerates the failure of a minority of its managers
+	switch c.Definition.Cluster.Complexity {
+	case Complexity.Dev:
+		managerCount = 1
+	case Complexity.Normal:
+		managerCount = 3
+	case Complexity.Volume:
+		managerCount = 5
+	}
+
+	if len(c.Definition.ManagerIDs) < managerCount {
+		log.Printf("Creating Swarm Manager servers (%d)", managerCount-len(c.Definition.ManagerIDs))
+	}
+	for i := len(c.Definition.ManagerIDs) + 1; i <= managerCount; i++ {
+		_, err = c.addManager()
+		if err != nil {
+			return fmt.Errorf("failed to add Swarm Manager %d: %s", i, err.Error())
+		}
+	}
+
+	if !c.Definition.Configured {
+		log.Printf("Configuring cluster")
+		err = c.configure()
+		if err != nil {
+			return fmt.Errorf("failed to configure Swarm cluster: %s", err.Error())
+		}
+		c.Definition.Configured = true
+		err = c.WriteDefinition()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Cluster created and configured successfully, saving again to Object Storage
+	c.Definition.Cluster.State = ClusterState.Created
+	return c.WriteDefinition()
+}
+
+//GetName returns the name of the cluster
+func (c *Cluster) GetName() string {
+	return c.Definition.Cluster.Name
+}
+
+//Start starts the managers, then the workers once a quorum of managers is healthy
+//The cluster is Nominal when Start returns without error
+func (c *Cluster) Start() error {
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Nominal:
+		return fmt.Errorf("Can't start an already started cluster")
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't start a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting Swarm Manager servers")
+	err = utils.SetNodesState(svc, c.Definition.ManagerIDs, VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	err = c.waitManagersQuorum(svc)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting Swarm Worker nodes")
+	err = utils.SetNodesState(svc, c.workerIDs(), VMState.STARTED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	return utils.WaitNominal(c.ForceGetState, timeoutServices)
+}
+
+//Stop stops the workers, then the managers
+func (c *Cluster) Stop() error {
+	state, err := c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	switch state {
+	case ClusterState.Stopped:
+		return nil
+	case ClusterState.Creating, ClusterState.Removed:
+		return fmt.Errorf("Can't stop a cluster in state '%s'", state.String())
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping Swarm Worker nodes")
+	err = utils.SetNodesState(svc, c.workerIDs(), VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stopping Swarm Manager servers")
+	err = utils.SetNodesState(svc, c.Definition.ManagerIDs, VMState.STOPPED, utils.TimeoutVMState)
+	if err != nil {
+		return err
+	}
+
+	state, err = c.ForceGetState()
+	if err != nil {
+		return err
+	}
+	if state != ClusterState.Stopped {
+		return fmt.Errorf("cluster still in state '%s' once its nodes are stopped", state.String())
+	}
+	return nil
+}
+
+//workerIDs returns the IDs of the workers, private ones first
+func (c *Cluster) workerIDs() []string {
+	return append(append([]string{}, c.Definition.PrivateNodeIDs...), c.Definition.PublicNodeIDs...)
+}
+
+//waitManagersQuorum waits for a quorum of managers to be healthy, so the workers can rejoin the swarm
+func (c *Cluster) waitManagersQuorum(svc *providers.Service) error {
+	deadline := time.Now().Add(timeoutServices)
+	for {
+		healthy := 0
+		for _, id := range c.Definition.ManagerIDs {
+			if utils.CheckNodeCommand(svc, id, NodeType.Master, managerHealthCommand).State == NodeState.Started {
+				healthy++
+			}
+		}
+		if healthy > len(c.Definition.ManagerIDs)/2 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("only %d of %d managers healthy after %v", healthy, len(c.Definition.ManagerIDs), timeoutServices)
+		}
+		time.Sleep(utils.HealthCheckDelay)
+	}
+}
+
+//GetState returns the last collected state of the cluster, collected again if older than StateCollectInterval
+func (c *Cluster) GetState() (ClusterState.Enum, error) {
+	return utils.GetState(&c.Definition.Cluster, c.Definition.StateCollectInterval, c.ForceGetState)
+}
+
+//ForceGetState returns the current state of the cluster
+// This method will trigger a effective state collection at each call
+func (c *Cluster) ForceGetState() (ClusterState.Enum, error) {
+	state := c.Definition.Cluster.State
+	if state == ClusterState.Creating || state == ClusterState.Removed {
+		return state, nil
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return ClusterState.Error, err
+	}
+	var report []clusterapi.NodeHealth
+	for _, id := range c.Definition.ManagerIDs {
+		report = append(report, utils.CheckNodeCommand(svc, id, NodeType.Master, managerHealthCommand))
+	}
+	for _, id := range c.Definition.PrivateNodeIDs {
+		report = append(report, utils.CheckNodeCommand(svc, id, NodeType.PrivateAgent, workerHealthCommand))
+	}
+	for _, id := range c.Definition.PublicNodeIDs {
+		report = append(report, utils.CheckNodeCommand(svc, id, NodeType.PublicAgent, workerHealthCommand))
+	}
+
+	c.Definition.Cluster.State = clusterapi.StateFromHealth(report)
+	c.Definition.Cluster.NodesHealth = report
+	c.Definition.Cluster.LastStateCollection = time.Now()
+	err = c.WriteDefinition()
+	if err != nil {
+		log.Printf("failed to save state of cluster '%s': %s", c.Definition.Cluster.Name, err.Error())
+	}
+	return c.Definition.Cluster.State, nil
+}
+
+//GetLoad returns the number of pending tasks of the replicated services, the idle nodes being the private workers running none of their tasks
+func (c *Cluster) GetLoad() (*clusterapi.Load, error) {
+	retcode, output, err := c.executeScript(c.Definition.ManagerIDs[0], "swarm_get_load.sh", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if retcode != 0 {
+		return nil, fmt.Errorf("scripted load collection failed with error code %d:\n%s", retcode, *output)
+	}
+	addresses := map[string]string{}
+	for i, ip := range c.Definition.PrivateNodeIPs {
+		addresses[ip] = c.Definition.PrivateNodeIDs[i]
+	}
+	return utils.ParseLoad(*output, addresses)
+}
+
+//AddNode adds a worker node, public if nodeType is PublicAgent
+//Managers can't be added, their number is given by the complexity of the cluster
+func (c *Cluster) AddNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*pb.VM, error) {
+	switch nodeType {
+	case NodeType.PublicAgent:
+		fallthrough
+	case NodeType.PrivateAgent:
+		if c.Definition.Cluster.State == ClusterState.Creating {
+			return nil, fmt.Errorf("The Swarm flavor of Cluster needs to be in state 'Created' at least to allow node addition.")
+		}
+		return c.addWorkerNode(nodeType, req)
+	case NodeType.Master:
+		return nil, fmt.Errorf("the managers of a Swarm cluster are sized by its complexity, managers can't be added")
+	}
+	return nil, fmt.Errorf("unmanaged node type '%s (%d)'", nodeType.String(), nodeType)
+}
+
+//addManager adds a manager node
+func (c *Cluster) addManager() (*pb.VM, error) {
+	i := len(c.Definition.ManagerIDs) + 1
+	name := c.Definition.Cluster.Name + "-swarmmanager-" + strconv.Itoa(i)
+	tpl := c.Definition.Cluster.Spec.Templates.Master.Or(defaultTemplates.Master)
+
+	managerVM, err := utils.AdoptOrCreateVM(&pb.VMDefinition{
+		Name:      name,
+		CPUNumber: tpl.CPU,
+		RAM:       tpl.RAM,
+		Disk:      tpl.Disk,
+		ImageID:   tpl.OS,
+		Network:   c.Definition.Cluster.NetworkID,
+		Public:    false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Manager server %d: %s", i, err.Error())
+	}
+
+	// Registers the new Manager in the cluster struct and updates the cluster definition in Object Storage
+	err = utils.RegisterNode(managerVM.ID, managerVM.PrivateIP, &c.Definition.ManagerIDs, &c.Definition.ManagerIPs, c.WriteDefinition)
+	if err != nil {
+		return nil, err
+	}
+
+	return managerVM, nil
+}
+
+//addWorkerNode adds a worker node to the cluster
+func (c *Cluster) addWorkerNode(nodeType NodeType.Enum, req *pb.VMDefinition) (*pb.VM, error) {
+	var publicIP bool
+	coreName := "node"
+	if nodeType == NodeType.PublicAgent {
+		publicIP = true
+		coreName = "pub" + coreName
+	} else {
+		publicIP = false
+		coreName = "priv" + coreName
+	}
+
+	c.Definition.LastNodeIndex++
+	i := c.Definition.LastNodeIndex
+	req.Public = publicIP
+	req.Network = c.Definition.Cluster.NetworkID
+	req.Name = c.Definition.Cluster.Name + "-swarm" + coreName + "-" + strconv.Itoa(i)
+	tpl := c.Definition.Cluster.Spec.Templates.ForNodeType(nodeType).Or(defaultTemplates.ForNodeType(nodeType))
+	tpl.Complete(req)
+	workerVM, err := utils.AdoptOrCreateVM(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Worker node %d: %s", i, err.Error())
+	}
+
+	// Installs docker on worker node and joins the swarm
+	err = c.configureWorker(workerVM, nodeType)
+	if err != nil {
+		utils.DeleteVM(workerVM.ID)
+		return nil, fmt.Errorf("failed to install Swarm on Worker Node: %s", err.Error())
+	}
+
+	// Registers the new Worker in the cluster struct and updates the cluster definition in Object Storage
+	ids, ips := &c.Definition.PrivateNodeIDs, &c.Definition.PrivateNodeIPs
+	if nodeType == NodeType.PublicAgent {
+		ids, ips = &c.Definition.PublicNodeIDs, &c.Definition.PublicNodeIPs
+	}
+	err = utils.RegisterNode(workerVM.ID, workerVM.PrivateIP, ids, ips, c.WriteDefinition)
+	if err != nil {
+		return nil, err
+	}
+
+	return workerVM, nil
+}
+
+//configure installs docker on the managers, initializes the swarm on the first one, then joins the other ones to it
+func (c *Cluster) configure() error {
+	for i, id := range c.Definition.ManagerIDs {
+		log.Printf("Installing docker on Manager server %d", i+1)
+		err := c.installDocker(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Initializing swarm on first Manager server")
+	retcode, output, err := c.executeScript(c.Definition.ManagerIDs[0], "swarm_install_manager_node.sh", map[string]interface{}{
+		"FirstManager": "yes",
+		"NodeIP":       c.Definition.ManagerIPs[0],
+	})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted Manager initialization failed with error code %d:\n%s", retcode, *output)
+	}
+	if len(c.Definition.ManagerIDs) == 1 {
+		return nil
+	}
+
+	log.Printf("Joining Manager servers to the swarm")
+	token, err := c.getJoinToken("manager")
+	if err != nil {
+		return err
+	}
+	for i, m := range c.Definition.ManagerIDs[1:] {
+		retcode, output, err := c.executeScript(m, "swarm_install_manager_node.sh", map[string]interface{}{
+			"FirstManager": "no",
+			"NodeIP":       c.Definition.ManagerIPs[i+1],
+			"ManagerIP":    c.Definition.ManagerIPs[0],
+			"Token":        token,
+		})
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted Manager configuration failed with error code %d:\n%s", retcode, *output)
+		}
+	}
+	return nil
+}
+
+//getJoinToken returns the token joining a node to the swarm with role, manager or worker
+func (c *Cluster) getJoinToken(role string) (string, error) {
+	retcode, output, err := c.executeScript(c.Definition.ManagerIDs[0], "swarm_join_token.sh", map[string]interface{}{
+		"Role": role,
+	})
+	if err != nil {
+		return "", err
+	}
+	if retcode != 0 {
+		return "", fmt.Errorf("failed to get %s join token, error code %d:\n%s", role, retcode, *output)
+	}
+	lines := strings.Split(strings.TrimSpace(*output), "\n")
+	return lines[len(lines)-1], nil
+}
+
+//configureWorker installs docker on targetVM and joins it to the swarm, labelled as public if nodeType is PublicAgent
+func (c *Cluster) configureWorker(targetVM *pb.VM, nodeType NodeType.Enum) error {
+	err := c.installDocker(targetVM.ID)
+	if err != nil {
+		return err
+	}
+	token, err := c.getJoinToken("worker")
+	if err != nil {
+		return err
+	}
+	retcode, output, err := c.executeScript(targetVM.ID, "swarm_install_worker_node.sh", map[string]interface{}{
+		"NodeIP":    targetVM.PrivateIP,
+		"ManagerIP": c.Definition.ManagerIPs[0],
+		"Token":     token,
+	})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted Worker configuration failed with error code %d:\n%s", retcode, *output)
+	}
+	if nodeType != NodeType.PublicAgent {
+		return nil
+	}
+
+	retcode, output, err = c.executeScript(c.Definition.ManagerIDs[0], "swarm_label_public_node.sh", map[string]interface{}{
+		"NodeIP": targetVM.PrivateIP,
+	})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted labelling of public Worker failed with error code %d:\n%s", retcode, *output)
+	}
+	return nil
+}
+
+//installDocker installs docker on the VM identified by id, with the script used by deploy
+func (c *Cluster) installDocker(id string) error {
+	retcode, output, err := c.executeBoxScript(id, dockerScripts, "install_docker.sh", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if retcode != 0 {
+		return fmt.Errorf("scripted docker installation failed with error code %d:\n%s", retcode, *output)
+	}
+	return nil
+}
+
+//executeScript executes the script template of the package with the parameters on targetVM
+func (c *Cluster) executeScript(targetID string, script string, data map[string]interface{}) (int, *string, error) {
+	return c.executeBoxScript(targetID, scripts, script, data)
+}
+
+//executeBoxScript executes the script template of sb with the parameters and the common tools on targetVM
+func (c *Cluster) executeBoxScript(targetID string, sb *utils.ScriptBox, script string, data map[string]interface{}) (int, *string, error) {
+	commonTools, err := system.RealizeCommonTools()
+	if err != nil {
+		return 0, nil, err
+	}
+	data["CommonTools"] = commonTools
+	return sb.Execute(targetID, script, data)
+}
+
+//DeleteNode drains the worker node referenced by ref (name or ID) through the swarm, then deletes its VM
+//Managers can't be deleted, their number is given by the complexity of the cluster
+func (c *Cluster) DeleteNode(ref string) error {
+	vm, err := utils.GetVM(ref)
+	if err != nil {
+		return err
+	}
+	ids, ips := &c.Definition.PrivateNodeIDs, &c.Definition.PrivateNodeIPs
+	index := utils.IndexOf(*ids, vm.ID)
+	if index < 0 {
+		ids, ips = &c.Definition.PublicNodeIDs, &c.Definition.PublicNodeIPs
+		index = utils.IndexOf(*ids, vm.ID)
+	}
+	if index < 0 {
+		return fmt.Errorf("'%s' is not a worker node of cluster '%s'", ref, c.Definition.Cluster.Name)
+	}
+
+	// The node is drained from the first manager, if the swarm is running
+	manager, err := utils.GetVM(c.Definition.ManagerIDs[0])
+	if err != nil {
+		return err
+	}
+	if manager.State == pb.VMState_STARTED {
+		log.Printf("Draining Swarm Worker node '%s'", vm.Name)
+		retcode, output, err := c.executeScript(manager.ID, "swarm_drain_node.sh", map[string]interface{}{
+			"NodeIP": vm.PrivateIP,
+		})
+		if err != nil {
+			return err
+		}
+		if retcode != 0 {
+			return fmt.Errorf("scripted Worker draining failed with error code %d:\n%s", retcode, *output)
+		}
+	}
+	err = utils.DeleteVMIfExists(vm.ID)
+	if err != nil {
+		return err
+	}
+
+	*ids = append((*ids)[:index], (*ids)[index+1:]...)
+	if len(*ips) > index {
+		*ips = append((*ips)[:index], (*ips)[index+1:]...)
+	}
+	return c.WriteDefinition()
+}
+
+//ListMasters lists the manager nodes in the cluster
+func (c *Cluster) ListMasters() ([]*pb.VM, error) {
+	return utils.GetVMs(c.Definition.ManagerIDs)
+}
+
+//ListNodes lists the worker nodes in the cluster, private ones first
+func (c *Cluster) ListNodes() ([]*pb.VM, error) {
+	return utils.GetVMs(c.workerIDs())
+}
+
+//CountPrivateNodes returns the number of private worker nodes in the cluster
+func (c *Cluster) CountPrivateNodes() int {
+	return len(c.Definition.PrivateNodeIDs)
+}
+
+//GetNode returns the node referenced by ref (name or ID), which can be a manager or a worker
+func (c *Cluster) GetNode(ref string) (*pb.VM, error) {
+	vm, err := utils.GetVM(ref)
+	if err != nil {
+		return nil, err
+	}
+	if utils.IndexOf(c.Definition.ManagerIDs, vm.ID) >= 0 ||
+		utils.IndexOf(c.Definition.PrivateNodeIDs, vm.ID) >= 0 ||
+		utils.IndexOf(c.Definition.PublicNodeIDs, vm.ID) >= 0 {
+		return vm, nil
+	}
+	return nil, fmt.Errorf("'%s' is not a node of cluster '%s'", ref, c.Definition.Cluster.Name)
+}
+
+//WriteDefinition writes cluster definition in Object Storage
+func (c *Cluster) WriteDefinition() error {
+	return utils.WriteDefinition(c.Definition.Cluster.Name, c.Definition)
+}
+
+//ReadDefinition reads definition of cluster named 'name' from Metadata
+// Returns (true, nil) if found and loaded, (false, nil) if not found, and (false, error) in case of error
+func (c *Cluster) ReadDefinition() (bool, error) {
+	var d Definition
+	ok, err := utils.ReadDefinition(c.Definition.Cluster.Name, &d)
+	if ok {
+		c.Definition = &d
+	}
+	return ok, err
+}
+
+//RemoveDefinition removes definition of cluster from Object Storage
+func (c *Cluster) RemoveDefinition() error {
+	running := len(c.Definition.ManagerIDs) > 0 ||
+		len(c.Definition.PublicNodeIDs) > 0 ||
+		len(c.Definition.PrivateNodeIDs) > 0
+	return utils.RemoveDefinition(&c.Definition.Cluster, running)
+}
+
+//Delete destroys the workers, the managers, the key pair and the network of the cluster
+//The definition is updated after each deletion, so a failed deletion can be retried
+func (c *Cluster) Delete() error {
+	err := utils.DeleteNodes(&c.Definition.PublicNodeIDs, &c.Definition.PublicNodeIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+	err = utils.DeleteNodes(&c.Definition.PrivateNodeIDs, &c.Definition.PrivateNodeIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+	err = utils.DeleteNodes(&c.Definition.ManagerIDs, &c.Definition.ManagerIPs, c.WriteDefinition)
+	if err != nil {
+		return err
+	}
+
+	return utils.DeleteKeyPairAndNetwork(&c.Definition.Cluster, c.WriteDefinition)
+}
@@ -0,0 +1,35 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Drains the node with IP {{.NodeIP}}, then removes it from the swarm
+# Its tasks are rescheduled by the managers on the other nodes
+# This script must be executed on a manager node.
+
+NODE=$(docker node ls -q | xargs docker node inspect --format '{{"{{.ID}} {{.Status.Addr}}"}}' | awk '$2 == "{{.NodeIP}}" { print $1 }')
+
+# Nothing to drain if the node is not registered
+[ -z "$NODE" ] && exit 0
+
+docker node update --availability drain $NODE || exit $?
+
+# Waits at most 5 minutes for the tasks of the node to be stopped
+for i in $(seq 60); do
+    [ -z "$(docker node ps -q -f desired-state=running $NODE)" ] && break
+    sleep 5
+done
+
+docker node rm --force $NODE
+exit $?
@@ -0,0 +1,34 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Prints the load of the cluster for the autoscaler: a line 'PENDING <count>' with the number of
+# tasks of replicated services no node can run, then a line 'IDLE <IP>' per worker running none of them
+# The tasks of global services run on every node, they don't make a node busy
+# This script must be executed on a manager node.
+
+SERVICES=$(docker service ls -q -f mode=replicated) || exit $?
+TASKS=""
+if [ -n "$SERVICES" ]; then
+    TASKS=$(docker service ps -f desired-state=running --format '{{"{{.CurrentState}}|{{.Node}}"}}' $SERVICES) || exit $?
+fi
+
+echo "PENDING $(echo "$TASKS" | grep -c '^Pending')"
+
+BUSY=$(echo "$TASKS" | awk -F'|' '$1 ~ /^(Running|Starting|Preparing|Assigned|Accepted)/ { print $2 }' | sort -u)
+docker node ls -q -f role=worker | xargs -r docker node inspect --format '{{"{{.Description.Hostname}} {{.Status.Addr}}"}}' | while read NODE IP; do
+    echo "$BUSY" | grep -qx "$NODE" || echo "IDLE $IP"
+done
+exit ${PIPESTATUS[0]}
@@ -0,0 +1,34 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Configures a Docker Swarm manager node, docker being already installed
+# The first manager initializes the swarm, the other ones join it with a manager token
+# The nodes communicate, overlay networks included, on the private network of the cluster
+# This script must be executed on server to configure as manager node
+
+# Lets the SSH user reach the docker socket, used by the tunnel to the manager
+usermod -aG docker "${SUDO_USER}"
+
+# The node may be in the swarm already if the configuration of the cluster was interrupted
+[ "$(docker info --format '{{"{{.Swarm.LocalNodeState}}"}}')" = "active" ] && exit 0
+
+if [ "{{.FirstManager}}" = "yes" ]; then
+    docker swarm init --advertise-addr {{.NodeIP}} --listen-addr {{.NodeIP}}:2377 --data-path-addr {{.NodeIP}}
+    exit $?
+fi
+
+docker swarm join --token {{.Token}} --advertise-addr {{.NodeIP}} --listen-addr {{.NodeIP}}:2377 --data-path-addr {{.NodeIP}} {{.ManagerIP}}:2377
+exit $?
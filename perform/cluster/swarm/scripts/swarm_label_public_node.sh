@@ -0,0 +1,25 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# Labels the node with IP {{.NodeIP}} as public, so services can be constrained
+# to the nodes reachable from outside with node.labels.public==true
+# This script must be executed on a manager node.
+
+NODE=$(docker node ls -q | xargs docker node inspect --format '{{"{{.ID}} {{.Status.Addr}}"}}' | awk '$2 == "{{.NodeIP}}" { print $1 }')
+[ -z "$NODE" ] && exit 1
+
+docker node update --label-add public=true $NODE
+exit $?
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package swarm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/CS-SI/SafeScale/perform/utils"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+const (
+	//dockerSocket is the socket of the docker daemon of the managers
+	dockerSocket = "/var/run/docker.sock"
+	//timeoutTunnel is the time the tunnel is given to listen on its local port
+	timeoutTunnel = 30 * time.Second
+)
+
+//ManagerTunnel is an SSH tunnel forwarding a local port to the docker socket of a manager, through the gateway
+type ManagerTunnel struct {
+	//Endpoint is the endpoint of the manager to use with docker -H
+	Endpoint string
+	//Manager is the name of the manager reached by the tunnel
+	Manager string
+
+	cmd      *exec.Cmd
+	keyFiles []string
+}
+
+//OpenManagerTunnel opens an SSH tunnel from localPort to the docker socket of the first started manager
+func (c *Cluster) OpenManagerTunnel(localPort int) (*ManagerTunnel, error) {
+	managers, err := c.ListMasters()
+	if err != nil {
+		return nil, err
+	}
+	var manager *pb.VM
+	for _, m := range managers {
+		if m.State == pb.VMState_STARTED {
+			manager = m
+			break
+		}
+	}
+	if manager == nil {
+		return nil, fmt.Errorf("no manager of cluster '%s' is started", c.Definition.Cluster.Name)
+	}
+
+	svc, err := utils.GetProviderService()
+	if err != nil {
+		return nil, err
+	}
+	ssh, err := svc.GetSSHConfig(manager.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH config: %s", err.Error())
+	}
+
+	tunnel := &ManagerTunnel{
+		Endpoint: fmt.Sprintf("tcp://127.0.0.1:%d", localPort),
+		Manager:  manager.Name,
+	}
+	keyFile, err := tunnel.createKeyFile(ssh.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	options := []string{"-q", "-oServerAliveInterval=60", "-oStrictHostKeyChecking=no", "-oUserKnownHostsFile=/dev/null", "-oExitOnForwardFailure=yes"}
+	args := append([]string{"-i", keyFile, "-N", "-L", fmt.Sprintf("127.0.0.1:%d:%s", localPort, dockerSocket)}, options...)
+	if ssh.GatewayConfig != nil {
+		gwKeyFile, err := tunnel.createKeyFile(ssh.GatewayConfig.PrivateKey)
+		if err != nil {
+			tunnel.Close()
+			return nil, err
+		}
+		proxy := fmt.Sprintf("ssh -i %s -W %%h:%%p -q -oStrictHostKeyChecking=no -oUserKnownHostsFile=/dev/null -p %d %s@%s",
+			gwKeyFile, ssh.GatewayConfig.Port, ssh.GatewayConfig.User, ssh.GatewayConfig.Host)
+		args = append(args, "-oProxyCommand="+proxy)
+	}
+	args = append(args, "-p", strconv.Itoa(ssh.Port), ssh.User+"@"+ssh.Host)
+
+	tunnel.cmd = exec.Command("ssh", args...)
+	err = tunnel.cmd.Start()
+	if err != nil {
+		tunnel.Close()
+		return nil, fmt.Errorf("failed to open tunnel to manager '%s': %s", manager.Name, err.Error())
+	}
+	deadline := time.Now().Add(timeoutTunnel)
+	for !isListening(localPort) {
+		if time.Now().After(deadline) {
+			tunnel.Close()
+			return nil, fmt.Errorf("tunnel to manager '%s' not ready after %v", manager.Name, timeoutTunnel)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return tunnel, nil
+}
+
+//createKeyFile writes the private key in a file only readable by the user, removed when the tunnel is closed
+func (t *ManagerTunnel) createKeyFile(content string) (string, error) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		return "", err
+	}
+	t.keyFiles = append(t.keyFiles, f.Name())
+	defer f.Close()
+	_, err = f.WriteString(content)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Chmod(0400)
+}
+
+//Wait waits for the tunnel to be closed
+func (t *ManagerTunnel) Wait() error {
+	return t.cmd.Wait()
+}
+
+//Close closes the tunnel and removes its key files
+func (t *ManagerTunnel) Close() error {
+	var err error
+	if t.cmd != nil && t.cmd.Process != nil {
+		err = t.cmd.Process.Kill()
+	}
+	for _, f := range t.keyFiles {
+		os.Remove(f)
+	}
+	return err
+}
+
+//isListening tells if something listens on port of the loopback interface
+func isListening(port int) bool {
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -19,12 +19,21 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/CS-SI/SafeScale/perform/cluster"
 	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
-	"github.com/CS-SI/SafeScale/perform/cluster/api/Complexity"
-	"github.com/CS-SI/SafeScale/perform/cluster/api/Flavor"
+	"github.com/CS-SI/SafeScale/perform/cluster/k8s"
+	"github.com/CS-SI/SafeScale/perform/cluster/swarm"
+	performpb "github.com/CS-SI/SafeScale/perform/performpb"
+	"github.com/CS-SI/SafeScale/perform/utils"
+
+	pb "github.com/CS-SI/SafeScale/broker"
 
 	"github.com/urfave/cli"
 )
@@ -41,14 +50,42 @@ var ClusterCmd = cli.Command{
 		clusterStop,
 		clusterStart,
 		clusterState,
+		clusterNode,
+		clusterKubeconfig,
+		clusterEndpoint,
+		clusterAutoscaling,
+		clusterExport,
+		clusterOperation,
+		clusterOperations,
 	},
 }
 
+//waitFlag makes a command wait the end of the operation it starts on performd
+var waitFlag = cli.BoolFlag{
+	Name:  "wait",
+	Usage: "Wait the end of the operation started on performd",
+}
+
+//printOperation prints the operation started on performd, or waits its end if the command was called with --wait
+func printOperation(c *cli.Context, op *performpb.Operation) error {
+	if c.Bool("wait") {
+		var err error
+		op, err = utils.WaitOperation(op.GetID())
+		if err != nil {
+			return err
+		}
+	}
+	out, _ := json.Marshal(op)
+	fmt.Println(string(out))
+
+	return nil
+}
+
 var clusterList = cli.Command{
 	Name:  "list",
 	Usage: "List available Clusters on the current tenant",
 	Action: func(c *cli.Context) error {
-		list, err := cluster.List()
+		list, err := utils.ListClusters()
 		if err != nil {
 			return fmt.Errorf("Could not get cluster list: %v", err)
 		}
@@ -69,11 +106,11 @@ var clusterInspect = cli.Command{
 			cli.ShowSubcommandHelp(c)
 			return fmt.Errorf("Cluster name required")
 		}
-		instance, err := cluster.Get(c.Args().First())
+		definition, err := utils.InspectCluster(c.Args().First())
 		if err != nil {
 			return fmt.Errorf("Could not inspect cluster '%s': %v", c.Args().First(), err)
 		}
-		out, _ := json.Marshal(instance.GetDefinition())
+		out, _ := json.Marshal(definition)
 		fmt.Println(string(out))
 
 		return nil
@@ -85,6 +122,15 @@ var clusterCreate = cli.Command{
 	Usage:     "create a new cluster",
 	ArgsUsage: "<cluster name>",
 	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "file, f",
+			Usage: "Cluster definition file (YAML), the other flags and the cluster name given override its content",
+		},
+		cli.StringFlag{
+			Name:  "flavor",
+			Value: "DCOS",
+			Usage: "Flavor of the cluster; can be DCOS, K8S, SWARM, SLURM",
+		},
 		cli.StringFlag{
 			Name:  "complexity",
 			Value: "Normal",
@@ -92,43 +138,53 @@ var clusterCreate = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "cidr",
-			Value: "192.168.0.0/24",
-			Usage: "CIDR of the network",
+			Usage: "CIDR of the network, allocated from the network pool of the tenant if not set",
+		},
+		cli.BoolFlag{
+			Name:  "keep-on-failure",
+			Usage: "Keep the infrastructure already created if the creation fails, for debugging",
 		},
+		waitFlag,
 	},
 	Action: func(c *cli.Context) error {
-		if c.NArg() != 1 {
+		file := &cluster.DefinitionFile{}
+		if c.String("file") != "" {
+			var err error
+			file, err = cluster.ReadDefinitionFile(c.String("file"))
+			if err != nil {
+				return err
+			}
+		}
+		if c.NArg() == 1 {
+			file.Name = c.Args().First()
+		}
+		if file.Name == "" {
 			fmt.Println("Missing mandatory argument <cluster name>")
 			cli.ShowSubcommandHelp(c)
 			return fmt.Errorf("Cluster name required")
 		}
-		clusterName := c.Args().First()
-		instance, err := cluster.Get(clusterName)
-		if err != nil {
-			return err
+		if file.Flavor == "" || c.IsSet("flavor") {
+			file.Flavor = c.String("flavor")
+		}
+		if file.Complexity == "" || c.IsSet("complexity") {
+			file.Complexity = c.String("complexity")
 		}
-		if instance != nil {
-			return fmt.Errorf("cluster '%s' already exists.", clusterName)
+		if c.IsSet("cidr") {
+			file.CIDR = c.String("cidr")
 		}
-		log.Printf("Cluster '%s' not found, creating it (this will take a while)\n", clusterName)
-		complexity, err := Complexity.FromString(c.String("complexity"))
+		content, err := file.Bytes()
 		if err != nil {
 			return err
 		}
-		instance, err = cluster.Create(clusterapi.Request{
-			Name:       clusterName,
-			Complexity: complexity,
-			CIDR:       c.String("cidr"),
-			Flavor:     Flavor.DCOS,
-		})
+		op, err := utils.CreateCluster(content, c.Bool("keep-on-failure"))
 		if err != nil {
 			return fmt.Errorf("Failed to create cluster: %s", err.Error())
 		}
+		if c.Bool("wait") {
+			log.Printf("Creating cluster '%s' (this will take a while)\n", file.Name)
+		}
 
-		out, _ := json.Marshal(instance.GetDefinition())
-		fmt.Println(string(out))
-
-		return nil
+		return printOperation(c, op)
 	},
 }
 
@@ -136,20 +192,21 @@ var clusterDelete = cli.Command{
 	Name:      "delete",
 	Usage:     "Delete cluster",
 	ArgsUsage: "<cluster name>",
+	Flags: []cli.Flag{
+		waitFlag,
+	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() != 1 {
 			fmt.Println("Missing mandatory argument <cluster name>")
 			cli.ShowSubcommandHelp(c)
 			return fmt.Errorf("Cluster name required")
 		}
-		err := cluster.Delete(c.Args().First())
+		op, err := utils.DeleteCluster(c.Args().First())
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("Cluster '%s' deleted.\n", c.Args().First())
-
-		return nil
+		return printOperation(c, op)
 	},
 }
 
@@ -157,23 +214,21 @@ var clusterStop = cli.Command{
 	Name:      "stop",
 	Usage:     "Stop the cluster",
 	ArgsUsage: "<cluster name>",
+	Flags: []cli.Flag{
+		waitFlag,
+	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() != 1 {
 			fmt.Println("Missing mandatory argument <cluster name>")
 			cli.ShowSubcommandHelp(c)
 			return fmt.Errorf("Cluster name required")
 		}
-		instance, err := cluster.Get(c.Args().First())
-		if err != nil {
-			return err
-		}
-		err = instance.Stop()
+		op, err := utils.StopCluster(c.Args().First())
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Cluster '%s' stopped.\n", c.Args().First())
 
-		return nil
+		return printOperation(c, op)
 	},
 }
 
@@ -181,24 +236,21 @@ var clusterStart = cli.Command{
 	Name:      "start",
 	Usage:     "Start the cluster",
 	ArgsUsage: "<cluster name>",
+	Flags: []cli.Flag{
+		waitFlag,
+	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() != 1 {
 			fmt.Println("Missing mandatory argument <cluster name>")
 			cli.ShowSubcommandHelp(c)
 			return fmt.Errorf("Cluster name required")
 		}
-		instance, err := cluster.Get(c.Args().First())
-		if err != nil {
-			return nil
-		}
-		err = instance.Start()
+		op, err := utils.StartCluster(c.Args().First())
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("Cluster '%s' started.\n", c.Args().First())
-
-		return nil
+		return printOperation(c, op)
 	},
 }
 
@@ -223,6 +275,428 @@ var clusterState = cli.Command{
 
 		fmt.Printf("Cluster '%s' state : %s\n", c.Args().First(), state.String())
 
+		for _, node := range instance.GetHealthReport() {
+			fmt.Printf("  %s %s (%s): %s", node.Type.String(), node.Name, node.ID, node.State.String())
+			if node.Message != "" {
+				fmt.Printf(", %s", node.Message)
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
+
+var clusterKubeconfig = cli.Command{
+	Name:      "kubeconfig",
+	Usage:     "Print the kubeconfig of a Kubernetes cluster, reaching its API server through the gateway",
+	ArgsUsage: "<cluster name>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <cluster name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Cluster name required")
+		}
+		instance, err := cluster.Read(c.Args().First())
+		if err != nil {
+			return err
+		}
+		if instance == nil {
+			return fmt.Errorf("cluster '%s' not found", c.Args().First())
+		}
+		k8sCluster, ok := instance.(*k8s.Cluster)
+		if !ok {
+			return fmt.Errorf("cluster '%s' is not a Kubernetes cluster", c.Args().First())
+		}
+		kubeconfig, err := k8sCluster.GetKubeconfig()
+		if err != nil {
+			return err
+		}
+		fmt.Print(kubeconfig)
+
+		return nil
+	},
+}
+
+var clusterEndpoint = cli.Command{
+	Name:      "endpoint",
+	Usage:     "Open an SSH tunnel to a manager of a Swarm cluster and print its endpoint for docker -H, until interrupted",
+	ArgsUsage: "<cluster name>",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "port",
+			Value: 2375,
+			Usage: "Local port forwarded to the docker socket of the manager",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <cluster name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Cluster name required")
+		}
+		instance, err := cluster.Read(c.Args().First())
+		if err != nil {
+			return err
+		}
+		if instance == nil {
+			return fmt.Errorf("cluster '%s' not found", c.Args().First())
+		}
+		swarmCluster, ok := instance.(*swarm.Cluster)
+		if !ok {
+			return fmt.Errorf("cluster '%s' is not a Swarm cluster", c.Args().First())
+		}
+		tunnel, err := swarmCluster.OpenManagerTunnel(c.Int("port"))
+		if err != nil {
+			return err
+		}
+		defer tunnel.Close()
+
+		fmt.Printf("Manager '%s' reachable with: docker -H %s\n", tunnel.Manager, tunnel.Endpoint)
+		fmt.Println("Press Ctrl-C to close the tunnel")
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		closed := make(chan error, 1)
+		go func() {
+			closed <- tunnel.Wait()
+		}()
+		select {
+		case <-interrupt:
+		case err = <-closed:
+			return fmt.Errorf("tunnel to manager '%s' closed: %v", tunnel.Manager, err)
+		}
+
+		return nil
+	},
+}
+
+var clusterAutoscaling = cli.Command{
+	Name:      "autoscaling",
+	Usage:     "Configure the automatic addition and removal of private nodes of the cluster, done by performd started with -autoscale",
+	ArgsUsage: "<cluster name>",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "disable",
+			Usage: "Disable autoscaling, the nodes are kept",
+		},
+		cli.IntFlag{
+			Name:  "min",
+			Value: 1,
+			Usage: "Number of private nodes under which nodes are added whatever the load",
+		},
+		cli.IntFlag{
+			Name:  "max",
+			Value: 10,
+			Usage: "Number of private nodes never exceeded",
+		},
+		cli.DurationFlag{
+			Name:  "scale-up-cooldown",
+			Value: 5 * time.Minute,
+			Usage: "Time after a scaling before a node can be added",
+		},
+		cli.DurationFlag{
+			Name:  "scale-down-cooldown",
+			Value: 15 * time.Minute,
+			Usage: "Time after a scaling before a node can be removed",
+		},
+		cli.IntFlag{
+			Name:  "cpu",
+			Usage: "Number of CPU of the nodes added, given by the template of the private nodes if not set",
+		},
+		cli.Float64Flag{
+			Name:  "ram",
+			Usage: "RAM of the nodes added in GB, given by the template of the private nodes if not set",
+		},
+		cli.IntFlag{
+			Name:  "disk",
+			Usage: "Disk size of the nodes added in GB, given by the template of the private nodes if not set",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <cluster name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Cluster name required")
+		}
+		definition, err := utils.InspectCluster(c.Args().First())
+		if err != nil {
+			return fmt.Errorf("Could not inspect cluster '%s': %v", c.Args().First(), err)
+		}
+		autoScaling := definition.GetAutoScaling()
+		if autoScaling == nil {
+			autoScaling = &performpb.AutoScaling{}
+		}
+		if c.Bool("disable") {
+			autoScaling.Enabled = false
+		} else {
+			// The flags not set keep the values of the current configuration, if any
+			configured := autoScaling.MaxNodes > 0
+			if !configured || c.IsSet("min") {
+				autoScaling.MinNodes = int32(c.Int("min"))
+			}
+			if !configured || c.IsSet("max") {
+				autoScaling.MaxNodes = int32(c.Int("max"))
+			}
+			if !configured || c.IsSet("scale-up-cooldown") {
+				autoScaling.ScaleUpCooldown = int64(c.Duration("scale-up-cooldown") / time.Second)
+			}
+			if !configured || c.IsSet("scale-down-cooldown") {
+				autoScaling.ScaleDownCooldown = int64(c.Duration("scale-down-cooldown") / time.Second)
+			}
+			if !configured || c.IsSet("cpu") {
+				autoScaling.CPU = int32(c.Int("cpu"))
+			}
+			if !configured || c.IsSet("ram") {
+				autoScaling.RAM = float32(c.Float64("ram"))
+			}
+			if !configured || c.IsSet("disk") {
+				autoScaling.Disk = int32(c.Int("disk"))
+			}
+			autoScaling.Enabled = true
+		}
+		definition, err = utils.SetClusterAutoScaling(c.Args().First(), autoScaling)
+		if err != nil {
+			return fmt.Errorf("Could not configure autoscaling of cluster '%s': %v", c.Args().First(), err)
+		}
+		out, _ := json.Marshal(definition.GetAutoScaling())
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var clusterExport = cli.Command{
+	Name:      "export",
+	Usage:     "Print the definition file of the cluster, to create the same cluster with 'perform cluster create -f'",
+	ArgsUsage: "<cluster name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "File written instead of printing the definition",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		instance, err := getCluster(c)
+		if err != nil {
+			return err
+		}
+		out, err := cluster.Export(instance.GetDefinition())
+		if err != nil {
+			return err
+		}
+		if c.String("output") != "" {
+			return ioutil.WriteFile(c.String("output"), out, 0644)
+		}
+		fmt.Print(string(out))
+
+		return nil
+	},
+}
+
+var clusterNode = cli.Command{
+	Name:  "node",
+	Usage: "node COMMAND",
+	Subcommands: []cli.Command{
+		clusterNodeAdd,
+		clusterNodeList,
+		clusterNodeInspect,
+		clusterNodeRemove,
+	},
+}
+
+//getCluster returns the cluster named by the first argument of the command, without collecting its state
+//The definition of the cluster is left to performd, which may be running an operation on it
+func getCluster(c *cli.Context) (clusterapi.ClusterAPI, error) {
+	if c.NArg() < 1 {
+		fmt.Println("Missing mandatory argument <cluster name>")
+		cli.ShowSubcommandHelp(c)
+		return nil, fmt.Errorf("Cluster name required")
+	}
+	instance, err := cluster.Read(c.Args().First())
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		return nil, fmt.Errorf("cluster '%s' not found", c.Args().First())
+	}
+	return instance, nil
+}
+
+var clusterNodeAdd = cli.Command{
+	Name:      "add",
+	Usage:     "Add agent nodes to the cluster",
+	ArgsUsage: "<cluster name>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "type",
+			Value: "private",
+			Usage: "Type of the nodes; can be private or public",
+		},
+		cli.IntFlag{
+			Name:  "count",
+			Value: 1,
+			Usage: "Number of nodes to add",
+		},
+		cli.IntFlag{
+			Name:  "cpu",
+			Usage: "Number of CPU of the nodes, given by the template of their type if not set",
+		},
+		cli.Float64Flag{
+			Name:  "ram",
+			Usage: "RAM of the nodes in GB, given by the template of their type if not set",
+		},
+		cli.IntFlag{
+			Name:  "disk",
+			Usage: "Disk size of the nodes in GB, given by the template of their type if not set",
+		},
+		waitFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <cluster name>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Cluster name required")
+		}
+		var public bool
+		switch c.String("type") {
+		case "private":
+		case "public":
+			public = true
+		default:
+			return fmt.Errorf("Invalid node type '%s', must be private or public", c.String("type"))
+		}
+		// The nodes are added one after the other, performd running one operation at a time on a cluster
+		for i := 0; i < c.Int("count"); i++ {
+			op, err := utils.AddClusterNode(&performpb.NodeDefinition{
+				Cluster: c.Args().First(),
+				Public:  public,
+				CPU:     int32(c.Int("cpu")),
+				RAM:     float32(c.Float64("ram")),
+				Disk:    int32(c.Int("disk")),
+			})
+			if err == nil && c.Int("count") > 1 {
+				op, err = utils.WaitOperation(op.GetID())
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to add node %d: %s", i+1, err.Error())
+			}
+			err = printOperation(c, op)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+var clusterNodeList = cli.Command{
+	Name:      "list",
+	Usage:     "List the masters and the agent nodes of the cluster",
+	ArgsUsage: "<cluster name>",
+	Action: func(c *cli.Context) error {
+		instance, err := getCluster(c)
+		if err != nil {
+			return err
+		}
+		masters, err := instance.ListMasters()
+		if err != nil {
+			return err
+		}
+		nodes, err := instance.ListNodes()
+		if err != nil {
+			return err
+		}
+		out, _ := json.Marshal(map[string][]*pb.VM{
+			"masters": masters,
+			"nodes":   nodes,
+		})
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var clusterNodeInspect = cli.Command{
+	Name:      "inspect",
+	Usage:     "Inspect a node of the cluster",
+	ArgsUsage: "<cluster name> <node name or id>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <node name or id>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Node name or id required")
+		}
+		instance, err := getCluster(c)
+		if err != nil {
+			return err
+		}
+		vm, err := instance.GetNode(c.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		out, _ := json.Marshal(vm)
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var clusterNodeRemove = cli.Command{
+	Name:      "remove",
+	Usage:     "Drain an agent node and remove it from the cluster",
+	ArgsUsage: "<cluster name> <node name or id>",
+	Flags: []cli.Flag{
+		waitFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			fmt.Println("Missing mandatory argument <node name or id>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Node name or id required")
+		}
+		op, err := utils.RemoveClusterNode(c.Args().First(), c.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		return printOperation(c, op)
+	},
+}
+
+var clusterOperation = cli.Command{
+	Name:      "operation",
+	Usage:     "Print the progress of an operation of performd",
+	ArgsUsage: "<operation id>",
+	Flags: []cli.Flag{
+		waitFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			fmt.Println("Missing mandatory argument <operation id>")
+			cli.ShowSubcommandHelp(c)
+			return fmt.Errorf("Operation id required")
+		}
+		op, err := utils.GetOperation(c.Args().First())
+		if err != nil {
+			return err
+		}
+
+		return printOperation(c, op)
+	},
+}
+
+var clusterOperations = cli.Command{
+	Name:  "operations",
+	Usage: "List the operations started since performd started",
+	Action: func(c *cli.Context) error {
+		list, err := utils.ListOperations()
+		if err != nil {
+			return fmt.Errorf("Could not get operation list: %v", err)
+		}
+		out, _ := json.Marshal(list)
+		fmt.Println(string(out))
+
 		return nil
 	},
 }
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	brokerpb "github.com/CS-SI/SafeScale/broker"
+	"github.com/CS-SI/SafeScale/perform/cluster"
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+	pb "github.com/CS-SI/SafeScale/perform/performpb"
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+)
+
+// perform cluster create c1 -f c1.yml (la création est asynchrone, l'opération retournée est suivie avec --wait ou perform cluster operation)
+// perform cluster list
+// perform cluster inspect c1
+// perform cluster start c1
+// perform cluster stop c1
+// perform cluster delete c1
+// perform cluster node add c1 --type=public
+// perform cluster node remove c1 c1-node-3
+// perform cluster autoscaling c1 --min=2 --max=10
+// perform cluster operation <id>
+// perform cluster operations
+
+//ClusterServiceServer cluster service server grpc
+type ClusterServiceServer struct{}
+
+//toPBCluster converts the definition of a cluster to its protobuf message
+func toPBCluster(definition clusterapi.Cluster) *pb.Cluster {
+	return &pb.Cluster{
+		Name:       definition.Name,
+		Flavor:     definition.Flavor.String(),
+		Complexity: definition.Complexity.String(),
+		CIDR:       definition.CIDR,
+		State:      definition.State.String(),
+		Tenant:     definition.Tenant,
+		NetworkID:  definition.NetworkID,
+		Operation:  definition.Operation.ID,
+		AutoScaling: &pb.AutoScaling{
+			Enabled:           definition.AutoScaling.Enabled,
+			MinNodes:          int32(definition.AutoScaling.MinNodes),
+			MaxNodes:          int32(definition.AutoScaling.MaxNodes),
+			ScaleUpCooldown:   int64(definition.AutoScaling.ScaleUpCooldown / time.Second),
+			ScaleDownCooldown: int64(definition.AutoScaling.ScaleDownCooldown / time.Second),
+			CPU:               definition.AutoScaling.CPU,
+			RAM:               definition.AutoScaling.RAM,
+			Disk:              definition.AutoScaling.Disk,
+		},
+	}
+}
+
+//Create starts the creation of the cluster described by a definition file
+func (s *ClusterServiceServer) Create(ctx context.Context, in *pb.ClusterDefinition) (*pb.Operation, error) {
+	log.Println("Create Cluster called")
+
+	file, err := cluster.ParseDefinitionFile([]byte(in.GetFile()))
+	if err != nil {
+		return nil, err
+	}
+	req, err := file.Request()
+	if err != nil {
+		return nil, err
+	}
+	req.KeepOnFailure = in.GetKeepOnFailure()
+
+	instance, err := cluster.Get(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if instance != nil {
+		return nil, fmt.Errorf("cluster '%s' already exists", req.Name)
+	}
+	req.Operation = newOperation(operationCreate, "")
+	return create(req)
+}
+
+//Delete starts the deletion of a cluster
+func (s *ClusterServiceServer) Delete(ctx context.Context, in *pb.ClusterName) (*pb.Operation, error) {
+	log.Println("Delete Cluster called")
+	return run(newOperation(operationDelete, ""), in.GetName(), deleteCluster)
+}
+
+//List lists the clusters of the current tenant
+func (s *ClusterServiceServer) List(ctx context.Context, in *google_protobuf.Empty) (*pb.ClusterList, error) {
+	log.Println("List Cluster called")
+
+	clusters, err := cluster.List()
+	if err != nil {
+		return nil, err
+	}
+	var pbClusters []*pb.Cluster
+	for _, c := range clusters {
+		pbClusters = append(pbClusters, toPBCluster(c))
+	}
+	return &pb.ClusterList{Clusters: pbClusters}, nil
+}
+
+//Inspect returns the definition of a cluster, with the state collected last
+func (s *ClusterServiceServer) Inspect(ctx context.Context, in *pb.ClusterName) (*pb.Cluster, error) {
+	log.Println("Inspect Cluster called")
+
+	instance, err := cluster.Read(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		return nil, fmt.Errorf("cluster '%s' not found", in.GetName())
+	}
+	return toPBCluster(instance.GetDefinition()), nil
+}
+
+//Start starts the start of a cluster
+func (s *ClusterServiceServer) Start(ctx context.Context, in *pb.ClusterName) (*pb.Operation, error) {
+	log.Println("Start Cluster called")
+	return run(newOperation(operationStart, ""), in.GetName(), startCluster)
+}
+
+//Stop starts the stop of a cluster
+func (s *ClusterServiceServer) Stop(ctx context.Context, in *pb.ClusterName) (*pb.Operation, error) {
+	log.Println("Stop Cluster called")
+	return run(newOperation(operationStop, ""), in.GetName(), stopCluster)
+}
+
+//AddNode starts the addition of an agent node to a cluster
+func (s *ClusterServiceServer) AddNode(ctx context.Context, in *pb.NodeDefinition) (*pb.Operation, error) {
+	log.Println("Add Node called")
+
+	nodeType := NodeType.PrivateAgent
+	if in.GetPublic() {
+		nodeType = NodeType.PublicAgent
+	}
+	req := &brokerpb.VMDefinition{
+		CPUNumber: in.GetCPU(),
+		RAM:       in.GetRAM(),
+		Disk:      in.GetDisk(),
+	}
+	return run(newOperation(operationAddNode, ""), in.GetCluster(), func(instance clusterapi.ClusterAPI) (interface{}, error) {
+		return cluster.AddNode(instance, nodeType, req)
+	})
+}
+
+//RemoveNode starts the removal of an agent node from a cluster
+func (s *ClusterServiceServer) RemoveNode(ctx context.Context, in *pb.NodeReference) (*pb.Operation, error) {
+	log.Println("Remove Node called")
+
+	node := in.GetNode()
+	return run(newOperation(operationRemoveNode, node), in.GetCluster(), func(instance clusterapi.ClusterAPI) (interface{}, error) {
+		return removeNode(instance, node)
+	})
+}
+
+//SetAutoScaling replaces the autoscaling configuration of a cluster, no operation being in progress on it
+func (s *ClusterServiceServer) SetAutoScaling(ctx context.Context, in *pb.AutoScalingDefinition) (*pb.Cluster, error) {
+	log.Println("Set AutoScaling called")
+
+	a := in.GetAutoScaling()
+	if a.GetEnabled() && (a.GetMinNodes() < 0 || a.GetMaxNodes() < 1 || a.GetMinNodes() > a.GetMaxNodes()) {
+		return nil, fmt.Errorf("invalid bounds, 0 <= min <= max and max >= 1 expected")
+	}
+	var definition clusterapi.Cluster
+	err := configure(in.GetCluster(), func() error {
+		instance, err := cluster.Read(in.GetCluster())
+		if err != nil {
+			return err
+		}
+		if instance == nil {
+			return fmt.Errorf("cluster '%s' not found", in.GetCluster())
+		}
+		autoScaling := instance.GetDefinition().AutoScaling
+		autoScaling.Enabled = a.GetEnabled()
+		autoScaling.MinNodes = int(a.GetMinNodes())
+		autoScaling.MaxNodes = int(a.GetMaxNodes())
+		autoScaling.ScaleUpCooldown = time.Duration(a.GetScaleUpCooldown()) * time.Second
+		autoScaling.ScaleDownCooldown = time.Duration(a.GetScaleDownCooldown()) * time.Second
+		autoScaling.CPU = a.GetCPU()
+		autoScaling.RAM = a.GetRAM()
+		autoScaling.Disk = a.GetDisk()
+		instance.SetAutoScaling(autoScaling)
+		err = instance.WriteDefinition()
+		if err != nil {
+			return err
+		}
+		definition = instance.GetDefinition()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toPBCluster(definition), nil
+}
+
+//GetOperation returns the progress of an operation
+func (s *ClusterServiceServer) GetOperation(ctx context.Context, in *pb.OperationID) (*pb.Operation, error) {
+	return getOperation(in.GetID())
+}
+
+//ListOperations lists the operations started since performd started
+func (s *ClusterServiceServer) ListOperations(ctx context.Context, in *google_protobuf.Empty) (*pb.OperationList, error) {
+	return &pb.OperationList{Operations: listOperations()}, nil
+}
+
+//deleteCluster deletes the storage, the infrastructure and the definition of the cluster
+func deleteCluster(instance clusterapi.ClusterAPI) (interface{}, error) {
+	// The instance saved by run once the operation ends is the one whose definition is updated by the deletion
+	return nil, cluster.Destroy(instance)
+}
+
+//startCluster starts the nodes and the services of the cluster
+func startCluster(instance clusterapi.ClusterAPI) (interface{}, error) {
+	return nil, instance.Start()
+}
+
+//stopCluster stops the services and the nodes of the cluster
+func stopCluster(instance clusterapi.ClusterAPI) (interface{}, error) {
+	return nil, instance.Stop()
+}
+
+//removeNode drains the node referenced by ref and removes it from the cluster
+func removeNode(instance clusterapi.ClusterAPI, ref string) (interface{}, error) {
+	return nil, cluster.DeleteNode(instance, ref)
+}
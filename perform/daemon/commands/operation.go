@@ -0,0 +1,359 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/CS-SI/SafeScale/perform/cluster"
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	pb "github.com/CS-SI/SafeScale/perform/performpb"
+)
+
+const (
+	//operationCreate creates a cluster
+	operationCreate = "create"
+	//operationDelete deletes a cluster
+	operationDelete = "delete"
+	//operationStart starts a cluster
+	operationStart = "start"
+	//operationStop stops a cluster
+	operationStop = "stop"
+	//operationAddNode adds a node to a cluster
+	operationAddNode = "add-node"
+	//operationRemoveNode removes a node from a cluster
+	operationRemoveNode = "remove-node"
+
+	//autoscalerOperation marks in busyClusters the clusters reserved by the autoscaler
+	autoscalerOperation = "autoscaler"
+	//configurationOperation marks in busyClusters the clusters whose configuration is being changed
+	configurationOperation = "configuration"
+)
+
+var (
+	//operationsLock protects operations and busyClusters
+	operationsLock sync.Mutex
+	//operations contains the operations started since performd started, by ID
+	operations = map[string]*pb.Operation{}
+	//busyClusters contains the ID of the operation in progress on each cluster, or the marker of the autoscaler or of a
+	//configuration change, by cluster name
+	busyClusters = map[string]string{}
+
+	//getCluster returns the cluster named name to run an operation on, replaced by a fake in the tests
+	getCluster = cluster.Get
+)
+
+//newOperation returns a new operation of type operationType, on the node referenced by node if any
+func newOperation(operationType string, node string) clusterapi.Operation {
+	id, _ := uuid.NewV4()
+	return clusterapi.Operation{
+		ID:      id.String(),
+		Type:    operationType,
+		Node:    node,
+		Started: time.Now(),
+	}
+}
+
+//register registers operation on the cluster named name, failing if another operation is in progress on the cluster
+func register(operation clusterapi.Operation, name string) (*pb.Operation, error) {
+	operationsLock.Lock()
+	defer operationsLock.Unlock()
+
+	err := reserve(name, operation.ID)
+	if err != nil {
+		return nil, err
+	}
+	op := &pb.Operation{
+		ID:      operation.ID,
+		Type:    operation.Type,
+		Cluster: name,
+		State:   pb.OperationState_RUNNING,
+		Started: operation.Started.Unix(),
+	}
+	operations[operation.ID] = op
+	return proto.Clone(op).(*pb.Operation), nil
+}
+
+//reserve marks the cluster named name as busy with marker in busyClusters, failing if the cluster is already busy
+//operationsLock must be held
+func reserve(name string, marker string) error {
+	if other, ok := busyClusters[name]; ok {
+		switch other {
+		case autoscalerOperation:
+			return fmt.Errorf("cluster '%s' is being autoscaled, retry later", name)
+		case configurationOperation:
+			return fmt.Errorf("cluster '%s' is being configured, retry later", name)
+		}
+		return fmt.Errorf("operation '%s' already in progress on cluster '%s'", other, name)
+	}
+	busyClusters[name] = marker
+	return nil
+}
+
+//release releases the cluster named name if it is marked as busy with marker in busyClusters
+//operationsLock must be held
+func release(name string, marker string) {
+	if busyClusters[name] == marker {
+		delete(busyClusters, name)
+	}
+}
+
+//configure runs do on the cluster named name, no operation being started on the cluster until do returns
+func configure(name string, do func() error) error {
+	operationsLock.Lock()
+	err := reserve(name, configurationOperation)
+	operationsLock.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		operationsLock.Lock()
+		release(name, configurationOperation)
+		operationsLock.Unlock()
+	}()
+	return do()
+}
+
+//autoscalerLocker reserves the clusters for the autoscaler in busyClusters, so that no operation starts on a cluster
+//while it is autoscaled, and a cluster is not autoscaled while an operation is in progress on it
+type autoscalerLocker struct{}
+
+//AutoscalerLocker is the Locker the autoscaler of performd reserves the clusters with
+var AutoscalerLocker cluster.Locker = autoscalerLocker{}
+
+//TryLock reserves the cluster named name for the autoscaler, it returns false if an operation is in progress on the cluster
+func (autoscalerLocker) TryLock(name string) bool {
+	operationsLock.Lock()
+	defer operationsLock.Unlock()
+
+	return reserve(name, autoscalerOperation) == nil
+}
+
+//Unlock releases the cluster named name reserved by the autoscaler
+func (autoscalerLocker) Unlock(name string) {
+	operationsLock.Lock()
+	defer operationsLock.Unlock()
+
+	release(name, autoscalerOperation)
+}
+
+//finish records the end of the operation identified by id, with its result marshalled in JSON
+func finish(id string, result interface{}, err error) {
+	operationsLock.Lock()
+	defer operationsLock.Unlock()
+
+	op, ok := operations[id]
+	if !ok {
+		return
+	}
+	delete(busyClusters, op.Cluster)
+	op.Ended = time.Now().Unix()
+	if err != nil {
+		log.Printf("Operation '%s' (%s) on cluster '%s' failed: %s", op.ID, op.Type, op.Cluster, err.Error())
+		op.State = pb.OperationState_FAILED
+		op.Error = err.Error()
+		return
+	}
+	log.Printf("Operation '%s' (%s) on cluster '%s' done", op.ID, op.Type, op.Cluster)
+	op.State = pb.OperationState_DONE
+	if result != nil {
+		out, _ := json.Marshal(result)
+		op.Result = string(out)
+	}
+}
+
+//getOperation returns a copy of the operation identified by id
+func getOperation(id string) (*pb.Operation, error) {
+	operationsLock.Lock()
+	defer operationsLock.Unlock()
+
+	op, ok := operations[id]
+	if !ok {
+		return nil, fmt.Errorf("operation '%s' not found", id)
+	}
+	return proto.Clone(op).(*pb.Operation), nil
+}
+
+//listOperations returns a copy of the operations started since performd started
+func listOperations() []*pb.Operation {
+	operationsLock.Lock()
+	defer operationsLock.Unlock()
+
+	var list []*pb.Operation
+	for _, op := range operations {
+		list = append(list, proto.Clone(op).(*pb.Operation))
+	}
+	return list
+}
+
+//saveOperation replaces the operation in progress in the definition of the cluster instance and saves it
+func saveOperation(instance clusterapi.ClusterAPI, operation clusterapi.Operation) error {
+	instance.SetOperation(operation)
+	return instance.WriteDefinition()
+}
+
+//run runs do in background on the cluster named name, the operation being saved in the definition of the cluster
+//until it ends so it can be resumed if performd is interrupted
+func run(operation clusterapi.Operation, name string, do func(clusterapi.ClusterAPI) (interface{}, error)) (*pb.Operation, error) {
+	op, err := register(operation, name)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		instance, err := getCluster(name)
+		if err == nil && instance == nil {
+			err = fmt.Errorf("cluster '%s' not found", name)
+		}
+		if err != nil {
+			finish(operation.ID, nil, err)
+			return
+		}
+		err = saveOperation(instance, operation)
+		if err != nil {
+			finish(operation.ID, nil, err)
+			return
+		}
+		result, err := do(instance)
+		// The definition of a deleted cluster doesn't exist anymore
+		if operation.Type != operationDelete || err != nil {
+			cerr := saveOperation(instance, clusterapi.Operation{})
+			if cerr != nil {
+				log.Printf("failed to save end of operation '%s' on cluster '%s': %s", operation.ID, name, cerr.Error())
+			}
+		}
+		finish(operation.ID, result, err)
+	}()
+	return op, nil
+}
+
+//create creates in background the cluster requested by req, the operation being saved in the definition of the cluster
+//since its creation so it can be resumed if performd is interrupted
+func create(req clusterapi.Request) (*pb.Operation, error) {
+	op, err := register(req.Operation, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		instance, err := cluster.Create(req)
+		finishCreation(req.Operation, req.Name, instance, err)
+	}()
+	return op, nil
+}
+
+//finishCreation records the end of a creation, the cluster kept if the creation failed doesn't refer to the operation anymore
+func finishCreation(operation clusterapi.Operation, name string, instance clusterapi.ClusterAPI, err error) {
+	if instance == nil {
+		kept, gerr := getCluster(name)
+		if gerr == nil && kept != nil {
+			instance = kept
+		}
+	}
+	if instance != nil {
+		cerr := saveOperation(instance, clusterapi.Operation{})
+		if cerr != nil {
+			log.Printf("failed to save end of operation '%s' on cluster '%s': %s", operation.ID, name, cerr.Error())
+		}
+	}
+	if err != nil {
+		finish(operation.ID, nil, err)
+		return
+	}
+	finish(operation.ID, toPBCluster(instance.GetDefinition()), nil)
+}
+
+//ResumeOperations resumes the operations interrupted by the end of the previous performd
+//The creations, deletions, starts, stops and node removals are resumed; a node addition can't be resumed
+//and is reported as interrupted, the VM possibly created is adopted by the next addition of a node of the same type
+func ResumeOperations() {
+	clusters, err := cluster.List()
+	if err != nil {
+		log.Printf("failed to list clusters, interrupted operations not resumed: %s", err.Error())
+		return
+	}
+	for _, c := range clusters {
+		operation := c.Operation
+		if operation.ID == "" {
+			continue
+		}
+		log.Printf("Resuming operation '%s' (%s) on cluster '%s'", operation.ID, operation.Type, c.Name)
+		switch operation.Type {
+		case operationCreate:
+			name := c.Name
+			_, err = register(operation, name)
+			if err == nil {
+				go func() {
+					instance, err := getCluster(name)
+					if err == nil && instance == nil {
+						err = fmt.Errorf("cluster '%s' not found", name)
+					}
+					if err == nil {
+						instance, err = cluster.ResumeCreation(instance)
+					}
+					finishCreation(operation, name, instance, err)
+				}()
+			}
+		case operationDelete:
+			_, err = run(operation, c.Name, deleteCluster)
+		case operationStart:
+			_, err = run(operation, c.Name, startCluster)
+		case operationStop:
+			_, err = run(operation, c.Name, stopCluster)
+		case operationRemoveNode:
+			node := operation.Node
+			_, err = run(operation, c.Name, func(instance clusterapi.ClusterAPI) (interface{}, error) {
+				// The node was removed before the interruption if it's not a node of the cluster anymore
+				if _, gerr := instance.GetNode(node); gerr != nil {
+					return nil, nil
+				}
+				return removeNode(instance, node)
+			})
+		default:
+			err = interrupt(operation, c.Name)
+		}
+		if err != nil {
+			log.Printf("failed to resume operation '%s' on cluster '%s': %s", operation.ID, c.Name, err.Error())
+		}
+	}
+}
+
+//interrupt reports operation as interrupted and removes it from the definition of the cluster named name
+func interrupt(operation clusterapi.Operation, name string) error {
+	_, err := register(operation, name)
+	if err != nil {
+		return err
+	}
+	operationsLock.Lock()
+	op := operations[operation.ID]
+	delete(busyClusters, name)
+	op.State = pb.OperationState_INTERRUPTED
+	op.Error = "interrupted by the end of performd"
+	op.Ended = time.Now().Unix()
+	operationsLock.Unlock()
+
+	instance, err := getCluster(name)
+	if err != nil || instance == nil {
+		return err
+	}
+	return saveOperation(instance, clusterapi.Operation{})
+}
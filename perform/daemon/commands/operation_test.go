@@ -0,0 +1,232 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	brokerpb "github.com/CS-SI/SafeScale/broker"
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+	pb "github.com/CS-SI/SafeScale/perform/performpb"
+)
+
+//fakeCluster is a ClusterAPI recording the operation of its definition each time it is written
+type fakeCluster struct {
+	definition clusterapi.Cluster
+	saved      []clusterapi.Operation
+	writeErr   error
+}
+
+func (f *fakeCluster) Start() error                             { return nil }
+func (f *fakeCluster) Stop() error                              { return nil }
+func (f *fakeCluster) GetState() (ClusterState.Enum, error)     { return f.definition.State, nil }
+func (f *fakeCluster) GetHealthReport() []clusterapi.NodeHealth { return nil }
+func (f *fakeCluster) GetNetworkID() string                     { return f.definition.NetworkID }
+func (f *fakeCluster) GetLoad() (*clusterapi.Load, error)       { return &clusterapi.Load{}, nil }
+func (f *fakeCluster) DeleteNode(string) error                  { return nil }
+func (f *fakeCluster) ListMasters() ([]*brokerpb.VM, error)     { return nil, nil }
+func (f *fakeCluster) ListNodes() ([]*brokerpb.VM, error)       { return nil, nil }
+func (f *fakeCluster) CountPrivateNodes() int                   { return 0 }
+func (f *fakeCluster) GetNode(string) (*brokerpb.VM, error)     { return nil, fmt.Errorf("not found") }
+func (f *fakeCluster) ResumeCreation() error                    { return nil }
+func (f *fakeCluster) Delete() error                            { return nil }
+func (f *fakeCluster) GetDefinition() clusterapi.Cluster        { return f.definition }
+func (f *fakeCluster) SetAutoScaling(a clusterapi.AutoScaling)  { f.definition.AutoScaling = a }
+func (f *fakeCluster) SetOperation(o clusterapi.Operation)      { f.definition.Operation = o }
+func (f *fakeCluster) ReadDefinition() (bool, error)            { return true, nil }
+func (f *fakeCluster) RemoveDefinition() error                  { return nil }
+func (f *fakeCluster) AddNode(NodeType.Enum, *brokerpb.VMDefinition) (*brokerpb.VM, error) {
+	return nil, nil
+}
+
+func (f *fakeCluster) WriteDefinition() error {
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	f.saved = append(f.saved, f.definition.Operation)
+	return nil
+}
+
+//useClusters resets the operations and makes the operations run on the fake clusters
+func useClusters(clusters map[string]*fakeCluster) {
+	operations = map[string]*pb.Operation{}
+	busyClusters = map[string]string{}
+	getCluster = func(name string) (clusterapi.ClusterAPI, error) {
+		c, ok := clusters[name]
+		if !ok {
+			return nil, nil
+		}
+		return c, nil
+	}
+}
+
+//waitEnd waits the end of the operation identified by id
+func waitEnd(t *testing.T, id string) *pb.Operation {
+	for i := 0; i < 500; i++ {
+		op, err := getOperation(id)
+		assert.Nil(t, err)
+		if op.GetState() != pb.OperationState_RUNNING {
+			return op
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("operation '%s' still running", id)
+	return nil
+}
+
+func Test_register(t *testing.T) {
+	useClusters(nil)
+	first := newOperation(operationStart, "")
+	op, err := register(first, "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, pb.OperationState_RUNNING, op.GetState())
+	assert.Equal(t, "c1", op.GetCluster())
+
+	_, err = register(newOperation(operationStop, ""), "c1")
+	assert.NotNil(t, err)
+	_, err = register(newOperation(operationStop, ""), "c2")
+	assert.Nil(t, err)
+
+	finish(first.ID, nil, nil)
+	_, err = register(newOperation(operationStop, ""), "c1")
+	assert.Nil(t, err)
+}
+
+func Test_finish(t *testing.T) {
+	useClusters(nil)
+	done := newOperation(operationAddNode, "")
+	register(done, "c1")
+	finish(done.ID, map[string]string{"ID": "n1"}, nil)
+	op, err := getOperation(done.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, pb.OperationState_DONE, op.GetState())
+	assert.Equal(t, `{"ID":"n1"}`, op.GetResult())
+
+	failed := newOperation(operationAddNode, "")
+	register(failed, "c1")
+	finish(failed.ID, nil, fmt.Errorf("no quota"))
+	op, err = getOperation(failed.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, pb.OperationState_FAILED, op.GetState())
+	assert.Equal(t, "no quota", op.GetError())
+	assert.Len(t, listOperations(), 2)
+
+	_, err = getOperation("unknown")
+	assert.NotNil(t, err)
+}
+
+func Test_autoscalerLocker(t *testing.T) {
+	useClusters(nil)
+	assert.True(t, AutoscalerLocker.TryLock("c1"))
+	assert.False(t, AutoscalerLocker.TryLock("c1"))
+	_, err := register(newOperation(operationStart, ""), "c1")
+	assert.NotNil(t, err)
+	AutoscalerLocker.Unlock("c1")
+
+	operation := newOperation(operationStart, "")
+	_, err = register(operation, "c1")
+	assert.Nil(t, err)
+	assert.False(t, AutoscalerLocker.TryLock("c1"))
+	// The autoscaler never releases a cluster reserved by an operation
+	AutoscalerLocker.Unlock("c1")
+	_, err = register(newOperation(operationStop, ""), "c1")
+	assert.NotNil(t, err)
+	finish(operation.ID, nil, nil)
+	assert.True(t, AutoscalerLocker.TryLock("c1"))
+}
+
+func Test_configure(t *testing.T) {
+	useClusters(nil)
+	err := configure("c1", func() error {
+		_, err := register(newOperation(operationStart, ""), "c1")
+		assert.NotNil(t, err)
+		assert.False(t, AutoscalerLocker.TryLock("c1"))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, configure("c1", func() error { return nil }))
+
+	assert.True(t, AutoscalerLocker.TryLock("c1"))
+	err = configure("c1", func() error { return nil })
+	assert.NotNil(t, err)
+}
+
+func Test_saveOperation(t *testing.T) {
+	c := &fakeCluster{}
+	operation := newOperation(operationStop, "")
+	assert.Nil(t, saveOperation(c, operation))
+	assert.Equal(t, operation, c.definition.Operation)
+	assert.Equal(t, []clusterapi.Operation{operation}, c.saved)
+
+	c.writeErr = fmt.Errorf("object storage unavailable")
+	assert.NotNil(t, saveOperation(c, clusterapi.Operation{}))
+}
+
+func Test_run(t *testing.T) {
+	c := &fakeCluster{definition: clusterapi.Cluster{Name: "c1"}}
+	useClusters(map[string]*fakeCluster{"c1": c})
+	operation := newOperation(operationStop, "")
+	op, err := run(operation, "c1", func(instance clusterapi.ClusterAPI) (interface{}, error) {
+		// The operation is saved in the definition while it runs
+		assert.Equal(t, operation.ID, instance.GetDefinition().Operation.ID)
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	op = waitEnd(t, op.GetID())
+	assert.Equal(t, pb.OperationState_DONE, op.GetState())
+	assert.Equal(t, []clusterapi.Operation{operation, {}}, c.saved)
+	assert.Empty(t, busyClusters)
+
+	_, err = run(newOperation(operationStop, ""), "c2", nil)
+	assert.Nil(t, err)
+	for _, o := range listOperations() {
+		if o.GetCluster() == "c2" {
+			assert.Equal(t, pb.OperationState_FAILED, waitEnd(t, o.GetID()).GetState())
+		}
+	}
+}
+
+func Test_run_delete(t *testing.T) {
+	deleted := &fakeCluster{definition: clusterapi.Cluster{Name: "c1"}}
+	failed := &fakeCluster{definition: clusterapi.Cluster{Name: "c2"}}
+	useClusters(map[string]*fakeCluster{"c1": deleted, "c2": failed})
+
+	// The definition of a deleted cluster isn't saved again
+	operation := newOperation(operationDelete, "")
+	op, err := run(operation, "c1", func(instance clusterapi.ClusterAPI) (interface{}, error) {
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, pb.OperationState_DONE, waitEnd(t, op.GetID()).GetState())
+	assert.Equal(t, []clusterapi.Operation{operation}, deleted.saved)
+
+	// The definition of a cluster whose deletion failed is saved without the operation
+	operation = newOperation(operationDelete, "")
+	op, err = run(operation, "c2", func(instance clusterapi.ClusterAPI) (interface{}, error) {
+		return nil, fmt.Errorf("failed to delete network")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, pb.OperationState_FAILED, waitEnd(t, op.GetID()).GetState())
+	assert.Equal(t, []clusterapi.Operation{operation, {}}, failed.saved)
+	assert.Empty(t, busyClusters)
+}
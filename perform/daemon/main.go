@@ -0,0 +1,71 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"github.com/CS-SI/SafeScale/perform/cluster"
+	"github.com/CS-SI/SafeScale/perform/daemon/commands"
+	pb "github.com/CS-SI/SafeScale/perform/performpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	port = ":50052"
+)
+
+/*
+performd, performd -autoscale=1m (les clusters avec l'autoscaling activé sont évalués toutes les minutes, désactivé par défaut)
+
+Les opérations interrompues par l'arrêt de performd sont reprises au démarrage: les créations, suppressions, démarrages,
+arrêts et retraits de noeud sont repris, les ajouts de noeud sont marqués interrompus.
+*/
+
+// *** MAIN ***
+func main() {
+	autoscale := flag.Duration("autoscale", 0, "Interval between two evaluations of the load of the clusters with autoscaling enabled, 0 to disable the autoscaler")
+	flag.Parse()
+
+	log.Println("Starting server")
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	s := grpc.NewServer()
+
+	log.Println("Registering services")
+	pb.RegisterClusterServiceServer(s, &commands.ClusterServiceServer{})
+
+	log.Println("Resuming interrupted operations")
+	commands.ResumeOperations()
+
+	if *autoscale > 0 {
+		log.Printf("Autoscaling clusters every %v", *autoscale)
+		go cluster.RunAutoscaler(*autoscale, nil, commands.AutoscalerLocker)
+	}
+
+	// Register reflection service on gRPC server.
+	reflection.Register(s)
+	log.Println("Ready to serve :-)")
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
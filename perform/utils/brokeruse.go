@@ -26,6 +26,8 @@ import (
 
 	google_protobuf "github.com/golang/protobuf/ptypes/empty"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -127,6 +129,20 @@ func CreateVM(req *pb.VMDefinition) (*pb.VM, error) {
 	return vm, nil
 }
 
+//GetVM returns the VM referenced by ref (name or ID) using brokerd
+func GetVM(ref string) (*pb.VM, error) {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewVMServiceClient(conn)
+	vm, err := service.Inspect(ctx, &pb.Reference{ID: ref})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect VM '%s': %v", ref, err)
+	}
+	return vm, nil
+}
+
 //DeleteVM deletes a VM using brokerd
 func DeleteVM(id string) error {
 	conn := GetConnection()
@@ -151,3 +167,214 @@ func CreateMetadataContainer() error {
 	}
 	return nil
 }
+
+//GetNetworkTopology returns the topology of the network referenced by ref (name or ID) using brokerd
+func GetNetworkTopology(ref string) (*pb.NetworkTopology, error) {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	networkService := pb.NewNetworkServiceClient(conn)
+	topology, err := networkService.Topology(ctx, &pb.Reference{ID: ref})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topology of Network '%s': %v", ref, err)
+	}
+	return topology, nil
+}
+
+//CreateLoadBalancer creates a load balancer using brokerd
+func CreateLoadBalancer(req *pb.LoadBalancerDefinition) (*pb.LoadBalancer, error) {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewLoadBalancerServiceClient(conn)
+	lb, err := service.Create(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Load Balancer '%s': %v", req.Name, err)
+	}
+	return lb, nil
+}
+
+//AddLoadBalancerBackend adds the VM identified by vmID to the backends of the load balancer identified by lbID using brokerd
+func AddLoadBalancerBackend(lbID string, vmID string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewLoadBalancerServiceClient(conn)
+	_, err := service.AddBackend(ctx, &pb.LoadBalancerBackend{
+		LoadBalancer: &pb.Reference{ID: lbID},
+		VM:           &pb.Reference{ID: vmID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add VM '%s' to Load Balancer '%s': %v", vmID, lbID, err)
+	}
+	return nil
+}
+
+//DeleteLoadBalancer deletes a load balancer using brokerd
+func DeleteLoadBalancer(id string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewLoadBalancerServiceClient(conn)
+	_, err := service.Delete(ctx, &pb.Reference{ID: id})
+	return err
+}
+
+//IsNotFound tells if err is the error returned by brokerd for a resource which doesn't exist
+func IsNotFound(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.NotFound
+}
+
+//CreateNas exports path of the VM referenced by vmRef (name or ID) as the NAS named name using brokerd
+func CreateNas(name string, vmRef string, path string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewNasServiceClient(conn)
+	_, err := service.Create(ctx, &pb.NasDefinition{
+		Nas:  &pb.NasName{Name: name},
+		VM:   &pb.Reference{Name: vmRef},
+		Path: path,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create NAS '%s': %v", name, err)
+	}
+	return nil
+}
+
+//DeleteNas deletes the NAS named name using brokerd
+func DeleteNas(name string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewNasServiceClient(conn)
+	_, err := service.Delete(ctx, &pb.NasName{Name: name})
+	return err
+}
+
+//MountNas mounts the NAS named name on path of the VM referenced by vmRef (name or ID) using brokerd
+func MountNas(name string, vmRef string, path string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewNasServiceClient(conn)
+	_, err := service.Mount(ctx, &pb.NasDefinition{
+		Nas:  &pb.NasName{Name: name},
+		VM:   &pb.Reference{Name: vmRef},
+		Path: path,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mount NAS '%s' on VM '%s': %v", name, vmRef, err)
+	}
+	return nil
+}
+
+//IsNasMounted tells if the NAS named name is registered by brokerd as mounted on the VM identified by vmID
+func IsNasMounted(name string, vmID string) (bool, error) {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewNasServiceClient(conn)
+	list, err := service.Inspect(ctx, &pb.NasName{Name: name})
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect NAS '%s': %v", name, err)
+	}
+	for _, nas := range list.GetNasList() {
+		if !nas.GetIsServer() && nas.GetVM().GetID() == vmID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//UMountNas unmounts the NAS named name from the VM referenced by vmRef (name or ID) using brokerd
+func UMountNas(name string, vmRef string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewNasServiceClient(conn)
+	_, err := service.UMount(ctx, &pb.NasDefinition{
+		Nas: &pb.NasName{Name: name},
+		VM:  &pb.Reference{Name: vmRef},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unmount NAS '%s' from VM '%s': %v", name, vmRef, err)
+	}
+	return nil
+}
+
+//CreateVolume creates the volume named name of size GB using brokerd
+func CreateVolume(name string, size int32, speed pb.VolumeSpeed) (*pb.Volume, error) {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewVolumeServiceClient(conn)
+	volume, err := service.Create(ctx, &pb.VolumeDefinition{
+		Name:  name,
+		Size:  size,
+		Speed: speed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create volume '%s': %v", name, err)
+	}
+	return volume, nil
+}
+
+//AttachVolume attaches the volume named name to the VM referenced by vmRef (name or ID), then mounts it on path
+//formatted with format, using brokerd
+func AttachVolume(name string, vmRef string, path string, format string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewVolumeServiceClient(conn)
+	_, err := service.Attach(ctx, &pb.VolumeAttachment{
+		Volume:    &pb.Reference{Name: name},
+		VM:        &pb.Reference{Name: vmRef},
+		MountPath: path,
+		Format:    format,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach volume '%s' to VM '%s': %v", name, vmRef, err)
+	}
+	return nil
+}
+
+//DetachVolume unmounts and detaches the volume named name from the VM referenced by vmRef (name or ID) using brokerd
+func DetachVolume(name string, vmRef string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewVolumeServiceClient(conn)
+	_, err := service.Detach(ctx, &pb.VolumeDetachment{
+		Volume: &pb.Reference{Name: name},
+		VM:     &pb.Reference{Name: vmRef},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to detach volume '%s' from VM '%s': %v", name, vmRef, err)
+	}
+	return nil
+}
+
+//DeleteVolume deletes the volume named name using brokerd
+func DeleteVolume(name string) error {
+	conn := GetConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewVolumeServiceClient(conn)
+	_, err := service.Delete(ctx, &pb.Reference{Name: name})
+	return err
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
+	providerapi "github.com/CS-SI/SafeScale/providers/api"
+)
+
+//CreateKeyPair creates the key pair of the cluster named name
+//Only the keys are kept in the cluster definition, the key pair itself is deleted from the provider
+func CreateKeyPair(name string) (*providerapi.KeyPair, error) {
+	svc, err := GetProviderService()
+	if err != nil {
+		return nil, err
+	}
+	kpName := keyPairName(name)
+	svc.DeleteKeyPair(kpName)
+	kp, err := svc.CreateKeyPair(kpName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Key Pair: %s", err.Error())
+	}
+	svc.DeleteKeyPair(kpName)
+	return kp, nil
+}
+
+//keyPairName returns the name of the key pair of the cluster named name
+func keyPairName(name string) string {
+	return "cluster_" + name + "_key"
+}
+
+//DeleteKeyPairAndNetwork deletes the key pair and the network of cluster, the last resources deleted with a cluster
+//The network is removed from the definition, which is saved with write
+func DeleteKeyPairAndNetwork(cluster *clusterapi.Cluster, write func() error) error {
+	svc, err := GetProviderService()
+	if err != nil {
+		return err
+	}
+	svc.DeleteKeyPair(keyPairName(cluster.Name))
+
+	if cluster.NetworkID == "" {
+		return nil
+	}
+	err = DeleteNetwork(cluster.NetworkID)
+	if err != nil && !strings.Contains(err.Error(), "does not exists") {
+		return err
+	}
+	cluster.NetworkID = ""
+	return write()
+}
+
+//AbortCreation deletes the infrastructure and the definition of instance, whose creation failed
+//The infrastructure is kept for debugging if keepOnFailure is set
+func AbortCreation(instance clusterapi.ClusterAPI, keepOnFailure bool) {
+	name := instance.GetDefinition().Name
+	if keepOnFailure {
+		log.Printf("Keeping infrastructure of cluster '%s' for debugging, 'perform cluster delete %s' removes it", name, name)
+		return
+	}
+	log.Printf("Deleting infrastructure of cluster '%s'", name)
+	err := instance.Delete()
+	if err == nil {
+		err = instance.RemoveDefinition()
+	}
+	if err != nil {
+		log.Printf("failed to delete infrastructure of cluster '%s': %s", name, err.Error())
+	}
+}
+
+//WaitNominal collects the state of a cluster with forceGetState until the cluster is Nominal, for at most timeout
+func WaitNominal(forceGetState func() (ClusterState.Enum, error), timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := forceGetState()
+		if err != nil {
+			return err
+		}
+		if state == ClusterState.Nominal {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("cluster started but still in state '%s' after %v", state.String(), timeout)
+		}
+		time.Sleep(HealthCheckDelay)
+	}
+}
+
+//GetState returns the state of cluster, collected again with forceGetState if the last collection is older than interval
+func GetState(cluster *clusterapi.Cluster, interval time.Duration, forceGetState func() (ClusterState.Enum, error)) (ClusterState.Enum, error) {
+	now := time.Now()
+	if now.After(cluster.LastStateCollection.Add(interval)) {
+		return forceGetState()
+	}
+	return cluster.State, nil
+}
+
+//WriteDefinition writes in Object Storage definition, the definition of the cluster named name
+func WriteDefinition(name string, definition interface{}) error {
+	CreateMetadataContainer()
+
+	// writes  the data in Object Storage
+	return WriteMetadata(clusterapi.ClusterMetadataPrefix, name, definition)
+}
+
+//ReadDefinition reads from Object Storage the definition of the cluster named name into definition, a pointer to the
+//definition of its flavor
+// Returns (true, nil) if found and loaded, (false, nil) if not found, and (false, error) in case of error
+func ReadDefinition(name string, definition interface{}) (bool, error) {
+	CreateMetadataContainer()
+
+	ok, err := FindMetadata(clusterapi.ClusterMetadataPrefix, name)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	// reads the data in Object Storage
+	err = ReadMetadata(clusterapi.ClusterMetadataPrefix, name, func(buf *bytes.Buffer) error {
+		return gob.NewDecoder(buf).Decode(definition)
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//RemoveDefinition removes from Object Storage the definition of cluster, refused if running tells the flavor still has
+//infrastructure running
+func RemoveDefinition(cluster *clusterapi.Cluster, running bool) error {
+	if running || cluster.NetworkID != "" {
+		return fmt.Errorf("can't remove a definition of a cluster with infrastructure still running")
+	}
+
+	err := DeleteMetadata(clusterapi.ClusterMetadataPrefix, cluster.Name)
+	if err != nil {
+		return fmt.Errorf("failed to remove cluster definition in Object Storage: %s", err.Error())
+	}
+	cluster.State = ClusterState.Removed
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/ClusterState"
+)
+
+func Test_GetState(t *testing.T) {
+	collections := 0
+	forceGetState := func() (ClusterState.Enum, error) {
+		collections++
+		return ClusterState.Degraded, nil
+	}
+	cluster := clusterapi.Cluster{State: ClusterState.Nominal, LastStateCollection: time.Now()}
+	state, err := GetState(&cluster, time.Minute, forceGetState)
+	assert.Nil(t, err)
+	assert.Equal(t, ClusterState.Nominal, state)
+	assert.Equal(t, 0, collections)
+
+	cluster.LastStateCollection = time.Now().Add(-2 * time.Minute)
+	state, err = GetState(&cluster, time.Minute, forceGetState)
+	assert.Nil(t, err)
+	assert.Equal(t, ClusterState.Degraded, state)
+	assert.Equal(t, 1, collections)
+}
+
+func Test_WaitNominal(t *testing.T) {
+	err := WaitNominal(func() (ClusterState.Enum, error) { return ClusterState.Nominal, nil }, time.Minute)
+	assert.Nil(t, err)
+	err = WaitNominal(func() (ClusterState.Enum, error) { return ClusterState.Error, fmt.Errorf("no master") }, time.Minute)
+	assert.NotNil(t, err)
+	err = WaitNominal(func() (ClusterState.Enum, error) { return ClusterState.Degraded, nil }, 0)
+	assert.NotNil(t, err)
+}
+
+func Test_RemoveDefinition(t *testing.T) {
+	cluster := clusterapi.Cluster{Name: "c1", State: ClusterState.Stopped}
+	assert.NotNil(t, RemoveDefinition(&cluster, true))
+	cluster.NetworkID = "n1"
+	assert.NotNil(t, RemoveDefinition(&cluster, false))
+	assert.Equal(t, ClusterState.Stopped, cluster.State)
+}
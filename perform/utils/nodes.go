@@ -0,0 +1,230 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	clusterapi "github.com/CS-SI/SafeScale/perform/cluster/api"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeState"
+	"github.com/CS-SI/SafeScale/perform/cluster/api/NodeType"
+	"github.com/CS-SI/SafeScale/providers"
+	"github.com/CS-SI/SafeScale/providers/api/VMState"
+
+	pb "github.com/CS-SI/SafeScale/broker"
+)
+
+const (
+	//TimeoutVMState is the time the VM of a node is given to be started or stopped
+	TimeoutVMState = 5 * time.Minute
+	//HealthCheckDelay is the delay between two health checks while waiting for the services of the nodes
+	HealthCheckDelay = 10 * time.Second
+)
+
+//SetNodesState starts or stops the VMs identified by ids, then waits at most timeout for all of them to reach state
+func SetNodesState(svc *providers.Service, ids []string, state VMState.Enum, timeout time.Duration) error {
+	var pending []string
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		vm, err := svc.GetVM(id)
+		if err != nil {
+			return fmt.Errorf("failed to get VM '%s': %s", id, err.Error())
+		}
+		if vm.State == state {
+			continue
+		}
+		if state == VMState.STARTED {
+			err = svc.StartVM(id)
+		} else {
+			err = svc.StopVM(id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to change state of VM '%s': %s", vm.Name, err.Error())
+		}
+		pending = append(pending, id)
+	}
+	for _, id := range pending {
+		_, err := svc.WaitVMState(id, state, timeout)
+		if err != nil {
+			return fmt.Errorf("VM '%s' not %s after %v: %s", id, strings.ToLower(state.String()), timeout, err.Error())
+		}
+	}
+	return nil
+}
+
+//CheckNode collects the health of the node identified by id, whose services answer on healthURL when healthy
+func CheckNode(svc *providers.Service, id string, nodeType NodeType.Enum, healthURL string) clusterapi.NodeHealth {
+	return CheckNodeCommand(svc, id, nodeType, fmt.Sprintf("curl -sfk -o /dev/null %s", healthURL))
+}
+
+//CheckNodeCommand collects the health of the node identified by id, whose services are healthy when command succeeds as root
+func CheckNodeCommand(svc *providers.Service, id string, nodeType NodeType.Enum, command string) clusterapi.NodeHealth {
+	health := clusterapi.NodeHealth{
+		ID:    id,
+		Type:  nodeType,
+		State: NodeState.Disabled,
+	}
+	vm, err := GetVM(id)
+	if err != nil {
+		health.Message = err.Error()
+		return health
+	}
+	health.Name = vm.Name
+	switch vm.State {
+	case pb.VMState_STARTED:
+	case pb.VMState_STOPPED:
+		health.State = NodeState.Stopped
+		return health
+	default:
+		health.Message = fmt.Sprintf("VM is %s", strings.ToLower(vm.State.String()))
+		return health
+	}
+
+	ssh, err := svc.GetSSHConfig(id)
+	if err != nil {
+		health.Message = fmt.Sprintf("failed to read SSH config: %s", err.Error())
+		return health
+	}
+	cmd, err := ssh.SudoCommand(command)
+	if err == nil {
+		err = cmd.Run()
+	}
+	if err != nil {
+		health.Message = fmt.Sprintf("'%s' failed: %s", command, err.Error())
+		return health
+	}
+	health.State = NodeState.Started
+	return health
+}
+
+//GetVMs returns the VMs identified by ids
+func GetVMs(ids []string) ([]*pb.VM, error) {
+	var vms []*pb.VM
+	for _, id := range ids {
+		vm, err := GetVM(id)
+		if err != nil {
+			return nil, err
+		}
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+//IndexOf returns the index of id in ids, -1 if ids doesn't contain id
+func IndexOf(ids []string, id string) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
+
+//DeleteNodes deletes the VMs identified by ids from the last one, removing them and their ips from the definition
+//The definition is saved with write after each deletion, so a failed deletion can be retried
+func DeleteNodes(ids *[]string, ips *[]string, write func() error) error {
+	for len(*ids) > 0 {
+		last := len(*ids) - 1
+		err := DeleteVMIfExists((*ids)[last])
+		if err != nil {
+			return err
+		}
+		*ids = (*ids)[:last]
+		if len(*ips) > last {
+			*ips = (*ips)[:last]
+		}
+		err = write()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//RegisterNode adds the new node, whose VM is identified by id, to the IDs ids and its IP ip to the IPs ips of its nodes,
+//then saves the definition with write
+//The node is removed and its VM deleted if the definition can't be saved
+func RegisterNode(id string, ip string, ids *[]string, ips *[]string, write func() error) error {
+	*ids = append(*ids, id)
+	*ips = append(*ips, ip)
+	err := write()
+	if err != nil {
+		*ids = (*ids)[:len(*ids)-1]
+		*ips = (*ips)[:len(*ips)-1]
+		DeleteVM(id)
+		return fmt.Errorf("failed to update Cluster definition: %s", err.Error())
+	}
+	return nil
+}
+
+//AdoptOrCreateVM returns the VM named req.Name if it exists, created before the interruption of an operation on the cluster
+//and not registered in its definition yet, or creates it
+//The names of the nodes are given by their index in the definition, a resumed operation creates the same names again
+func AdoptOrCreateVM(req *pb.VMDefinition) (*pb.VM, error) {
+	vm, err := GetVM(req.Name)
+	if err == nil {
+		log.Printf("Adopting VM '%s' created before an interruption", req.Name)
+		return vm, nil
+	}
+	if !strings.Contains(err.Error(), "does not exists") {
+		return nil, err
+	}
+	return CreateVM(req)
+}
+
+//DeleteVMIfExists deletes the VM identified by id, a VM already deleted is not an error
+func DeleteVMIfExists(id string) error {
+	err := DeleteVM(id)
+	if err != nil && !strings.Contains(err.Error(), "does not exists") {
+		return fmt.Errorf("failed to delete VM '%s': %s", id, err.Error())
+	}
+	return nil
+}
+
+//ParseLoad reads the load printed by the load scripts of the flavors: a line 'PENDING <count>', then a line 'IDLE <address>' per idle node
+//addresses maps the addresses of the nodes which can be removed to their IDs, the other idle nodes are ignored
+func ParseLoad(output string, addresses map[string]string) (*clusterapi.Load, error) {
+	load := clusterapi.Load{PendingTasks: -1}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "PENDING":
+			count, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid count of pending tasks '%s'", fields[1])
+			}
+			load.PendingTasks = count
+		case "IDLE":
+			if id, ok := addresses[fields[1]]; ok {
+				load.IdleNodes = append(load.IdleNodes, id)
+			}
+		}
+	}
+	if load.PendingTasks < 0 {
+		return nil, fmt.Errorf("count of pending tasks not found in load report")
+	}
+	return &load, nil
+}
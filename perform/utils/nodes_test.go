@@ -0,0 +1,63 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IndexOf(t *testing.T) {
+	ids := []string{"vm1", "vm2", "vm3"}
+	assert.Equal(t, 0, IndexOf(ids, "vm1"))
+	assert.Equal(t, 2, IndexOf(ids, "vm3"))
+	assert.Equal(t, -1, IndexOf(ids, "vm4"))
+	assert.Equal(t, -1, IndexOf(nil, "vm1"))
+}
+
+func Test_RegisterNode(t *testing.T) {
+	ids := []string{"vm1"}
+	ips := []string{"10.0.0.1"}
+	var saved []string
+	err := RegisterNode("vm2", "10.0.0.2", &ids, &ips, func() error {
+		saved = append([]string{}, ids...)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm1", "vm2"}, ids)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, ips)
+	assert.Equal(t, ids, saved)
+}
+
+func Test_ParseLoad(t *testing.T) {
+	addresses := map[string]string{"10.0.0.2": "vm2", "10.0.0.3": "vm3"}
+	load, err := ParseLoad("PENDING 4\nIDLE 10.0.0.2\nIDLE 10.0.0.1\n\nIDLE 10.0.0.3\n", addresses)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, load.PendingTasks)
+	assert.Equal(t, []string{"vm2", "vm3"}, load.IdleNodes)
+
+	load, err = ParseLoad("Warning: no scheduler metrics yet\nPENDING 0\n", addresses)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, load.PendingTasks)
+	assert.Empty(t, load.IdleNodes)
+
+	_, err = ParseLoad("PENDING many\n", addresses)
+	assert.NotNil(t, err)
+	_, err = ParseLoad("IDLE 10.0.0.2\n", addresses)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	pb "github.com/CS-SI/SafeScale/perform/performpb"
+
+	google_protobuf "github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+)
+
+const (
+	performdAddress = "localhost:50052"
+	//PollingInterval is the time between two checks of the progress of an operation of performd
+	PollingInterval = 10 * time.Second
+)
+
+//GetPerformdConnection returns a connection to the GRPC server of performd
+func GetPerformdConnection() *grpc.ClientConn {
+	conn, err := grpc.Dial(performdAddress, grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	return conn
+}
+
+//CreateCluster starts the creation of the cluster described by the definition file content using performd
+func CreateCluster(file []byte, keepOnFailure bool) (*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.Create(ctx, &pb.ClusterDefinition{
+		File:          string(file),
+		KeepOnFailure: keepOnFailure,
+	})
+}
+
+//DeleteCluster starts the deletion of a cluster using performd
+func DeleteCluster(name string) (*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.Delete(ctx, &pb.ClusterName{Name: name})
+}
+
+//ListClusters lists the clusters using performd
+func ListClusters() ([]*pb.Cluster, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	list, err := service.List(ctx, &google_protobuf.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	return list.GetClusters(), nil
+}
+
+//InspectCluster returns the definition of a cluster using performd
+func InspectCluster(name string) (*pb.Cluster, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxVM)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.Inspect(ctx, &pb.ClusterName{Name: name})
+}
+
+//StartCluster starts the start of a cluster using performd
+func StartCluster(name string) (*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.Start(ctx, &pb.ClusterName{Name: name})
+}
+
+//StopCluster starts the stop of a cluster using performd
+func StopCluster(name string) (*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.Stop(ctx, &pb.ClusterName{Name: name})
+}
+
+//AddClusterNode starts the addition of an agent node to a cluster using performd
+func AddClusterNode(req *pb.NodeDefinition) (*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.AddNode(ctx, req)
+}
+
+//RemoveClusterNode starts the removal of an agent node from a cluster using performd
+func RemoveClusterNode(name string, node string) (*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.RemoveNode(ctx, &pb.NodeReference{Cluster: name, Node: node})
+}
+
+//SetClusterAutoScaling replaces the autoscaling configuration of a cluster using performd
+func SetClusterAutoScaling(name string, autoScaling *pb.AutoScaling) (*pb.Cluster, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.SetAutoScaling(ctx, &pb.AutoScalingDefinition{Cluster: name, AutoScaling: autoScaling})
+}
+
+//GetOperation returns the progress of an operation of performd
+func GetOperation(id string) (*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	return service.GetOperation(ctx, &pb.OperationID{ID: id})
+}
+
+//ListOperations lists the operations started since performd started
+func ListOperations() ([]*pb.Operation, error) {
+	conn := GetPerformdConnection()
+	defer conn.Close()
+	ctx, cancel := GetContext(TimeoutCtxDefault)
+	defer cancel()
+	service := pb.NewClusterServiceClient(conn)
+	list, err := service.ListOperations(ctx, &google_protobuf.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	return list.GetOperations(), nil
+}
+
+//WaitOperation waits the end of an operation of performd, failing if the operation didn't succeed
+func WaitOperation(id string) (*pb.Operation, error) {
+	for {
+		op, err := GetOperation(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.GetState() {
+		case pb.OperationState_RUNNING:
+			time.Sleep(PollingInterval)
+		case pb.OperationState_DONE:
+			return op, nil
+		default:
+			return op, fmt.Errorf("operation '%s' %s: %s", id, op.GetState().String(), op.GetError())
+		}
+	}
+}
@@ -17,6 +17,8 @@
 package utils
 
 import (
+	"fmt"
+
 	"github.com/CS-SI/SafeScale/providers"
 
 	_ "github.com/CS-SI/SafeScale/providers/cloudwatt"      // Imported to initialise tenants
@@ -36,3 +38,31 @@ func GetProviderService() (*providers.Service, error) {
 	}
 	return svc, nil
 }
+
+//IsVolumeAttached tells if the volume named name is attached to the VM identified by vmID
+func IsVolumeAttached(name string, vmID string) (bool, error) {
+	svc, err := GetProviderService()
+	if err != nil {
+		return false, err
+	}
+	volumes, err := svc.ListVolumes()
+	if err != nil {
+		return false, err
+	}
+	for _, v := range volumes {
+		if v.Name != name {
+			continue
+		}
+		attachments, err := svc.ListVolumeAttachments(vmID)
+		if err != nil {
+			return false, err
+		}
+		for _, a := range attachments {
+			if a.VolumeID == v.ID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("volume '%s' not found", name)
+}
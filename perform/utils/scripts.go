@@ -0,0 +1,159 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	rice "github.com/GeertJohan/go.rice"
+)
+
+//ScriptBox gives the script templates of a flavor, found in a rice box
+//The templates of the flavors installing common components include them with IncludeInstallCommons
+type ScriptBox struct {
+	find        func() (*rice.Box, error)
+	commons     string
+	commonsData map[string]interface{}
+
+	lock           sync.Mutex
+	box            *rice.Box
+	installCommons *string
+}
+
+//NewScriptBox creates the ScriptBox of the rice box returned by find, whose template commons, realized with commonsData,
+//installs the common components, if not empty
+//The box is found by the flavor, the rice tool only embedding the boxes found with a literal path in their package
+func NewScriptBox(find func() (*rice.Box, error), commons string, commonsData map[string]interface{}) *ScriptBox {
+	return &ScriptBox{
+		find:        find,
+		commons:     commons,
+		commonsData: commonsData,
+	}
+}
+
+//Box returns the rice box of the script templates
+func (sb *ScriptBox) Box() (*rice.Box, error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	if sb.box == nil {
+		b, err := sb.find()
+		if err != nil {
+			return nil, err
+		}
+		sb.box = b
+	}
+	return sb.box, nil
+}
+
+//InstallCommons returns the script installing the common components, realized once
+func (sb *ScriptBox) InstallCommons() (string, error) {
+	b, err := sb.Box()
+	if err != nil {
+		return "", err
+	}
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	if sb.installCommons == nil {
+		result, err := RealizeScript(b, sb.commons, sb.commonsData)
+		if err != nil {
+			return "", err
+		}
+		sb.installCommons = &result
+	}
+	return *sb.installCommons, nil
+}
+
+//Execute executes the script template with the parameters on the VM identified by targetID
+func (sb *ScriptBox) Execute(targetID string, script string, data map[string]interface{}) (int, *string, error) {
+	b, err := sb.Box()
+	if err != nil {
+		return 0, nil, err
+	}
+	if sb.commons != "" {
+		installCommons, err := sb.InstallCommons()
+		if err != nil {
+			return 0, nil, err
+		}
+		data["IncludeInstallCommons"] = installCommons
+	}
+	return ExecuteScript(b, targetID, script, data)
+}
+
+//RealizeScript realizes the script template of the rice box b with the parameters
+func RealizeScript(b *rice.Box, script string, data map[string]interface{}) (string, error) {
+	// get file contents as string
+	tmplString, err := b.String(script)
+	if err != nil {
+		return "", fmt.Errorf("failed to load script template: %s", err.Error())
+	}
+	// parse and execute the template
+	tmplCmd, err := template.New("cmd").Parse(tmplString)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse script template: %s", err.Error())
+	}
+
+	dataBuffer := bytes.NewBufferString("")
+	err = tmplCmd.Execute(dataBuffer, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to realize script template: %s", err.Error())
+	}
+	return dataBuffer.String(), nil
+}
+
+//ExecuteScript executes the script template of the rice box b with the parameters on the VM identified by targetID
+//Returns the exit code of the script and its output
+func ExecuteScript(b *rice.Box, targetID string, script string, data map[string]interface{}) (int, *string, error) {
+	svc, err := GetProviderService()
+	if err != nil {
+		return 0, nil, err
+	}
+	ssh, err := svc.GetSSHConfig(targetID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read SSH config: %s", err.Error())
+	}
+	ssh.WaitServerReady(60 * time.Second)
+
+	cmd, err := RealizeScript(b, script, data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	cmdResult, err := ssh.SudoCommand(cmd)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to execute script '%s': %s", script, err.Error())
+	}
+	retcode := 0
+	out, err := cmdResult.CombinedOutput()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			if status, ok := ee.Sys().(syscall.WaitStatus); ok {
+				retcode = status.ExitStatus()
+			}
+		} else {
+			return 0, nil, fmt.Errorf("failed to fetch output of script '%s': %s", script, err.Error())
+		}
+	}
+
+	strOut := string(out)
+	return retcode, &strOut, nil
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+//Package GatewayMode defines an enum to represents the way the egress traffic of a network is routed
+package GatewayMode
+
+//go:generate stringer -type=Enum
+
+//Enum represents the way the egress traffic of a network is routed
+type Enum int
+
+const (
+
+	//VM the egress traffic is routed by gateway VMs, also used as SSH bastions
+	VM Enum = iota
+	//ROUTER the egress traffic is routed by the router or NAT gateway of the provider
+	ROUTER
+	//NONE the network has no egress
+	NONE
+)
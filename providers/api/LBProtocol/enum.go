@@ -0,0 +1,33 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+//Package LBProtocol defines an enum to represents the protocol of the traffic balanced by a load balancer
+package LBProtocol
+
+//go:generate stringer -type=Enum
+
+//Enum represents the protocol of the traffic balanced by a load balancer
+type Enum int
+
+const (
+
+	//TCP the traffic is balanced per TCP connection
+	TCP Enum = iota
+	//HTTP the traffic is balanced per HTTP request
+	HTTP
+	//HTTPS the TLS traffic is passed through to the backends, which hold the certificates
+	HTTPS
+)
@@ -19,11 +19,16 @@ package api
 import (
 	"fmt"
 	"io"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	// "github.com/CS-SI/SafeScale/system"
 
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
+	"github.com/CS-SI/SafeScale/providers/api/LBProtocol"
 	"github.com/CS-SI/SafeScale/providers/api/VMState"
 	"github.com/CS-SI/SafeScale/providers/api/VolumeSpeed"
 	"github.com/CS-SI/SafeScale/providers/api/VolumeState"
@@ -54,6 +59,31 @@ const (
 	VMContainerName = "0.vm"
 	// NasContainerName is the tecnical name of the container used to store nas info
 	NasContainerName = "0.nas"
+	// VolumeContainerName is the tecnical name of the container used to store volume attachments info
+	VolumeContainerName = "0.vol"
+	// MountContainerName is the tecnical name of the container used to store container mounts info
+	MountContainerName = "0.mnt"
+	// PublicIPContainerName is the tecnical name of the container used to store reserved public IPs info
+	PublicIPContainerName = "0.ip"
+	// LoadBalancerContainerName is the tecnical name of the container used to store load balancers info
+	LoadBalancerContainerName = "0.lb"
+	// DNSContainerName is the tecnical name of the container used to store the private DNS zones of the networks
+	DNSContainerName = "0.dns"
+	// VPNContainerName is the tecnical name of the container used to store the VPNs of the networks
+	VPNContainerName = "0.vpn"
+	// CIDRContainerName is the tecnical name of the container used to store the CIDRs reserved by the networks
+	CIDRContainerName = "0.cidr"
+)
+
+const (
+	//MultipartThreshold is the size above which an object is automatically uploaded in parts
+	MultipartThreshold int64 = 1024 * 1024 * 1024
+	//DefaultPartSize is the size of the parts of an object uploaded in parts
+	DefaultPartSize int64 = 100 * 1024 * 1024
+	//MaxParts is the maximum number of parts of an object uploaded in parts with the S3 API
+	MaxParts = 10000
+	//MaxSLOSegments is the default maximum number of segments of a Swift static large object (max_manifest_segments)
+	MaxSLOSegments = 1000
 )
 
 //TimeoutError defines a Timeout error
@@ -65,6 +95,15 @@ func (e *TimeoutError) Error() string {
 	return e.Message
 }
 
+//NotAvailableError defines the error returned when the provider does not offer a service
+type NotAvailableError struct {
+	Message string
+}
+
+func (e *NotAvailableError) Error() string {
+	return e.Message
+}
+
 //KeyPair represents a SSH key pair
 type KeyPair struct {
 	ID         string `json:"id,omitempty"`
@@ -106,6 +145,9 @@ type VM struct {
 	State        VMState.Enum `json:"state,omitempty"`
 	PrivateKey   string       `json:"private_key,omitempty"`
 	GatewayID    string       `json:"gateway_id,omitempty"`
+	//GatewayIDs are the IDs of all the gateways of the network of the VM, used to fail over when
+	//the gateway identified by GatewayID is not reachable
+	GatewayIDs []string `json:"gateway_ids,omitempty"`
 }
 
 //GetAccessIP computes access IP of the VM
@@ -114,20 +156,31 @@ func (vm *VM) GetAccessIP() string {
 	if ip == "" {
 		ip = vm.AccessIPv6
 	}
-	if ip == "" {
-		if len(vm.PrivateIPsV4) > 0 {
-			ip = vm.PrivateIPsV4[0]
-		} else {
-			ip = vm.PrivateIPsV6[0]
-		}
+	if ip == "" && len(vm.PrivateIPsV4) > 0 {
+		ip = vm.PrivateIPsV4[0]
+	}
+	if ip == "" && len(vm.PrivateIPsV6) > 0 {
+		ip = vm.PrivateIPsV6[0]
 	}
 	return ip
 }
 
+//GetPrivateIP returns the IP of the VM in its first network, the IPv4 one if the network is dual-stack
+func (vm *VM) GetPrivateIP() string {
+	if len(vm.PrivateIPsV4) > 0 {
+		return vm.PrivateIPsV4[0]
+	}
+	if len(vm.PrivateIPsV6) > 0 {
+		return vm.PrivateIPsV6[0]
+	}
+	return ""
+}
+
 //VMRequest represents requirements to create virtual machine properties
 type VMRequest struct {
 	Name string `json:"name,omitempty"`
 	//NetworksIDs list of the network IDs the VM must be connected
+	//The first network provides the default route and the gateway of a private VM
 	NetworkIDs []string `json:"network_i_ds,omitempty"`
 	//PublicIP a flg telling if the VM must have a public IP is
 	PublicIP bool `json:"public_ip,omitempty"`
@@ -146,6 +199,123 @@ type GWRequest struct {
 	//ImageID  is the UUID of the image that contains the server's OS and initial state.
 	ImageID string   `json:"image_id,omitempty"`
 	KeyPair *KeyPair `json:"key_pair,omitempty"`
+	//HA if true a pair of gateways sharing a virtual IP with VRRP is created
+	HA bool `json:"ha,omitempty"`
+	//Mode is the way the egress traffic of the network is routed (see GatewayMode)
+	//If Mode is not GatewayMode.VM, no gateway VM is created
+	Mode GatewayMode.Enum `json:"mode,omitempty"`
+	//Bastion if true and Mode is not GatewayMode.VM, a public VM is created to reach the VMs of the network with SSH
+	Bastion bool `json:"bastion,omitempty"`
+}
+
+//Gateway represents the VMs acting as gateway of a network
+type Gateway struct {
+	NetworkID string `json:"network_id,omitempty"`
+	//Mode is the way the egress traffic of the network is routed (see GatewayMode)
+	Mode GatewayMode.Enum `json:"mode,omitempty"`
+	//VMIDs are the IDs of the gateway VMs, the first one being the VRRP master
+	//If Mode is not GatewayMode.VM, VMIDs contains the ID of the bastion of the network if any
+	VMIDs []string `json:"vm_ids,omitempty"`
+	//VIP is the virtual IP shared by the gateways in high availability
+	VIP string `json:"vip,omitempty"`
+	//VIPPortID is the ID of the port reserving the virtual IP in the network
+	VIPPortID string `json:"vip_port_id,omitempty"`
+}
+
+//NetworkPeering represents the routing of the traffic between two networks
+type NetworkPeering struct {
+	//ID is the ID of the provider resource routing the traffic between the networks
+	ID         string   `json:"id,omitempty"`
+	NetworkIDs []string `json:"network_ids,omitempty"`
+	//NextHops maps the ID of each network to the IP, in this network, routing the traffic to the other network
+	//NextHops is empty if the provider routes the traffic between the networks without any route on the VMs
+	NextHops map[string]string `json:"next_hops,omitempty"`
+}
+
+//PublicIP represents a public IP which can be moved from a VM to another
+type PublicIP struct {
+	ID string `json:"id,omitempty"`
+	IP string `json:"ip,omitempty"`
+	//VMID is the ID of the VM the public IP is attached to, empty if the public IP is not attached
+	VMID string `json:"vm_id,omitempty"`
+}
+
+//LoadBalancerRequest represents load balancer requirements to create a load balancer
+type LoadBalancerRequest struct {
+	Name      string `json:"name,omitempty"`
+	NetworkID string `json:"network_id,omitempty"`
+	//Protocol is the protocol of the traffic balanced, HTTPS traffic is passed through to the backends
+	Protocol LBProtocol.Enum `json:"protocol,omitempty"`
+	//Port is the port on which the load balancer receives the traffic
+	Port int `json:"port,omitempty"`
+	//BackendPort is the port on which the backends receive the traffic, Port if 0
+	BackendPort int `json:"backend_port,omitempty"`
+	//HealthCheckPath is the path of the HTTP health check of the backends, the health check only opens a TCP connection if empty
+	HealthCheckPath string `json:"health_check_path,omitempty"`
+}
+
+//LoadBalancer represents a load balancer distributing the traffic among VMs of a network
+type LoadBalancer struct {
+	ID              string          `json:"id,omitempty"`
+	Name            string          `json:"name,omitempty"`
+	NetworkID       string          `json:"network_id,omitempty"`
+	Protocol        LBProtocol.Enum `json:"protocol,omitempty"`
+	Port            int             `json:"port,omitempty"`
+	BackendPort     int             `json:"backend_port,omitempty"`
+	HealthCheckPath string          `json:"health_check_path,omitempty"`
+	//VIP is the IP on which the load balancer receives the traffic
+	VIP string `json:"vip,omitempty"`
+	//Backends maps the IDs of the VMs receiving the traffic to their IP in the network
+	Backends map[string]string `json:"backends,omitempty"`
+	//GatewayVMIDs are the IDs of the gateway VMs running HAProxy, empty if the load balancer is provided by the provider
+	GatewayVMIDs []string `json:"gateway_vm_ids,omitempty"`
+}
+
+//DNSRecord represents a record of the private DNS zone of a network
+type DNSRecord struct {
+	//Name is the name of the record in the zone, without the domain of the zone
+	Name string `json:"name,omitempty"`
+	//Type is the type of the record: A, AAAA or CNAME
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value,omitempty"`
+	//VMID is the ID of the VM the record has been created for, empty for the records added by users
+	VMID string `json:"vm_id,omitempty"`
+}
+
+//DNSZone represents the private DNS zone of a network
+type DNSZone struct {
+	//ID is the ID of the zone in the DNS service of the provider, empty if the zone is served by the gateways
+	ID        string `json:"id,omitempty"`
+	NetworkID string `json:"network_id,omitempty"`
+	Domain    string `json:"domain,omitempty"`
+	//Nameservers are the IPs of the servers resolving the zone, empty if the resolvers of the network already resolve it
+	Nameservers []string    `json:"nameservers,omitempty"`
+	Records     []DNSRecord `json:"records,omitempty"`
+	//GatewayVMIDs are the IDs of the gateway VMs running dnsmasq, empty if the zone is served by the provider
+	GatewayVMIDs []string `json:"gateway_vm_ids,omitempty"`
+}
+
+//VPN represents the WireGuard VPN giving access to a network from workstations
+type VPN struct {
+	NetworkID string `json:"network_id,omitempty"`
+	//GatewayVMID is the ID of the gateway VM running WireGuard
+	GatewayVMID string `json:"gateway_vm_id,omitempty"`
+	//Endpoint is the public address, IP:port, the peers connect to
+	Endpoint string `json:"endpoint,omitempty"`
+	//CIDR is the network of the IPs of the gateway and the peers in the VPN
+	CIDR       string    `json:"cidr,omitempty"`
+	PrivateKey string    `json:"private_key,omitempty"`
+	PublicKey  string    `json:"public_key,omitempty"`
+	Peers      []VPNPeer `json:"peers,omitempty"`
+}
+
+//VPNPeer represents a workstation of a user connected to a VPN
+type VPNPeer struct {
+	User string `json:"user,omitempty"`
+	//IP is the IP of the peer in the VPN
+	IP         string `json:"ip,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
 }
 
 //Volume represents a block volume
@@ -171,6 +341,12 @@ type VolumeAttachment struct {
 	VolumeID string `json:"volume,omitempty"`
 	ServerID string `json:"vm,omitempty"`
 	Device   string `json:"device,omitempty"`
+	//MountPoint is the path where the volume is mounted on the VM
+	MountPoint string `json:"mount_point,omitempty"`
+	//Format is the filesystem of the volume (ext4, xfs, btrfs)
+	Format string `json:"format,omitempty"`
+	//MountOptions are the options used to mount the filesystem
+	MountOptions string `json:"mount_options,omitempty"`
 }
 
 //VolumeAttachmentRequest represents a volume attachment request
@@ -202,6 +378,18 @@ type ContainerInfo struct {
 	NbItems    int    `json:"nbitems,omitempty"`
 }
 
+//ObjectStorageCredentials represents credentials giving access to the object storage only,
+//used to avoid spreading the account password on VMs
+type ObjectStorageCredentials struct {
+	//ID identifies the credentials to be able to revoke them
+	ID string `json:"id,omitempty"`
+	//Endpoint is the URL of the S3 compatible endpoint of the object storage
+	Endpoint  string `json:"endpoint,omitempty"`
+	Region    string `json:"region,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+}
+
 /*
 //RouterRequest represents a router request
 type RouterRequest struct {
@@ -227,10 +415,39 @@ type Network struct {
 	IPVersion IPVersion.Enum `json:"ip_version,omitempty"`
 	//Mask mask in CIDR notation
 	CIDR string `json:"mask,omitempty"`
+	//IPv6CIDR is the IPv6 mask of a dual-stack network, empty for a single stack network
+	IPv6CIDR string `json:"ipv6_mask,omitempty"`
 	// //Gateway network gateway
 	// GatewayID string
 }
 
+//SecurityRule represents a rule of the security groups protecting the VMs of a network
+type SecurityRule struct {
+	//Direction is "ingress" or "egress"
+	Direction string `json:"direction,omitempty"`
+	//Protocol is the IP protocol of the traffic, empty for any protocol
+	Protocol string `json:"protocol,omitempty"`
+	//PortFrom and PortTo are the range of ports allowed, 0 or -1 for any port
+	PortFrom int `json:"port_from,omitempty"`
+	PortTo   int `json:"port_to,omitempty"`
+	//CIDR is the range of remote addresses allowed, empty if the rule allows the VMs protected by the same security group
+	CIDR string `json:"cidr,omitempty"`
+}
+
+//NetworkTopology represents a network with the VMs and services attached to it
+type NetworkTopology struct {
+	Network Network `json:"network,omitempty"`
+	//Gateway is nil if the network has no gateway
+	Gateway *Gateway `json:"gateway,omitempty"`
+	//GatewayVMs are the gateway VMs of the network, or its bastion
+	GatewayVMs []VM `json:"gateway_vms,omitempty"`
+	//VMs are the other VMs having an IP in the network
+	VMs []VM `json:"vms,omitempty"`
+	//Nas are the NAS servers and clients running on the VMs of the network
+	Nas           []Nas          `json:"nas,omitempty"`
+	SecurityRules []SecurityRule `json:"security_rules,omitempty"`
+}
+
 /*
 //Subnet represents a sub network where Mask is defined in CIDR notation
 //like "192.0.2.0/24" or "2001:db8::/32", as defined in RFC 4632 and RFC 4291.
@@ -254,6 +471,10 @@ type NetworkRequest struct {
 	IPVersion IPVersion.Enum `json:"ip_version,omitempty"`
 	//CIDR mask
 	CIDR string `json:"cidr,omitempty"`
+	//IPv6CIDR is the IPv6 mask of the network if IPVersion is IPv4 and the network is dual-stack
+	IPv6CIDR string `json:"ipv6_cidr,omitempty"`
+	//GatewayMode is the way the egress traffic of the network is routed (see GatewayMode)
+	GatewayMode GatewayMode.Enum `json:"gateway_mode,omitempty"`
 }
 
 //Object object to put in a container
@@ -268,6 +489,41 @@ type Object struct {
 	ContentLength int64             `json:"content_length,omitempty"`
 }
 
+//streamedContent is the content of a downloaded object read as it is received, it can't be seeked
+type streamedContent struct {
+	io.ReadCloser
+}
+
+//Seek fails, a streamed content can't be seeked
+func (c streamedContent) Seek(offset int64, whence int) (int64, error) {
+	return 0, fmt.Errorf("streamed object content can't be seeked")
+}
+
+//StreamedContent returns body as the Content of a downloaded object, the object being streamed instead
+//of being loaded in memory
+func StreamedContent(body io.ReadCloser) io.ReadSeeker {
+	return streamedContent{body}
+}
+
+//UploadSession represents an upload of an object in parts, which can be resumed as long as it
+//is neither completed nor aborted
+type UploadSession struct {
+	ID        string            `json:"id,omitempty"`
+	Container string            `json:"container,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	PartSize  int64             `json:"part_size,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	DeleteAt  time.Time         `json:"delete_at,omitempty"`
+}
+
+//UploadPart represents a part of an object uploaded in an upload session
+type UploadPart struct {
+	//Number of the part, starting from 1
+	Number int    `json:"number,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	ETag   string `json:"etag,omitempty"`
+}
+
 //ObjectFilter filter object
 type ObjectFilter struct {
 	Prefix string `json:"prefix,omitempty"`
@@ -285,6 +541,7 @@ func NewRange(from, to int) Range {
 	return Range{&from, &to}
 }
 
+//String returns the range as in the Range header of HTTP, "-to" being the last to bytes
 func (r Range) String() string {
 	if r.From != nil && r.To != nil {
 		return fmt.Sprintf("%d-%d", *r.From, *r.To)
@@ -293,11 +550,54 @@ func (r Range) String() string {
 		return fmt.Sprintf("%d-", *r.From)
 	}
 	if r.To != nil {
-		return fmt.Sprintf("%d", *r.To)
+		return fmt.Sprintf("-%d", *r.To)
 	}
 	return ""
 }
 
+//ParseRange creates a range from its string representation ("from-to", "from-" or "-to" for the last to bytes)
+func ParseRange(s string) (Range, error) {
+	var r Range
+	parts := strings.SplitN(strings.TrimSpace(s), "-", 2)
+	if len(parts) != 2 {
+		return r, fmt.Errorf("Invalid range '%s'", s)
+	}
+	if parts[0] != "" {
+		v, err := strconv.Atoi(parts[0])
+		if err != nil || v < 0 {
+			return r, fmt.Errorf("Invalid range '%s'", s)
+		}
+		r.From = &v
+	}
+	if parts[1] != "" {
+		v, err := strconv.Atoi(parts[1])
+		if err != nil || v < 0 {
+			return r, fmt.Errorf("Invalid range '%s'", s)
+		}
+		r.To = &v
+	}
+	if r.From == nil && r.To == nil {
+		return r, fmt.Errorf("Invalid range '%s'", s)
+	}
+	if r.From != nil && r.To != nil && *r.To < *r.From {
+		return r, fmt.Errorf("Invalid range '%s'", s)
+	}
+	return r, nil
+}
+
+//CIDROverlap returns true if the networks defined by cidr1 and cidr2 share addresses
+func CIDROverlap(cidr1, cidr2 string) (bool, error) {
+	_, n1, err := net.ParseCIDR(cidr1)
+	if err != nil {
+		return false, err
+	}
+	_, n2, err := net.ParseCIDR(cidr2)
+	if err != nil {
+		return false, err
+	}
+	return n1.Contains(n2.IP) || n2.Contains(n1.IP), nil
+}
+
 //ClientAPI is an API defining an IaaS driver
 type ClientAPI interface {
 	Build(map[string]interface{}) (ClientAPI, error)
@@ -334,6 +634,16 @@ type ClientAPI interface {
 	CreateGateway(req GWRequest) error
 	//DeleteGateway delete the public gateway of a private network
 	DeleteGateway(networkID string) error
+	//GetGateway returns the gateway of the network identified by networkID
+	GetGateway(networkID string) (*Gateway, error)
+	//PeerNetworks routes the traffic between the networks identified by networkID1 and networkID2
+	PeerNetworks(networkID1, networkID2 string) (*NetworkPeering, error)
+	//ListNetworkPeerings lists the peerings of the network identified by networkID
+	ListNetworkPeerings(networkID string) ([]NetworkPeering, error)
+	//UnpeerNetworks stops routing the traffic between the networks identified by networkID1 and networkID2
+	UnpeerNetworks(networkID1, networkID2 string) error
+	//ListSecurityRules lists the rules of the security groups protecting the VMs of the network identified by networkID
+	ListSecurityRules(networkID string) ([]SecurityRule, error)
 
 	//CreateVM creates a VM that fulfils the request
 	CreateVM(request VMRequest) (*VM, error)
@@ -350,6 +660,40 @@ type ClientAPI interface {
 	//GetSSHConfig creates SSHConfig from VM
 	GetSSHConfig(id string) (*system.SSHConfig, error)
 
+	//CreatePublicIP reserves a public IP
+	CreatePublicIP() (*PublicIP, error)
+	//GetPublicIP returns the public IP identified by id
+	GetPublicIP(id string) (*PublicIP, error)
+	//ListPublicIPs lists the public IPs of the tenant
+	ListPublicIPs() ([]PublicIP, error)
+	//AttachPublicIP attaches the public IP identified by id to the VM identified by vmID
+	AttachPublicIP(id string, vmID string) error
+	//DetachPublicIP detaches the public IP identified by id from its VM
+	DetachPublicIP(id string) error
+	//DeletePublicIP releases the public IP identified by id
+	DeletePublicIP(id string) error
+
+	//CreateLoadBalancer creates a load balancer, returns a NotAvailableError if the provider does not offer load balancers
+	CreateLoadBalancer(req LoadBalancerRequest) (*LoadBalancer, error)
+	//GetLoadBalancer returns the load balancer identified by id
+	GetLoadBalancer(id string) (*LoadBalancer, error)
+	//AddLoadBalancerBackend adds the VM identified by vmID, receiving the traffic on ip:port, to the backends of the load balancer identified by id
+	AddLoadBalancerBackend(id string, vmID string, ip string, port int) error
+	//RemoveLoadBalancerBackend removes the VM identified by vmID from the backends of the load balancer identified by id
+	RemoveLoadBalancerBackend(id string, vmID string) error
+	//DeleteLoadBalancer deletes the load balancer identified by id
+	DeleteLoadBalancer(id string) error
+
+	//CreateDNSZone creates the private DNS zone domain of the network identified by networkID
+	//Returns a NotAvailableError if the provider does not offer a DNS service
+	CreateDNSZone(networkID string, domain string) (*DNSZone, error)
+	//AddDNSRecord adds record to the DNS zone identified by zoneID
+	AddDNSRecord(zoneID string, record DNSRecord) error
+	//RemoveDNSRecord removes record from the DNS zone identified by zoneID
+	RemoveDNSRecord(zoneID string, record DNSRecord) error
+	//DeleteDNSZone deletes the DNS zone identified by zoneID with its records
+	DeleteDNSZone(zoneID string) error
+
 	//CreateVolume creates a block volume
 	//- name is the name of the volume
 	//- size is the size of the volume in GB
@@ -361,6 +705,10 @@ type ClientAPI interface {
 	ListVolumes() ([]Volume, error)
 	//DeleteVolume deletes the volume identified by id
 	DeleteVolume(id string) error
+	//ExtendVolume extends the volume identified by id to size GB
+	ExtendVolume(id string, size int) error
+	//RetypeVolume changes the speed of the volume identified by id, if the provider allows it
+	RetypeVolume(id string, speed VolumeSpeed.Enum) error
 
 	//CreateVolumeAttachment attaches a volume to a VM
 	//- name the name of the volume attachment
@@ -398,6 +746,22 @@ type ClientAPI interface {
 	//DeleteObject delete an object from a container
 	DeleteObject(container, object string) error
 
+	//CreateUploadSession starts the upload in parts of obj, obj content is ignored
+	CreateUploadSession(container string, obj Object) (*UploadSession, error)
+	//UploadPart uploads the part number of an upload session, content is read until size bytes
+	UploadPart(session UploadSession, number int, content io.ReadSeeker, size int64) (*UploadPart, error)
+	//ListUploadParts lists the parts already uploaded in an upload session
+	ListUploadParts(session UploadSession) ([]UploadPart, error)
+	//CompleteUploadSession assembles the parts of an upload session into the final object
+	CompleteUploadSession(session UploadSession, parts []UploadPart) error
+	//AbortUploadSession cancels an upload session and deletes the parts already uploaded
+	AbortUploadSession(session UploadSession) error
+
+	//CreateObjectStorageCredentials creates S3 credentials giving access to the container, restricted to it if the provider can
+	CreateObjectStorageCredentials(container string) (*ObjectStorageCredentials, error)
+	//DeleteObjectStorageCredentials revokes the object storage credentials identified by id
+	DeleteObjectStorageCredentials(id string) error
+
 	//GetAuthOpts returns authentification options as a Config
 	GetAuthOpts() (Config, error)
 	//GetCfgOpts returns configuration options as a Config
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CS-SI/SafeScale/providers/api"
+)
+
+func Test_GetAccessIP(t *testing.T) {
+	vm := api.VM{}
+	assert.Equal(t, "", vm.GetAccessIP())
+	vm.PrivateIPsV6 = []string{"fd00::5"}
+	assert.Equal(t, "fd00::5", vm.GetAccessIP())
+	vm.PrivateIPsV4 = []string{"192.168.0.5"}
+	assert.Equal(t, "192.168.0.5", vm.GetAccessIP())
+	vm.AccessIPv6 = "2001:db8::5"
+	assert.Equal(t, "2001:db8::5", vm.GetAccessIP())
+	vm.AccessIPv4 = "203.0.113.5"
+	assert.Equal(t, "203.0.113.5", vm.GetAccessIP())
+}
+
+func Test_CIDROverlap(t *testing.T) {
+	tests := []struct {
+		cidr1   string
+		cidr2   string
+		overlap bool
+		err     bool
+	}{
+		{cidr1: "192.168.0.0/16", cidr2: "192.168.12.0/24", overlap: true},
+		{cidr1: "192.168.12.0/24", cidr2: "192.168.0.0/16", overlap: true},
+		{cidr1: "192.168.1.0/24", cidr2: "192.168.1.0/24", overlap: true},
+		{cidr1: "192.168.1.7/24", cidr2: "192.168.1.128/25", overlap: true},
+		{cidr1: "192.168.0.0/24", cidr2: "192.168.1.0/24", overlap: false},
+		{cidr1: "10.0.0.0/8", cidr2: "192.168.0.0/16", overlap: false},
+		{cidr1: "fd00::/48", cidr2: "fd00:0:0:1::/64", overlap: true},
+		{cidr1: "192.168.0.0/16", cidr2: "fd00::/48", overlap: false},
+		{cidr1: "192.168.0.0", cidr2: "192.168.1.0/24", err: true},
+		{cidr1: "192.168.1.0/24", cidr2: "", err: true},
+	}
+	for _, tt := range tests {
+		overlap, err := api.CIDROverlap(tt.cidr1, tt.cidr2)
+		if tt.err {
+			assert.NotNil(t, err, tt.cidr1+" "+tt.cidr2)
+			continue
+		}
+		assert.Nil(t, err, tt.cidr1+" "+tt.cidr2)
+		assert.Equal(t, tt.overlap, overlap, tt.cidr1+" "+tt.cidr2)
+	}
+}
+
+func Test_ParseRange(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err bool
+	}{
+		{in: "0-99", out: "0-99"},
+		{in: " 10-20 ", out: "10-20"},
+		{in: "100-", out: "100-"},
+		{in: "-500", out: "-500"},
+		{in: "100", err: true},
+		{in: "-", err: true},
+		{in: "", err: true},
+		{in: "a-b", err: true},
+		{in: "20-10", err: true},
+		{in: "1-2-3", err: true},
+	}
+	for _, tt := range tests {
+		r, err := api.ParseRange(tt.in)
+		if tt.err {
+			assert.NotNil(t, err, tt.in)
+			continue
+		}
+		assert.Nil(t, err, tt.in)
+		assert.Equal(t, tt.out, r.String(), tt.in)
+	}
+}
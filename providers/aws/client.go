@@ -24,6 +24,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
@@ -34,10 +36,12 @@ import (
 
 	"github.com/CS-SI/SafeScale/providers/api/VolumeSpeed"
 
+	"github.com/CS-SI/SafeScale/providers/api/LBProtocol"
 	"github.com/CS-SI/SafeScale/providers/api/VMState"
 	rice "github.com/GeertJohan/go.rice"
 
 	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/aws/s3"
 	"github.com/CS-SI/SafeScale/system"
 
@@ -46,7 +50,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/route53"
 	awss3 "github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -74,6 +81,12 @@ type AuthOpts struct {
 	//Config *Config
 }
 
+//CfgOpts AWS configuration options
+type CfgOpts struct {
+	//NetworkCIDRPool is the network the CIDRs of the networks created without CIDR are allocated from (optional)
+	NetworkCIDRPool string
+}
+
 // Retrieve returns nil if it successfully retrieved the value.
 // Error is returned if the value were not obtainable, or empty.
 func (o AuthOpts) Retrieve() (credentials.Value, error) {
@@ -121,6 +134,8 @@ func AuthenticatedClient(opts AuthOpts) (*Client, error) {
 	c := Client{
 		Session:     s,
 		EC2:         ec2.New(s),
+		ELB:         elbv2.New(s),
+		Route53:     route53.New(s),
 		Pricing:     pricing.New(sPricing),
 		AuthOpts:    opts,
 		UserDataTpl: tpl,
@@ -147,20 +162,50 @@ func (c *Client) Build(params map[string]interface{}) (api.ClientAPI, error) {
 	AccessKeyID, _ := params["AccessKeyID"].(string)
 	SecretAccessKey, _ := params["SecretAccessKey"].(string)
 	Region, _ := params["Region"].(string)
-	return AuthenticatedClient(AuthOpts{
+	NetworkCIDRPool, _ := params["NetworkCIDRPool"].(string)
+	client, err := AuthenticatedClient(AuthOpts{
 		AccessKeyID:     AccessKeyID,
 		SecretAccessKey: SecretAccessKey,
 		Region:          Region,
 	})
+	if err != nil {
+		return nil, err
+	}
+	client.Cfg = CfgOpts{
+		NetworkCIDRPool: NetworkCIDRPool,
+	}
+	return client, nil
+}
+
+//GetAuthOpts returns the auth options
+func (c *Client) GetAuthOpts() (api.Config, error) {
+	cfg := api.ConfigMap{}
 
+	cfg.Set("AccessKeyID", c.AuthOpts.AccessKeyID)
+	cfg.Set("SecretAccessKey", c.AuthOpts.SecretAccessKey)
+	cfg.Set("Region", c.AuthOpts.Region)
+
+	return cfg, nil
+}
+
+//GetCfgOpts return configuration parameters
+func (c *Client) GetCfgOpts() (api.Config, error) {
+	cfg := api.ConfigMap{}
+
+	cfg.Set("NetworkCIDRPool", c.Cfg.NetworkCIDRPool)
+
+	return cfg, nil
 }
 
 //Client a AWS provider client
 type Client struct {
 	Session     *session.Session
 	EC2         *ec2.EC2
+	ELB         *elbv2.ELBV2
+	Route53     *route53.Route53
 	Pricing     *pricing.Pricing
 	AuthOpts    AuthOpts
+	Cfg         CfgOpts
 	UserDataTpl *template.Template
 	//ImageOwners []string
 }
@@ -632,12 +677,24 @@ func (c *Client) removeNetwork(netID string) error {
 
 //CreateNetwork creates a network
 func (c *Client) CreateNetwork(req api.NetworkRequest) (*api.Network, error) {
+	// The IPv6 CIDR of a VPC is allocated by AWS
+	if req.IPv6CIDR != "" {
+		return nil, fmt.Errorf("Error creating network %s: custom IPv6 CIDRs are not supported by AWS", req.Name)
+	}
 	vpcOut, err := c.EC2.CreateVpc(&ec2.CreateVpcInput{
 		CidrBlock: aws.String(req.CIDR),
 	})
 	if err != nil {
 		return nil, err
 	}
+	if req.GatewayMode != GatewayMode.VM {
+		net, err := c.createNetworkWithoutGateway(req, vpcOut.Vpc.VpcId)
+		if err != nil {
+			c.DeleteNetwork(*vpcOut.Vpc.VpcId)
+			return nil, wrapError("Error creating network", err)
+		}
+		return net, nil
+	}
 	sn, err := c.EC2.CreateSubnet(&ec2.CreateSubnetInput{
 		CidrBlock: aws.String(req.CIDR),
 		VpcId:     vpcOut.Vpc.VpcId,
@@ -718,6 +775,207 @@ func (c *Client) CreateNetwork(req api.NetworkRequest) (*api.Network, error) {
 	return &net, nil
 }
 
+//publicSubnetTag tags the subnet of a VPC holding the VMs having a public IP and the NAT gateway,
+//in a network whose egress traffic is not routed by a gateway VM
+const publicSubnetTag = "safescale:public"
+
+//splitCIDR returns the first half of the IPv4 network cidr, and the first /28 of its second half
+func splitCIDR(cidr string) (string, string, error) {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", "", err
+	}
+	ones, bits := n.Mask.Size()
+	if bits != 32 || ones > 27 {
+		return "", "", fmt.Errorf("network %s is too small to hold a public subnet, /27 at least is required", cidr)
+	}
+	second := make(net.IP, 4)
+	copy(second, n.IP.To4())
+	second[(ones)/8] |= 0x80 >> uint(ones%8)
+	return fmt.Sprintf("%s/%d", n.IP.String(), ones+1), fmt.Sprintf("%s/28", second.String()), nil
+}
+
+//createNetworkWithoutGateway creates the subnets of the VPC vpcID, whose egress traffic is not routed by a gateway VM
+//The VMs are created in a private subnet, the first half of the network, except the ones having a public IP
+//which are created with the NAT gateway in a public subnet routed to the internet gateway
+//In GatewayMode.ROUTER the private subnet is routed to the NAT gateway, in GatewayMode.NONE it has no egress
+func (c *Client) createNetworkWithoutGateway(req api.NetworkRequest, vpcID *string) (*api.Network, error) {
+	privateCIDR, publicCIDR, err := splitCIDR(req.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	mainTableID, err := c.getRouteTableID(*vpcID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.EC2.CreateSubnet(&ec2.CreateSubnetInput{
+		CidrBlock: aws.String(privateCIDR),
+		VpcId:     vpcID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	public, err := c.EC2.CreateSubnet(&ec2.CreateSubnetInput{
+		CidrBlock: aws.String(publicCIDR),
+		VpcId:     vpcID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.EC2.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{public.Subnet.SubnetId},
+		Tags:      []*ec2.Tag{{Key: aws.String(publicSubnetTag), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	igw, err := c.EC2.CreateInternetGateway(&ec2.CreateInternetGatewayInput{})
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.EC2.AttachInternetGateway(&ec2.AttachInternetGatewayInput{
+		VpcId:             vpcID,
+		InternetGatewayId: igw.InternetGateway.InternetGatewayId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	table, err := c.EC2.CreateRouteTable(&ec2.CreateRouteTableInput{
+		VpcId: vpcID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.EC2.CreateRoute(&ec2.CreateRouteInput{
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		GatewayId:            igw.InternetGateway.InternetGatewayId,
+		RouteTableId:         table.RouteTable.RouteTableId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.EC2.AssociateRouteTable(&ec2.AssociateRouteTableInput{
+		RouteTableId: table.RouteTable.RouteTableId,
+		SubnetId:     public.Subnet.SubnetId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GatewayMode == GatewayMode.ROUTER {
+		addr, err := c.EC2.AllocateAddress(&ec2.AllocateAddressInput{
+			Domain: aws.String("vpc"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		nat, err := c.EC2.CreateNatGateway(&ec2.CreateNatGatewayInput{
+			AllocationId: addr.AllocationId,
+			SubnetId:     public.Subnet.SubnetId,
+		})
+		if err != nil {
+			c.EC2.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: addr.AllocationId})
+			return nil, err
+		}
+		err = c.EC2.WaitUntilNatGatewayAvailable(&ec2.DescribeNatGatewaysInput{
+			NatGatewayIds: []*string{nat.NatGateway.NatGatewayId},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The main route table is the one of the private subnet
+		_, err = c.EC2.CreateRoute(&ec2.CreateRouteInput{
+			DestinationCidrBlock: aws.String("0.0.0.0/0"),
+			NatGatewayId:         nat.NatGateway.NatGatewayId,
+			RouteTableId:         mainTableID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	net := api.Network{
+		CIDR:      req.CIDR,
+		ID:        pStr(vpcID),
+		Name:      req.Name,
+		IPVersion: req.IPVersion,
+	}
+	err = c.saveNetwork(net)
+	if err != nil {
+		return nil, err
+	}
+	return &net, nil
+}
+
+//deleteNetworkResources deletes the NAT gateways, the internet gateways, the subnets and the route tables of the VPC vpcID,
+//which must be deleted before the VPC
+func (c *Client) deleteNetworkResources(vpcID string) {
+	filters := []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}}}
+	nats, err := c.EC2.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{Filter: filters})
+	if err == nil {
+		ids := []*string{}
+		for _, nat := range nats.NatGateways {
+			if pStr(nat.State) == ec2.NatGatewayStateDeleted {
+				continue
+			}
+			c.EC2.DeleteNatGateway(&ec2.DeleteNatGatewayInput{NatGatewayId: nat.NatGatewayId})
+			ids = append(ids, nat.NatGatewayId)
+		}
+		if len(ids) > 0 {
+			c.EC2.WaitUntilNatGatewayDeleted(&ec2.DescribeNatGatewaysInput{NatGatewayIds: ids})
+		}
+		// The addresses of the NAT gateways are released once the NAT gateways are deleted
+		for _, nat := range nats.NatGateways {
+			for _, addr := range nat.NatGatewayAddresses {
+				c.EC2.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: addr.AllocationId})
+			}
+		}
+	}
+	igws, err := c.EC2.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+		Filters: []*ec2.Filter{{Name: aws.String("attachment.vpc-id"), Values: []*string{aws.String(vpcID)}}},
+	})
+	if err == nil {
+		for _, igw := range igws.InternetGateways {
+			c.EC2.DetachInternetGateway(&ec2.DetachInternetGatewayInput{
+				InternetGatewayId: igw.InternetGatewayId,
+				VpcId:             aws.String(vpcID),
+			})
+			c.EC2.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: igw.InternetGatewayId})
+		}
+	}
+	sns, err := c.getSubnets([]string{vpcID})
+	if err == nil {
+		for _, sn := range sns {
+			c.EC2.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: sn.SubnetId})
+		}
+	}
+	tables, err := c.EC2.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: filters})
+	if err == nil {
+		for _, table := range tables.RouteTables {
+			main := false
+			for _, assoc := range table.Associations {
+				if assoc.Main != nil && *assoc.Main {
+					main = true
+				}
+			}
+			if !main {
+				c.EC2.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: table.RouteTableId})
+			}
+		}
+	}
+}
+
+//isPublicSubnet tells if sn is the public subnet of a network whose egress traffic is not routed by a gateway VM
+func isPublicSubnet(sn *ec2.Subnet) bool {
+	for _, tag := range sn.Tags {
+		if pStr(tag.Key) == publicSubnetTag {
+			return true
+		}
+	}
+	return false
+}
+
 //GetNetwork returns the network identified by id
 func (c *Client) GetNetwork(id string) (*api.Network, error) {
 	net, err := c.getNetwork(id)
@@ -758,7 +1016,7 @@ func (c *Client) ListNetworks() ([]api.Network, error) {
 //DeleteNetwork deletes the network identified by id
 func (c *Client) DeleteNetwork(id string) error {
 	net, err := c.getNetwork(id)
-	if err == nil {
+	if err == nil && net.GatewayID != "" {
 		c.DeleteVM(net.GatewayID)
 		addrs, _ := c.EC2.DescribeAddresses(&ec2.DescribeAddressesInput{
 			Filters: []*ec2.Filter{
@@ -786,20 +1044,344 @@ func (c *Client) DeleteNetwork(id string) error {
 		}
 	}
 
+	// The bastion of a network without gateway VM is deleted with its gateway
+	if gw, err := c.GetGateway(id); err == nil && gw.Mode != GatewayMode.VM {
+		c.DeleteGateway(id)
+	}
+	c.deleteNetworkResources(id)
+
 	_, err = c.EC2.DeleteVpc(&ec2.DeleteVpcInput{
 		VpcId: aws.String(id),
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	c.removeNetwork(id)
+	return nil
 }
 
-//CreateGateway exists only to comply with api.ClientAPI interface
+//CreateGateway records the gateway mode of a network whose egress traffic is not routed by a VM,
+//with its bastion if req.Bastion is true
+//The gateway VMs of the other networks are created by CreateNetwork
 func (c *Client) CreateGateway(req api.GWRequest) error {
-	return fmt.Errorf("aws.CreateGateway() isn't available by design")
+	if req.Mode == GatewayMode.VM {
+		return fmt.Errorf("aws.CreateGateway() isn't available by design, gateway VMs are created with the network")
+	}
+	net, err := c.getNetwork(req.NetworkID)
+	if err != nil {
+		return fmt.Errorf("Network %s not found: %s", req.NetworkID, err)
+	}
+	gw := api.Gateway{
+		NetworkID: req.NetworkID,
+		Mode:      req.Mode,
+	}
+	if req.Bastion {
+		vm, err := c.CreateVM(api.VMRequest{
+			ImageID:    req.ImageID,
+			KeyPair:    req.KeyPair,
+			Name:       "bastion-" + net.Name,
+			TemplateID: req.TemplateID,
+			NetworkIDs: []string{req.NetworkID},
+			PublicIP:   true,
+		})
+		if err != nil {
+			return wrapError("Error creating bastion", err)
+		}
+		gw.VMIDs = []string{vm.ID}
+	}
+	err = c.saveGateway(gw)
+	if err != nil {
+		for _, id := range gw.VMIDs {
+			c.DeleteVM(id)
+		}
+		return wrapError("Error creating bastion", err)
+	}
+	return nil
 }
 
-//DeleteGateway exists only to comply with api.ClientAPI interface
+//DeleteGateway deletes the bastion of a network whose egress traffic is not routed by a VM
+//The gateway VMs of the other networks are deleted by DeleteNetwork
 func (c *Client) DeleteGateway(networkID string) error {
-	return fmt.Errorf("aws.DeleteGateway() isn't available by design")
+	gw, err := c.GetGateway(networkID)
+	if err != nil {
+		return err
+	}
+	if gw.Mode == GatewayMode.VM {
+		return fmt.Errorf("aws.DeleteGateway() isn't available by design, gateway VMs are deleted with the network")
+	}
+	for _, id := range gw.VMIDs {
+		err = c.DeleteVM(id)
+		if err != nil {
+			return err
+		}
+	}
+	return c.removeGateway(networkID)
+}
+
+//GetGateway returns the gateway of a network, the gateway VM created with the network or the gateway mode recorded by CreateGateway
+func (c *Client) GetGateway(networkID string) (*api.Gateway, error) {
+	o, err := c.GetObject("gpac.aws.gateways", networkID, nil)
+	if err != nil {
+		net, nerr := c.getNetwork(networkID)
+		if nerr != nil || net.GatewayID == "" {
+			return nil, fmt.Errorf("Network %s has no gateway: %s", networkID, err)
+		}
+		return &api.Gateway{
+			NetworkID: networkID,
+			Mode:      GatewayMode.VM,
+			VMIDs:     []string{net.GatewayID},
+		}, nil
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	gw := api.Gateway{}
+	err = json.Unmarshal(buffer.Bytes(), &gw)
+	if err != nil {
+		return nil, err
+	}
+	return &gw, nil
+}
+
+func (c *Client) saveGateway(gw api.Gateway) error {
+	b, err := json.Marshal(gw)
+	if err != nil {
+		return err
+	}
+	return c.PutObject("gpac.aws.gateways", api.Object{
+		Name:    gw.NetworkID,
+		Content: bytes.NewReader(b),
+	})
+}
+
+func (c *Client) removeGateway(netID string) error {
+	return c.DeleteObject("gpac.aws.gateways", netID)
+}
+
+//getRouteTableID returns the ID of the route table of the VPC identified by vpcID
+func (c *Client) getRouteTableID(vpcID string) (*string, error) {
+	out, err := c.EC2.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(vpcID)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.RouteTables) < 1 {
+		return nil, fmt.Errorf("VPC %s has no route table", vpcID)
+	}
+	return out.RouteTables[0].RouteTableId, nil
+}
+
+//toNetworkPeering converts a VPC peering connection into a network peering
+func toNetworkPeering(pc *ec2.VpcPeeringConnection) api.NetworkPeering {
+	return api.NetworkPeering{
+		ID:         pStr(pc.VpcPeeringConnectionId),
+		NetworkIDs: []string{pStr(pc.RequesterVpcInfo.VpcId), pStr(pc.AccepterVpcInfo.VpcId)},
+	}
+}
+
+//PeerNetworks routes the traffic between the networks identified by networkID1 and networkID2 with a VPC peering connection
+//The security groups of each VPC let in the traffic of the other one
+func (c *Client) PeerNetworks(networkID1, networkID2 string) (*api.NetworkPeering, error) {
+	out, err := c.EC2.CreateVpcPeeringConnection(&ec2.CreateVpcPeeringConnectionInput{
+		VpcId:     aws.String(networkID1),
+		PeerVpcId: aws.String(networkID2),
+	})
+	if err != nil {
+		return nil, wrapError("Error peering networks", err)
+	}
+	pcID := out.VpcPeeringConnection.VpcPeeringConnectionId
+	_, err = c.EC2.AcceptVpcPeeringConnection(&ec2.AcceptVpcPeeringConnectionInput{
+		VpcPeeringConnectionId: pcID,
+	})
+	if err != nil {
+		c.EC2.DeleteVpcPeeringConnection(&ec2.DeleteVpcPeeringConnectionInput{VpcPeeringConnectionId: pcID})
+		return nil, wrapError("Error peering networks", err)
+	}
+	ids := []string{networkID1, networkID2}
+	for i, id := range ids {
+		peer, err := c.GetNetwork(ids[1-i])
+		if err == nil {
+			var tableID *string
+			tableID, err = c.getRouteTableID(id)
+			if err == nil {
+				_, err = c.EC2.CreateRoute(&ec2.CreateRouteInput{
+					DestinationCidrBlock:   aws.String(peer.CIDR),
+					RouteTableId:           tableID,
+					VpcPeeringConnectionId: pcID,
+				})
+			}
+			if err == nil {
+				err = c.allowPeer(id, peer.CIDR, true)
+			}
+		}
+		if err != nil {
+			c.UnpeerNetworks(networkID1, networkID2)
+			return nil, wrapError("Error peering networks", err)
+		}
+	}
+	return &api.NetworkPeering{
+		ID:         pStr(pcID),
+		NetworkIDs: ids,
+	}, nil
+}
+
+//allowPeer lets in (or stops letting in if allow is false) the traffic of the peered network cidr in the security groups of the VPC vpcID
+func (c *Client) allowPeer(vpcID string, cidr string, allow bool) error {
+	out, err := c.EC2.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(vpcID)},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	permissions := []*ec2.IpPermission{
+		{
+			IpProtocol: aws.String("-1"),
+			IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(cidr)}},
+		},
+	}
+	for _, sg := range out.SecurityGroups {
+		if allow {
+			_, err = c.EC2.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+				GroupId:       sg.GroupId,
+				IpPermissions: permissions,
+			})
+			if err != nil && strings.Contains(err.Error(), "InvalidPermission.Duplicate") {
+				err = nil
+			}
+		} else {
+			_, err = c.EC2.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       sg.GroupId,
+				IpPermissions: permissions,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//ListNetworkPeerings lists the active VPC peering connections of the network identified by networkID
+func (c *Client) ListNetworkPeerings(networkID string) ([]api.NetworkPeering, error) {
+	peerings := []api.NetworkPeering{}
+	for _, side := range []string{"requester-vpc-info.vpc-id", "accepter-vpc-info.vpc-id"} {
+		out, err := c.EC2.DescribeVpcPeeringConnections(&ec2.DescribeVpcPeeringConnectionsInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String(side),
+					Values: []*string{aws.String(networkID)},
+				},
+				{
+					Name:   aws.String("status-code"),
+					Values: []*string{aws.String("active")},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, pc := range out.VpcPeeringConnections {
+			peerings = append(peerings, toNetworkPeering(pc))
+		}
+	}
+	return peerings, nil
+}
+
+//UnpeerNetworks deletes the VPC peering connection between the networks identified by networkID1 and networkID2
+//The routes through the peering connection are removed first, AWS would otherwise leave them blackholed
+func (c *Client) UnpeerNetworks(networkID1, networkID2 string) error {
+	peerings, err := c.ListNetworkPeerings(networkID1)
+	if err != nil {
+		return err
+	}
+	for _, peering := range peerings {
+		if peering.NetworkIDs[0] != networkID2 && peering.NetworkIDs[1] != networkID2 {
+			continue
+		}
+		for i, id := range peering.NetworkIDs {
+			peer, err := c.GetNetwork(peering.NetworkIDs[1-i])
+			if err != nil {
+				continue
+			}
+			tableID, err := c.getRouteTableID(id)
+			if err != nil {
+				continue
+			}
+			c.EC2.DeleteRoute(&ec2.DeleteRouteInput{
+				DestinationCidrBlock: aws.String(peer.CIDR),
+				RouteTableId:         tableID,
+			})
+			c.allowPeer(id, peer.CIDR, false)
+		}
+		_, err = c.EC2.DeleteVpcPeeringConnection(&ec2.DeleteVpcPeeringConnectionInput{
+			VpcPeeringConnectionId: aws.String(peering.ID),
+		})
+		return err
+	}
+	return fmt.Errorf("Networks %s and %s are not peered", networkID1, networkID2)
+}
+
+//ListSecurityRules lists the rules of the security groups of the VPC networkID
+func (c *Client) ListSecurityRules(networkID string) ([]api.SecurityRule, error) {
+	out, err := c.EC2.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(networkID)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, wrapError("Error listing security rules", err)
+	}
+	var rules []api.SecurityRule
+	for _, sg := range out.SecurityGroups {
+		for _, dir := range []struct {
+			name        string
+			permissions []*ec2.IpPermission
+		}{{"ingress", sg.IpPermissions}, {"egress", sg.IpPermissionsEgress}} {
+			for _, perm := range dir.permissions {
+				rule := api.SecurityRule{
+					Direction: dir.name,
+					Protocol:  pStr(perm.IpProtocol),
+				}
+				if rule.Protocol == "-1" {
+					rule.Protocol = ""
+				}
+				if perm.FromPort != nil {
+					rule.PortFrom = int(*perm.FromPort)
+				}
+				if perm.ToPort != nil {
+					rule.PortTo = int(*perm.ToPort)
+				}
+				var cidrs []string
+				for _, r := range perm.IpRanges {
+					cidrs = append(cidrs, pStr(r.CidrIp))
+				}
+				for _, r := range perm.Ipv6Ranges {
+					cidrs = append(cidrs, pStr(r.CidrIpv6))
+				}
+				if len(cidrs) == 0 {
+					rules = append(rules, rule)
+				}
+				for _, cidr := range cidrs {
+					rule.CIDR = cidr
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+	return rules, nil
 }
 
 func (c *Client) getSubnets(vpcIDs []string) ([]*ec2.Subnet, error) {
@@ -899,7 +1481,7 @@ func (c *Client) prepareUserData(request api.VMRequest, kp *api.KeyPair, gw *api
 		User:        api.DefaultUser,
 		Key:         strings.Trim(kp.PublicKey, "\n"),
 		IsGateway:   request.IsGateway,
-		AddGateway:  !request.PublicIP,
+		AddGateway:  !request.PublicIP && ip != "",
 		ResolveConf: ResolveConf,
 		GatewayIP:   ip,
 	}
@@ -997,12 +1579,14 @@ func (c *Client) CreateVM(request api.VMRequest) (*api.VM, error) {
 		if err != nil {
 			return nil, err
 		}
+		// The egress traffic of the VMs of a network without gateway VM is routed by the VPC
 		gwID = net.GatewayID
-		gw, err = c.GetVM(gwID)
-		if err != nil {
-			return nil, err
+		if gwID != "" {
+			gw, err = c.GetVM(gwID)
+			if err != nil {
+				return nil, err
+			}
 		}
-
 	}
 	//get subnet of each network
 	sns, err := c.getSubnets(request.NetworkIDs)
@@ -1016,10 +1600,18 @@ func (c *Client) CreateVM(request api.VMRequest) (*api.VM, error) {
 	//Create networks interfaces
 	networkInterfaces := []*ec2.InstanceNetworkInterfaceSpecification{}
 
+	// The VMs having a public IP are created in the public subnet of the networks having one
 	vpcs := map[string][]*ec2.Subnet{}
 	for _, sn := range sns {
+		if isPublicSubnet(sn) != request.PublicIP {
+			continue
+		}
 		vpcs[*sn.VpcId] = append(vpcs[*sn.VpcId], sn)
-
+	}
+	for _, sn := range sns {
+		if len(vpcs[*sn.VpcId]) == 0 {
+			vpcs[*sn.VpcId] = append(vpcs[*sn.VpcId], sn)
+		}
 	}
 
 	i := 0
@@ -1255,6 +1847,428 @@ func (c *Client) GetSSHConfig(vmID string) (*system.SSHConfig, error) {
 	return &sshConfig, nil
 }
 
+//toPublicIP converts an Elastic IP into an api public IP
+func toPublicIP(addr *ec2.Address) *api.PublicIP {
+	return &api.PublicIP{
+		ID:   pStr(addr.AllocationId),
+		IP:   pStr(addr.PublicIp),
+		VMID: pStr(addr.InstanceId),
+	}
+}
+
+//getAddress returns the Elastic IP identified by its allocation id
+func (c *Client) getAddress(id string) (*ec2.Address, error) {
+	out, err := c.EC2.DescribeAddresses(&ec2.DescribeAddressesInput{
+		AllocationIds: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Addresses) == 0 {
+		return nil, providers.ResourceNotFoundError("Public IP", id)
+	}
+	return out.Addresses[0], nil
+}
+
+//CreatePublicIP allocates an Elastic IP
+func (c *Client) CreatePublicIP() (*api.PublicIP, error) {
+	out, err := c.EC2.AllocateAddress(&ec2.AllocateAddressInput{
+		Domain: aws.String("vpc"),
+	})
+	if err != nil {
+		return nil, wrapError("Error creating public IP", err)
+	}
+	return &api.PublicIP{
+		ID: pStr(out.AllocationId),
+		IP: pStr(out.PublicIp),
+	}, nil
+}
+
+//GetPublicIP returns the Elastic IP identified by its allocation id
+func (c *Client) GetPublicIP(id string) (*api.PublicIP, error) {
+	addr, err := c.getAddress(id)
+	if err != nil {
+		return nil, err
+	}
+	return toPublicIP(addr), nil
+}
+
+//ListPublicIPs lists the Elastic IPs of the account
+func (c *Client) ListPublicIPs() ([]api.PublicIP, error) {
+	out, err := c.EC2.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("domain"),
+				Values: []*string{aws.String("vpc")},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ips := []api.PublicIP{}
+	for _, addr := range out.Addresses {
+		ips = append(ips, *toPublicIP(addr))
+	}
+	return ips, nil
+}
+
+//AttachPublicIP associates the Elastic IP identified by id to the VM identified by vmID
+func (c *Client) AttachPublicIP(id string, vmID string) error {
+	_, err := c.EC2.AssociateAddress(&ec2.AssociateAddressInput{
+		AllocationId:       aws.String(id),
+		InstanceId:         aws.String(vmID),
+		AllowReassociation: aws.Bool(false),
+	})
+	return err
+}
+
+//DetachPublicIP disassociates the Elastic IP identified by id from its VM
+func (c *Client) DetachPublicIP(id string) error {
+	addr, err := c.getAddress(id)
+	if err != nil {
+		return err
+	}
+	if addr.AssociationId == nil {
+		return fmt.Errorf("Public IP %s is not attached", pStr(addr.PublicIp))
+	}
+	_, err = c.EC2.DisassociateAddress(&ec2.DisassociateAddressInput{
+		AssociationId: addr.AssociationId,
+	})
+	return err
+}
+
+//DeletePublicIP releases the Elastic IP identified by id
+func (c *Client) DeletePublicIP(id string) error {
+	_, err := c.EC2.ReleaseAddress(&ec2.ReleaseAddressInput{
+		AllocationId: aws.String(id),
+	})
+	return err
+}
+
+//CreateLoadBalancer creates an internal Network Load Balancer in the subnet of the VPC req.NetworkID
+//HTTP and HTTPS traffic is balanced per TCP connection, HTTPS traffic being passed through to the backends
+func (c *Client) CreateLoadBalancer(req api.LoadBalancerRequest) (*api.LoadBalancer, error) {
+	sns, err := c.getSubnets([]string{req.NetworkID})
+	if err == nil && len(sns) > 1 && isPublicSubnet(sns[0]) {
+		sns = sns[1:]
+	}
+	if err != nil || len(sns) == 0 {
+		return nil, fmt.Errorf("Error creating load balancer: network %s has no subnet", req.NetworkID)
+	}
+	lbOut, err := c.ELB.CreateLoadBalancer(&elbv2.CreateLoadBalancerInput{
+		Name:    aws.String(req.Name),
+		Type:    aws.String(elbv2.LoadBalancerTypeEnumNetwork),
+		Scheme:  aws.String(elbv2.LoadBalancerSchemeEnumInternal),
+		Subnets: []*string{sns[0].SubnetId},
+	})
+	if err != nil {
+		return nil, wrapError("Error creating load balancer", err)
+	}
+	lbArn := lbOut.LoadBalancers[0].LoadBalancerArn
+	hcProtocol := elbv2.ProtocolEnumTcp
+	if req.HealthCheckPath != "" && req.Protocol == LBProtocol.HTTP {
+		hcProtocol = elbv2.ProtocolEnumHttp
+	} else if req.HealthCheckPath != "" && req.Protocol == LBProtocol.HTTPS {
+		hcProtocol = elbv2.ProtocolEnumHttps
+	}
+	tgIn := elbv2.CreateTargetGroupInput{
+		Name:                aws.String(req.Name),
+		Protocol:            aws.String(elbv2.ProtocolEnumTcp),
+		Port:                aws.Int64(int64(req.BackendPort)),
+		VpcId:               aws.String(req.NetworkID),
+		HealthCheckProtocol: aws.String(hcProtocol),
+	}
+	if hcProtocol != elbv2.ProtocolEnumTcp {
+		tgIn.HealthCheckPath = aws.String(req.HealthCheckPath)
+	}
+	tgOut, err := c.ELB.CreateTargetGroup(&tgIn)
+	if err != nil {
+		c.DeleteLoadBalancer(*lbArn)
+		return nil, wrapError("Error creating load balancer", err)
+	}
+	_, err = c.ELB.CreateListener(&elbv2.CreateListenerInput{
+		LoadBalancerArn: lbArn,
+		Protocol:        aws.String(elbv2.ProtocolEnumTcp),
+		Port:            aws.Int64(int64(req.Port)),
+		DefaultActions: []*elbv2.Action{
+			{
+				Type:           aws.String(elbv2.ActionTypeEnumForward),
+				TargetGroupArn: tgOut.TargetGroups[0].TargetGroupArn,
+			},
+		},
+	})
+	if err != nil {
+		c.DeleteLoadBalancer(*lbArn)
+		return nil, wrapError("Error creating load balancer", err)
+	}
+	return c.GetLoadBalancer(*lbArn)
+}
+
+//getTargetGroup returns the target group of the load balancer identified by its ARN id
+func (c *Client) getTargetGroup(id string) (*elbv2.TargetGroup, error) {
+	out, err := c.ELB.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+		LoadBalancerArn: aws.String(id),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.TargetGroups) == 0 {
+		return nil, fmt.Errorf("load balancer %s has no target group", id)
+	}
+	return out.TargetGroups[0], nil
+}
+
+//GetLoadBalancer returns the load balancer identified by its ARN id
+//The VIP of the load balancer is its DNS name as a Network Load Balancer has an IP per availability zone
+func (c *Client) GetLoadBalancer(id string) (*api.LoadBalancer, error) {
+	out, err := c.ELB.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, wrapError("Error getting load balancer", err)
+	}
+	if len(out.LoadBalancers) == 0 {
+		return nil, providers.ResourceNotFoundError("load balancer", id)
+	}
+	lb := out.LoadBalancers[0]
+	res := api.LoadBalancer{
+		ID:        id,
+		Name:      pStr(lb.LoadBalancerName),
+		NetworkID: pStr(lb.VpcId),
+		VIP:       pStr(lb.DNSName),
+		Backends:  map[string]string{},
+	}
+	lOut, err := c.ELB.DescribeListeners(&elbv2.DescribeListenersInput{
+		LoadBalancerArn: aws.String(id),
+	})
+	if err == nil && len(lOut.Listeners) > 0 {
+		res.Port = int(aws.Int64Value(lOut.Listeners[0].Port))
+	}
+	tg, err := c.getTargetGroup(id)
+	if err != nil {
+		return &res, nil
+	}
+	res.BackendPort = int(aws.Int64Value(tg.Port))
+	res.HealthCheckPath = pStr(tg.HealthCheckPath)
+	switch pStr(tg.HealthCheckProtocol) {
+	case elbv2.ProtocolEnumHttp:
+		res.Protocol = LBProtocol.HTTP
+	case elbv2.ProtocolEnumHttps:
+		res.Protocol = LBProtocol.HTTPS
+	}
+	hOut, err := c.ELB.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: tg.TargetGroupArn,
+	})
+	if err != nil {
+		return nil, wrapError("Error getting load balancer", err)
+	}
+	for _, h := range hOut.TargetHealthDescriptions {
+		vmID := pStr(h.Target.Id)
+		res.Backends[vmID] = ""
+		vm, err := c.GetVM(vmID)
+		if err == nil && len(vm.PrivateIPsV4) > 0 {
+			res.Backends[vmID] = vm.PrivateIPsV4[0]
+		}
+	}
+	return &res, nil
+}
+
+//AddLoadBalancerBackend registers the instance vmID, receiving the traffic on port, in the target group of the load balancer identified by its ARN id
+//The target group being of type instance, ip is not used
+func (c *Client) AddLoadBalancerBackend(id string, vmID string, ip string, port int) error {
+	tg, err := c.getTargetGroup(id)
+	if err != nil {
+		return wrapError("Error adding load balancer backend", err)
+	}
+	_, err = c.ELB.RegisterTargets(&elbv2.RegisterTargetsInput{
+		TargetGroupArn: tg.TargetGroupArn,
+		Targets: []*elbv2.TargetDescription{
+			{Id: aws.String(vmID), Port: aws.Int64(int64(port))},
+		},
+	})
+	return wrapError("Error adding load balancer backend", err)
+}
+
+//RemoveLoadBalancerBackend deregisters the instance vmID from the target group of the load balancer identified by its ARN id
+func (c *Client) RemoveLoadBalancerBackend(id string, vmID string) error {
+	tg, err := c.getTargetGroup(id)
+	if err != nil {
+		return wrapError("Error removing load balancer backend", err)
+	}
+	_, err = c.ELB.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+		TargetGroupArn: tg.TargetGroupArn,
+		Targets: []*elbv2.TargetDescription{
+			{Id: aws.String(vmID)},
+		},
+	})
+	return wrapError("Error removing load balancer backend", err)
+}
+
+//DeleteLoadBalancer deletes the load balancer identified by its ARN id, with its listeners, then its target group
+func (c *Client) DeleteLoadBalancer(id string) error {
+	tg, tgErr := c.getTargetGroup(id)
+	_, err := c.ELB.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{
+		LoadBalancerArn: aws.String(id),
+	})
+	if err != nil {
+		return wrapError("Error deleting load balancer", err)
+	}
+	if tgErr == nil {
+		_, err = c.ELB.DeleteTargetGroup(&elbv2.DeleteTargetGroupInput{
+			TargetGroupArn: tg.TargetGroupArn,
+		})
+	}
+	return wrapError("Error deleting load balancer", err)
+}
+
+//CreateDNSZone creates a Route53 private hosted zone associated to the VPC networkID
+//The zone is resolved by the resolver of the VPC, so no nameserver is returned
+func (c *Client) CreateDNSZone(networkID string, domain string) (*api.DNSZone, error) {
+	out, err := c.Route53.CreateHostedZone(&route53.CreateHostedZoneInput{
+		Name:            aws.String(domain),
+		CallerReference: aws.String(fmt.Sprintf("%s-%d", networkID, time.Now().UnixNano())),
+		HostedZoneConfig: &route53.HostedZoneConfig{
+			PrivateZone: aws.Bool(true),
+		},
+		VPC: &route53.VPC{
+			VPCId:     aws.String(networkID),
+			VPCRegion: aws.String(c.AuthOpts.Region),
+		},
+	})
+	if err != nil {
+		return nil, wrapError("Error creating DNS zone", err)
+	}
+	return &api.DNSZone{
+		ID:        pStr(out.HostedZone.Id),
+		NetworkID: networkID,
+		Domain:    domain,
+	}, nil
+}
+
+//getResourceRecordSet returns the record set of the name and the type of record in the hosted zone zoneID, nil if there is none
+//The fully qualified name of the record and its value as expected by Route53 are returned too
+func (c *Client) getResourceRecordSet(zoneID string, record api.DNSRecord) (*route53.ResourceRecordSet, string, string, error) {
+	zone, err := c.Route53.GetHostedZone(&route53.GetHostedZoneInput{
+		Id: aws.String(zoneID),
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	domain := pStr(zone.HostedZone.Name)
+	name := record.Name + "." + domain
+	value := record.Value
+	if record.Type == "CNAME" && !strings.Contains(value, ".") {
+		value = value + "." + domain
+	}
+	out, err := c.Route53.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: aws.String(record.Type),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	for _, set := range out.ResourceRecordSets {
+		if pStr(set.Name) == name && pStr(set.Type) == record.Type {
+			return set, name, value, nil
+		}
+	}
+	return nil, name, value, nil
+}
+
+//changeResourceRecordSet applies action to the record set of the hosted zone zoneID
+func (c *Client) changeResourceRecordSet(zoneID string, action string, set *route53.ResourceRecordSet) error {
+	_, err := c.Route53.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action:            aws.String(action),
+					ResourceRecordSet: set,
+				},
+			},
+		},
+	})
+	return err
+}
+
+//AddDNSRecord adds record to the hosted zone zoneID
+//The value is added to the record set of the name of the record if it already exists
+func (c *Client) AddDNSRecord(zoneID string, record api.DNSRecord) error {
+	set, name, value, err := c.getResourceRecordSet(zoneID, record)
+	if err != nil {
+		return wrapError("Error adding DNS record", err)
+	}
+	if set == nil {
+		set = &route53.ResourceRecordSet{
+			Name: aws.String(name),
+			Type: aws.String(record.Type),
+			TTL:  aws.Int64(300),
+		}
+	}
+	for _, r := range set.ResourceRecords {
+		if pStr(r.Value) == value {
+			return nil
+		}
+	}
+	set.ResourceRecords = append(set.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+	return wrapError("Error adding DNS record", c.changeResourceRecordSet(zoneID, route53.ChangeActionUpsert, set))
+}
+
+//RemoveDNSRecord removes record from the hosted zone zoneID
+//The record set is deleted with its last value
+func (c *Client) RemoveDNSRecord(zoneID string, record api.DNSRecord) error {
+	set, _, value, err := c.getResourceRecordSet(zoneID, record)
+	if err != nil {
+		return wrapError("Error removing DNS record", err)
+	}
+	if set == nil {
+		return nil
+	}
+	var values []*route53.ResourceRecord
+	for _, r := range set.ResourceRecords {
+		if pStr(r.Value) != value {
+			values = append(values, r)
+		}
+	}
+	if len(values) == 0 {
+		err = c.changeResourceRecordSet(zoneID, route53.ChangeActionDelete, set)
+	} else {
+		set.ResourceRecords = values
+		err = c.changeResourceRecordSet(zoneID, route53.ChangeActionUpsert, set)
+	}
+	return wrapError("Error removing DNS record", err)
+}
+
+//DeleteDNSZone deletes the hosted zone zoneID, Route53 requiring its records but SOA and NS to be deleted first
+func (c *Client) DeleteDNSZone(zoneID string) error {
+	var sets []*route53.ResourceRecordSet
+	err := c.Route53.ListResourceRecordSetsPages(&route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+	}, func(out *route53.ListResourceRecordSetsOutput, last bool) bool {
+		sets = append(sets, out.ResourceRecordSets...)
+		return true
+	})
+	if err != nil {
+		return wrapError("Error deleting DNS zone", err)
+	}
+	for _, set := range sets {
+		if pStr(set.Type) == "SOA" || pStr(set.Type) == "NS" {
+			continue
+		}
+		err = c.changeResourceRecordSet(zoneID, route53.ChangeActionDelete, set)
+		if err != nil {
+			return wrapError("Error deleting DNS zone", err)
+		}
+	}
+	_, err = c.Route53.DeleteHostedZone(&route53.DeleteHostedZoneInput{
+		Id: aws.String(zoneID),
+	})
+	return wrapError("Error deleting DNS zone", err)
+}
+
 func toVolumeType(speed VolumeSpeed.Enum) string {
 	switch speed {
 	case VolumeSpeed.COLD:
@@ -1417,6 +2431,24 @@ func (c *Client) DeleteVolume(id string) error {
 	return err
 }
 
+//ExtendVolume extends the volume identified by id to size GB
+func (c *Client) ExtendVolume(id string, size int) error {
+	_, err := c.EC2.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: aws.String(id),
+		Size:     aws.Int64(int64(size)),
+	})
+	return err
+}
+
+//RetypeVolume changes the speed of the volume identified by id
+func (c *Client) RetypeVolume(id string, speed VolumeSpeed.Enum) error {
+	_, err := c.EC2.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId:   aws.String(id),
+		VolumeType: aws.String(toVolumeType(speed)),
+	})
+	return err
+}
+
 // func (c *Client) saveVolumeAttachmentName(id, name string) error {
 // 	return c.PutObject("__volume_atachements__", api.Object{
 // 		Name:    id,
@@ -1569,3 +2601,160 @@ func (c *Client) CopyObject(containerSrc, objectSrc, objectDst string) error {
 func (c *Client) DeleteObject(container, object string) error {
 	return s3.DeleteObject(awss3.New(c.Session), container, object)
 }
+
+//CreateUploadSession starts the upload in parts of obj, obj content is ignored
+func (c *Client) CreateUploadSession(container string, obj api.Object) (*api.UploadSession, error) {
+	return s3.CreateUploadSession(awss3.New(c.Session), container, obj)
+}
+
+//UploadPart uploads a part of an upload session
+func (c *Client) UploadPart(session api.UploadSession, number int, content io.ReadSeeker, size int64) (*api.UploadPart, error) {
+	return s3.UploadPart(awss3.New(c.Session), session, number, content, size)
+}
+
+//ListUploadParts lists the parts already uploaded in an upload session
+func (c *Client) ListUploadParts(session api.UploadSession) ([]api.UploadPart, error) {
+	return s3.ListUploadParts(awss3.New(c.Session), session)
+}
+
+//CompleteUploadSession assembles the parts of an upload session into the object
+func (c *Client) CompleteUploadSession(session api.UploadSession, parts []api.UploadPart) error {
+	return s3.CompleteUploadSession(awss3.New(c.Session), session, parts)
+}
+
+//AbortUploadSession aborts an upload session and deletes its uploaded parts
+func (c *Client) AbortUploadSession(session api.UploadSession) error {
+	return s3.AbortUploadSession(awss3.New(c.Session), session)
+}
+
+//objectStorageUserPath is the IAM path of the users created to give access to a single bucket
+const objectStorageUserPath = "/safescale/"
+
+//objectStoragePolicyName is the name of the inline policy restricting those users to their bucket
+const objectStoragePolicyName = "safescale-bucket-access"
+
+//objectStoragePolicy is the inline policy giving access to the bucket named by its argument only
+const objectStoragePolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Effect": "Allow",
+			"Action": ["s3:ListBucket", "s3:GetBucketLocation", "s3:ListBucketMultipartUploads"],
+			"Resource": "arn:aws:s3:::%[1]s"
+		},
+		{
+			"Effect": "Allow",
+			"Action": ["s3:GetObject", "s3:PutObject", "s3:DeleteObject", "s3:AbortMultipartUpload", "s3:ListMultipartUploadParts"],
+			"Resource": "arn:aws:s3:::%[1]s/*"
+		}
+	]
+}`
+
+//CreateObjectStorageCredentials creates an IAM user restricted to the bucket named container, and returns its access key
+//The ID of the credentials is the name of the user
+func (c *Client) CreateObjectStorageCredentials(container string) (*api.ObjectStorageCredentials, error) {
+	svc := iam.New(c.Session)
+	name := fmt.Sprintf("safescale-%s-%d", container, time.Now().UnixNano())
+	if len(name) > 64 {
+		name = fmt.Sprintf("safescale-%d", time.Now().UnixNano())
+	}
+	_, err := svc.CreateUser(&iam.CreateUserInput{
+		Path:     aws.String(objectStorageUserPath),
+		UserName: aws.String(name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error creating IAM user of container '%s': %s", container, err)
+	}
+
+	_, err = svc.PutUserPolicy(&iam.PutUserPolicyInput{
+		UserName:       aws.String(name),
+		PolicyName:     aws.String(objectStoragePolicyName),
+		PolicyDocument: aws.String(fmt.Sprintf(objectStoragePolicy, container)),
+	})
+	if err != nil {
+		c.DeleteObjectStorageCredentials(name)
+		return nil, fmt.Errorf("Error restricting IAM user '%s' to container '%s': %s", name, container, err)
+	}
+
+	out, err := svc.CreateAccessKey(&iam.CreateAccessKeyInput{
+		UserName: aws.String(name),
+	})
+	if err != nil {
+		c.DeleteObjectStorageCredentials(name)
+		return nil, fmt.Errorf("Error creating access key of IAM user '%s': %s", name, err)
+	}
+	creds := &api.ObjectStorageCredentials{
+		ID:        name,
+		Endpoint:  fmt.Sprintf("https://s3.%s.amazonaws.com", c.AuthOpts.Region),
+		Region:    c.AuthOpts.Region,
+		AccessKey: *out.AccessKey.AccessKeyId,
+		SecretKey: *out.AccessKey.SecretAccessKey,
+	}
+
+	// IAM is eventually consistent, the key is returned once S3 accepts it
+	err = c.waitObjectStorageCredentials(creds, container, 2*time.Minute)
+	if err != nil {
+		c.DeleteObjectStorageCredentials(name)
+		return nil, err
+	}
+	return creds, nil
+}
+
+//waitObjectStorageCredentials waits for the bucket named container to be reachable with creds
+func (c *Client) waitObjectStorageCredentials(creds *api.ObjectStorageCredentials, container string, timeout time.Duration) error {
+	s, err := session.NewSession(&aws.Config{
+		Region:      aws.String(creds.Region),
+		Credentials: credentials.NewStaticCredentials(creds.AccessKey, creds.SecretKey, ""),
+	})
+	if err != nil {
+		return err
+	}
+	svc := awss3.New(s)
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err = svc.HeadBucket(&awss3.HeadBucketInput{
+			Bucket: aws.String(container),
+		})
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Access key of IAM user '%s' not accepted by S3 after %v: %s", creds.ID, timeout, err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+//DeleteObjectStorageCredentials deletes the IAM user named id with its access keys and its policy
+func (c *Client) DeleteObjectStorageCredentials(id string) error {
+	svc := iam.New(c.Session)
+	keys, err := svc.ListAccessKeys(&iam.ListAccessKeysInput{
+		UserName: aws.String(id),
+	})
+	if err != nil {
+		return fmt.Errorf("Error listing access keys of IAM user '%s': %s", id, err)
+	}
+	for _, k := range keys.AccessKeyMetadata {
+		_, err = svc.DeleteAccessKey(&iam.DeleteAccessKeyInput{
+			UserName:    aws.String(id),
+			AccessKeyId: k.AccessKeyId,
+		})
+		if err != nil {
+			return fmt.Errorf("Error deleting access key of IAM user '%s': %s", id, err)
+		}
+	}
+	_, err = svc.DeleteUserPolicy(&iam.DeleteUserPolicyInput{
+		UserName:   aws.String(id),
+		PolicyName: aws.String(objectStoragePolicyName),
+	})
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != iam.ErrCodeNoSuchEntityException) {
+		return fmt.Errorf("Error deleting policy of IAM user '%s': %s", id, err)
+	}
+	_, err = svc.DeleteUser(&iam.DeleteUserInput{
+		UserName: aws.String(id),
+	})
+	if err != nil {
+		return fmt.Errorf("Error deleting IAM user '%s': %s", id, err)
+	}
+	return nil
+}
@@ -19,10 +19,12 @@ package s3
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/multipart"
 
 	"github.com/aws/aws-sdk-go/aws"
 	awss3 "github.com/aws/aws-sdk-go/service/s3"
@@ -36,50 +38,199 @@ func createTagging(m map[string]string) string {
 	return strings.Join(tags, "&")
 }
 
+//setExpiration sets the life cycle of the objects of container named name to expire at deleteAt
+func setExpiration(service *awss3.S3, container string, name string, deleteAt time.Time) error {
+	_, err := service.PutBucketLifecycle(&awss3.PutBucketLifecycleInput{
+		Bucket: aws.String(container),
+		LifecycleConfiguration: &awss3.LifecycleConfiguration{
+			Rules: []*awss3.Rule{
+				&awss3.Rule{
+					Expiration: &awss3.LifecycleExpiration{
+						Date: &deleteAt,
+					},
+					Prefix: aws.String(name),
+					Status: aws.String("Enabled"),
+				},
+			},
+		},
+	})
+	return err
+}
+
+//objectTagging returns the tagging of obj, including its creation and deletion dates
+func objectTagging(obj api.Object) string {
+	metadata := map[string]string{}
+	for k, v := range obj.Metadata {
+		metadata[k] = v
+	}
+	dateBytes, _ := time.Now().MarshalText()
+	metadata["__date__"] = string(dateBytes)
+	dateBytes, _ = obj.DeleteAt.MarshalText()
+	metadata["__delete_at__"] = string(dateBytes)
+	return createTagging(metadata)
+}
+
 //PutObject put an object into an object container
+//Objects larger than api.MultipartThreshold are uploaded in parts
 func PutObject(service *awss3.S3, container string, obj api.Object) error {
+	size, err := multipart.Size(obj.Content)
+	if err != nil {
+		return err
+	}
+	if size > api.MultipartThreshold {
+		return multipart.Put(&uploader{service: service}, container, obj, size)
+	}
+
 	//Manage object life cycle
 	expires := obj.DeleteAt != time.Time{}
 	if expires {
-		_, err := service.PutBucketLifecycle(&awss3.PutBucketLifecycleInput{
-			Bucket: aws.String(container),
-			LifecycleConfiguration: &awss3.LifecycleConfiguration{
-				Rules: []*awss3.Rule{
-					&awss3.Rule{
-						Expiration: &awss3.LifecycleExpiration{
-							Date: &obj.DeleteAt,
-						},
-						Prefix: aws.String(obj.Name),
-						Status: aws.String("Enabled"),
-					},
-				},
-			},
-		})
+		err := setExpiration(service, container, obj.Name, obj.DeleteAt)
 		if err != nil {
 			return err
 		}
 	}
 
-	if obj.Metadata == nil {
-		obj.Metadata = map[string]string{}
-	}
-	dateBytes, _ := time.Now().MarshalText()
-	obj.Metadata["__date__"] = string(dateBytes)
-	dateBytes, _ = obj.DeleteAt.MarshalText()
-	obj.Metadata["__delete_at__"] = string(dateBytes)
 	input := &awss3.PutObjectInput{
 		Body:        aws.ReadSeekCloser(obj.Content),
 		Bucket:      aws.String(container),
 		Key:         aws.String(obj.Name),
 		ContentType: aws.String(obj.ContentType),
-		Tagging:     aws.String(createTagging(obj.Metadata)),
+		Tagging:     aws.String(objectTagging(obj)),
+	}
+
+	_, err = service.PutObject(input)
+
+	return err
+}
+
+//CreateUploadSession starts a multipart upload of obj, obj content is ignored
+func CreateUploadSession(service *awss3.S3, container string, obj api.Object) (*api.UploadSession, error) {
+	expires := obj.DeleteAt != time.Time{}
+	if expires {
+		err := setExpiration(service, container, obj.Name, obj.DeleteAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	out, err := service.CreateMultipartUpload(&awss3.CreateMultipartUploadInput{
+		Bucket:      aws.String(container),
+		Key:         aws.String(obj.Name),
+		ContentType: aws.String(obj.ContentType),
+		Tagging:     aws.String(objectTagging(obj)),
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &api.UploadSession{
+		ID:        pStr(out.UploadId),
+		Container: container,
+		Name:      obj.Name,
+		PartSize:  multipart.PartSize(obj.ContentLength, api.MaxParts),
+		Metadata:  obj.Metadata,
+		DeleteAt:  obj.DeleteAt,
+	}, nil
+}
 
-	_, err := service.PutObject(input)
+//UploadPart uploads a part of a multipart upload
+func UploadPart(service *awss3.S3, session api.UploadSession, number int, content io.ReadSeeker, size int64) (*api.UploadPart, error) {
+	out, err := service.UploadPart(&awss3.UploadPartInput{
+		Body:          content,
+		Bucket:        aws.String(session.Container),
+		Key:           aws.String(session.Name),
+		UploadId:      aws.String(session.ID),
+		PartNumber:    aws.Int64(int64(number)),
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.UploadPart{
+		Number: number,
+		Size:   size,
+		ETag:   pStr(out.ETag),
+	}, nil
+}
 
+//ListUploadParts lists the parts already uploaded in a multipart upload
+func ListUploadParts(service *awss3.S3, session api.UploadSession) ([]api.UploadPart, error) {
+	var parts []api.UploadPart
+	err := service.ListPartsPages(&awss3.ListPartsInput{
+		Bucket:   aws.String(session.Container),
+		Key:      aws.String(session.Name),
+		UploadId: aws.String(session.ID),
+	},
+		func(out *awss3.ListPartsOutput, last bool) bool {
+			for _, p := range out.Parts {
+				parts = append(parts, api.UploadPart{
+					Number: int(pInt64(p.PartNumber)),
+					Size:   pInt64(p.Size),
+					ETag:   pStr(p.ETag),
+				})
+			}
+			return !last
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+//CompleteUploadSession assembles the parts of a multipart upload into the object
+func CompleteUploadSession(service *awss3.S3, session api.UploadSession, parts []api.UploadPart) error {
+	var completed []*awss3.CompletedPart
+	for _, p := range parts {
+		completed = append(completed, &awss3.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int64(int64(p.Number)),
+		})
+	}
+	_, err := service.CompleteMultipartUpload(&awss3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(session.Container),
+		Key:      aws.String(session.Name),
+		UploadId: aws.String(session.ID),
+		MultipartUpload: &awss3.CompletedMultipartUpload{
+			Parts: completed,
+		},
+	})
+	return err
+}
+
+//AbortUploadSession aborts a multipart upload and deletes its uploaded parts
+func AbortUploadSession(service *awss3.S3, session api.UploadSession) error {
+	_, err := service.AbortMultipartUpload(&awss3.AbortMultipartUploadInput{
+		Bucket:   aws.String(session.Container),
+		Key:      aws.String(session.Name),
+		UploadId: aws.String(session.ID),
+	})
 	return err
 }
 
+//uploader uploads objects in parts with the S3 multipart upload API
+type uploader struct {
+	service *awss3.S3
+}
+
+func (u *uploader) CreateUploadSession(container string, obj api.Object) (*api.UploadSession, error) {
+	return CreateUploadSession(u.service, container, obj)
+}
+
+func (u *uploader) UploadPart(session api.UploadSession, number int, content io.ReadSeeker, size int64) (*api.UploadPart, error) {
+	return UploadPart(u.service, session, number, content, size)
+}
+
+func (u *uploader) ListUploadParts(session api.UploadSession) ([]api.UploadPart, error) {
+	return ListUploadParts(u.service, session)
+}
+
+func (u *uploader) CompleteUploadSession(session api.UploadSession, parts []api.UploadPart) error {
+	return CompleteUploadSession(u.service, session, parts)
+}
+
+func (u *uploader) AbortUploadSession(session api.UploadSession) error {
+	return AbortUploadSession(u.service, session)
+}
+
 //UpdateObjectMetadata update an object into an object container
 func UpdateObjectMetadata(service *awss3.S3, container string, obj api.Object) error {
 	//meta, err := c.GetObjectMetadata(container, obj.Name
@@ -128,12 +279,14 @@ func GetObject(service *awss3.S3, container string, name string, ranges []api.Ra
 	for _, r := range ranges {
 		rList = append(rList, r.String())
 	}
-	sRanges := strings.Join(rList, ",")
-	out, err := service.GetObject(&awss3.GetObjectInput{
+	input := &awss3.GetObjectInput{
 		Bucket: aws.String(container),
 		Key:    aws.String(name),
-		Range:  aws.String(sRanges),
-	})
+	}
+	if len(rList) > 0 {
+		input.Range = aws.String("bytes=" + strings.Join(rList, ","))
+	}
+	out, err := service.GetObject(input)
 	if err != nil {
 		return nil, err
 	}
@@ -90,12 +90,17 @@ func (c *Client) Build(params map[string]interface{}) (api.ClientAPI, error) {
 	Password, _ := params["Password"].(string)
 	TenantName, _ := params["TenantName"].(string)
 	Region, _ := params["Region"].(string)
-	return AuthenticatedClient(AuthOptions{
+	client, err := AuthenticatedClient(AuthOptions{
 		Username:   Username,
 		Password:   Password,
 		TenantName: TenantName,
 		Region:     Region,
 	})
+	if err != nil {
+		return nil, err
+	}
+	client.Cfg.NetworkCIDRPool, _ = params["NetworkCIDRPool"].(string)
+	return client, nil
 }
 
 func init() {
@@ -0,0 +1,315 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package flexibleengine
+
+import (
+	"fmt"
+
+	gc "github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+//The VPC router routes the traffic between all the subnets of the VPC, the traffic of the networks not peered anymore
+//is denied by the network ACLs of their subnets
+//A network ACL is a firewall group bound to the router interface of the subnet, its ingress policy holds a deny rule
+//for each former peer followed by a rule letting in the rest of the traffic
+
+//routerInterfaceOwner is the device owner of the port connecting a subnet to the VPC router
+const routerInterfaceOwner = "network:router_interface_distributed"
+
+type firewallRule struct {
+	ID              string `json:"id,omitempty"`
+	Name            string `json:"name"`
+	Action          string `json:"action"`
+	IPVersion       int    `json:"ip_version"`
+	SourceIPAddress string `json:"source_ip_address,omitempty"`
+	Enabled         bool   `json:"enabled"`
+}
+
+type firewallPolicy struct {
+	ID            string   `json:"id,omitempty"`
+	Name          string   `json:"name"`
+	FirewallRules []string `json:"firewall_rules"`
+}
+
+type firewallGroup struct {
+	ID                      string   `json:"id,omitempty"`
+	Name                    string   `json:"name"`
+	IngressFirewallPolicyID string   `json:"ingress_firewall_policy_id,omitempty"`
+	EgressFirewallPolicyID  string   `json:"egress_firewall_policy_id,omitempty"`
+	Ports                   []string `json:"ports"`
+}
+
+//aclName returns the name of the network ACL of the network identified by networkID
+func aclName(networkID string) string {
+	return "acl-" + networkID
+}
+
+//denyRuleName returns the name of the rule of the network ACL of the network identified by networkID denying the
+//traffic of the network identified by peerID
+func denyRuleName(networkID, peerID string) string {
+	return fmt.Sprintf("deny-%s-%s", networkID, peerID)
+}
+
+//fwaasRequest sends the request method on the network ACL resource, body and result being its JSON bodies
+func (client *Client) fwaasRequest(method string, resource string, body interface{}, result interface{}) error {
+	url := client.osclt.Network.Endpoint + "v2.0/fwaas/" + resource
+	opts := gc.RequestOpts{
+		JSONBody:     body,
+		JSONResponse: result,
+		OkCodes:      []int{200, 201, 204},
+	}
+	_, err := client.osclt.Provider.Request(method, url, &opts)
+	return err
+}
+
+//getACL returns the network ACL of the network identified by networkID, nil if the network has none
+func (client *Client) getACL(networkID string) (*firewallGroup, error) {
+	var r struct {
+		FirewallGroups []firewallGroup `json:"firewall_groups"`
+	}
+	err := client.fwaasRequest("GET", "firewall_groups?name="+aclName(networkID), nil, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.FirewallGroups) == 0 {
+		return nil, nil
+	}
+	return &r.FirewallGroups[0], nil
+}
+
+//getACLPolicy returns the firewall policy identified by id
+func (client *Client) getACLPolicy(id string) (*firewallPolicy, error) {
+	var r struct {
+		FirewallPolicy firewallPolicy `json:"firewall_policy"`
+	}
+	err := client.fwaasRequest("GET", "firewall_policies/"+id, nil, &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r.FirewallPolicy, nil
+}
+
+//createACLRule creates the firewall rule
+func (client *Client) createACLRule(rule firewallRule) (string, error) {
+	var r struct {
+		FirewallRule firewallRule `json:"firewall_rule"`
+	}
+	err := client.fwaasRequest("POST", "firewall_rules", map[string]interface{}{"firewall_rule": rule}, &r)
+	if err != nil {
+		return "", err
+	}
+	return r.FirewallRule.ID, nil
+}
+
+//createACLPolicy creates a firewall policy named name holding a rule letting in or out all the traffic
+func (client *Client) createACLPolicy(name string) (string, error) {
+	ruleID, err := client.createACLRule(firewallRule{
+		Name:      "allow-" + name,
+		Action:    "allow",
+		IPVersion: 4,
+		Enabled:   true,
+	})
+	if err != nil {
+		return "", err
+	}
+	var r struct {
+		FirewallPolicy firewallPolicy `json:"firewall_policy"`
+	}
+	err = client.fwaasRequest("POST", "firewall_policies", map[string]interface{}{
+		"firewall_policy": firewallPolicy{Name: name, FirewallRules: []string{ruleID}},
+	}, &r)
+	if err != nil {
+		client.fwaasRequest("DELETE", "firewall_rules/"+ruleID, nil, nil)
+		return "", err
+	}
+	return r.FirewallPolicy.ID, nil
+}
+
+//deleteACLPolicy deletes the firewall policy identified by id and its rules
+func (client *Client) deleteACLPolicy(id string) error {
+	policy, err := client.getACLPolicy(id)
+	if err != nil {
+		return err
+	}
+	err = client.fwaasRequest("DELETE", "firewall_policies/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	for _, ruleID := range policy.FirewallRules {
+		err = client.fwaasRequest("DELETE", "firewall_rules/"+ruleID, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//listRouterInterfaces lists the ports connecting the subnet of the network identified by networkID to the VPC router
+func (client *Client) listRouterInterfaces(networkID string) ([]string, error) {
+	var ids []string
+	err := ports.List(client.osclt.Network, ports.ListOpts{
+		NetworkID:   networkID,
+		DeviceOwner: routerInterfaceOwner,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := ports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range list {
+			ids = append(ids, p.ID)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("network %s is not connected to the VPC router", networkID)
+	}
+	return ids, nil
+}
+
+//createACL creates the network ACL of the network identified by networkID, letting in and out all the traffic
+func (client *Client) createACL(networkID string) (*firewallGroup, error) {
+	portIDs, err := client.listRouterInterfaces(networkID)
+	if err != nil {
+		return nil, err
+	}
+	ingressID, err := client.createACLPolicy(aclName(networkID) + "-in")
+	if err != nil {
+		return nil, err
+	}
+	egressID, err := client.createACLPolicy(aclName(networkID) + "-out")
+	if err != nil {
+		client.deleteACLPolicy(ingressID)
+		return nil, err
+	}
+	var r struct {
+		FirewallGroup firewallGroup `json:"firewall_group"`
+	}
+	err = client.fwaasRequest("POST", "firewall_groups", map[string]interface{}{
+		"firewall_group": firewallGroup{
+			Name:                    aclName(networkID),
+			IngressFirewallPolicyID: ingressID,
+			EgressFirewallPolicyID:  egressID,
+			Ports:                   portIDs,
+		},
+	}, &r)
+	if err != nil {
+		client.deleteACLPolicy(ingressID)
+		client.deleteACLPolicy(egressID)
+		return nil, err
+	}
+	return &r.FirewallGroup, nil
+}
+
+//deleteACL deletes the network ACL of the network identified by networkID, if any
+func (client *Client) deleteACL(networkID string) error {
+	acl, err := client.getACL(networkID)
+	if err != nil || acl == nil {
+		return err
+	}
+	// The subnet is released before the deletion of the firewall group
+	err = client.fwaasRequest("PUT", "firewall_groups/"+acl.ID, map[string]interface{}{
+		"firewall_group": map[string]interface{}{"ports": []string{}},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	err = client.fwaasRequest("DELETE", "firewall_groups/"+acl.ID, nil, nil)
+	if err != nil {
+		return err
+	}
+	for _, id := range []string{acl.IngressFirewallPolicyID, acl.EgressFirewallPolicyID} {
+		err = client.deleteACLPolicy(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//denyPeerTraffic adds to the network ACL of the network identified by networkID the rule denying the traffic of the
+//network identified by peerID, whose CIDR is peerCIDR
+func (client *Client) denyPeerTraffic(networkID, peerID, peerCIDR string) error {
+	acl, err := client.getACL(networkID)
+	if err != nil {
+		return err
+	}
+	if acl == nil {
+		acl, err = client.createACL(networkID)
+		if err != nil {
+			return err
+		}
+	}
+	policy, err := client.getACLPolicy(acl.IngressFirewallPolicyID)
+	if err != nil {
+		return err
+	}
+	ruleID, err := client.createACLRule(firewallRule{
+		Name:            denyRuleName(networkID, peerID),
+		Action:          "deny",
+		IPVersion:       4,
+		SourceIPAddress: peerCIDR,
+		Enabled:         true,
+	})
+	if err != nil {
+		return err
+	}
+	// The deny rules come first, the last rule of the policy lets in the rest of the traffic
+	insert := map[string]string{"firewall_rule_id": ruleID}
+	if len(policy.FirewallRules) > 0 {
+		insert["insert_before"] = policy.FirewallRules[0]
+	}
+	err = client.fwaasRequest("PUT", "firewall_policies/"+policy.ID+"/insert_rule", insert, nil)
+	if err != nil {
+		client.fwaasRequest("DELETE", "firewall_rules/"+ruleID, nil, nil)
+		return err
+	}
+	return nil
+}
+
+//allowPeerTraffic removes from the network ACL of the network identified by networkID the rules added by
+//denyPeerTraffic for the network identified by peerID
+func (client *Client) allowPeerTraffic(networkID, peerID string) error {
+	acl, err := client.getACL(networkID)
+	if err != nil || acl == nil {
+		return err
+	}
+	var r struct {
+		FirewallRules []firewallRule `json:"firewall_rules"`
+	}
+	err = client.fwaasRequest("GET", "firewall_rules?name="+denyRuleName(networkID, peerID), nil, &r)
+	if err != nil {
+		return err
+	}
+	for _, rule := range r.FirewallRules {
+		err = client.fwaasRequest("PUT", "firewall_policies/"+acl.IngressFirewallPolicyID+"/remove_rule", map[string]string{
+			"firewall_rule_id": rule.ID,
+		}, nil)
+		if err != nil {
+			return err
+		}
+		err = client.fwaasRequest("DELETE", "firewall_rules/"+rule.ID, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -96,6 +96,10 @@ type CfgOptions struct {
 
 	//VolumeSpeeds map volume types with volume speeds
 	VolumeSpeeds map[string]VolumeSpeed.Enum
+
+	//NetworkCIDRPool is the network the CIDRs of the networks created without CIDR are allocated from (optional)
+	//The CIDR of the VPC is used by default
+	NetworkCIDRPool string
 }
 
 //errorString creates an error string from flexibleengine api error
@@ -223,6 +227,14 @@ func AuthenticatedClient(opts AuthOptions, cfg CfgOptions) (*Client, error) {
 		return nil, fmt.Errorf("%s", errorString(err))
 	}
 
+	//Block storage API v3, needed to extend attached volumes; VolumeV3 is nil if not deployed
+	blockStorageV3, err := openstack.NewBlockStorageV3(provider, gc.EndpointOpts{
+		Region: opts.Region,
+	})
+	if err != nil {
+		blockStorageV3 = nil
+	}
+
 	// Need to get Endpoint URL for ObjectStorage, thzt will be used with AWS S3 protocol
 	objectStorage, err := gcos.NewObjectStorageV1(provider, gc.EndpointOpts{
 		Type:   "object",
@@ -280,6 +292,7 @@ func AuthenticatedClient(opts AuthOptions, cfg CfgOptions) (*Client, error) {
 		Compute:  compute,
 		Network:  network,
 		Volume:   blockStorage,
+		VolumeV3: blockStorageV3,
 		//Container:   objectStorage,
 		ScriptBox:   box,
 		UserDataTpl: tpl,
@@ -312,6 +325,34 @@ func AuthenticatedClient(opts AuthOptions, cfg CfgOptions) (*Client, error) {
 	if err != nil {
 		fmt.Printf("failed to create Object Container %s: %s\n", api.VMContainerName, err)
 	}
+	err = clt.CreateContainer(api.VolumeContainerName)
+	if err != nil {
+		fmt.Printf("failed to create Object Container %s: %s\n", api.VolumeContainerName, err)
+	}
+	err = clt.CreateContainer(api.MountContainerName)
+	if err != nil {
+		fmt.Printf("failed to create Object Container %s: %s\n", api.MountContainerName, err)
+	}
+	err = clt.CreateContainer(api.PublicIPContainerName)
+	if err != nil {
+		fmt.Printf("failed to create Object Container %s: %s\n", api.PublicIPContainerName, err)
+	}
+	err = clt.CreateContainer(api.LoadBalancerContainerName)
+	if err != nil {
+		fmt.Printf("failed to create Object Container %s: %s\n", api.LoadBalancerContainerName, err)
+	}
+	err = clt.CreateContainer(api.DNSContainerName)
+	if err != nil {
+		fmt.Printf("failed to create Object Container %s: %s\n", api.DNSContainerName, err)
+	}
+	err = clt.CreateContainer(api.VPNContainerName)
+	if err != nil {
+		fmt.Printf("failed to create Object Container %s: %s\n", api.VPNContainerName, err)
+	}
+	err = clt.CreateContainer(api.CIDRContainerName)
+	if err != nil {
+		fmt.Printf("failed to create Object Container %s: %s\n", api.CIDRContainerName, err)
+	}
 	return &clt, nil
 }
 
@@ -346,6 +387,7 @@ func (client *Client) Build(params map[string]interface{}) (api.ClientAPI, error
 	Region, _ := params["Region"].(string)
 	S3AccessKeyID, _ := params["S3AccessKeyID"].(string)
 	S3AccessKeyPassword, _ := params["S3AccessKeyPassword"].(string)
+	NetworkCIDRPool, _ := params["NetworkCIDRPool"].(string)
 	return AuthenticatedClient(AuthOptions{
 		Username:            Username,
 		Password:            Password,
@@ -366,6 +408,7 @@ func (client *Client) Build(params map[string]interface{}) (api.ClientAPI, error
 			"SAS":  VolumeSpeed.HDD,
 			"SSD":  VolumeSpeed.SSD,
 		},
+		NetworkCIDRPool: NetworkCIDRPool,
 	})
 }
 
@@ -678,6 +721,11 @@ func (client *Client) GetCfgOpts() (api.Config, error) {
 
 	cfg.Set("DNSList", client.Cfg.DNSList)
 	cfg.Set("S3Protocol", "s3")
+	if client.Cfg.NetworkCIDRPool != "" {
+		cfg.Set("NetworkCIDRPool", client.Cfg.NetworkCIDRPool)
+	} else {
+		cfg.Set("NetworkCIDRPool", client.Opts.VPCCIDR)
+	}
 
 	return cfg, nil
 }
@@ -29,8 +29,10 @@ import (
 
 	"github.com/CS-SI/SafeScale/providers"
 	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
 	"github.com/CS-SI/SafeScale/providers/api/VMState"
+	"github.com/CS-SI/SafeScale/providers/openstack"
 	"github.com/CS-SI/SafeScale/system"
 	uuid "github.com/satori/go.uuid"
 
@@ -245,11 +247,12 @@ func (opts serverCreateOpts) ToServerCreateMap() (map[string]interface{}, error)
 
 //CreateVM creates a new VM
 func (client *Client) CreateVM(request api.VMRequest) (*api.VM, error) {
-	return client.createVM(request, false)
+	return client.createVM(request, false, nil)
 }
 
 //createVM creates a new VM and configure it as gateway for the network if isGateway is true
-func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM, error) {
+//vrrp is the VRRP configuration of a gateway in high availability, nil otherwise
+func (client *Client) createVM(request api.VMRequest, isGateway bool, vrrp *openstack.VRRPConfig) (*api.VM, error) {
 	if isGateway && !request.PublicIP {
 		return nil, fmt.Errorf("can't create a gateway without public IP")
 	}
@@ -260,17 +263,15 @@ func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM,
 	}
 
 	//Eventual network gateway
-	var gw *api.VM
+	var gw *api.Gateway
+	var gwVM *api.VM
 	// If the VM is not public it has to be created on a network owning a Gateway
 	if !request.PublicIP {
-		gwServer, err := client.loadGateway(request.NetworkIDs[0])
+		var err error
+		gw, gwVM, err = client.loadGateway(request.NetworkIDs[0])
 		if err != nil {
 			return nil, fmt.Errorf("No private VM can be created on a network without gateway")
 		}
-		gw, err = client.readVMDefinition(gwServer.ID)
-		if err != nil {
-			return nil, fmt.Errorf("Bad state, Gateway for network %s is not accessible", request.NetworkIDs[0])
-		}
 	}
 
 	var nets []servers.Network
@@ -295,7 +296,7 @@ func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM,
 		defer client.DeleteKeyPair(kp.ID)
 	}
 
-	userData, err := client.osclt.PrepareUserData(request, isGateway, kp, gw)
+	userData, err := client.osclt.PrepareUserData(request, isGateway, kp, openstack.GatewayIP(gw, gwVM), vrrp, nil)
 
 	// Determine system disk size based on vcpus count
 	template, err := client.GetTemplate(request.TemplateID)
@@ -369,12 +370,13 @@ func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM,
 	// Fixes the size of bootdisk, FlexibleEngine is used to not give one...
 	vm.Size.DiskSize = diskSize
 	vm.PrivateKey = kp.PrivateKey
-	//Add gateway ID to VM definition
-	var gwID string
-	if gw != nil {
-		gwID = gw.ID
+	//Add gateway IDs to VM definition
+	if gwVM != nil {
+		vm.GatewayID = gwVM.ID
+		if len(gw.VMIDs) > 1 {
+			vm.GatewayIDs = gw.VMIDs
+		}
 	}
-	vm.GatewayID = gwID
 
 	//if Floating IP are not used or no public address is requested
 	if request.PublicIP {
@@ -425,16 +427,24 @@ func validateVMName(req api.VMRequest) (bool, error) {
 	return true, nil
 }
 
-func (client *Client) loadGateway(networkID string) (*servers.Server, error) {
-	gwID, err := client.GetGateway(networkID)
+//loadGateway returns the gateway of the network identified by networkID and its first started VM
+//The VM is nil if the network has no started bastion and its egress traffic is not routed by a VM
+func (client *Client) loadGateway(networkID string) (*api.Gateway, *api.VM, error) {
+	gw, err := client.GetGateway(networkID)
 	if err != nil {
-		return nil, fmt.Errorf("unable to find Gateway %s", errorString(err))
+		return nil, nil, fmt.Errorf("unable to find Gateway %s", errorString(err))
 	}
-	gw, err := servers.Get(client.osclt.Compute, gwID).Extract()
-	if err != nil {
-		return nil, fmt.Errorf("unable to find Gateway %s", errorString(err))
+	for _, id := range gw.VMIDs {
+		vm, err := client.GetVM(id)
+		if err != nil || vm.State != VMState.STARTED {
+			continue
+		}
+		return gw, vm, nil
 	}
-	return gw, nil
+	if gw.Mode != GatewayMode.VM {
+		return gw, nil, nil
+	}
+	return nil, nil, fmt.Errorf("no gateway of network %s is started", networkID)
 }
 
 //WaitVMState waits a vm achieve state
@@ -667,18 +677,11 @@ func (client *Client) getSSHConfig(vm *api.VM) (*system.SSHConfig, error) {
 		User:       api.DefaultUser,
 	}
 	if vm.GatewayID != "" {
-		gw, err := client.GetVM(vm.GatewayID)
+		gatewayConfig, err := openstack.GetGatewaySSHConfig(client.GetVM, vm)
 		if err != nil {
 			return nil, err
 		}
-		ip := gw.GetAccessIP()
-		GatewayConfig := system.SSHConfig{
-			PrivateKey: gw.PrivateKey,
-			Port:       22,
-			User:       api.DefaultUser,
-			Host:       ip,
-		}
-		sshConfig.GatewayConfig = &GatewayConfig
+		sshConfig.GatewayConfig = gatewayConfig
 	}
 
 	return &sshConfig, nil
@@ -909,7 +912,7 @@ func (client *Client) convertAdresses(addresses map[string]interface{}) map[IPVe
 			case 4:
 				addrs[IPVersion.IPv4] = append(addrs[IPVersion.IPv4], fixedIP)
 			case 6:
-				addrs[IPVersion.IPv6] = append(addrs[IPVersion.IPv4], fixedIP)
+				addrs[IPVersion.IPv6] = append(addrs[IPVersion.IPv6], fixedIP)
 			}
 			//}
 		}
@@ -936,6 +939,7 @@ func (client *Client) toVM(server *servers.Server) *api.VM {
 	vmDef, err := client.readVMDefinition(server.ID)
 	if err == nil {
 		vm.GatewayID = vmDef.GatewayID
+		vm.GatewayIDs = vmDef.GatewayIDs
 		vm.PrivateKey = vmDef.PrivateKey
 		//Floating IP management
 		if vm.AccessIPv4 == "" {
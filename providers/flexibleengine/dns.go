@@ -0,0 +1,44 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package flexibleengine
+
+import (
+	"github.com/CS-SI/SafeScale/providers/api"
+)
+
+//notAvailableDNS is returned as the private zones of FlexibleEngine are not managed yet, so the zones are served by the gateways
+var notAvailableDNS = &api.NotAvailableError{Message: "DNS zones are not available: private zones of FlexibleEngine are not managed yet"}
+
+//CreateDNSZone returns a NotAvailableError
+func (client *Client) CreateDNSZone(networkID string, domain string) (*api.DNSZone, error) {
+	return nil, notAvailableDNS
+}
+
+//AddDNSRecord returns a NotAvailableError
+func (client *Client) AddDNSRecord(zoneID string, record api.DNSRecord) error {
+	return notAvailableDNS
+}
+
+//RemoveDNSRecord returns a NotAvailableError
+func (client *Client) RemoveDNSRecord(zoneID string, record api.DNSRecord) error {
+	return notAvailableDNS
+}
+
+//DeleteDNSZone returns a NotAvailableError
+func (client *Client) DeleteDNSZone(zoneID string) error {
+	return notAvailableDNS
+}
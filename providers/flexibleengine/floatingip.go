@@ -23,6 +23,7 @@ import (
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/gophercloud/gophercloud/pagination"
 )
 
@@ -61,6 +62,8 @@ type FloatingIP struct {
 	TenantID        string `json:"tenant_id"`
 	CreateTime      string `json:"create_time"`
 	BandwidthSize   int    `json:"bandwidth_size"`
+	//PortID is the ID of the port the floating IP is bound to, empty if the floating IP is not bound
+	PortID string `json:"port_id,omitempty"`
 }
 
 type floatingIPPage struct {
@@ -274,3 +277,134 @@ func (client *Client) DissociateFloatingIP(vm *api.VM, id string) error {
 	}
 	return nil
 }
+
+//toPublicIP converts a floating IP into an api public IP, the VM being the owner of the port the floating IP is bound to
+func (client *Client) toPublicIP(fip *FloatingIP) (*api.PublicIP, error) {
+	ip := api.PublicIP{
+		ID: fip.ID,
+		IP: fip.PublicIPAddress,
+	}
+	if fip.PortID != "" {
+		port, err := ports.Get(client.osclt.Network, fip.PortID).Extract()
+		if err != nil {
+			return nil, err
+		}
+		ip.VMID = port.DeviceID
+	}
+	return &ip, nil
+}
+
+//CreatePublicIP reserves a public IP
+func (client *Client) CreatePublicIP() (*api.PublicIP, error) {
+	fip, err := client.CreateFloatingIP()
+	if err != nil {
+		return nil, err
+	}
+	return client.toPublicIP(fip)
+}
+
+//GetPublicIP returns the public IP identified by id
+func (client *Client) GetPublicIP(id string) (*api.PublicIP, error) {
+	fip, err := client.GetFloatingIP(id)
+	if err != nil {
+		return nil, err
+	}
+	return client.toPublicIP(fip)
+}
+
+//ListPublicIPs lists the public IPs of the VPC
+func (client *Client) ListPublicIPs() ([]api.PublicIP, error) {
+	var ips []api.PublicIP
+	err := client.ListFloatingIPs().EachPage(func(page pagination.Page) (bool, error) {
+		list, err := extractFloatingIPs(page)
+		if err != nil {
+			return false, err
+		}
+		for _, fip := range list {
+			ip, err := client.toPublicIP(&fip)
+			if err != nil {
+				return false, err
+			}
+			ips = append(ips, *ip)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list public IPs: %s", errorString(err))
+	}
+	return ips, nil
+}
+
+//AttachPublicIP attaches the public IP identified by id to the VM identified by vmID
+//The public IP becomes the access IP of the VM
+func (client *Client) AttachPublicIP(id string, vmID string) error {
+	ip, err := client.GetPublicIP(id)
+	if err != nil {
+		return err
+	}
+	if ip.VMID != "" {
+		return fmt.Errorf("Public IP '%s' is already attached to VM '%s'", ip.IP, ip.VMID)
+	}
+	vm, err := client.GetVM(vmID)
+	if err != nil {
+		return err
+	}
+	err = client.AssociateFloatingIP(vm, id)
+	if err != nil {
+		return err
+	}
+	return client.setVMAccessIP(vmID, "", ip.IP)
+}
+
+//DetachPublicIP detaches the public IP identified by id from its VM
+func (client *Client) DetachPublicIP(id string) error {
+	ip, err := client.GetPublicIP(id)
+	if err != nil {
+		return err
+	}
+	if ip.VMID == "" {
+		return fmt.Errorf("Public IP '%s' is not attached", ip.IP)
+	}
+	vm, err := client.GetVM(ip.VMID)
+	if err != nil {
+		return err
+	}
+	err = client.DissociateFloatingIP(vm, id)
+	if err != nil {
+		return err
+	}
+	return client.setVMAccessIP(ip.VMID, ip.IP, "")
+}
+
+//DeletePublicIP releases the public IP identified by id, which must not be attached
+func (client *Client) DeletePublicIP(id string) error {
+	ip, err := client.GetPublicIP(id)
+	if err != nil {
+		return err
+	}
+	if ip.VMID != "" {
+		return fmt.Errorf("Public IP '%s' is attached to VM '%s'", ip.IP, ip.VMID)
+	}
+	err = client.DeleteFloatingIP(id)
+	if err != nil {
+		return fmt.Errorf("Failed to delete public IP '%s': %s", ip.IP, errorString(err))
+	}
+	return nil
+}
+
+//setVMAccessIP replaces the access IP old of the VM identified by vmID by ip in the VM definition
+//If old is empty the access IP is replaced whatever it is
+func (client *Client) setVMAccessIP(vmID string, old string, ip string) error {
+	vm, err := client.readVMDefinition(vmID)
+	if err != nil {
+		// VMs not created by SafeScale have no definition
+		return nil
+	}
+	if old != "" && vm.AccessIPv4 != old && vm.AccessIPv6 != old {
+		return nil
+	}
+	vm.AccessIPv4 = ""
+	vm.AccessIPv6 = ""
+	updateAccessIPsOfVM(vm, ip)
+	return client.saveVMDefinition(*vm)
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package flexibleengine
+
+import (
+	"github.com/CS-SI/SafeScale/providers/api"
+)
+
+//CreateLoadBalancer creates an Enhanced Load Balancer, which is managed through the LBaaS v2 API of the network service
+func (client *Client) CreateLoadBalancer(req api.LoadBalancerRequest) (*api.LoadBalancer, error) {
+	return client.osclt.CreateLoadBalancer(req)
+}
+
+//GetLoadBalancer returns the load balancer identified by id
+func (client *Client) GetLoadBalancer(id string) (*api.LoadBalancer, error) {
+	return client.osclt.GetLoadBalancer(id)
+}
+
+//AddLoadBalancerBackend adds the VM identified by vmID, receiving the traffic on ip:port, to the backends of the load balancer identified by id
+func (client *Client) AddLoadBalancerBackend(id string, vmID string, ip string, port int) error {
+	return client.osclt.AddLoadBalancerBackend(id, vmID, ip, port)
+}
+
+//RemoveLoadBalancerBackend removes the VM identified by vmID from the backends of the load balancer identified by id
+func (client *Client) RemoveLoadBalancerBackend(id string, vmID string) error {
+	return client.osclt.RemoveLoadBalancerBackend(id, vmID)
+}
+
+//DeleteLoadBalancer deletes the load balancer identified by id
+func (client *Client) DeleteLoadBalancer(id string) error {
+	return client.osclt.DeleteLoadBalancer(id)
+}
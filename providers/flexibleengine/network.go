@@ -18,15 +18,20 @@ package flexibleengine
 
 import (
 	"bytes"
+	"encoding/gob"
 	"fmt"
 	"net"
+	"path"
 	"strings"
 
 	"github.com/CS-SI/SafeScale/providers"
 	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
+	"github.com/CS-SI/SafeScale/providers/openstack"
 	gc "github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
+	secrules "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
 	"github.com/gophercloud/gophercloud/pagination"
@@ -186,6 +191,13 @@ func (client *Client) CreateNetwork(req api.NetworkRequest) (*api.Network, error
 	if ok, err := validateNetworkName(req); !ok {
 		return nil, fmt.Errorf("network name '%s' invalid: %s", req.Name, err)
 	}
+	// The subnets of the VPC are not routed to Internet without a NAT gateway, which is not managed yet
+	if req.GatewayMode == GatewayMode.ROUTER {
+		return nil, fmt.Errorf("error creating Network '%s': router gateway mode not supported by FlexibleEngine", req.Name)
+	}
+	if req.IPv6CIDR != "" {
+		return nil, fmt.Errorf("error creating Network '%s': dual-stack networks not supported by FlexibleEngine", req.Name)
+	}
 
 	subnet, err = client.createSubnet(req.Name, req.CIDR)
 	if err != nil {
@@ -273,6 +285,10 @@ func (client *Client) listMonitoredNetworks() ([]api.Network, error) {
 	var netList []api.Network
 
 	for _, netID := range netIDs {
+		// Only the gateway of a network is stored under its ID, other entries are named <network ID>/...
+		if strings.Contains(netID, "/") {
+			continue
+		}
 		net, err := client.GetNetwork(netID)
 		if err != nil {
 			return nil, providers.ResourceNotFoundError("Network", netID)
@@ -288,10 +304,35 @@ func (client *Client) listMonitoredNetworks() ([]api.Network, error) {
 
 //DeleteNetwork consists to delete subnet in FlexibleEngine VPC
 func (client *Client) DeleteNetwork(id string) error {
-	err := client.DeleteGateway(id)
+	peerings, err := client.ListNetworkPeerings(id)
+	if err != nil {
+		return fmt.Errorf("failed to list network peerings: %s", errorString(err))
+	}
+	for _, peering := range peerings {
+		err = client.removePeering(peering)
+		if err != nil {
+			return fmt.Errorf("failed to remove network peering: %s", errorString(err))
+		}
+	}
+	err = client.DeleteGateway(id)
 	if err != nil {
 		return fmt.Errorf("failed to delete gateway VM: %s", errorString(err))
 	}
+	// The network ACLs of the former peers stop denying a CIDR which may be reused
+	nets, err := client.listMonitoredNetworks()
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %s", errorString(err))
+	}
+	for _, n := range nets {
+		err = client.allowPeerTraffic(n.ID, id)
+		if err != nil {
+			return fmt.Errorf("failed to update network ACL of network %s: %s", n.ID, errorString(err))
+		}
+	}
+	err = client.deleteACL(id)
+	if err != nil {
+		return fmt.Errorf("failed to delete network ACL: %s", errorString(err))
+	}
 	return client.deleteSubnet(id)
 }
 
@@ -349,11 +390,6 @@ func convertNumberToIPv4(n uint32) net.IP {
 	return IP
 }
 
-//cidrIntersects tells if the 2 CIDR passed as parameter intersect
-func cidrIntersects(n1, n2 *net.IPNet) bool {
-	return n2.Contains(n1.IP) || n1.Contains(n2.IP)
-}
-
 //createSubnet creates a subnet using native FlexibleEngine API
 func (client *Client) createSubnet(name string, cidr string) (*subnets.Subnet, error) {
 	// Validates CIDR regarding the existing subnets
@@ -361,13 +397,16 @@ func (client *Client) createSubnet(name string, cidr string) (*subnets.Subnet, e
 	if err != nil {
 		return nil, err
 	}
-	network, networkDesc, err := net.ParseCIDR(cidr)
+	network, _, err := net.ParseCIDR(cidr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create subnet '%s (%s)': %s", name, cidr, errorString(err))
 	}
 	for _, s := range *subnets {
-		_, sDesc, _ := net.ParseCIDR(s.CIDR)
-		if cidrIntersects(networkDesc, sDesc) {
+		overlap, err := api.CIDROverlap(cidr, s.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create subnet '%s (%s)': %s", name, cidr, errorString(err))
+		}
+		if overlap {
 			return nil, fmt.Errorf("can't create subnet '%s (%s)', would intersect with '%s (%s)'", name, cidr, s.Name, s.CIDR)
 		}
 	}
@@ -516,24 +555,39 @@ func fromIntIPVersion(v int) IPVersion.Enum {
 	return -1
 }
 
-//writeGateway writes in Object Storage the ID of the VM acting as gateway for the network identified by netID
-func (client *Client) writeGateway(netID string, vmID string) error {
-	err := client.PutObject(api.NetworkContainerName, api.Object{
-		Name:    netID,
-		Content: strings.NewReader(vmID),
+//writeGateway writes in Object Storage the gateway of the network identified by gw.NetworkID
+func (client *Client) writeGateway(gw api.Gateway) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(gw)
+	if err != nil {
+		return err
+	}
+	return client.PutObject(api.NetworkContainerName, api.Object{
+		Name:    gw.NetworkID,
+		Content: bytes.NewReader(buffer.Bytes()),
 	})
-	return err
 }
 
-//readGateway reads inn Object Storage the ID of the VM acting as gateway for the network identified by netID
-func (client *Client) readGateway(netID string) (string, error) {
+//readGateway reads in Object Storage the gateway of the network identified by netID
+//Networks created before high availability support only store the ID of their gateway VM
+func (client *Client) readGateway(netID string) (*api.Gateway, error) {
 	o, err := client.GetObject(api.NetworkContainerName, netID, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	var buffer bytes.Buffer
 	buffer.ReadFrom(o.Content)
-	return buffer.String(), nil
+	content := buffer.String()
+	var gw api.Gateway
+	err = gob.NewDecoder(&buffer).Decode(&gw)
+	if err != nil {
+		return &api.Gateway{
+			NetworkID: netID,
+			VMIDs:     []string{content},
+		}, nil
+	}
+	return &gw, nil
 }
 
 //removeGateway deletes from Object Storage the gateway data for the network identified by netID
@@ -542,48 +596,304 @@ func (client *Client) removeGateway(netID string) error {
 }
 
 //CreateGateway creates a gateway for a network.
-// By current implementation, only one gateway can exist by Network because the object is intended
-// to contain only one vmID
+//If req.HA is true, a pair of gateways sharing a virtual IP with VRRP is created
+//If req.Mode is not GatewayMode.VM, only a bastion is created if req.Bastion is true
 func (client *Client) CreateGateway(req api.GWRequest) error {
 	net, err := client.GetNetwork(req.NetworkID)
 	if err != nil {
 		return fmt.Errorf("Network %s not found: %s", req.NetworkID, errorString(err))
 	}
-	vmReq := api.VMRequest{
-		ImageID:    req.ImageID,
-		KeyPair:    req.KeyPair,
-		Name:       "gw-" + net.Name,
-		TemplateID: req.TemplateID,
-		NetworkIDs: []string{req.NetworkID},
-		PublicIP:   true,
+	if req.Mode != GatewayMode.VM {
+		return client.createBastion(req, net)
+	}
+	gw := api.Gateway{
+		NetworkID: req.NetworkID,
+		Mode:      GatewayMode.VM,
+	}
+	names := []string{"gw-" + net.Name}
+	var vrrpPassword string
+	if req.HA {
+		names = append(names, "gw-"+net.Name+"-2")
+		vip, err := client.osclt.CreateVIP(req.NetworkID, "vip-"+net.Name)
+		if err != nil {
+			return fmt.Errorf("Error creating gateway : %s", errorString(err))
+		}
+		gw.VIP = vip.IP
+		gw.VIPPortID = vip.PortID
+		err = client.allowVRRP()
+		if err != nil {
+			client.deleteGatewayResources(gw)
+			return fmt.Errorf("Error creating gateway : %s", errorString(err))
+		}
+		vrrpPassword = openstack.NewVRRPPassword()
+	}
+
+	for i, name := range names {
+		vmReq := api.VMRequest{
+			ImageID:    req.ImageID,
+			KeyPair:    req.KeyPair,
+			Name:       name,
+			TemplateID: req.TemplateID,
+			NetworkIDs: []string{req.NetworkID},
+			PublicIP:   true,
+		}
+		var vrrp *openstack.VRRPConfig
+		if gw.VIP != "" {
+			vrrp = &openstack.VRRPConfig{
+				VIP:      gw.VIP,
+				Priority: openstack.VRRPMasterPriority - i*openstack.VRRPPriorityStep,
+				Password: vrrpPassword,
+			}
+		}
+		vm, err := client.createVM(vmReq, true, vrrp)
+		if err != nil {
+			client.deleteGatewayResources(gw)
+			return fmt.Errorf("Error creating gateway : %s", errorString(err))
+		}
+		gw.VMIDs = append(gw.VMIDs, vm.ID)
+		if gw.VIP != "" {
+			err = client.osclt.BindVIP(gw.VIP, vm.ID, req.NetworkID)
+			if err != nil {
+				client.deleteGatewayResources(gw)
+				return fmt.Errorf("Error creating gateway : %s", errorString(err))
+			}
+		}
 	}
-	vm, err := client.createVM(vmReq, true)
+
+	err = client.writeGateway(gw)
 	if err != nil {
+		client.deleteGatewayResources(gw)
 		return fmt.Errorf("Error creating gateway : %s", errorString(err))
 	}
-	err = client.writeGateway(req.NetworkID, vm.ID)
+	return nil
+}
+
+//createBastion creates the bastion of a network whose egress traffic is not routed by a VM
+func (client *Client) createBastion(req api.GWRequest, net *api.Network) error {
+	gw := api.Gateway{
+		NetworkID: req.NetworkID,
+		Mode:      req.Mode,
+	}
+	if req.Bastion {
+		vm, err := client.createVM(api.VMRequest{
+			ImageID:    req.ImageID,
+			KeyPair:    req.KeyPair,
+			Name:       "bastion-" + net.Name,
+			TemplateID: req.TemplateID,
+			NetworkIDs: []string{req.NetworkID},
+			PublicIP:   true,
+		}, false, nil)
+		if err != nil {
+			return fmt.Errorf("Error creating bastion : %s", errorString(err))
+		}
+		gw.VMIDs = []string{vm.ID}
+	}
+	err := client.writeGateway(gw)
 	if err != nil {
-		client.DeleteVM(vm.ID)
-		return fmt.Errorf("Error creating gateway : %s", errorString(err))
+		client.deleteGatewayResources(gw)
+		return fmt.Errorf("Error creating bastion : %s", errorString(err))
 	}
 	return nil
 }
 
-//GetGateway returns the name of the gateway of a network
-func (client *Client) GetGateway(networkID string) (string, error) {
-	vmID, err := client.readGateway(networkID)
+//GetGateway returns the gateway of a network
+func (client *Client) GetGateway(networkID string) (*api.Gateway, error) {
+	return client.readGateway(networkID)
+}
+
+//writePeering writes in Object Storage the peering, on the side of each of its networks
+func (client *Client) writePeering(peering api.NetworkPeering) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(peering)
 	if err != nil {
-		return "", err
+		return err
+	}
+	for i, netID := range peering.NetworkIDs {
+		err = client.PutObject(api.NetworkContainerName, api.Object{
+			Name:    fmt.Sprintf("%s/peer/%s", netID, peering.NetworkIDs[1-i]),
+			Content: bytes.NewReader(buffer.Bytes()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//readPeering reads in Object Storage the peering of the networks identified by networkID1 and networkID2
+func (client *Client) readPeering(networkID1, networkID2 string) (*api.NetworkPeering, error) {
+	o, err := client.GetObject(api.NetworkContainerName, fmt.Sprintf("%s/peer/%s", networkID1, networkID2), nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	var peering api.NetworkPeering
+	err = gob.NewDecoder(&buffer).Decode(&peering)
+	if err != nil {
+		return nil, err
+	}
+	return &peering, nil
+}
+
+//PeerNetworks routes the traffic between the networks identified by networkID1 and networkID2
+//The subnets of the VPC are already routed by the VPC router, so the peering is recorded once the network ACLs of both
+//networks stop denying the traffic of the other one
+func (client *Client) PeerNetworks(networkID1, networkID2 string) (*api.NetworkPeering, error) {
+	if networkID1 == networkID2 {
+		return nil, fmt.Errorf("Error peering networks: a network cannot be peered with itself")
+	}
+	if _, err := client.readPeering(networkID1, networkID2); err == nil {
+		return nil, fmt.Errorf("Error peering networks: networks %s and %s are already peered", networkID1, networkID2)
+	}
+	ids := []string{networkID1, networkID2}
+	for _, id := range ids {
+		_, err := client.GetNetwork(id)
+		if err != nil {
+			return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+		}
+	}
+	for i, id := range ids {
+		err := client.allowPeerTraffic(id, ids[1-i])
+		if err != nil {
+			return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+		}
+	}
+	peering := api.NetworkPeering{
+		ID:         client.vpc.ID,
+		NetworkIDs: ids,
+	}
+	err := client.writePeering(peering)
+	if err != nil {
+		return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+	}
+	return &peering, nil
+}
+
+//removePeering deletes from Object Storage the peering, on the side of each of its networks
+func (client *Client) removePeering(peering api.NetworkPeering) error {
+	for i, netID := range peering.NetworkIDs {
+		err := client.DeleteObject(api.NetworkContainerName, fmt.Sprintf("%s/peer/%s", netID, peering.NetworkIDs[1-i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//ListNetworkPeerings lists the peerings of the network identified by networkID
+func (client *Client) ListNetworkPeerings(networkID string) ([]api.NetworkPeering, error) {
+	names, err := client.ListObjects(api.NetworkContainerName, api.ObjectFilter{
+		Prefix: fmt.Sprintf("%s/peer/", networkID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var peerings []api.NetworkPeering
+	for _, name := range names {
+		peering, err := client.readPeering(networkID, path.Base(name))
+		if err != nil {
+			return nil, err
+		}
+		peerings = append(peerings, *peering)
+	}
+	return peerings, nil
+}
+
+//UnpeerNetworks stops routing the traffic between the networks identified by networkID1 and networkID2
+//The VPC router keeps routing between its subnets, so the network ACL of each network denies the traffic of the other one
+func (client *Client) UnpeerNetworks(networkID1, networkID2 string) error {
+	peering, err := client.readPeering(networkID1, networkID2)
+	if err != nil {
+		return fmt.Errorf("Error unpeering networks: networks %s and %s are not peered", networkID1, networkID2)
+	}
+	var nets []*api.Network
+	for _, netID := range peering.NetworkIDs {
+		n, err := client.GetNetwork(netID)
+		if err != nil {
+			return fmt.Errorf("Error unpeering networks: %s", errorString(err))
+		}
+		nets = append(nets, n)
+	}
+	for i, n := range nets {
+		err = client.denyPeerTraffic(n.ID, nets[1-i].ID, nets[1-i].CIDR)
+		if err != nil {
+			client.allowPeerTraffic(nets[0].ID, nets[1].ID)
+			return fmt.Errorf("Error unpeering networks: %s", errorString(err))
+		}
+	}
+	err = client.removePeering(*peering)
+	if err != nil {
+		return fmt.Errorf("Error unpeering networks: %s", errorString(err))
+	}
+	return nil
+}
+
+//ListSecurityRules lists the rules of the default security group, which protects the VMs of all the networks
+func (client *Client) ListSecurityRules(networkID string) ([]api.SecurityRule, error) {
+	var rules []api.SecurityRule
+	err := secrules.List(client.osclt.Network, secrules.ListOpts{
+		SecGroupID: client.SecurityGroup.ID,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := secrules.ExtractRules(page)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range list {
+			rules = append(rules, api.SecurityRule{
+				Direction: r.Direction,
+				Protocol:  r.Protocol,
+				PortFrom:  r.PortRangeMin,
+				PortTo:    r.PortRangeMax,
+				CIDR:      r.RemoteIPPrefix,
+			})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing security rules: %s", errorString(err))
+	}
+	return rules, nil
+}
+
+//deleteGatewayResources deletes the VMs and the virtual IP of a gateway
+func (client *Client) deleteGatewayResources(gw api.Gateway) {
+	for _, id := range gw.VMIDs {
+		client.DeleteVM(id)
+	}
+	if gw.VIPPortID != "" {
+		client.osclt.DeleteVIP(gw.VIPPortID)
 	}
-	return vmID, nil
 }
 
 //DeleteGateway deletes the gateway associated with network identified by ID
 func (client *Client) DeleteGateway(networkID string) error {
-	vmID, err := client.readGateway(networkID)
+	gw, err := client.readGateway(networkID)
 	if err != nil {
 		return fmt.Errorf("Error deleting gateway: %s", errorString(err))
 	}
-	client.DeleteVM(vmID)
+	client.deleteGatewayResources(*gw)
 	return client.removeGateway(networkID)
 }
+
+//allowVRRP adds to the default security group the rules letting gateways exchange VRRP advertisements
+func (client *Client) allowVRRP() error {
+	for _, etherType := range []secrules.RuleEtherType{secrules.EtherType4, secrules.EtherType6} {
+		_, err := secrules.Create(client.osclt.Network, secrules.CreateOpts{
+			Direction:     secrules.DirIngress,
+			EtherType:     etherType,
+			SecGroupID:    client.SecurityGroup.ID,
+			Protocol:      secrules.RuleProtocol(openstack.VRRPProtocol),
+			RemoteGroupID: client.SecurityGroup.ID,
+		}).Extract()
+		if err != nil {
+			if _, ok := err.(gc.ErrDefault409); ok {
+				// The rule already exists
+				continue
+			}
+			return fmt.Errorf("Error allowing VRRP: %s", errorString(err))
+		}
+	}
+	return nil
+}
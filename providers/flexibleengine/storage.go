@@ -18,11 +18,13 @@ package flexibleengine
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/CS-SI/SafeScale/providers/api"
 	"github.com/CS-SI/SafeScale/providers/api/VolumeSpeed"
 	"github.com/CS-SI/SafeScale/providers/api/VolumeState"
 	"github.com/CS-SI/SafeScale/providers/aws/s3"
+	"github.com/CS-SI/SafeScale/providers/openstack"
 
 	v2_vol "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
 
@@ -57,6 +59,16 @@ func (client *Client) DeleteVolume(id string) error {
 	return client.osclt.DeleteVolume(id)
 }
 
+//ExtendVolume extends the volume identified by id to size GB
+func (client *Client) ExtendVolume(id string, size int) error {
+	return client.osclt.ExtendVolume(id, size)
+}
+
+//RetypeVolume changes the speed of the volume identified by id
+func (client *Client) RetypeVolume(id string, speed VolumeSpeed.Enum) error {
+	return openstack.RetypeVolume(client.osclt.Volume, id, client.getVolumeType(speed))
+}
+
 //toVM converts a Volume status returned by the OpenStack driver into VolumeState enum
 func toVolumeState(status string) VolumeState.Enum {
 	switch status {
@@ -203,3 +215,44 @@ func (client *Client) CopyObject(containerSrc, objectSrc, objectDst string) erro
 func (client *Client) DeleteObject(container, object string) error {
 	return s3.DeleteObject(awss3.New(client.S3Session), container, object)
 }
+
+//CreateUploadSession starts the upload in parts of obj, obj content is ignored
+func (client *Client) CreateUploadSession(container string, obj api.Object) (*api.UploadSession, error) {
+	return s3.CreateUploadSession(awss3.New(client.S3Session), container, obj)
+}
+
+//UploadPart uploads a part of an upload session
+func (client *Client) UploadPart(session api.UploadSession, number int, content io.ReadSeeker, size int64) (*api.UploadPart, error) {
+	return s3.UploadPart(awss3.New(client.S3Session), session, number, content, size)
+}
+
+//ListUploadParts lists the parts already uploaded in an upload session
+func (client *Client) ListUploadParts(session api.UploadSession) ([]api.UploadPart, error) {
+	return s3.ListUploadParts(awss3.New(client.S3Session), session)
+}
+
+//CompleteUploadSession assembles the parts of an upload session into the object
+func (client *Client) CompleteUploadSession(session api.UploadSession, parts []api.UploadPart) error {
+	return s3.CompleteUploadSession(awss3.New(client.S3Session), session, parts)
+}
+
+//AbortUploadSession aborts an upload session and deletes its uploaded parts
+func (client *Client) AbortUploadSession(session api.UploadSession) error {
+	return s3.AbortUploadSession(awss3.New(client.S3Session), session)
+}
+
+//CreateObjectStorageCredentials returns the S3 access key configured for the tenant, which is already
+//restricted to the object storage
+func (client *Client) CreateObjectStorageCredentials(container string) (*api.ObjectStorageCredentials, error) {
+	return &api.ObjectStorageCredentials{
+		Endpoint:  *client.S3Session.Config.Endpoint,
+		Region:    client.Opts.Region,
+		AccessKey: client.Opts.S3AccessKeyID,
+		SecretKey: client.Opts.S3AccessKeyPassword,
+	}, nil
+}
+
+//DeleteObjectStorageCredentials does nothing, the S3 access key of the tenant is not managed by SafeScale
+func (client *Client) DeleteObjectStorageCredentials(id string) error {
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package multipart
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CS-SI/SafeScale/providers/api"
+)
+
+const (
+	//Concurrency is the number of parts uploaded in parallel
+	Concurrency = 4
+	//Retries is the number of times the upload of a part is retried before giving up
+	Retries = 3
+)
+
+//Uploader is implemented by the object storages able to upload objects in parts
+type Uploader interface {
+	CreateUploadSession(container string, obj api.Object) (*api.UploadSession, error)
+	UploadPart(session api.UploadSession, number int, content io.ReadSeeker, size int64) (*api.UploadPart, error)
+	ListUploadParts(session api.UploadSession) ([]api.UploadPart, error)
+	CompleteUploadSession(session api.UploadSession, parts []api.UploadPart) error
+	AbortUploadSession(session api.UploadSession) error
+}
+
+//Size returns the size of content, which is rewinded
+func Size(content io.ReadSeeker) (int64, error) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	return size, err
+}
+
+//PartSize returns the size of the parts used to upload an object of size bytes, keeping the number
+//of parts under maxParts, the limit of the object storage
+func PartSize(size int64, maxParts int64) int64 {
+	partSize := api.DefaultPartSize
+	if size/partSize >= maxParts {
+		partSize = size/(maxParts-1) + 1
+	}
+	return partSize
+}
+
+//Put uploads obj in parts, the upload session is aborted on failure
+func Put(u Uploader, container string, obj api.Object, size int64) error {
+	obj.ContentLength = size
+	session, err := u.CreateUploadSession(container, obj)
+	if err != nil {
+		return err
+	}
+	err = Resume(u, *session, obj.Content, size)
+	if err != nil {
+		aerr := u.AbortUploadSession(*session)
+		if aerr != nil {
+			log.Printf("Failed to abort upload session of object '%s': %s", obj.Name, aerr)
+		}
+		return err
+	}
+	return nil
+}
+
+//Resume uploads in parallel the parts of content not yet uploaded in session, then completes the session
+func Resume(u Uploader, session api.UploadSession, content io.ReadSeeker, size int64) error {
+	if session.PartSize <= 0 {
+		return fmt.Errorf("Invalid part size %d in upload session of object '%s'", session.PartSize, session.Name)
+	}
+	uploaded, err := u.ListUploadParts(session)
+	if err != nil {
+		return err
+	}
+
+	nbParts := int((size + session.PartSize - 1) / session.PartSize)
+	if nbParts == 0 {
+		nbParts = 1
+	}
+	parts := make([]api.UploadPart, nbParts)
+	done := map[int]bool{}
+	for _, p := range uploaded {
+		if p.Number >= 1 && p.Number <= nbParts && p.Size == partLength(p.Number, session.PartSize, size) {
+			parts[p.Number-1] = p
+			done[p.Number] = true
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	numbers := make(chan int)
+	for i := 0; i < Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				part, err := uploadPart(u, session, content, &mu, number, size)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil {
+					parts[number-1] = *part
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for number := 1; number <= nbParts; number++ {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		if !done[number] {
+			numbers <- number
+		}
+	}
+	close(numbers)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return u.CompleteUploadSession(session, parts)
+}
+
+//partLength returns the size of the part number of an object of size bytes
+func partLength(number int, partSize int64, size int64) int64 {
+	offset := int64(number-1) * partSize
+	if offset+partSize > size {
+		return size - offset
+	}
+	return partSize
+}
+
+//uploadPart uploads a part of content, retrying on failure
+//If content implements io.ReaderAt parts are read concurrently, otherwise the part is buffered in memory
+func uploadPart(u Uploader, session api.UploadSession, content io.ReadSeeker, mu *sync.Mutex, number int, size int64) (*api.UploadPart, error) {
+	offset := int64(number-1) * session.PartSize
+	length := partLength(number, session.PartSize, size)
+
+	var section io.ReadSeeker
+	if ra, ok := content.(io.ReaderAt); ok {
+		section = io.NewSectionReader(ra, offset, length)
+	} else {
+		buf := make([]byte, length)
+		mu.Lock()
+		_, err := content.Seek(offset, io.SeekStart)
+		if err == nil {
+			_, err = io.ReadFull(content, buf)
+		}
+		mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading part %d of object '%s': %s", number, session.Name, err)
+		}
+		section = bytes.NewReader(buf)
+	}
+
+	var err error
+	for attempt := 0; attempt <= Retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Retrying upload of part %d of object '%s' (%d/%d): %s", number, session.Name, attempt, Retries, err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+			_, err = section.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var part *api.UploadPart
+		part, err = u.UploadPart(session, number, section, length)
+		if err == nil {
+			return part, nil
+		}
+	}
+	return nil, fmt.Errorf("Error uploading part %d of object '%s': %s", number, session.Name, err)
+}
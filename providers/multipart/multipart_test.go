@@ -0,0 +1,119 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package multipart_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/multipart"
+)
+
+//memUploader stores parts in memory and fails the first upload of the parts listed in failures
+type memUploader struct {
+	mu        sync.Mutex
+	parts     map[int][]byte
+	failures  map[int]bool
+	uploads   int
+	completed []byte
+	aborted   bool
+}
+
+func newMemUploader() *memUploader {
+	return &memUploader{parts: map[int][]byte{}, failures: map[int]bool{}}
+}
+
+func (u *memUploader) CreateUploadSession(container string, obj api.Object) (*api.UploadSession, error) {
+	return &api.UploadSession{ID: "s1", Container: container, Name: obj.Name, PartSize: 4}, nil
+}
+
+func (u *memUploader) UploadPart(session api.UploadSession, number int, content io.ReadSeeker, size int64) (*api.UploadPart, error) {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.uploads++
+	if u.failures[number] {
+		delete(u.failures, number)
+		return nil, fmt.Errorf("failure of part %d", number)
+	}
+	u.parts[number] = data
+	return &api.UploadPart{Number: number, Size: int64(len(data))}, nil
+}
+
+func (u *memUploader) ListUploadParts(session api.UploadSession) ([]api.UploadPart, error) {
+	var parts []api.UploadPart
+	for n, data := range u.parts {
+		parts = append(parts, api.UploadPart{Number: n, Size: int64(len(data))})
+	}
+	return parts, nil
+}
+
+func (u *memUploader) CompleteUploadSession(session api.UploadSession, parts []api.UploadPart) error {
+	var buf bytes.Buffer
+	for _, p := range parts {
+		buf.Write(u.parts[p.Number])
+	}
+	u.completed = buf.Bytes()
+	return nil
+}
+
+func (u *memUploader) AbortUploadSession(session api.UploadSession) error {
+	u.aborted = true
+	return nil
+}
+
+func Test_PutRetriesParts(t *testing.T) {
+	u := newMemUploader()
+	u.failures[2] = true
+	content := "0123456789abcdefghi"
+	err := multipart.Put(u, "c1", api.Object{Name: "o1", Content: strings.NewReader(content)}, int64(len(content)))
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(u.completed))
+	assert.Equal(t, 6, u.uploads)
+	assert.False(t, u.aborted)
+}
+
+func Test_ResumeSkipsUploadedParts(t *testing.T) {
+	u := newMemUploader()
+	content := "0123456789abcdefghi"
+	u.parts[1] = []byte("0123")
+	u.parts[3] = []byte("89ab")
+	session := api.UploadSession{ID: "s1", Container: "c1", Name: "o1", PartSize: 4}
+	err := multipart.Resume(u, session, strings.NewReader(content), int64(len(content)))
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(u.completed))
+	assert.Equal(t, 3, u.uploads)
+}
+
+func Test_PartSize(t *testing.T) {
+	assert.Equal(t, api.DefaultPartSize, multipart.PartSize(10, api.MaxParts))
+	size := api.DefaultPartSize * api.MaxParts * 2
+	assert.True(t, multipart.PartSize(size, api.MaxParts)*api.MaxParts >= size)
+	size = api.DefaultPartSize * api.MaxSLOSegments * 2
+	assert.True(t, multipart.PartSize(size, api.MaxSLOSegments)*api.MaxSLOSegments >= size)
+}
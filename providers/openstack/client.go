@@ -112,6 +112,9 @@ type CfgOptions struct {
 
 	//S3Protocol protocol used to mount object storage (ex: swiftks or s3)
 	S3Protocol string
+
+	//NetworkCIDRPool is the network the CIDRs of the networks created without CIDR are allocated from (optional)
+	NetworkCIDRPool string
 }
 
 //errorString creates an error string from openstack api error
@@ -170,12 +173,27 @@ func AuthenticatedClient(opts AuthOptions, cfg CfgOptions) (*Client, error) {
 		Region: opts.Region,
 	})
 
+	//Block storage API v3, needed to extend attached volumes; not deployed by every provider so VolumeV3 is nil without it
+	blocstorageV3, err := NewBlockStorageV3(pClient, gc.EndpointOpts{
+		Region: opts.Region,
+	})
+	if err != nil {
+		blocstorageV3 = nil
+	}
+
 	objectstorage, err := openstack.NewObjectStorageV1(pClient, gc.EndpointOpts{
 		Region: opts.Region,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("%s", errorString(err))
 	}
+	//DNS API, Designate is not deployed by every provider so DNS is nil without it
+	dns, err := openstack.NewDNSV2(pClient, gc.EndpointOpts{
+		Region: opts.Region,
+	})
+	if err != nil {
+		dns = nil
+	}
 	box, err := rice.FindBox("scripts")
 	if err != nil {
 		return nil, err
@@ -201,7 +219,9 @@ func AuthenticatedClient(opts AuthOptions, cfg CfgOptions) (*Client, error) {
 		Compute:           compute,
 		Network:           network,
 		Volume:            blocstorage,
+		VolumeV3:          blocstorageV3,
 		Container:         objectstorage,
+		DNS:               dns,
 		ScriptBox:         box,
 		UserDataTpl:       tpl,
 		ProviderNetworkID: nID,
@@ -214,6 +234,13 @@ func AuthenticatedClient(opts AuthOptions, cfg CfgOptions) (*Client, error) {
 	clt.CreateContainer(api.NetworkContainerName)
 	clt.CreateContainer(api.VMContainerName)
 	clt.CreateContainer(api.NasContainerName)
+	clt.CreateContainer(api.VolumeContainerName)
+	clt.CreateContainer(api.MountContainerName)
+	clt.CreateContainer(api.PublicIPContainerName)
+	clt.CreateContainer(api.LoadBalancerContainerName)
+	clt.CreateContainer(api.DNSContainerName)
+	clt.CreateContainer(api.VPNContainerName)
+	clt.CreateContainer(api.CIDRContainerName)
 	return &clt, nil
 }
 
@@ -228,7 +255,9 @@ type Client struct {
 	Compute     *gc.ServiceClient
 	Network     *gc.ServiceClient
 	Volume      *gc.ServiceClient
+	VolumeV3    *gc.ServiceClient
 	Container   *gc.ServiceClient
+	DNS         *gc.ServiceClient
 	ScriptBox   *rice.Box
 	UserDataTpl *template.Template
 
@@ -389,6 +418,7 @@ func (client *Client) Build(params map[string]interface{}) (api.ClientAPI, error
 	TenantName, _ := params["TenantName"].(string)
 	Region, _ := params["Region"].(string)
 	FloatingIPPool, _ := params["FloatingIPPool"].(string)
+	NetworkCIDRPool, _ := params["NetworkCIDRPool"].(string)
 	return AuthenticatedClient(
 		AuthOptions{
 			IdentityEndpoint: IdentityEndpoint,
@@ -407,8 +437,9 @@ func (client *Client) Build(params map[string]interface{}) (api.ClientAPI, error
 				"standard":   VolumeSpeed.COLD,
 				"performant": VolumeSpeed.HDD,
 			},
-			DNSList:    []string{"185.23.94.244", "185.23.94.244"},
-			S3Protocol: "swiftks",
+			DNSList:         []string{"185.23.94.244", "185.23.94.244"},
+			S3Protocol:      "swiftks",
+			NetworkCIDRPool: NetworkCIDRPool,
 		},
 	)
 }
@@ -432,6 +463,7 @@ func (client *Client) GetCfgOpts() (api.Config, error) {
 
 	cfg.Set("DNSList", client.Cfg.DNSList)
 	cfg.Set("S3Protocol", client.Cfg.S3Protocol)
+	cfg.Set("NetworkCIDRPool", client.Cfg.NetworkCIDRPool)
 
 	return cfg, nil
 }
@@ -21,9 +21,11 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -33,6 +35,7 @@ import (
 	"github.com/CS-SI/SafeScale/system"
 
 	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
 	"github.com/CS-SI/SafeScale/providers/api/VMState"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
@@ -285,7 +288,7 @@ func (client *Client) convertAdresses(addresses map[string]interface{}) (map[IPV
 				case 4:
 					addrs[IPVersion.IPv4] = append(addrs[IPVersion.IPv4], fixedIP)
 				case 6:
-					addrs[IPVersion.IPv6] = append(addrs[IPVersion.IPv4], fixedIP)
+					addrs[IPVersion.IPv6] = append(addrs[IPVersion.IPv6], fixedIP)
 				}
 			}
 
@@ -317,6 +320,7 @@ func (client *Client) toVM(server *servers.Server) *api.VM {
 	vmDef, err := client.readVMDefinition(server.ID)
 	if err == nil {
 		vm.GatewayID = vmDef.GatewayID
+		vm.GatewayIDs = vmDef.GatewayIDs
 		vm.PrivateKey = vmDef.PrivateKey
 		//Floating IP management
 		if vm.AccessIPv4 == "" {
@@ -347,10 +351,126 @@ type userData struct {
 	ResolveConf string
 	//IP of the gateway
 	GatewayIP string
+	//Virtual IP shared with the other gateway of the network
+	//Used only if IsGateway is true
+	VIP string
+	//VRRP priority of the gateway
+	VRRPPriority int
+	//Password authenticating VRRP advertisements
+	VRRPPassword string
+	//IPv4 network of the first network of the VM, used to find its interface in the network
+	//Used only if IPv6CIDR is not empty
+	NetworkCIDR string
+	//IPv6 network of the first network of the VM if it is dual-stack and its IPv6 prefix is not advertised
+	IPv6CIDR string
+	//First 64 bits of IPv6CIDR, the address of the VM is derived from it and from its MAC address
+	IPv6Prefix string
+	//IPv6 of the gateway, default route of the IPv6 traffic
+	IPv6GatewayIP string
+}
+
+const (
+	//VRRPMasterPriority is the VRRP priority of the first gateway of a pair
+	VRRPMasterPriority = 150
+	//VRRPPriorityStep is the difference of VRRP priority between the gateways of a pair
+	VRRPPriorityStep = 50
+	//VRRPProtocol is the IP protocol number of VRRP
+	VRRPProtocol = "112"
+	//SSHReachableTimeout is the time given to a gateway of a pair to accept SSH connections before failing over
+	SSHReachableTimeout = 5 * time.Second
+)
+
+//VRRPConfig defines the VRRP configuration of a gateway in high availability
+type VRRPConfig struct {
+	//VIP is the virtual IP shared by the gateways
+	VIP string
+	//Priority is the VRRP priority of the gateway, the gateway with the highest one holds the virtual IP
+	Priority int
+	//Password authenticates the VRRP advertisements, only the first 8 characters are used
+	Password string
+}
+
+//IPv6Config defines the IPv6 configuration of a VM of a dual-stack network whose IPv6 traffic is routed by gateway VMs
+//No router advertises the IPv6 prefix of such a network, the VMs derive their address from the prefix and their MAC
+//address, as OpenStack does for SLAAC sub networks
+type IPv6Config struct {
+	//NetworkCIDR is the IPv4 network of the network
+	NetworkCIDR string
+	//CIDR is the IPv6 network of the network, a /64
+	CIDR string
+	//GatewayIP is the IPv6 default route of the VM, empty for a gateway or a public VM
+	GatewayIP string
+}
+
+//Prefix returns the first 64 bits of the IPv6 network of cfg, as 4 groups of hexadecimal digits
+func (cfg *IPv6Config) Prefix() string {
+	_, n, err := net.ParseCIDR(cfg.CIDR)
+	if err != nil {
+		return ""
+	}
+	ip := n.IP.To16()
+	return fmt.Sprintf("%x:%x:%x:%x",
+		binary.BigEndian.Uint16(ip[0:2]), binary.BigEndian.Uint16(ip[2:4]),
+		binary.BigEndian.Uint16(ip[4:6]), binary.BigEndian.Uint16(ip[6:8]))
+}
+
+//ipv6Config returns the IPv6 configuration of a VM whose first network is the network identified by networkID
+//The configuration is nil if the network is not dual-stack or if its IPv6 prefix is advertised by a router
+//- gwVM is the started gateway VM of the network of a private VM, nil otherwise
+func (client *Client) ipv6Config(networkID string, isGateway bool, gwVM *api.VM) *IPv6Config {
+	if client.Cfg.UseLayer3Networking {
+		return nil
+	}
+	n, err := client.GetNetwork(networkID)
+	if err != nil || n.IPv6CIDR == "" {
+		return nil
+	}
+	if !isGateway {
+		gw, err := client.GetGateway(networkID)
+		if err != nil || gw.Mode != GatewayMode.VM {
+			return nil
+		}
+	}
+	cfg := IPv6Config{
+		NetworkCIDR: n.CIDR,
+		CIDR:        n.IPv6CIDR,
+	}
+	if gwVM != nil {
+		_, cidr, _ := net.ParseCIDR(n.IPv6CIDR)
+		for _, ip := range gwVM.PrivateIPsV6 {
+			if cidr.Contains(net.ParseIP(ip)) {
+				cfg.GatewayIP = ip
+				break
+			}
+		}
+	}
+	return &cfg
+}
+
+//GatewayIP returns the IP used as default route by the VMs of the network of gw, vm being a started gateway VM
+//The IP is empty if the egress traffic of the network is not routed by a VM
+func GatewayIP(gw *api.Gateway, vm *api.VM) string {
+	if gw == nil || gw.Mode != GatewayMode.VM {
+		return ""
+	}
+	if gw.VIP != "" {
+		return gw.VIP
+	}
+	if vm != nil {
+		if len(vm.PrivateIPsV4) > 0 {
+			return vm.PrivateIPsV4[0]
+		} else if len(vm.PrivateIPsV6) > 0 {
+			return vm.PrivateIPsV6[0]
+		}
+	}
+	return ""
 }
 
 //PrepareUserData prepares the initial configuration script
-func (client *Client) PrepareUserData(request api.VMRequest, isGateway bool, kp *api.KeyPair, gw *api.VM) ([]byte, error) {
+//- gatewayIP is the default route of the VM if it is not public
+//- vrrp is the VRRP configuration of a gateway in high availability, nil otherwise
+//- ipv6 is the IPv6 configuration of a VM of a dual-stack network routed by gateway VMs, nil otherwise
+func (client *Client) PrepareUserData(request api.VMRequest, isGateway bool, kp *api.KeyPair, gatewayIP string, vrrp *VRRPConfig, ipv6 *IPv6Config) ([]byte, error) {
 	dataBuffer := bytes.NewBufferString("")
 	var ResolveConf string
 	var err error
@@ -362,22 +482,27 @@ func (client *Client) PrepareUserData(request api.VMRequest, isGateway bool, kp
 		ResolveConf = buffer.String()
 	}
 
-	ip := ""
-	if gw != nil {
-		if len(gw.PrivateIPsV4) > 0 {
-			ip = gw.PrivateIPsV4[0]
-		} else if len(gw.PrivateIPsV6) > 0 {
-			ip = gw.PrivateIPsV6[0]
-		}
-	}
 	data := userData{
 		User:        api.DefaultUser,
 		Key:         strings.Trim(kp.PublicKey, "\n"),
 		ConfIF:      !client.Cfg.AutoVMNetworkInterfaces,
 		IsGateway:   isGateway && !client.Cfg.UseLayer3Networking,
-		AddGateway:  !request.PublicIP && !client.Cfg.UseLayer3Networking,
+		AddGateway:  !request.PublicIP && !client.Cfg.UseLayer3Networking && gatewayIP != "",
 		ResolveConf: ResolveConf,
-		GatewayIP:   ip,
+		GatewayIP:   gatewayIP,
+	}
+	if vrrp != nil && data.IsGateway {
+		data.VIP = vrrp.VIP
+		data.VRRPPriority = vrrp.Priority
+		data.VRRPPassword = vrrp.Password
+	}
+	if ipv6 != nil {
+		data.NetworkCIDR = ipv6.NetworkCIDR
+		data.IPv6CIDR = ipv6.CIDR
+		data.IPv6Prefix = ipv6.Prefix()
+		if data.AddGateway {
+			data.IPv6GatewayIP = ipv6.GatewayIP
+		}
 	}
 	err = client.UserDataTpl.Execute(dataBuffer, data)
 	if err != nil {
@@ -386,31 +511,42 @@ func (client *Client) PrepareUserData(request api.VMRequest, isGateway bool, kp
 	return dataBuffer.Bytes(), nil
 }
 
-func (client *Client) readGateway(networkID string) (*servers.Server, error) {
-	gwID, err := client.getGateway(networkID)
+//readGateway returns the gateway of the network identified by networkID and its first started VM
+//The VM is nil if the network has no started bastion and its egress traffic is not routed by a VM
+func (client *Client) readGateway(networkID string) (*api.Gateway, *api.VM, error) {
+	gw, err := client.GetGateway(networkID)
 	if err != nil {
-		return nil, fmt.Errorf("Error creating VM: Enable to found Gateway %s", errorString(err))
+		return nil, nil, fmt.Errorf("Error creating VM: Enable to found Gateway %s", errorString(err))
 	}
-	gw, err := servers.Get(client.Compute, gwID).Extract()
-	if err != nil {
-		return nil, fmt.Errorf("Error creating VM: Enable to found Gateway %s", errorString(err))
+	for _, id := range gw.VMIDs {
+		vm, err := client.GetVM(id)
+		if err != nil || vm.State != VMState.STARTED {
+			continue
+		}
+		return gw, vm, nil
 	}
-	return gw, nil
+	if gw.Mode != GatewayMode.VM {
+		return gw, nil, nil
+	}
+	return nil, nil, fmt.Errorf("Error creating VM: no gateway of network %s is started", networkID)
 }
 
-func (client *Client) saveVMDefinition(vm api.VM, netID string) error {
+//saveVMDefinition saves the VM definition in Object Storage, registering the VM in each of the networks identified by netIDs
+func (client *Client) saveVMDefinition(vm api.VM, netIDs []string) error {
 	var buffer bytes.Buffer
 	enc := gob.NewEncoder(&buffer)
 	err := enc.Encode(vm)
 	if err != nil {
 		return err
 	}
-	err = client.PutObject(api.NetworkContainerName, api.Object{
-		Name:    fmt.Sprintf("%s/vm/%s", netID, vm.ID),
-		Content: bytes.NewReader(buffer.Bytes()),
-	})
-	if err != nil {
-		return err
+	for _, netID := range netIDs {
+		err = client.PutObject(api.NetworkContainerName, api.Object{
+			Name:    fmt.Sprintf("%s/vm/%s", netID, vm.ID),
+			Content: bytes.NewReader(buffer.Bytes()),
+		})
+		if err != nil {
+			return err
+		}
 	}
 	return client.PutObject(api.VMContainerName, api.Object{
 		Name:    vm.ID,
@@ -419,7 +555,7 @@ func (client *Client) saveVMDefinition(vm api.VM, netID string) error {
 }
 
 func (client *Client) removeVMDefinition(vmID string) error {
-	// Find the network the vm the is attached on
+	// Find the networks the vm the is attached on
 	networks, err := client.ListNetworks(false)
 	if err != nil {
 		return err
@@ -439,7 +575,6 @@ func (client *Client) removeVMDefinition(vmID string) error {
 				return err
 			}
 			found = true
-			break
 		}
 	}
 	if !found {
@@ -467,22 +602,23 @@ func (client *Client) readVMDefinition(vmID string) (*api.VM, error) {
 
 //CreateVM creates a VM satisfying request
 func (client *Client) CreateVM(request api.VMRequest) (*api.VM, error) {
-	return client.createVM(request, false)
+	return client.createVM(request, false, nil)
 }
 
-func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM, error) {
+//createVM creates a VM satisfying request, configured as gateway if isGateway is true
+//vrrp is the VRRP configuration of a gateway in high availability, nil otherwise
+func (client *Client) createVM(request api.VMRequest, isGateway bool, vrrp *VRRPConfig) (*api.VM, error) {
 	//Eventual network gateway
-	var gw *api.VM
+	var gw *api.Gateway
+	var gwVM *api.VM
 	//If the VM is not public it has to be created on a network owning a Gateway
+	//The first network of a VM connected to several networks provides its default route
 	if !request.PublicIP {
-		gwServer, err := client.readGateway(request.NetworkIDs[0])
+		var err error
+		gw, gwVM, err = client.readGateway(request.NetworkIDs[0])
 		if err != nil {
 			return nil, fmt.Errorf("No private VM can be created on a network without gateway")
 		}
-		gw, err = client.readVMDefinition(gwServer.ID)
-		if err != nil {
-			return nil, fmt.Errorf("Bad state, Gateway for network %s is not accessible", request.NetworkIDs[0])
-		}
 	}
 
 	var nets []servers.Network
@@ -514,7 +650,8 @@ func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM,
 		defer client.DeleteKeyPair(kp.ID)
 	}
 
-	userData, err := client.PrepareUserData(request, isGateway, kp, gw)
+	ipv6 := client.ipv6Config(request.NetworkIDs[0], isGateway, gwVM)
+	userData, err := client.PrepareUserData(request, isGateway, kp, GatewayIP(gw, gwVM), vrrp, ipv6)
 	//fmt.Println(string(userData))
 	//Create VM
 	srvOpts := servers.CreateOpts{
@@ -543,16 +680,23 @@ func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM,
 	if err != nil {
 		return nil, fmt.Errorf("Timeout creating VM: %s", errorString(err))
 	}
-	//Add gateway ID to VM definition
-	var gwID string
-	if gw != nil {
-		gwID = gw.ID
+	//The VM lets in the traffic of the networks peered with its networks
+	err = client.bindPeerGroups(vm.ID, request.NetworkIDs)
+	if err != nil {
+		servers.Delete(client.Compute, vm.ID)
+		return nil, fmt.Errorf("Error creating VM: %s", errorString(err))
+	}
+	//Add gateway IDs to VM definition
+	if gwVM != nil {
+		vm.GatewayID = gwVM.ID
+		if len(gw.VMIDs) > 1 {
+			vm.GatewayIDs = gw.VMIDs
+		}
 	}
-	vm.GatewayID = gwID
 	vm.PrivateKey = kp.PrivateKey
 	//if Floating IP are not used or no public address is requested
 	if !client.Cfg.UseFloatingIP || !request.PublicIP {
-		err = client.saveVMDefinition(*vm, request.NetworkIDs[0])
+		err = client.saveVMDefinition(*vm, request.NetworkIDs)
 		if err != nil {
 			client.DeleteVM(vm.ID)
 			return nil, fmt.Errorf("Error creating VM: %s", errorString(err))
@@ -584,7 +728,7 @@ func (client *Client) createVM(request api.VMRequest, isGateway bool) (*api.VM,
 	} else if IPVersion.IPv6.Is(ip.IP) {
 		vm.AccessIPv6 = ip.IP
 	}
-	err = client.saveVMDefinition(*vm, request.NetworkIDs[0])
+	err = client.saveVMDefinition(*vm, request.NetworkIDs)
 	if err != nil {
 		client.DeleteVM(vm.ID)
 		return nil, fmt.Errorf("Error creating VM: %s", errorString(err))
@@ -745,22 +889,45 @@ func (client *Client) getSSHConfig(vm *api.VM) (*system.SSHConfig, error) {
 		User:       api.DefaultUser,
 	}
 	if vm.GatewayID != "" {
-		gw, err := client.GetVM(vm.GatewayID)
+		gatewayConfig, err := GetGatewaySSHConfig(client.GetVM, vm)
 		if err != nil {
 			return nil, err
 		}
-		ip := gw.GetAccessIP()
-		GatewayConfig := system.SSHConfig{
+		sshConfig.GatewayConfig = gatewayConfig
+	}
+
+	return &sshConfig, nil
+
+}
+
+//GetGatewaySSHConfig creates the SSHConfig to connect the gateway of vm, the gateways being got with getVM
+//If the network of the VM has several gateways, the first reachable one is used
+func GetGatewaySSHConfig(getVM func(id string) (*api.VM, error), vm *api.VM) (*system.SSHConfig, error) {
+	ids := []string{vm.GatewayID}
+	for _, id := range vm.GatewayIDs {
+		if id != vm.GatewayID {
+			ids = append(ids, id)
+		}
+	}
+	var err error
+	for _, id := range ids {
+		var gw *api.VM
+		gw, err = getVM(id)
+		if err != nil {
+			continue
+		}
+		gatewayConfig := system.SSHConfig{
 			PrivateKey: gw.PrivateKey,
 			Port:       22,
 			User:       api.DefaultUser,
-			Host:       ip,
+			Host:       gw.GetAccessIP(),
+		}
+		if len(ids) == 1 || gatewayConfig.IsReachable(SSHReachableTimeout) {
+			return &gatewayConfig, nil
 		}
-		sshConfig.GatewayConfig = &GatewayConfig
+		err = fmt.Errorf("Gateway %s is not reachable", gw.Name)
 	}
-
-	return &sshConfig, nil
-
+	return nil, err
 }
 
 //GetSSHConfig creates SSHConfig to connect a VM
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+//fqdn returns the fully qualified name, with the final dot, of name in the zone domain
+func fqdn(name string, domain string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	if name == "" || name == "@" {
+		return strings.TrimSuffix(domain, ".") + "."
+	}
+	return name + "." + strings.TrimSuffix(domain, ".") + "."
+}
+
+//CreateDNSZone creates the Designate zone domain
+//The VMs of the network resolve the zone with the nameservers of the zone
+func (client *Client) CreateDNSZone(networkID string, domain string) (*api.DNSZone, error) {
+	if client.DNS == nil {
+		return nil, &api.NotAvailableError{Message: "DNS zones are not available: Designate is not deployed"}
+	}
+	zone, err := zones.Create(client.DNS, zones.CreateOpts{
+		Name:  fqdn("", domain),
+		Email: "hostmaster@" + domain,
+		TTL:   300,
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating DNS zone: %s", errorString(err))
+	}
+	nameservers, err := client.getZoneNameservers(zone.ID)
+	if err != nil {
+		client.DeleteDNSZone(zone.ID)
+		return nil, fmt.Errorf("Error creating DNS zone: %s", errorString(err))
+	}
+	return &api.DNSZone{
+		ID:          zone.ID,
+		NetworkID:   networkID,
+		Domain:      domain,
+		Nameservers: nameservers,
+	}, nil
+}
+
+//getZoneNameservers returns the IPs of the servers of the NS records of the zone identified by zoneID
+func (client *Client) getZoneNameservers(zoneID string) ([]string, error) {
+	sets, err := client.listRecordSets(zoneID, recordsets.ListOpts{Type: "NS"})
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, set := range sets {
+		for _, ns := range set.Records {
+			addrs, err := net.LookupHost(strings.TrimSuffix(ns, "."))
+			if err != nil {
+				return nil, fmt.Errorf("nameserver %s can't be resolved: %v", ns, err)
+			}
+			ips = append(ips, addrs...)
+		}
+	}
+	return ips, nil
+}
+
+//listRecordSets lists the record sets of the zone identified by zoneID matching opts
+func (client *Client) listRecordSets(zoneID string, opts recordsets.ListOpts) ([]recordsets.RecordSet, error) {
+	var sets []recordsets.RecordSet
+	err := recordsets.ListByZone(client.DNS, zoneID, opts).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := recordsets.ExtractRecordSets(page)
+		if err != nil {
+			return false, err
+		}
+		sets = append(sets, list...)
+		return true, nil
+	})
+	return sets, err
+}
+
+//getRecordSet returns the record set of the name and the type of record in the zone identified by zoneID, nil if there is none
+func (client *Client) getRecordSet(zoneID string, record api.DNSRecord) (*zones.Zone, *recordsets.RecordSet, error) {
+	zone, err := zones.Get(client.DNS, zoneID).Extract()
+	if err != nil {
+		return nil, nil, err
+	}
+	sets, err := client.listRecordSets(zoneID, recordsets.ListOpts{
+		Name: fqdn(record.Name, zone.Name),
+		Type: record.Type,
+	})
+	if err != nil || len(sets) == 0 {
+		return zone, nil, err
+	}
+	return zone, &sets[0], nil
+}
+
+//recordValue returns the value of record as expected by Designate, the target of a CNAME being fully qualified
+func recordValue(record api.DNSRecord, domain string) string {
+	if record.Type == "CNAME" {
+		return fqdn(record.Value, domain)
+	}
+	return record.Value
+}
+
+//AddDNSRecord adds record to the Designate zone identified by zoneID
+//The value is added to the record set of the name of the record if it already exists
+func (client *Client) AddDNSRecord(zoneID string, record api.DNSRecord) error {
+	zone, set, err := client.getRecordSet(zoneID, record)
+	if err != nil {
+		return fmt.Errorf("Error adding DNS record: %s", errorString(err))
+	}
+	value := recordValue(record, zone.Name)
+	if set == nil {
+		_, err = recordsets.Create(client.DNS, zoneID, recordsets.CreateOpts{
+			Name:    fqdn(record.Name, zone.Name),
+			Type:    record.Type,
+			TTL:     300,
+			Records: []string{value},
+		}).Extract()
+	} else {
+		for _, v := range set.Records {
+			if v == value {
+				return nil
+			}
+		}
+		_, err = recordsets.Update(client.DNS, zoneID, set.ID, recordsets.UpdateOpts{
+			Records: append(set.Records, value),
+		}).Extract()
+	}
+	if err != nil {
+		return fmt.Errorf("Error adding DNS record: %s", errorString(err))
+	}
+	return nil
+}
+
+//RemoveDNSRecord removes record from the Designate zone identified by zoneID
+//The record set is deleted with its last value
+func (client *Client) RemoveDNSRecord(zoneID string, record api.DNSRecord) error {
+	zone, set, err := client.getRecordSet(zoneID, record)
+	if err != nil {
+		return fmt.Errorf("Error removing DNS record: %s", errorString(err))
+	}
+	if set == nil {
+		return nil
+	}
+	value := recordValue(record, zone.Name)
+	var values []string
+	for _, v := range set.Records {
+		if v != value {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		err = recordsets.Delete(client.DNS, zoneID, set.ID).ExtractErr()
+	} else {
+		_, err = recordsets.Update(client.DNS, zoneID, set.ID, recordsets.UpdateOpts{
+			Records: values,
+		}).Extract()
+	}
+	if err != nil {
+		return fmt.Errorf("Error removing DNS record: %s", errorString(err))
+	}
+	return nil
+}
+
+//DeleteDNSZone deletes the Designate zone identified by zoneID, Designate deletes its records
+func (client *Client) DeleteDNSZone(zoneID string) error {
+	if client.DNS == nil {
+		return &api.NotAvailableError{Message: "DNS zones are not available: Designate is not deployed"}
+	}
+	_, err := zones.Delete(client.DNS, zoneID).Extract()
+	if err != nil {
+		return fmt.Errorf("Error deleting DNS zone: %s", errorString(err))
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/LBProtocol"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/monitors"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+//lbProtocols maps the protocols of the load balancers to the LBaaS protocols
+var lbProtocols = map[LBProtocol.Enum]string{
+	LBProtocol.TCP:   "TCP",
+	LBProtocol.HTTP:  "HTTP",
+	LBProtocol.HTTPS: "HTTPS",
+}
+
+//toLBProtocol converts a LBaaS protocol into a LBProtocol enum
+func toLBProtocol(protocol string) LBProtocol.Enum {
+	for p, s := range lbProtocols {
+		if s == protocol {
+			return p
+		}
+	}
+	return LBProtocol.TCP
+}
+
+//checkLoadBalancerService returns a NotAvailableError if the network service does not offer the LBaaS v2 extension
+func (client *Client) checkLoadBalancerService() error {
+	_, err := extensions.Get(client.Network, "lbaasv2").Extract()
+	if err != nil {
+		return &api.NotAvailableError{Message: "Load balancers are not available: LBaaS v2 is not enabled"}
+	}
+	return nil
+}
+
+//waitLoadBalancerActive waits until the load balancer identified by id accepts new modifications
+func (client *Client) waitLoadBalancerActive(id string) error {
+	timeout := time.Now().Add(5 * time.Minute)
+	for time.Now().Before(timeout) {
+		lb, err := loadbalancers.Get(client.Network, id).Extract()
+		if err != nil {
+			return err
+		}
+		switch lb.ProvisioningStatus {
+		case "ACTIVE":
+			return nil
+		case "ERROR":
+			return fmt.Errorf("load balancer %s is in error", id)
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return &api.TimeoutError{Message: "Wait load balancer active timeout"}
+}
+
+//CreateLoadBalancer creates a LBaaS load balancer in the subnet of the network req.NetworkID
+//The load balancer has a listener, a round robin pool of the backends and a health monitor
+func (client *Client) CreateLoadBalancer(req api.LoadBalancerRequest) (*api.LoadBalancer, error) {
+	err := client.checkLoadBalancerService()
+	if err != nil {
+		return nil, err
+	}
+	sn, err := client.getNetworkSubnet(req.NetworkID)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating load balancer: %s", errorString(err))
+	}
+	lb, err := loadbalancers.Create(client.Network, loadbalancers.CreateOpts{
+		Name:        req.Name,
+		VipSubnetID: sn.ID,
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating load balancer: %s", errorString(err))
+	}
+	err = client.configureLoadBalancer(lb.ID, req)
+	if err != nil {
+		client.DeleteLoadBalancer(lb.ID)
+		return nil, fmt.Errorf("Error creating load balancer: %s", errorString(err))
+	}
+	return client.GetLoadBalancer(lb.ID)
+}
+
+//configureLoadBalancer creates the listener, the pool and the health monitor of the load balancer identified by id
+func (client *Client) configureLoadBalancer(id string, req api.LoadBalancerRequest) error {
+	protocol := lbProtocols[req.Protocol]
+	err := client.waitLoadBalancerActive(id)
+	if err != nil {
+		return err
+	}
+	listener, err := listeners.Create(client.Network, listeners.CreateOpts{
+		Name:           req.Name,
+		LoadbalancerID: id,
+		Protocol:       listeners.Protocol(protocol),
+		ProtocolPort:   req.Port,
+	}).Extract()
+	if err != nil {
+		return err
+	}
+	err = client.waitLoadBalancerActive(id)
+	if err != nil {
+		return err
+	}
+	pool, err := pools.Create(client.Network, pools.CreateOpts{
+		Name:       req.Name,
+		ListenerID: listener.ID,
+		LBMethod:   pools.LBMethodRoundRobin,
+		Protocol:   pools.Protocol(protocol),
+	}).Extract()
+	if err != nil {
+		return err
+	}
+	err = client.waitLoadBalancerActive(id)
+	if err != nil {
+		return err
+	}
+	monitorType := monitors.TypeTCP
+	if req.HealthCheckPath != "" && req.Protocol != LBProtocol.TCP {
+		monitorType = protocol
+	}
+	_, err = monitors.Create(client.Network, monitors.CreateOpts{
+		Name:       req.Name,
+		PoolID:     pool.ID,
+		Type:       monitorType,
+		URLPath:    req.HealthCheckPath,
+		Delay:      5,
+		Timeout:    3,
+		MaxRetries: 3,
+	}).Extract()
+	if err != nil {
+		return err
+	}
+	return client.waitLoadBalancerActive(id)
+}
+
+//getLoadBalancerPool returns the pool of the load balancer identified by id
+func (client *Client) getLoadBalancerPool(id string) (*pools.Pool, error) {
+	var found *pools.Pool
+	err := pools.List(client.Network, pools.ListOpts{
+		LoadbalancerID: id,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := pools.ExtractPools(page)
+		if err != nil {
+			return false, err
+		}
+		if len(list) > 0 {
+			found = &list[0]
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("load balancer %s has no pool", id)
+	}
+	return found, nil
+}
+
+//listPoolMembers lists the members of the pool identified by poolID
+func (client *Client) listPoolMembers(poolID string) ([]pools.Member, error) {
+	var members []pools.Member
+	err := pools.ListMembers(client.Network, poolID, pools.ListMembersOpts{}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := pools.ExtractMembers(page)
+		if err != nil {
+			return false, err
+		}
+		members = append(members, list...)
+		return true, nil
+	})
+	return members, err
+}
+
+//GetLoadBalancer returns the load balancer identified by id
+func (client *Client) GetLoadBalancer(id string) (*api.LoadBalancer, error) {
+	lb, err := loadbalancers.Get(client.Network, id).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting load balancer: %s", errorString(err))
+	}
+	sn, err := subnets.Get(client.Network, lb.VipSubnetID).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting load balancer: %s", errorString(err))
+	}
+	out := api.LoadBalancer{
+		ID:        lb.ID,
+		Name:      lb.Name,
+		NetworkID: sn.NetworkID,
+		VIP:       lb.VipAddress,
+		Backends:  map[string]string{},
+	}
+	if len(lb.Listeners) > 0 {
+		listener, err := listeners.Get(client.Network, lb.Listeners[0].ID).Extract()
+		if err != nil {
+			return nil, fmt.Errorf("Error getting load balancer: %s", errorString(err))
+		}
+		out.Protocol = toLBProtocol(listener.Protocol)
+		out.Port = listener.ProtocolPort
+	}
+	pool, err := client.getLoadBalancerPool(id)
+	if err != nil {
+		// The load balancer is not configured yet
+		return &out, nil
+	}
+	if pool.MonitorID != "" {
+		monitor, err := monitors.Get(client.Network, pool.MonitorID).Extract()
+		if err == nil {
+			out.HealthCheckPath = monitor.URLPath
+		}
+	}
+	members, err := client.listPoolMembers(pool.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting load balancer: %s", errorString(err))
+	}
+	out.BackendPort = out.Port
+	for _, m := range members {
+		out.Backends[m.Name] = m.Address
+		out.BackendPort = m.ProtocolPort
+	}
+	return &out, nil
+}
+
+//AddLoadBalancerBackend adds the VM identified by vmID, receiving the traffic on ip:port, to the pool of the load balancer identified by id
+func (client *Client) AddLoadBalancerBackend(id string, vmID string, ip string, port int) error {
+	lb, err := loadbalancers.Get(client.Network, id).Extract()
+	if err != nil {
+		return fmt.Errorf("Error adding load balancer backend: %s", errorString(err))
+	}
+	pool, err := client.getLoadBalancerPool(id)
+	if err != nil {
+		return fmt.Errorf("Error adding load balancer backend: %s", errorString(err))
+	}
+	_, err = pools.CreateMember(client.Network, pool.ID, pools.CreateMemberOpts{
+		Name:         vmID,
+		Address:      ip,
+		ProtocolPort: port,
+		SubnetID:     lb.VipSubnetID,
+	}).Extract()
+	if err != nil {
+		return fmt.Errorf("Error adding load balancer backend: %s", errorString(err))
+	}
+	return client.waitLoadBalancerActive(id)
+}
+
+//RemoveLoadBalancerBackend removes the VM identified by vmID from the pool of the load balancer identified by id
+func (client *Client) RemoveLoadBalancerBackend(id string, vmID string) error {
+	pool, err := client.getLoadBalancerPool(id)
+	if err != nil {
+		return fmt.Errorf("Error removing load balancer backend: %s", errorString(err))
+	}
+	members, err := client.listPoolMembers(pool.ID)
+	if err != nil {
+		return fmt.Errorf("Error removing load balancer backend: %s", errorString(err))
+	}
+	for _, m := range members {
+		if m.Name != vmID {
+			continue
+		}
+		err = pools.DeleteMember(client.Network, pool.ID, m.ID).ExtractErr()
+		if err != nil {
+			return fmt.Errorf("Error removing load balancer backend: %s", errorString(err))
+		}
+		return client.waitLoadBalancerActive(id)
+	}
+	return fmt.Errorf("Error removing load balancer backend: VM %s is not a backend of load balancer %s", vmID, id)
+}
+
+//DeleteLoadBalancer deletes the load balancer identified by id with its health monitor, pool and listener
+//LBaaS v2 does not delete a load balancer which still has children
+func (client *Client) DeleteLoadBalancer(id string) error {
+	lb, err := loadbalancers.Get(client.Network, id).Extract()
+	if err != nil {
+		return fmt.Errorf("Error deleting load balancer: %s", errorString(err))
+	}
+	pool, err := client.getLoadBalancerPool(id)
+	if err == nil {
+		if pool.MonitorID != "" {
+			monitors.Delete(client.Network, pool.MonitorID)
+			client.waitLoadBalancerActive(id)
+		}
+		pools.Delete(client.Network, pool.ID)
+		client.waitLoadBalancerActive(id)
+	}
+	for _, l := range lb.Listeners {
+		listeners.Delete(client.Network, l.ID)
+		client.waitLoadBalancerActive(id)
+	}
+	err = loadbalancers.Delete(client.Network, id).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("Error deleting load balancer: %s", errorString(err))
+	}
+	return nil
+}
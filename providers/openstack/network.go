@@ -18,6 +18,7 @@ package openstack
 
 import (
 	"bytes"
+	"encoding/gob"
 	"fmt"
 	"path"
 	"strings"
@@ -25,12 +26,17 @@ import (
 
 	"github.com/CS-SI/SafeScale/providers"
 	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/GatewayMode"
 	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
 	gc "github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	secrules "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
 	"github.com/gophercloud/gophercloud/pagination"
+	uuid "github.com/satori/go.uuid"
 )
 
 //RouterRequest represents a router request
@@ -60,22 +66,39 @@ type Subnet struct {
 	NetworkID string `json:"network_id,omitempty"`
 }
 
-func (client *Client) saveGateway(netID string, vmID string) error {
-	err := client.PutObject(api.NetworkContainerName, api.Object{
-		Name:    fmt.Sprintf("%s/gw", netID),
-		Content: strings.NewReader(vmID),
+//saveGateway saves in Object Storage the gateway of the network gw.NetworkID
+func (client *Client) saveGateway(gw api.Gateway) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(gw)
+	if err != nil {
+		return err
+	}
+	return client.PutObject(api.NetworkContainerName, api.Object{
+		Name:    fmt.Sprintf("%s/gw", gw.NetworkID),
+		Content: bytes.NewReader(buffer.Bytes()),
 	})
-	return err
 }
 
-func (client *Client) getGateway(netID string) (string, error) {
+//GetGateway reads in Object Storage the gateway of the network identified by netID
+//Networks created before high availability support only store the ID of their gateway VM
+func (client *Client) GetGateway(netID string) (*api.Gateway, error) {
 	o, err := client.GetObject(api.NetworkContainerName, fmt.Sprintf("%s/gw", netID), nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	var buffer bytes.Buffer
 	buffer.ReadFrom(o.Content)
-	return buffer.String(), nil
+	content := buffer.String()
+	var gw api.Gateway
+	err = gob.NewDecoder(&buffer).Decode(&gw)
+	if err != nil {
+		return &api.Gateway{
+			NetworkID: netID,
+			VMIDs:     []string{content},
+		}, nil
+	}
+	return &gw, nil
 }
 
 func (client *Client) removeGateway(netID string) error {
@@ -97,19 +120,63 @@ func (client *Client) CreateNetwork(req api.NetworkRequest) (*api.Network, error
 		return nil, fmt.Errorf("Error creating network %s: %s", req.Name, errorString(err))
 	}
 
-	sn, err := client.createSubnet(req.Name, network.ID, req.CIDR, req.IPVersion)
+	// The egress traffic is routed by a router if requested, or by default if layer 3 networking is used
+	withRouter := req.GatewayMode == GatewayMode.ROUTER || (req.GatewayMode == GatewayMode.VM && client.Cfg.UseLayer3Networking)
+	sn, err := client.createSubnet(req.Name, network.ID, req.CIDR, req.IPVersion, withRouter)
 	if err != nil {
 		client.DeleteNetwork(network.ID)
 		return nil, fmt.Errorf("Error creating network %s: %s", req.Name, errorString(err))
 	}
-
-	return &api.Network{
+	net := api.Network{
 		ID:        network.ID,
 		Name:      network.Name,
 		CIDR:      sn.Mask,
 		IPVersion: sn.IPVersion,
-	}, nil
+	}
 
+	// A dual-stack network has a second sub network for IPv6
+	if req.IPv6CIDR != "" {
+		sn6, err := client.createSubnet(req.Name, network.ID, req.IPv6CIDR, IPVersion.IPv6, withRouter)
+		if err != nil {
+			client.DeleteNetwork(network.ID)
+			return nil, fmt.Errorf("Error creating network %s: %s", req.Name, errorString(err))
+		}
+		err = client.allowICMPv6()
+		if err != nil {
+			client.DeleteNetwork(network.ID)
+			return nil, fmt.Errorf("Error creating network %s: %s", req.Name, errorString(err))
+		}
+		net.IPv6CIDR = sn6.Mask
+	}
+
+	return &net, nil
+
+}
+
+//toNetwork converts an OpenStack network and its sub networks into an api.Network
+//A network has one sub network, or an IPv4 and an IPv6 sub networks if it is dual-stack
+func toNetwork(network *networks.Network, sns []Subnet) (*api.Network, error) {
+	net := api.Network{
+		ID:   network.ID,
+		Name: network.Name,
+	}
+	switch {
+	case len(sns) == 1:
+		net.CIDR = sns[0].Mask
+		net.IPVersion = sns[0].IPVersion
+	case len(sns) == 2 && sns[0].IPVersion != sns[1].IPVersion:
+		for _, sn := range sns {
+			if sn.IPVersion == IPVersion.IPv6 {
+				net.IPv6CIDR = sn.Mask
+			} else {
+				net.CIDR = sn.Mask
+				net.IPVersion = sn.IPVersion
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Bad configuration, each network should have exactly one subnet, or an IPv4 and an IPv6 subnets")
+	}
+	return &net, nil
 }
 
 //GetNetwork returns the network identified by id
@@ -122,22 +189,12 @@ func (client *Client) GetNetwork(id string) (*api.Network, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error getting network: %s", errorString(err))
 	}
-	if len(sns) != 1 {
-		return nil, fmt.Errorf("Bad configuration, each network should have exactly one subnet")
-	}
-	sn := sns[0]
 	// gwID, _ := client.getGateway(id)
 	// if err != nil {
 	// 	return nil, fmt.Errorf("Bad configuration, no gateway associated to this network")
 	// }
 
-	return &api.Network{
-		ID:        network.ID,
-		Name:      network.Name,
-		CIDR:      sn.Mask,
-		IPVersion: sn.IPVersion,
-		// GatewayID: gwID,
-	}, nil
+	return toNetwork(network, sns)
 }
 
 //ListNetworks lists available networks
@@ -170,24 +227,18 @@ func (client *Client) listAllNetworks() ([]api.Network, error) {
 			if err != nil {
 				return false, fmt.Errorf("Error getting network: %s", errorString(err))
 			}
-			if len(sns) != 1 {
+			if n.ID == client.ProviderNetworkID {
 				continue
 			}
-			if n.ID == client.ProviderNetworkID {
+			net, err := toNetwork(&n, sns)
+			if err != nil {
 				continue
 			}
-			sn := sns[0]
 			// gwID, err := client.getGateway(n.ID)
 			// if err != nil {
 			// 	return false, fmt.Errorf("Error getting network: %s", errorString(err))
 			// }
-			netList = append(netList, api.Network{
-				ID:        n.ID,
-				Name:      n.Name,
-				CIDR:      sn.Mask,
-				IPVersion: sn.IPVersion,
-				// GatewayID: gwID,
-			})
+			netList = append(netList, *net)
 		}
 		return true, nil
 	})
@@ -238,21 +289,41 @@ func (client *Client) DeleteNetwork(networkID string) error {
 	if err != nil {
 		return err
 	}
-	if len(vmids) > 1 {
-		gw, err := client.readGateway(networkID)
-		if err != nil {
-			return fmt.Errorf("Error getting gateway: %s", errorString(err))
+	gw, err := client.GetGateway(networkID)
+	if err != nil {
+		return fmt.Errorf("Error getting gateway: %s", errorString(err))
+	}
+	if len(vmids) > len(gw.VMIDs) {
+		gwIDs := map[string]bool{}
+		for _, id := range gw.VMIDs {
+			gwIDs[id] = true
 		}
 		var ids []string
 		for _, id := range vmids {
-			if !strings.HasSuffix(id, gw.ID) {
+			if !gwIDs[path.Base(id)] {
 				ids = append(ids, path.Base(id))
 			}
 		}
 		return fmt.Errorf("Network '%s' has vms attached: %s", networkID, strings.Join(ids, " "))
 	}
 
+	// The router of a peering holds a port in the network
+	peerings, err := client.ListNetworkPeerings(networkID)
+	if err != nil {
+		return fmt.Errorf("Error deleting network: %s", errorString(err))
+	}
+	for _, peering := range peerings {
+		err = client.UnpeerNetworks(peering.NetworkIDs[0], peering.NetworkIDs[1])
+		if err != nil {
+			return err
+		}
+	}
+
 	client.DeleteGateway(net.ID)
+	err = client.deletePeerGroup(networkID)
+	if err != nil {
+		return fmt.Errorf("Error deleting network: %s", errorString(err))
+	}
 	sns, err := client.listSubnets(networkID)
 	if err != nil {
 		return fmt.Errorf("error deleting network: %s", errorString(err))
@@ -271,46 +342,730 @@ func (client *Client) DeleteNetwork(networkID string) error {
 }
 
 //CreateGateway creates a public Gateway for a private network
+//If req.HA is true, a pair of gateways sharing a virtual IP with VRRP is created
+//If req.Mode is not GatewayMode.VM, only a bastion is created if req.Bastion is true
 func (client *Client) CreateGateway(req api.GWRequest) error {
 	net, err := client.GetNetwork(req.NetworkID)
 	if err != nil {
 		return fmt.Errorf("Network %s not found %s", req.NetworkID, errorString(err))
 	}
-	vmReq := api.VMRequest{
-		ImageID:    req.ImageID,
-		KeyPair:    req.KeyPair,
-		Name:       "gw_" + net.Name,
-		TemplateID: req.TemplateID,
-		NetworkIDs: []string{req.NetworkID},
-		PublicIP:   true,
+	if req.Mode != GatewayMode.VM {
+		return client.createBastion(req, net)
+	}
+	gw := api.Gateway{
+		NetworkID: req.NetworkID,
+		Mode:      GatewayMode.VM,
+	}
+	names := []string{"gw_" + net.Name}
+	var vrrpPassword string
+	if req.HA {
+		names = append(names, "gw_"+net.Name+"_2")
+		//With layer 3 networking VMs are routed by the router of the network, the gateways are only used as
+		//SSH bastions and don't need a virtual IP
+		if !client.Cfg.UseLayer3Networking {
+			vip, err := client.CreateVIP(req.NetworkID, "vip_"+net.Name)
+			if err != nil {
+				return fmt.Errorf("Error creating gateway : %s", errorString(err))
+			}
+			gw.VIP = vip.IP
+			gw.VIPPortID = vip.PortID
+			err = client.allowVRRP()
+			if err != nil {
+				client.deleteGatewayResources(gw)
+				return fmt.Errorf("Error creating gateway : %s", errorString(err))
+			}
+			vrrpPassword = NewVRRPPassword()
+		}
 	}
-	vm, err := client.createVM(vmReq, true)
+
+	for i, name := range names {
+		vmReq := api.VMRequest{
+			ImageID:    req.ImageID,
+			KeyPair:    req.KeyPair,
+			Name:       name,
+			TemplateID: req.TemplateID,
+			NetworkIDs: []string{req.NetworkID},
+			PublicIP:   true,
+		}
+		var vrrp *VRRPConfig
+		if gw.VIP != "" {
+			vrrp = &VRRPConfig{
+				VIP:      gw.VIP,
+				Priority: VRRPMasterPriority - i*VRRPPriorityStep,
+				Password: vrrpPassword,
+			}
+		}
+		vm, err := client.createVM(vmReq, true, vrrp)
+		if err != nil {
+			client.deleteGatewayResources(gw)
+			return fmt.Errorf("Error creating gateway : %s", errorString(err))
+		}
+		gw.VMIDs = append(gw.VMIDs, vm.ID)
+		// The gateway forwards the IPv6 traffic of the VMs, whose source addresses are not its own
+		if net.IPv6CIDR != "" && !client.Cfg.UseLayer3Networking {
+			err = client.BindVIP("::/0", vm.ID, req.NetworkID)
+			if err != nil {
+				client.deleteGatewayResources(gw)
+				return fmt.Errorf("Error creating gateway : %s", errorString(err))
+			}
+		}
+		if gw.VIP != "" {
+			err = client.BindVIP(gw.VIP, vm.ID, req.NetworkID)
+			if err != nil {
+				client.deleteGatewayResources(gw)
+				return fmt.Errorf("Error creating gateway : %s", errorString(err))
+			}
+		}
+	}
+
+	err = client.saveGateway(gw)
 	if err != nil {
+		client.deleteGatewayResources(gw)
 		return fmt.Errorf("Error creating gateway : %s", errorString(err))
 	}
-	err = client.saveGateway(req.NetworkID, vm.ID)
+	return nil
+}
+
+//createBastion creates the bastion of a network whose egress traffic is not routed by a VM
+func (client *Client) createBastion(req api.GWRequest, net *api.Network) error {
+	gw := api.Gateway{
+		NetworkID: req.NetworkID,
+		Mode:      req.Mode,
+	}
+	if req.Bastion {
+		vm, err := client.createVM(api.VMRequest{
+			ImageID:    req.ImageID,
+			KeyPair:    req.KeyPair,
+			Name:       "bastion_" + net.Name,
+			TemplateID: req.TemplateID,
+			NetworkIDs: []string{req.NetworkID},
+			PublicIP:   true,
+		}, false, nil)
+		if err != nil {
+			return fmt.Errorf("Error creating bastion : %s", errorString(err))
+		}
+		gw.VMIDs = []string{vm.ID}
+	}
+	err := client.saveGateway(gw)
 	if err != nil {
-		client.DeleteVM(vm.ID)
-		return fmt.Errorf("Error creating gateway : %s", errorString(err))
+		client.deleteGatewayResources(gw)
+		return fmt.Errorf("Error creating bastion : %s", errorString(err))
 	}
 	return nil
 }
 
+//deleteGatewayResources deletes the VMs and the virtual IP of a gateway
+func (client *Client) deleteGatewayResources(gw api.Gateway) {
+	for _, id := range gw.VMIDs {
+		client.DeleteVM(id)
+		// Loop waiting for effective deletion of the VM
+		timeout := time.Now().Add(2 * time.Minute)
+		for _, err := client.GetVM(id); err == nil && time.Now().Before(timeout); _, err = client.GetVM(id) {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if gw.VIPPortID != "" {
+		client.DeleteVIP(gw.VIPPortID)
+	}
+}
+
 //DeleteGateway delete the public gateway of a private network
 func (client *Client) DeleteGateway(networkID string) error {
-	srv, err := client.readGateway(networkID)
+	gw, err := client.GetGateway(networkID)
 	if err != nil {
 		return fmt.Errorf("Error deleting gateway: %s", errorString(err))
 	}
-	client.DeleteVM(srv.ID)
-	// Loop waiting for effective deletion of the VM
-	for err = nil; err != nil; _, err = client.GetVM(srv.ID) {
-		time.Sleep(100 * time.Millisecond)
-	}
+	client.deleteGatewayResources(*gw)
 	return client.removeGateway(networkID)
 
 }
 
+//VIP is a virtual IP reserved in a network by a port bound to no VM
+type VIP struct {
+	PortID string
+	IP     string
+}
+
+//CreateVIP reserves a virtual IP in the network identified by networkID
+func (client *Client) CreateVIP(networkID string, name string) (*VIP, error) {
+	state := true
+	port, err := ports.Create(client.Network, ports.CreateOpts{
+		NetworkID:    networkID,
+		Name:         name,
+		AdminStateUp: &state,
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating virtual IP: %s", errorString(err))
+	}
+	if len(port.FixedIPs) == 0 {
+		ports.Delete(client.Network, port.ID)
+		return nil, fmt.Errorf("Error creating virtual IP: no IP allocated to port %s", port.ID)
+	}
+	return &VIP{
+		PortID: port.ID,
+		IP:     port.FixedIPs[0].IPAddress,
+	}, nil
+}
+
+//BindVIP allows the VM identified by vmID to hold the virtual IP vip on its port of the network identified by networkID
+func (client *Client) BindVIP(vip string, vmID string, networkID string) error {
+	var vmPorts []ports.Port
+	err := ports.List(client.Network, ports.ListOpts{
+		DeviceID:  vmID,
+		NetworkID: networkID,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := ports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+		vmPorts = append(vmPorts, list...)
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error binding virtual IP: %s", errorString(err))
+	}
+	if len(vmPorts) == 0 {
+		return fmt.Errorf("Error binding virtual IP: VM %s has no port in network %s", vmID, networkID)
+	}
+	port := vmPorts[0]
+	pairs := append(port.AllowedAddressPairs, ports.AddressPair{
+		IPAddress: vip,
+	})
+	_, err = ports.Update(client.Network, port.ID, ports.UpdateOpts{
+		AllowedAddressPairs: &pairs,
+	}).Extract()
+	if err != nil {
+		return fmt.Errorf("Error binding virtual IP: %s", errorString(err))
+	}
+	return nil
+}
+
+//DeleteVIP releases the virtual IP reserved by the port identified by portID
+func (client *Client) DeleteVIP(portID string) error {
+	err := ports.Delete(client.Network, portID).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("Error deleting virtual IP: %s", errorString(err))
+	}
+	return nil
+}
+
+//allowVRRP adds to the default security group the rules letting gateways exchange VRRP advertisements
+func (client *Client) allowVRRP() error {
+	for _, etherType := range []secrules.RuleEtherType{secrules.EtherType4, secrules.EtherType6} {
+		_, err := secrules.Create(client.Network, secrules.CreateOpts{
+			Direction:     secrules.DirIngress,
+			EtherType:     etherType,
+			SecGroupID:    client.SecurityGroup.ID,
+			Protocol:      secrules.RuleProtocol(VRRPProtocol),
+			RemoteGroupID: client.SecurityGroup.ID,
+		}).Extract()
+		if err != nil {
+			if _, ok := err.(gc.ErrDefault409); ok {
+				// The rule already exists
+				continue
+			}
+			return fmt.Errorf("Error allowing VRRP: %s", errorString(err))
+		}
+	}
+	return nil
+}
+
+//allowICMPv6 adds to the default security group the rule letting VMs exchange ICMPv6 messages, required by neighbor discovery
+func (client *Client) allowICMPv6() error {
+	_, err := secrules.Create(client.Network, secrules.CreateOpts{
+		Direction:      secrules.DirIngress,
+		EtherType:      secrules.EtherType6,
+		SecGroupID:     client.SecurityGroup.ID,
+		Protocol:       secrules.RuleProtocol("ipv6-icmp"),
+		RemoteIPPrefix: "::/0",
+	}).Extract()
+	if err != nil {
+		if _, ok := err.(gc.ErrDefault409); ok {
+			// The rule already exists
+			return nil
+		}
+		return fmt.Errorf("Error allowing ICMPv6: %s", errorString(err))
+	}
+	return nil
+}
+
+//peerGroupName returns the name of the security group letting in the traffic of the peers of the network identified by networkID
+func peerGroupName(networkID string) string {
+	return fmt.Sprintf("peer_%s", networkID)
+}
+
+//getPeerGroup returns the ID of the peer group of the network identified by networkID, empty if the network has none
+func (client *Client) getPeerGroup(networkID string) (string, error) {
+	var id string
+	err := groups.List(client.Network, groups.ListOpts{
+		Name: peerGroupName(networkID),
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := groups.ExtractGroups(page)
+		if err != nil {
+			return false, err
+		}
+		if len(list) > 0 {
+			id = list[0].ID
+			return false, nil
+		}
+		return true, nil
+	})
+	return id, err
+}
+
+//createPeerGroup creates the peer group of the network identified by networkID and binds it to the VMs of the network
+func (client *Client) createPeerGroup(networkID string) (string, error) {
+	group, err := groups.Create(client.Network, groups.CreateOpts{
+		Name:        peerGroupName(networkID),
+		Description: "Traffic of the networks peered with network " + networkID,
+	}).Extract()
+	if err != nil {
+		return "", err
+	}
+	err = client.bindPeerGroup(group.ID, networkID, "")
+	if err != nil {
+		groups.Delete(client.Network, group.ID)
+		return "", err
+	}
+	return group.ID, nil
+}
+
+//bindPeerGroup adds the security group identified by groupID to the ports of the VMs in the network identified by networkID,
+//restricted to the VM identified by vmID if not empty
+func (client *Client) bindPeerGroup(groupID string, networkID string, vmID string) error {
+	var vmPorts []ports.Port
+	err := ports.List(client.Network, ports.ListOpts{
+		NetworkID: networkID,
+		DeviceID:  vmID,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := ports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range list {
+			// The ports of the routers and DHCP agents are not protected by security groups
+			if strings.HasPrefix(p.DeviceOwner, "compute:") {
+				vmPorts = append(vmPorts, p)
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range vmPorts {
+		bound := false
+		for _, id := range p.SecurityGroups {
+			bound = bound || id == groupID
+		}
+		if bound {
+			continue
+		}
+		sgs := append(p.SecurityGroups, groupID)
+		_, err = ports.Update(client.Network, p.ID, ports.UpdateOpts{
+			SecurityGroups: &sgs,
+		}).Extract()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//bindPeerGroups adds to the VM identified by vmID the peer groups of the networks identified by networkIDs
+func (client *Client) bindPeerGroups(vmID string, networkIDs []string) error {
+	for _, networkID := range networkIDs {
+		groupID, err := client.getPeerGroup(networkID)
+		if err != nil {
+			return err
+		}
+		if groupID == "" {
+			continue
+		}
+		err = client.bindPeerGroup(groupID, networkID, vmID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//deletePeerGroup deletes the peer group of the network identified by networkID, once the VMs of the network are deleted
+func (client *Client) deletePeerGroup(networkID string) error {
+	groupID, err := client.getPeerGroup(networkID)
+	if err != nil || groupID == "" {
+		return err
+	}
+	return groups.Delete(client.Network, groupID).ExtractErr()
+}
+
+//allowPeer adds to the peer group of the network identified by networkID the rule letting the VMs of the peered network
+//cidr reach the VMs of the network
+func (client *Client) allowPeer(networkID string, cidr string) error {
+	groupID, err := client.getPeerGroup(networkID)
+	if err == nil && groupID == "" {
+		groupID, err = client.createPeerGroup(networkID)
+	}
+	if err != nil {
+		return fmt.Errorf("Error allowing traffic from %s: %s", cidr, errorString(err))
+	}
+	etherType := secrules.EtherType4
+	if strings.Contains(cidr, ":") {
+		etherType = secrules.EtherType6
+	}
+	_, err = secrules.Create(client.Network, secrules.CreateOpts{
+		Direction:      secrules.DirIngress,
+		EtherType:      etherType,
+		SecGroupID:     groupID,
+		RemoteIPPrefix: cidr,
+	}).Extract()
+	if err != nil {
+		if _, ok := err.(gc.ErrDefault409); ok {
+			// The rule already exists
+			return nil
+		}
+		return fmt.Errorf("Error allowing traffic from %s: %s", cidr, errorString(err))
+	}
+	return nil
+}
+
+//revokePeer removes from the peer group of the network identified by networkID the rule added by allowPeer for cidr
+func (client *Client) revokePeer(networkID string, cidr string) error {
+	groupID, err := client.getPeerGroup(networkID)
+	if err != nil {
+		return fmt.Errorf("Error revoking traffic from %s: %s", cidr, errorString(err))
+	}
+	if groupID == "" {
+		return nil
+	}
+	var ids []string
+	err = secrules.List(client.Network, secrules.ListOpts{
+		SecGroupID:     groupID,
+		Direction:      string(secrules.DirIngress),
+		RemoteIPPrefix: cidr,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := secrules.ExtractRules(page)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range list {
+			if r.Protocol == "" && r.RemoteIPPrefix == cidr {
+				ids = append(ids, r.ID)
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error revoking traffic from %s: %s", cidr, errorString(err))
+	}
+	for _, id := range ids {
+		err = secrules.Delete(client.Network, id).ExtractErr()
+		if err != nil {
+			return fmt.Errorf("Error revoking traffic from %s: %s", cidr, errorString(err))
+		}
+	}
+	return nil
+}
+
+//NewVRRPPassword generates the password authenticating the VRRP advertisements of a pair of gateways
+func NewVRRPPassword() string {
+	id, _ := uuid.NewV4()
+	return id.String()[:8]
+}
+
+//savePeering saves in Object Storage the peering, on the side of each of its networks
+func (client *Client) savePeering(peering api.NetworkPeering) error {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(peering)
+	if err != nil {
+		return err
+	}
+	for i, netID := range peering.NetworkIDs {
+		err = client.PutObject(api.NetworkContainerName, api.Object{
+			Name:    fmt.Sprintf("%s/peer/%s", netID, peering.NetworkIDs[1-i]),
+			Content: bytes.NewReader(buffer.Bytes()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//getPeering reads in Object Storage the peering of the networks identified by networkID1 and networkID2
+func (client *Client) getPeering(networkID1, networkID2 string) (*api.NetworkPeering, error) {
+	o, err := client.GetObject(api.NetworkContainerName, fmt.Sprintf("%s/peer/%s", networkID1, networkID2), nil)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.ReadFrom(o.Content)
+	var peering api.NetworkPeering
+	err = gob.NewDecoder(&buffer).Decode(&peering)
+	if err != nil {
+		return nil, err
+	}
+	return &peering, nil
+}
+
+//removePeering deletes from Object Storage the peering, on the side of each of its networks
+func (client *Client) removePeering(peering api.NetworkPeering) error {
+	for i, netID := range peering.NetworkIDs {
+		err := client.DeleteObject(api.NetworkContainerName, fmt.Sprintf("%s/peer/%s", netID, peering.NetworkIDs[1-i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//getNetworkSubnet returns the sub network of the network identified by networkID, the IPv4 one if the network is dual-stack
+func (client *Client) getNetworkSubnet(networkID string) (*Subnet, error) {
+	sns, err := client.listSubnets(networkID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sns) == 0 {
+		return nil, fmt.Errorf("Network %s has no subnet", networkID)
+	}
+	for _, sn := range sns {
+		if sn.IPVersion == IPVersion.IPv4 {
+			return &sn, nil
+		}
+	}
+	return &sns[0], nil
+}
+
+//PeerNetworks routes the traffic between the networks identified by networkID1 and networkID2
+//A router is connected to both networks and the route to each network is pushed by DHCP to the VMs of the other one
+func (client *Client) PeerNetworks(networkID1, networkID2 string) (*api.NetworkPeering, error) {
+	if networkID1 == networkID2 {
+		return nil, fmt.Errorf("Error peering networks: a network cannot be peered with itself")
+	}
+	if _, err := client.getPeering(networkID1, networkID2); err == nil {
+		return nil, fmt.Errorf("Error peering networks: networks %s and %s are already peered", networkID1, networkID2)
+	}
+	var sns []*Subnet
+	for _, id := range []string{networkID1, networkID2} {
+		sn, err := client.getNetworkSubnet(id)
+		if err != nil {
+			return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+		}
+		sns = append(sns, sn)
+	}
+	overlap, err := api.CIDROverlap(sns[0].Mask, sns[1].Mask)
+	if err != nil {
+		return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+	}
+	if overlap {
+		return nil, fmt.Errorf("Error peering networks: %s and %s overlap", sns[0].Mask, sns[1].Mask)
+	}
+
+	// The router has no gateway on the provider network, it only routes between the networks
+	state := true
+	router, err := routers.Create(client.Network, routers.CreateOpts{
+		Name:         fmt.Sprintf("peer_%s_%s", networkID1, networkID2),
+		AdminStateUp: &state,
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+	}
+	peering := api.NetworkPeering{
+		ID:         router.ID,
+		NetworkIDs: []string{networkID1, networkID2},
+		NextHops:   map[string]string{},
+	}
+	for _, sn := range sns {
+		ip, err := client.connectRouter(router.ID, sn)
+		if err != nil {
+			client.deletePeeringRouter(peering, sns)
+			return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+		}
+		peering.NextHops[sn.NetworkID] = ip
+	}
+	for i, sn := range sns {
+		err = client.addHostRoute(sn.ID, subnets.HostRoute{
+			DestinationCIDR: sns[1-i].Mask,
+			NextHop:         peering.NextHops[sn.NetworkID],
+		})
+		if err != nil {
+			client.removeHostRoute(sns[0].ID, sns[1].Mask)
+			client.deletePeeringRouter(peering, sns)
+			return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+		}
+	}
+	// The peer group of each network lets in the traffic of the other one
+	for i, sn := range sns {
+		err = client.allowPeer(sn.NetworkID, sns[1-i].Mask)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = client.savePeering(peering)
+	}
+	if err != nil {
+		client.revokePeer(sns[0].NetworkID, sns[1].Mask)
+		client.revokePeer(sns[1].NetworkID, sns[0].Mask)
+		client.removeHostRoute(sns[0].ID, sns[1].Mask)
+		client.removeHostRoute(sns[1].ID, sns[0].Mask)
+		client.deletePeeringRouter(peering, sns)
+		return nil, fmt.Errorf("Error peering networks: %s", errorString(err))
+	}
+	return &peering, nil
+}
+
+//ListNetworkPeerings lists the peerings of the network identified by networkID
+func (client *Client) ListNetworkPeerings(networkID string) ([]api.NetworkPeering, error) {
+	names, err := client.ListObjects(api.NetworkContainerName, api.ObjectFilter{
+		Prefix: fmt.Sprintf("%s/peer/", networkID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var peerings []api.NetworkPeering
+	for _, name := range names {
+		peering, err := client.getPeering(networkID, path.Base(name))
+		if err != nil {
+			return nil, err
+		}
+		peerings = append(peerings, *peering)
+	}
+	return peerings, nil
+}
+
+//UnpeerNetworks stops routing the traffic between the networks identified by networkID1 and networkID2
+func (client *Client) UnpeerNetworks(networkID1, networkID2 string) error {
+	peering, err := client.getPeering(networkID1, networkID2)
+	if err != nil {
+		return fmt.Errorf("Error unpeering networks: networks %s and %s are not peered", networkID1, networkID2)
+	}
+	var sns []*Subnet
+	for _, id := range peering.NetworkIDs {
+		sn, err := client.getNetworkSubnet(id)
+		if err != nil {
+			return fmt.Errorf("Error unpeering networks: %s", errorString(err))
+		}
+		sns = append(sns, sn)
+	}
+	for i, sn := range sns {
+		err = client.removeHostRoute(sn.ID, sns[1-i].Mask)
+		if err != nil {
+			return fmt.Errorf("Error unpeering networks: %s", errorString(err))
+		}
+	}
+	err = client.deletePeeringRouter(*peering, sns)
+	if err != nil {
+		return fmt.Errorf("Error unpeering networks: %s", errorString(err))
+	}
+	for i, sn := range sns {
+		err = client.revokePeer(sn.NetworkID, sns[1-i].Mask)
+		if err != nil {
+			return fmt.Errorf("Error unpeering networks: %s", errorString(err))
+		}
+	}
+	return client.removePeering(*peering)
+}
+
+//ListSecurityRules lists the rules of the default security group, which protects the VMs of all the networks
+func (client *Client) ListSecurityRules(networkID string) ([]api.SecurityRule, error) {
+	var rules []api.SecurityRule
+	err := secrules.List(client.Network, secrules.ListOpts{
+		SecGroupID: client.SecurityGroup.ID,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := secrules.ExtractRules(page)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range list {
+			rules = append(rules, api.SecurityRule{
+				Direction: r.Direction,
+				Protocol:  r.Protocol,
+				PortFrom:  r.PortRangeMin,
+				PortTo:    r.PortRangeMax,
+				CIDR:      r.RemoteIPPrefix,
+			})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing security rules: %s", errorString(err))
+	}
+	return rules, nil
+}
+
+//connectRouter connects the router identified by routerID to the sub network sn and returns the IP of the router in sn
+//The gateway IP of sn is left to the gateway of the network
+func (client *Client) connectRouter(routerID string, sn *Subnet) (string, error) {
+	state := true
+	port, err := ports.Create(client.Network, ports.CreateOpts{
+		NetworkID:    sn.NetworkID,
+		Name:         fmt.Sprintf("peer_%s", routerID),
+		AdminStateUp: &state,
+		FixedIPs:     []ports.IP{{SubnetID: sn.ID}},
+	}).Extract()
+	if err != nil {
+		return "", err
+	}
+	if len(port.FixedIPs) == 0 {
+		ports.Delete(client.Network, port.ID)
+		return "", fmt.Errorf("no IP allocated to port %s", port.ID)
+	}
+	_, err = routers.AddInterface(client.Network, routerID, routers.AddInterfaceOpts{
+		PortID: port.ID,
+	}).Extract()
+	if err != nil {
+		ports.Delete(client.Network, port.ID)
+		return "", err
+	}
+	return port.FixedIPs[0].IPAddress, nil
+}
+
+//deletePeeringRouter disconnects the router of peering from the sub networks sns and deletes it
+func (client *Client) deletePeeringRouter(peering api.NetworkPeering, sns []*Subnet) error {
+	for _, sn := range sns {
+		if _, ok := peering.NextHops[sn.NetworkID]; ok {
+			err := client.removeSubnetFromRouter(peering.ID, sn.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return client.deleteRouter(peering.ID)
+}
+
+//addHostRoute adds route to the routes pushed by DHCP to the VMs of the sub network identified by subnetID
+func (client *Client) addHostRoute(subnetID string, route subnets.HostRoute) error {
+	sn, err := subnets.Get(client.Network, subnetID).Extract()
+	if err != nil {
+		return err
+	}
+	routes := append(sn.HostRoutes, route)
+	_, err = subnets.Update(client.Network, subnetID, subnets.UpdateOpts{
+		HostRoutes: &routes,
+	}).Extract()
+	return err
+}
+
+//removeHostRoute removes the route to destination from the routes pushed by DHCP to the VMs of the sub network identified by subnetID
+func (client *Client) removeHostRoute(subnetID string, destination string) error {
+	sn, err := subnets.Get(client.Network, subnetID).Extract()
+	if err != nil {
+		return err
+	}
+	routes := []subnets.HostRoute{}
+	for _, r := range sn.HostRoutes {
+		if r.DestinationCIDR != destination {
+			routes = append(routes, r)
+		}
+	}
+	_, err = subnets.Update(client.Network, subnetID, subnets.UpdateOpts{
+		HostRoutes: &routes,
+	}).Extract()
+	return err
+}
+
 func toGopherIPversion(v IPVersion.Enum) gc.IPVersion {
 	if v == IPVersion.IPv4 {
 		return gc.IPv4
@@ -341,7 +1096,10 @@ func fromIntIPversion(v int) IPVersion.Enum {
 //- netID ID of the parent network
 //- name is the name of the sub network
 //- mask is a network mask defined in CIDR notation
-func (client *Client) createSubnet(name string, networkID string, cidr string, ipVersion IPVersion.Enum) (*Subnet, error) {
+//- withRouter if true the sub network is connected to the provider network by a router
+//The addresses of an IPv6 sub network are autoconfigured (SLAAC) from the prefix advertised by its router, or
+//from the prefix set by the userdata of the VMs without router
+func (client *Client) createSubnet(name string, networkID string, cidr string, ipVersion IPVersion.Enum, withRouter bool) (*Subnet, error) {
 	// You must associate a new subnet with an existing network - to do this you
 	// need its UUID. You must also provide a well-formed CIDR value.
 	//addr, _, err := net.ParseCIDR(mask)
@@ -353,14 +1111,19 @@ func (client *Client) createSubnet(name string, networkID string, cidr string, i
 		Name:       name,
 		EnableDHCP: &dhcp,
 	}
+	if ipVersion == IPVersion.IPv6 {
+		opts.IPv6AddressMode = "slaac"
+		if withRouter {
+			opts.IPv6RAMode = "slaac"
+		}
+	}
 
 	// Execute the operation and get back a subnets.Subnet struct
 	subnet, err := subnets.Create(client.Network, opts).Extract()
-	if client.Cfg.UseLayer3Networking {
-		if err != nil {
-			return nil, fmt.Errorf("Error creating subnet: %s", errorString(err))
-		}
-
+	if err != nil {
+		return nil, fmt.Errorf("Error creating subnet: %s", errorString(err))
+	}
+	if withRouter {
 		router, err := client.createRouter(RouterRequest{
 			Name:      subnet.ID,
 			NetworkID: client.ProviderNetworkID,
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"fmt"
+
+	"github.com/CS-SI/SafeScale/providers/api"
+	"github.com/CS-SI/SafeScale/providers/api/IPVersion"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+//toPublicIP converts a floating IP into an api public IP
+func toPublicIP(fip *floatingips.FloatingIP) *api.PublicIP {
+	return &api.PublicIP{
+		ID:   fip.ID,
+		IP:   fip.IP,
+		VMID: fip.InstanceID,
+	}
+}
+
+//CreatePublicIP reserves a floating IP in the floating IP pool
+func (client *Client) CreatePublicIP() (*api.PublicIP, error) {
+	if !client.Cfg.UseFloatingIP {
+		return nil, fmt.Errorf("Error creating public IP: public IPs require floating IPs, which are not used by this provider")
+	}
+	fip, err := floatingips.Create(client.Compute, floatingips.CreateOpts{
+		Pool: client.Opts.FloatingIPPool,
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating public IP: %s", errorString(err))
+	}
+	return toPublicIP(fip), nil
+}
+
+//GetPublicIP returns the public IP identified by id
+func (client *Client) GetPublicIP(id string) (*api.PublicIP, error) {
+	fip, err := floatingips.Get(client.Compute, id).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting public IP: %s", errorString(err))
+	}
+	return toPublicIP(fip), nil
+}
+
+//ListPublicIPs lists the floating IPs of the tenant
+func (client *Client) ListPublicIPs() ([]api.PublicIP, error) {
+	var ips []api.PublicIP
+	err := floatingips.List(client.Compute).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := floatingips.ExtractFloatingIPs(page)
+		if err != nil {
+			return false, err
+		}
+		for _, fip := range list {
+			ips = append(ips, *toPublicIP(&fip))
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing public IPs: %s", errorString(err))
+	}
+	return ips, nil
+}
+
+//AttachPublicIP attaches the public IP identified by id to the VM identified by vmID
+//The public IP becomes the access IP of the VM
+func (client *Client) AttachPublicIP(id string, vmID string) error {
+	fip, err := floatingips.Get(client.Compute, id).Extract()
+	if err != nil {
+		return fmt.Errorf("Error attaching public IP: %s", errorString(err))
+	}
+	if fip.InstanceID != "" {
+		return fmt.Errorf("Error attaching public IP: %s is already attached to VM %s", fip.IP, fip.InstanceID)
+	}
+	err = floatingips.AssociateInstance(client.Compute, vmID, floatingips.AssociateOpts{
+		FloatingIP: fip.IP,
+	}).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("Error attaching public IP: %s", errorString(err))
+	}
+	return client.setVMAccessIP(vmID, "", fip.IP)
+}
+
+//DetachPublicIP detaches the public IP identified by id from its VM
+func (client *Client) DetachPublicIP(id string) error {
+	fip, err := floatingips.Get(client.Compute, id).Extract()
+	if err != nil {
+		return fmt.Errorf("Error detaching public IP: %s", errorString(err))
+	}
+	if fip.InstanceID == "" {
+		return fmt.Errorf("Error detaching public IP: %s is not attached", fip.IP)
+	}
+	err = floatingips.DisassociateInstance(client.Compute, fip.InstanceID, floatingips.DisassociateOpts{
+		FloatingIP: fip.IP,
+	}).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("Error detaching public IP: %s", errorString(err))
+	}
+	return client.setVMAccessIP(fip.InstanceID, fip.IP, "")
+}
+
+//DeletePublicIP releases the public IP identified by id, which must not be attached
+func (client *Client) DeletePublicIP(id string) error {
+	fip, err := floatingips.Get(client.Compute, id).Extract()
+	if err != nil {
+		return fmt.Errorf("Error deleting public IP: %s", errorString(err))
+	}
+	if fip.InstanceID != "" {
+		return fmt.Errorf("Error deleting public IP: %s is attached to VM %s", fip.IP, fip.InstanceID)
+	}
+	err = floatingips.Delete(client.Compute, id).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("Error deleting public IP: %s", errorString(err))
+	}
+	return nil
+}
+
+//setVMAccessIP replaces the access IP old of the VM identified by vmID by ip in the VM definition
+//If old is empty the access IP is replaced whatever it is
+func (client *Client) setVMAccessIP(vmID string, old string, ip string) error {
+	vm, err := client.readVMDefinition(vmID)
+	if err != nil {
+		// VMs not created by SafeScale have no definition
+		return nil
+	}
+	if old != "" && vm.AccessIPv4 != old && vm.AccessIPv6 != old {
+		return nil
+	}
+	vm.AccessIPv4 = ""
+	vm.AccessIPv6 = ""
+	if IPVersion.IPv4.Is(ip) {
+		vm.AccessIPv4 = ip
+	} else if IPVersion.IPv6.Is(ip) {
+		vm.AccessIPv6 = ip
+	}
+	return client.saveVMDefinition(*vm, nil)
+}
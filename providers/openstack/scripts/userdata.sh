@@ -75,14 +75,14 @@ network:
   version: 2
   renderer: networkd
   ethernets:
-    ens3:
-      dhcp4: true
-    ens4:
-      dhcp4: true
-{{if .GatewayIP}}
-      gateway4: {{.GatewayIP}}
-{{end}}
 EOF
+    # Configure all network interfaces in dhcp, the default route is set by configure_gateway
+    for IF in $(ls /sys/class/net); do
+        if [ $IF != "lo" ]; then
+            echo "    ${IF}:" >> /etc/netplan/50-cloud-init.yaml
+            echo "      dhcp4: true" >> /etc/netplan/50-cloud-init.yaml
+        fi
+    done
     netplan generate
     netplan apply
 
@@ -117,7 +117,7 @@ EOF
 
 configure_as_gateway() {
     echo "Configuring host as gateway..."
-    PUBLIC_IP=$(curl ipinfo.io/ip)
+    PUBLIC_IP=$(curl -4 ipinfo.io/ip)
     PUBLIC_IF=$(netstat -ie | grep -B1 ${PUBLIC_IP} | head -n1 | awk '{print $1}')
 
     PRIVATE_IP=
@@ -141,6 +141,13 @@ echo "activate routing"
 iptables -t nat -A POSTROUTING -o ${PUBLIC_IF} -j MASQUERADE
 iptables -A FORWARD -i ${PRIVATE_IF} -o ${PUBLIC_IF} -j ACCEPT
 iptables -A FORWARD -i ${PUBLIC_IF} -o ${PRIVATE_IF} -m state --state RELATED,ESTABLISHED -j ACCEPT
+{{- if .IPv6CIDR}}
+sysctl -w net.ipv6.conf.all.forwarding=1
+sysctl -w net.ipv6.conf.${PUBLIC_IF}.accept_ra=2
+ip6tables -t nat -A POSTROUTING -s {{.IPv6CIDR}} -o ${PUBLIC_IF} -j MASQUERADE
+ip6tables -A FORWARD -i ${PRIVATE_IF} -o ${PUBLIC_IF} -j ACCEPT
+ip6tables -A FORWARD -i ${PUBLIC_IF} -o ${PRIVATE_IF} -m state --state RELATED,ESTABLISHED -j ACCEPT
+{{- end}}
 EOF
 
         cat <<- EOF >/etc/systemd/system/routing.service
@@ -171,6 +178,87 @@ EOF
     echo done
 }
 
+configure_vrrp() {
+    echo "Configuring VRRP on ${PRIVATE_IF} for virtual IP {{.VIP}}..."
+
+    case $LINUX_KIND in
+        debian|ubuntu)
+            apt-get update && apt-get install -y keepalived
+            ;;
+        redhat|centos)
+            yum install -y keepalived
+            ;;
+    esac
+
+    # Both gateways start as backup, the one with the highest priority is elected master
+    cat <<- EOF >/etc/keepalived/keepalived.conf
+vrrp_instance VI_GW {
+    state BACKUP
+    interface ${PRIVATE_IF}
+    virtual_router_id 51
+    priority {{.VRRPPriority}}
+    advert_int 1
+    authentication {
+        auth_type PASS
+        auth_pass {{.VRRPPassword}}
+    }
+    virtual_ipaddress {
+        {{.VIP}}
+    }
+}
+EOF
+
+    systemctl enable keepalived
+    systemctl restart keepalived
+
+    echo done
+}
+
+# eui64 prints the IPv6 interface identifier derived from the MAC address of the interface $1, as SLAAC does
+eui64() {
+    IFS=: read -r A B C D E F < /sys/class/net/$1/address
+    printf "%02x%s:%sff:fe%s:%s%s" $((0x$A ^ 2)) $B $C $D $E $F
+}
+
+configure_ipv6() {
+    echo "Configuring IPv6 address in {{.IPv6CIDR}}..."
+
+    # No router advertises the prefix of the network, the address is the one OpenStack derives from the MAC address
+    cat <<- EOF > /sbin/ipv6
+#!/bin/bash -
+$(declare -f eui64)
+for i in \$(seq 30); do
+    IF=\$(ip -o -4 route show {{.NetworkCIDR}} | awk '{print \$3}' | head -n1)
+    [ ! -z "\$IF" ] && break
+    sleep 2
+done
+[ -z "\$IF" ] && exit 1
+ip -6 addr replace {{.IPv6Prefix}}:\$(eui64 \$IF)/64 dev \$IF
+{{- if .IPv6GatewayIP}}
+ip -6 route replace default via {{.IPv6GatewayIP}} dev \$IF
+{{- end}}
+EOF
+    chmod u+x /sbin/ipv6
+    cat <<- EOF > /etc/systemd/system/ipv6.service
+[Unit]
+Description=configure IPv6 address in {{.IPv6CIDR}}
+After=network.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/sbin/ipv6
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+    systemctl enable ipv6
+    systemctl start ipv6
+
+    echo done
+}
+
 configure_dns_legacy() {
     cat <<-EOF > /etc/resolv.conf
 {{.ResolveConf}}
@@ -188,11 +276,13 @@ EOF
 configure_gateway() {
     echo "Configuring default router to {{.GatewayIP}}"
 
-    route del -net default
+    # A VM connected to several networks gets a default route by DHCP on each of them
+    while route del -net default 2>/dev/null; do :; done
 
     cat <<- EOF > /sbin/gateway
 #!/bin/sh -
 echo "configure default gateway"
+while /sbin/route del -net default 2>/dev/null; do :; done
 /sbin/route add default gw {{.GatewayIP}}
 
 EOF
@@ -225,6 +315,12 @@ case $LINUX_KIND in
         {{end}}
         {{if .IsGateway}}
         configure_as_gateway
+        {{if .VIP}}
+        configure_vrrp
+        {{end}}
+        {{end}}
+        {{if .IPv6CIDR}}
+        configure_ipv6
         {{end}}
         {{if .AddGateway}}
         configure_gateway
@@ -243,6 +339,12 @@ case $LINUX_KIND in
         {{end}}
         {{if .IsGateway}}
         configure_as_gateway
+        {{if .VIP}}
+        configure_vrrp
+        {{end}}
+        {{end}}
+        {{if .IPv6CIDR}}
+        configure_ipv6
         {{end}}
         {{if .AddGateway}}
         configure_gateway
@@ -254,6 +356,12 @@ case $LINUX_KIND in
         create_user
         {{if .IsGateway}}
         configure_as_gateway
+        {{if .VIP}}
+        configure_vrrp
+        {{end}}
+        {{end}}
+        {{if .IPv6CIDR}}
+        configure_ipv6
         {{end}}
         {{if .AddGateway}}
         configure_gateway
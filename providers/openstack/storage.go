@@ -18,20 +18,30 @@ package openstack
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/CS-SI/SafeScale/providers/api"
 	"github.com/CS-SI/SafeScale/providers/api/VolumeSpeed"
 	"github.com/CS-SI/SafeScale/providers/api/VolumeState"
+	"github.com/CS-SI/SafeScale/providers/multipart"
+	gc "github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
 
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
 
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v1/volumes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
 	"github.com/gophercloud/gophercloud/pagination"
+	uuid "github.com/satori/go.uuid"
 )
 
 //toVM converts a Volume status returned by the OpenStack driver into VolumeState enum
@@ -154,6 +164,85 @@ func (client *Client) DeleteVolume(id string) error {
 	return nil
 }
 
+//extendInUseMicroversion is the first microversion of the block storage API allowing to extend an attached volume
+const extendInUseMicroversion = "volume 3.42"
+
+//NewBlockStorageV3 creates a ServiceClient for the block storage API v3, whose microversions are not managed by gophercloud
+func NewBlockStorageV3(pClient *gc.ProviderClient, eo gc.EndpointOpts) (*gc.ServiceClient, error) {
+	eo.ApplyDefaults("volumev3")
+	url, err := pClient.EndpointLocator(eo)
+	if err != nil {
+		return nil, err
+	}
+	return &gc.ServiceClient{ProviderClient: pClient, Endpoint: url}, nil
+}
+
+//ExtendVolume extends the volume identified by id to size GB
+//An attached volume can only be extended through the block storage API v3 with microversion 3.42 or later
+func (client *Client) ExtendVolume(id string, size int) error {
+	if client.VolumeV3 != nil {
+		return ExtendVolume(client.VolumeV3, id, size)
+	}
+	vol, err := volumes.Get(client.Volume, id).Extract()
+	if err != nil {
+		return fmt.Errorf("Error getting volume: %s", errorString(err))
+	}
+	if vol.Status == "in-use" {
+		return fmt.Errorf("Error extending volume %s: block storage API v3 not available, an attached volume can't be extended; detach it first", id)
+	}
+	err = volumeactions.ExtendSize(client.Volume, id, volumeactions.ExtendSizeOpts{
+		NewSize: size,
+	}).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("Error extending volume %s to %d GB: %s", id, size, errorString(err))
+	}
+	return nil
+}
+
+//ExtendVolume extends the volume identified by id to size GB using the os-extend action of the block storage API v3
+//Microversion 3.42 is requested so the volume can be extended while attached
+func ExtendVolume(sc *gc.ServiceClient, id string, size int) error {
+	b := map[string]interface{}{
+		"os-extend": map[string]interface{}{
+			"new_size": size,
+		},
+	}
+	_, err := sc.Post(sc.ServiceURL("volumes", id, "action"), b, nil, &gc.RequestOpts{
+		OkCodes:     []int{202},
+		MoreHeaders: map[string]string{"OpenStack-API-Version": extendInUseMicroversion},
+	})
+	if err != nil {
+		return fmt.Errorf("Error extending volume %s to %d GB (block storage API %s required for attached volumes): %s", id, size, extendInUseMicroversion, errorString(err))
+	}
+	return nil
+}
+
+//RetypeVolume changes the speed of the volume identified by id
+func (client *Client) RetypeVolume(id string, speed VolumeSpeed.Enum) error {
+	return RetypeVolume(client.Volume, id, client.getVolumeType(speed))
+}
+
+//RetypeVolume changes the volume type of the volume identified by id using the os-retype action
+//Data are migrated on demand if the new type is hosted on another backend
+func RetypeVolume(sc *gc.ServiceClient, id string, volumeType string) error {
+	if volumeType == "" {
+		return fmt.Errorf("Error retyping volume %s: no volume type matching requested speed", id)
+	}
+	b := map[string]interface{}{
+		"os-retype": map[string]interface{}{
+			"new_type":         volumeType,
+			"migration_policy": "on-demand",
+		},
+	}
+	_, err := sc.Post(sc.ServiceURL("volumes", id, "action"), b, nil, &gc.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		return fmt.Errorf("Error retyping volume %s to %s: %s", id, volumeType, errorString(err))
+	}
+	return nil
+}
+
 //CreateVolumeAttachment attaches a volume to a VM
 //- name the name of the volume attachment
 //- volume the volume to attach
@@ -310,6 +399,14 @@ func (client *Client) ListContainers() ([]string, error) {
 
 //PutObject put an object into an object container
 func (client *Client) PutObject(container string, obj api.Object) error {
+	size, err := multipart.Size(obj.Content)
+	if err != nil {
+		return fmt.Errorf("Error getting size of object %s: %s", obj.Name, err)
+	}
+	if size > api.MultipartThreshold {
+		return multipart.Put(client, container, obj, size)
+	}
+
 	var ti time.Time
 	opts := objects.CreateOpts{
 		Metadata:    obj.Metadata,
@@ -319,7 +416,7 @@ func (client *Client) PutObject(container string, obj api.Object) error {
 	if ti != obj.DeleteAt {
 		opts.DeleteAt = int(obj.DeleteAt.Unix())
 	}
-	_, err := objects.Create(client.Container, container, obj.Name, opts).Extract()
+	_, err = objects.Create(client.Container, container, obj.Name, opts).Extract()
 	if err != nil {
 		return fmt.Errorf("Error creating object %s in container %s : %s", obj.Name, container, errorString(err))
 	}
@@ -345,13 +442,13 @@ func (client *Client) GetObject(container string, name string, ranges []api.Rang
 	for _, r := range ranges {
 		rList = append(rList, r.String())
 	}
-	sRanges := strings.Join(rList, ",")
-	res := objects.Download(client.Container, container, name, objects.DownloadOpts{
-		Range: fmt.Sprintf("bytes=%s", sRanges),
-	})
-	content, err := res.ExtractContent()
-	if err != nil {
-		return nil, fmt.Errorf("Error getting object %s from %s : %s", name, container, errorString(err))
+	opts := objects.DownloadOpts{}
+	if len(rList) > 0 {
+		opts.Range = fmt.Sprintf("bytes=%s", strings.Join(rList, ","))
+	}
+	res := objects.Download(client.Container, container, name, opts)
+	if res.Err != nil {
+		return nil, fmt.Errorf("Error getting object %s from %s : %s", name, container, errorString(res.Err))
 	}
 	metadata := make(map[string]string)
 	for k, v := range res.Header {
@@ -365,9 +462,15 @@ func (client *Client) GetObject(container string, name string, ranges []api.Rang
 		return nil, fmt.Errorf("Error getting object %s from %s : %s", name, container, errorString(err))
 	}
 
+	// The content is streamed, except for several ranges returned in a multipart body to parse
+	content := api.StreamedContent(res.Body)
 	if len(ranges) > 1 {
+		body, err := res.ExtractContent()
+		if err != nil {
+			return nil, fmt.Errorf("Error getting object %s from %s : %s", name, container, errorString(err))
+		}
 		var buff bytes.Buffer
-		sc := string(content)
+		sc := string(body)
 		tokens := strings.Split(sc, "\r\n")
 		read := false
 		for _, t := range tokens {
@@ -381,11 +484,12 @@ func (client *Client) GetObject(container string, name string, ranges []api.Rang
 				read = false
 			}
 		}
-		content = buff.Bytes()
+		content = bytes.NewReader(buff.Bytes())
 	}
 
 	return &api.Object{
-		Content:       bytes.NewReader(content),
+		Name:          name,
+		Content:       content,
 		DeleteAt:      header.DeleteAt,
 		Metadata:      metadata,
 		Date:          header.Date,
@@ -410,6 +514,7 @@ func (client *Client) GetObjectMetadata(container string, name string) (*api.Obj
 	}
 
 	return &api.Object{
+		Name:          name,
 		DeleteAt:      header.DeleteAt,
 		Metadata:      meta,
 		Date:          header.Date,
@@ -461,11 +566,302 @@ func (client *Client) CopyObject(containerSrc, objectSrc, objectDst string) erro
 }
 
 //DeleteObject deleta an object from a container
+//The segments of an object uploaded in parts are deleted with the object
 func (client *Client) DeleteObject(container, object string) error {
-	_, err := objects.Delete(client.Container, container, object, objects.DeleteOpts{}).Extract()
+	// The segments of a dynamic large object are not deleted with its manifest
+	header, err := objects.Get(client.Container, container, object, objects.GetOpts{}).Extract()
+	if err != nil {
+		return fmt.Errorf("Error deleting objects %s of container %s: %s", object, container, errorString(err))
+	}
+	_, err = objects.Delete(client.Container, container, object, objects.DeleteOpts{
+		MultipartManifest: "delete",
+	}).Extract()
 	if err != nil {
 		return fmt.Errorf("Error deleting objects %s of container %s: %s", object, container, errorString(err))
 	}
+	if header.ObjectManifest != "" {
+		return client.deleteSegments(header.ObjectManifest)
+	}
 	return nil
+}
+
+//deleteSegments deletes the segments of a dynamic large object, designated by its manifest <container>/<prefix>
+func (client *Client) deleteSegments(manifest string) error {
+	manifest, err := url.PathUnescape(manifest)
+	if err != nil {
+		return fmt.Errorf("Error parsing manifest %s: %s", manifest, err)
+	}
+	parts := strings.SplitN(manifest, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("Error parsing manifest %s: <container>/<prefix> expected", manifest)
+	}
+	names, err := client.ListObjects(parts[0], api.ObjectFilter{Prefix: parts[1]})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, err = objects.Delete(client.Container, parts[0], name, objects.DeleteOpts{}).Extract()
+		if err != nil {
+			return fmt.Errorf("Error deleting segment %s of container %s: %s", name, parts[0], errorString(err))
+		}
+	}
+	return nil
+}
 
+//segmentsContainer returns the name of the container used to store the segments of the objects of container
+func segmentsContainer(container string) string {
+	return container + "_segments"
+}
+
+//segmentsPrefix returns the prefix of the names of the segments of an upload session
+func segmentsPrefix(session api.UploadSession) string {
+	return fmt.Sprintf("%s/%s/", session.Name, session.ID)
+}
+
+//CreateUploadSession starts the upload in segments of obj, obj content is ignored
+func (client *Client) CreateUploadSession(container string, obj api.Object) (*api.UploadSession, error) {
+	_, err := containers.Create(client.Container, segmentsContainer(container), containers.CreateOpts{}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating container %s: %s", segmentsContainer(container), errorString(err))
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	return &api.UploadSession{
+		ID:        id.String(),
+		Container: container,
+		Name:      obj.Name,
+		PartSize:  multipart.PartSize(obj.ContentLength, client.maxSegments()),
+		Metadata:  obj.Metadata,
+		DeleteAt:  obj.DeleteAt,
+	}, nil
+}
+
+//UploadPart uploads a segment of an upload session
+func (client *Client) UploadPart(session api.UploadSession, number int, content io.ReadSeeker, size int64) (*api.UploadPart, error) {
+	opts := objects.CreateOpts{
+		Content: content,
+	}
+	if !session.DeleteAt.IsZero() {
+		opts.DeleteAt = int(session.DeleteAt.Unix())
+	}
+	name := fmt.Sprintf("%s%08d", segmentsPrefix(session), number)
+	header, err := objects.Create(client.Container, segmentsContainer(session.Container), name, opts).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("Error uploading segment %d of object %s: %s", number, session.Name, errorString(err))
+	}
+	return &api.UploadPart{
+		Number: number,
+		Size:   size,
+		ETag:   header.ETag,
+	}, nil
+}
+
+//ListUploadParts lists the segments already uploaded in an upload session
+func (client *Client) ListUploadParts(session api.UploadSession) ([]api.UploadPart, error) {
+	prefix := segmentsPrefix(session)
+	var parts []api.UploadPart
+	err := objects.List(client.Container, segmentsContainer(session.Container), &objects.ListOpts{
+		Full:   true,
+		Prefix: prefix,
+	}).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := objects.ExtractInfo(page)
+		if err != nil {
+			return false, err
+		}
+		for _, o := range list {
+			number, err := strconv.Atoi(strings.TrimPrefix(o.Name, prefix))
+			if err != nil {
+				continue
+			}
+			parts = append(parts, api.UploadPart{
+				Number: number,
+				Size:   o.Bytes,
+				ETag:   o.Hash,
+			})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing segments of object %s: %s", session.Name, errorString(err))
+	}
+	return parts, nil
+}
+
+//CompleteUploadSession creates the manifest of the object, a static large object (SLO) if the
+//object storage supports it, a dynamic large object (DLO) otherwise
+func (client *Client) CompleteUploadSession(session api.UploadSession, parts []api.UploadPart) error {
+	headers := map[string]string{}
+	for k, v := range session.Metadata {
+		headers["X-Object-Meta-"+k] = v
+	}
+	if !session.DeleteAt.IsZero() {
+		headers["X-Delete-At"] = strconv.FormatInt(session.DeleteAt.Unix(), 10)
+	}
+
+	if !client.supportsSLO() {
+		headers["X-Object-Manifest"] = segmentsContainer(session.Container) + "/" + segmentsPrefix(session)
+		_, err := client.Container.Request("PUT", client.Container.ServiceURL(session.Container, session.Name), &gc.RequestOpts{
+			RawBody:     bytes.NewReader([]byte{}),
+			MoreHeaders: headers,
+			OkCodes:     []int{201},
+		})
+		if err != nil {
+			return fmt.Errorf("Error creating manifest of object %s: %s", session.Name, errorString(err))
+		}
+		return nil
+	}
+
+	type segment struct {
+		Path      string `json:"path"`
+		ETag      string `json:"etag"`
+		SizeBytes int64  `json:"size_bytes"`
+	}
+	var manifest []segment
+	for _, p := range parts {
+		manifest = append(manifest, segment{
+			Path:      fmt.Sprintf("/%s/%s%08d", segmentsContainer(session.Container), segmentsPrefix(session), p.Number),
+			ETag:      p.ETag,
+			SizeBytes: p.Size,
+		})
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	_, err = client.Container.Request("PUT", client.Container.ServiceURL(session.Container, session.Name)+"?multipart-manifest=put", &gc.RequestOpts{
+		RawBody:     bytes.NewReader(b),
+		MoreHeaders: headers,
+		OkCodes:     []int{201},
+	})
+	if err != nil {
+		return fmt.Errorf("Error creating manifest of object %s: %s", session.Name, errorString(err))
+	}
+	return nil
+}
+
+//AbortUploadSession deletes the segments already uploaded in an upload session
+func (client *Client) AbortUploadSession(session api.UploadSession) error {
+	parts, err := client.ListUploadParts(session)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		name := fmt.Sprintf("%s%08d", segmentsPrefix(session), p.Number)
+		_, err = objects.Delete(client.Container, segmentsContainer(session.Container), name, objects.DeleteOpts{}).Extract()
+		if err != nil {
+			return fmt.Errorf("Error deleting segment %d of object %s: %s", p.Number, session.Name, errorString(err))
+		}
+	}
+	return nil
+}
+
+//capabilities returns the capabilities of the object storage, nil if they can't be read
+func (client *Client) capabilities() map[string]interface{} {
+	u, err := url.Parse(client.Container.Endpoint)
+	if err != nil {
+		return nil
+	}
+	var capabilities map[string]interface{}
+	_, err = client.Container.Get(u.Scheme+"://"+u.Host+"/info", &capabilities, &gc.RequestOpts{
+		OkCodes: []int{200},
+	})
+	if err != nil {
+		return nil
+	}
+	return capabilities
+}
+
+//supportsSLO tells if the object storage supports static large objects, from its capabilities
+func (client *Client) supportsSLO() bool {
+	_, ok := client.capabilities()["slo"]
+	return ok
+}
+
+//maxSegments returns the maximum number of segments of an object uploaded in parts
+//It is max_manifest_segments for a static large object, a dynamic large object having no limit
+func (client *Client) maxSegments() int64 {
+	slo, ok := client.capabilities()["slo"]
+	if !ok {
+		return api.MaxParts
+	}
+	settings, _ := slo.(map[string]interface{})
+	max, ok := settings["max_manifest_segments"].(float64)
+	if !ok || max < 2 {
+		return api.MaxSLOSegments
+	}
+	return int64(max)
+}
+
+//getIdentityScope returns the ID of the authenticated user and the ID of the project in which the token is scoped
+func (client *Client) getIdentityScope() (*gc.ServiceClient, string, string, error) {
+	identity, err := openstack.NewIdentityV3(client.Provider, gc.EndpointOpts{
+		Region: client.Opts.Region,
+	})
+	if err != nil {
+		return nil, "", "", fmt.Errorf("Error getting identity service: %s", errorString(err))
+	}
+	res := tokens.Get(identity, client.Provider.TokenID)
+	user, err := res.ExtractUser()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("Error getting user of token: %s", errorString(err))
+	}
+	project, err := res.ExtractProject()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("Error getting project of token: %s", errorString(err))
+	}
+	return identity, user.ID, project.ID, nil
+}
+
+//CreateObjectStorageCredentials creates EC2 credentials restricted to the current project.
+//These credentials are used with the S3 API of the object storage (swift3/s3api middleware),
+//Keystone can't restrict them to the container
+func (client *Client) CreateObjectStorageCredentials(container string) (*api.ObjectStorageCredentials, error) {
+	identity, userID, projectID, err := client.getIdentityScope()
+	if err != nil {
+		return nil, err
+	}
+	b := map[string]interface{}{
+		"tenant_id": projectID,
+	}
+	var r struct {
+		Credential struct {
+			Access string `json:"access"`
+			Secret string `json:"secret"`
+		} `json:"credential"`
+	}
+	_, err = identity.Post(identity.ServiceURL("users", userID, "credentials", "OS-EC2"), b, &r, &gc.RequestOpts{
+		OkCodes: []int{200, 201},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error creating object storage credentials: %s", errorString(err))
+	}
+
+	u, err := url.Parse(client.Container.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing object storage endpoint: %s", err)
+	}
+	return &api.ObjectStorageCredentials{
+		ID:        r.Credential.Access,
+		Endpoint:  u.Scheme + "://" + u.Host,
+		Region:    client.Opts.Region,
+		AccessKey: r.Credential.Access,
+		SecretKey: r.Credential.Secret,
+	}, nil
+}
+
+//DeleteObjectStorageCredentials revokes the EC2 credentials identified by id
+func (client *Client) DeleteObjectStorageCredentials(id string) error {
+	identity, userID, _, err := client.getIdentityScope()
+	if err != nil {
+		return err
+	}
+	_, err = identity.Delete(identity.ServiceURL("users", userID, "credentials", "OS-EC2", id), &gc.RequestOpts{
+		OkCodes: []int{204},
+	})
+	if err != nil {
+		return fmt.Errorf("Error deleting object storage credentials: %s", errorString(err))
+	}
+	return nil
 }
@@ -106,13 +106,18 @@ func (c *Client) Build(params map[string]interface{}) (api.ClientAPI, error) {
 	OpenstackPassword, _ := params["OpenstackPassword"].(string)
 	Region, _ := params["Region"].(string)
 	ProjectName, _ := params["ProjectName"].(string)
-	return AuthenticatedClient(AuthOptions{
+	client, err := AuthenticatedClient(AuthOptions{
 		ApplicationKey:    ApplicationKey,
 		OpenstackID:       OpenstackID,
 		OpenstackPassword: OpenstackPassword,
 		Region:            Region,
 		ProjectName:       ProjectName,
 	})
+	if err != nil {
+		return nil, err
+	}
+	client.Cfg.NetworkCIDRPool, _ = params["NetworkCIDRPool"].(string)
+	return client, nil
 }
 
 func init() {
@@ -15,18 +15,70 @@
 # limitations under the License.
 #
 # block_device_mount.sh
-# Creates a filesystem on a device and mounts it
+# Creates a filesystem on a device (if it doesn't already contain one) and mounts it
+# The last line written on stdout is the type of the filesystem mounted
 
-# Create filesystem
-mkfs -t {{.FileSystem}} "{{.Device}}"
+{{.CommonTools}}
+
+# Determines the tools needed to create the filesystem
+case "{{.FileSystem}}" in
+    ext4)
+        MKFS_TOOL=mkfs.ext4
+        PACKAGE=e2fsprogs
+        ;;
+    xfs)
+        MKFS_TOOL=mkfs.xfs
+        PACKAGE=xfsprogs
+        ;;
+    btrfs)
+        MKFS_TOOL=mkfs.btrfs
+        PACKAGE=btrfs-tools
+        [ "$LINUX_KIND" = "rhel" -o "$LINUX_KIND" = "centos" ] && PACKAGE=btrfs-progs
+        ;;
+    *)
+        echo "Unsupported filesystem '{{.FileSystem}}'" >&2
+        exit 1
+        ;;
+esac
+
+# Installs the tools if needed
+if ! which $MKFS_TOOL &>/dev/null; then
+    case $LINUX_KIND in
+        debian|ubuntu)
+            export DEBIAN_FRONTEND=noninteractive
+            wait_for_apt && apt-get update >/dev/null && wait_for_apt && apt-get install -qqy $PACKAGE >/dev/null || exit $?
+            ;;
+
+        rhel|centos)
+            yum install -y $PACKAGE >/dev/null || exit $?
+            ;;
+
+        *)
+            echo "Unsupported operating system '$LINUX_KIND'" >&2
+            exit 1
+            ;;
+    esac
+fi
+
+# Creates filesystem only if the device doesn't contain one yet, to preserve data on re-attach
+FILESYSTEM=$(blkid -o value -s TYPE "{{.Device}}")
+if [ -z "$FILESYSTEM" ]; then
+    mkfs -t {{.FileSystem}} {{.MkfsOptions}} "{{.Device}}" >/dev/null || exit $?
+    FILESYSTEM={{.FileSystem}}
+elif [ "$FILESYSTEM" != "{{.FileSystem}}" ]; then
+    echo "Device {{.Device}} already contains a '$FILESYSTEM' filesystem, it will be mounted as is" >&2
+fi
 
 # Create mountpoint
 mkdir -p "{{.MountPoint}}"
 
-# Configure fstab
-echo "{{.Device}} {{.MountPoint}} {{.FileSystem}} defaults 0 2" >>/etc/fstab
+# Configure fstab, replacing a previous entry of the device if any
+sed -i '\#^{{.Device}} #d' /etc/fstab
+echo "{{.Device}} {{.MountPoint}} $FILESYSTEM {{.MountOptions}} 0 2" >>/etc/fstab
 
 # Mounts device
-mount -a
+mount "{{.MountPoint}}" || exit $?
 
 chmod a+rxw "{{.MountPoint}}"
+
+echo $FILESYSTEM
@@ -0,0 +1,42 @@
+#!/usr/bin/env bash
+#
+# Copyright 2018, CS Systemes d'Information, http://www.c-s.fr
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+# block_device_resize.sh
+# Grows the filesystem of a mounted device to the size of the (extended) device
+
+# Asks the kernel to refresh the size of the device (needed for SCSI devices, harmless otherwise)
+DEVNAME=$(basename "{{.Device}}")
+[ -w /sys/class/block/$DEVNAME/device/rescan ] && echo 1 >/sys/class/block/$DEVNAME/device/rescan
+sleep 2
+
+FILESYSTEM=$(blkid -o value -s TYPE "{{.Device}}")
+[ -z "$FILESYSTEM" ] && FILESYSTEM={{.FileSystem}}
+
+case "$FILESYSTEM" in
+    ext4)
+        resize2fs "{{.Device}}" || exit $?
+        ;;
+    xfs)
+        xfs_growfs "{{.MountPoint}}" || exit $?
+        ;;
+    btrfs)
+        btrfs filesystem resize max "{{.MountPoint}}" || exit $?
+        ;;
+    *)
+        echo "Unsupported filesystem '$FILESYSTEM'" >&2
+        exit 1
+        ;;
+esac
@@ -18,10 +18,31 @@ package nfs
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/CS-SI/SafeScale/system"
 )
 
+const (
+	//DefaultFileSystem is the filesystem used to format a block device when none is given
+	DefaultFileSystem = "ext4"
+	//DefaultMountOptions are the mount options used when none are given
+	DefaultMountOptions = "defaults"
+)
+
+//supportedFileSystems lists the filesystems MountBlockDevice knows how to create
+var supportedFileSystems = map[string]bool{
+	"ext4":  true,
+	"xfs":   true,
+	"btrfs": true,
+}
+
+//IsFileSystemSupported tells if a block device can be formatted with filesystem fs
+func IsFileSystemSupported(fs string) bool {
+	_, ok := supportedFileSystems[fs]
+	return ok
+}
+
 //Server server structure
 type Server struct {
 	SshConfig *system.SSHConfig
@@ -51,14 +72,46 @@ func (s *Server) Install() error {
 }
 
 //MountBlockDevice mounts a block device in the remote system
-func (s *Server) MountBlockDevice(device string, mountPoint string) error {
+//The device is formatted with filesystem format (using mkfsOptions) only if it doesn't contain a filesystem yet,
+//so data are preserved when a volume is attached again. Returns the filesystem actually mounted
+func (s *Server) MountBlockDevice(device string, mountPoint string, format string, mkfsOptions string, mountOptions string) (string, error) {
+	if format == "" {
+		format = DefaultFileSystem
+	}
+	if !IsFileSystemSupported(format) {
+		return "", fmt.Errorf("Unsupported filesystem '%s'", format)
+	}
+	if mountOptions == "" {
+		mountOptions = DefaultMountOptions
+	}
+	data := map[string]interface{}{
+		"Device":       device,
+		"MountPoint":   mountPoint,
+		"FileSystem":   format,
+		"MkfsOptions":  mkfsOptions,
+		"MountOptions": mountOptions,
+	}
+	retcode, stdout, stderr, err := executeScript(*s.SshConfig, "block_device_mount.sh", data)
+	err = handleExecuteScriptReturn(retcode, stdout, stderr, err, "Error executing script to mount block device")
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	return strings.TrimSpace(lines[len(lines)-1]), nil
+}
+
+//ResizeBlockDevice grows the filesystem of a mounted block device to the new size of the device
+func (s *Server) ResizeBlockDevice(device string, mountPoint string, format string) error {
+	if format == "" {
+		format = DefaultFileSystem
+	}
 	data := map[string]interface{}{
 		"Device":     device,
 		"MountPoint": mountPoint,
-		"FileSystem": "ext4",
+		"FileSystem": format,
 	}
-	retcode, stdout, stderr, err := executeScript(*s.SshConfig, "block_device_mount.sh", data)
-	return handleExecuteScriptReturn(retcode, stdout, stderr, err, "Error executing script to mount block device")
+	retcode, stdout, stderr, err := executeScript(*s.SshConfig, "block_device_resize.sh", data)
+	return handleExecuteScriptReturn(retcode, stdout, stderr, err, "Error executing script to resize block device")
 }
 
 //UnmountBlockDevice unmounts a local block device on the remote system
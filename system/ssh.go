@@ -109,6 +109,14 @@ func isTunnelReady(port int) bool {
 
 }
 
+//bracketHost encloses host in brackets if it is an IPv6 address, as required by port forwardings and scp
+func bracketHost(host string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
 //CreateTunnel create SSH from local host to remote host throw gateway
 func createTunnel(cfg *SSHConfig) (*sshTunnel, error) {
 	f, err := createKeyFile(cfg.GatewayConfig.PrivateKey)
@@ -124,7 +132,7 @@ func createTunnel(cfg *SSHConfig) (*sshTunnel, error) {
 	cmdString := fmt.Sprintf("ssh -i %s -NL %d:%s:%d %s@%s %s -p %d",
 		f.Name(),
 		freePort,
-		cfg.Host,
+		bracketHost(cfg.Host),
 		cfg.Port,
 		cfg.GatewayConfig.User,
 		cfg.GatewayConfig.Host,
@@ -349,7 +357,7 @@ func createDownloadCmd(sshConfig *SSHConfig, remotePath, localPath string) (stri
 		sshConfig.Port,
 		options,
 		sshConfig.User,
-		sshConfig.Host,
+		bracketHost(sshConfig.Host),
 		remotePath,
 		localPath,
 	)
@@ -370,7 +378,7 @@ func createUploadCmd(sshConfig *SSHConfig, remotePath, localPath string) (string
 		options,
 		localPath,
 		sshConfig.User,
-		sshConfig.Host,
+		bracketHost(sshConfig.Host),
 		remotePath,
 	)
 	return sshCmdString, f, nil
@@ -429,6 +437,16 @@ func (ssh *SSHConfig) WaitServerReady(timeout time.Duration) error {
 
 }
 
+//IsReachable tells if the SSH server accepts connections within timeout
+func (ssh *SSHConfig) IsReachable(timeout time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ssh.Host, strconv.Itoa(ssh.Port)), timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
 //Download dowloads remotePath into localPath
 func (ssh *SSHConfig) Download(remotePath, localPath string) error {
 	tunnels, sshConfig, err := ssh.createTunnels()